@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clustertest
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+// NewMemoryCluster creates a mocked cluster which keeps the data in a
+// map, the map is returned to check the keys in the cluster, and must
+// not be changed by the caller.
+func NewMemoryCluster() (*MockedCluster, map[string]string) {
+	var lock sync.Mutex
+	data := map[string]string{}
+
+	getPrefix := func(prefix string) map[string]string {
+		lock.Lock()
+		defer lock.Unlock()
+		kvs := map[string]string{}
+		for k, v := range data {
+			if strings.HasPrefix(k, prefix) {
+				kvs[k] = v
+			}
+		}
+		return kvs
+	}
+
+	cls := NewMockedCluster()
+	cls.MockedPut = func(key, value string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		data[key] = value
+		return nil
+	}
+	cls.MockedGet = func(key string) (*string, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if v, ok := data[key]; ok {
+			return &v, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetRaw = func(key string) (*mvccpb.KeyValue, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if v, ok := data[key]; ok {
+			return &mvccpb.KeyValue{Key: []byte(key), Value: []byte(v)}, nil
+		}
+		return nil, nil
+	}
+	cls.MockedGetPrefix = func(prefix string) (map[string]string, error) {
+		return getPrefix(prefix), nil
+	}
+	cls.MockedGetRawPrefix = func(prefix string) (map[string]*mvccpb.KeyValue, error) {
+		kvs := map[string]*mvccpb.KeyValue{}
+		for k, v := range getPrefix(prefix) {
+			kvs[k] = &mvccpb.KeyValue{Key: []byte(k), Value: []byte(v)}
+		}
+		return kvs, nil
+	}
+	cls.MockedDelete = func(key string) error {
+		lock.Lock()
+		defer lock.Unlock()
+		delete(data, key)
+		return nil
+	}
+	cls.MockedSyncer = func(time.Duration) (cluster.Syncer, error) {
+		syncer := NewMockedSyncer()
+		syncer.MockedSyncPrefix = func(prefix string) (<-chan map[string]string, error) {
+			ch := make(chan map[string]string, 1)
+			ch <- getPrefix(prefix)
+			close(ch)
+			return ch, nil
+		}
+		return syncer, nil
+	}
+	return cls, data
+}
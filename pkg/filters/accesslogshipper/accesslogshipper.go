@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogshipper
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of AccessLogShipper.
+	Kind = "AccessLogShipper"
+
+	defaultQueueSize     = 10240
+	defaultBatchSize     = 1000
+	defaultFlushInterval = 5 * time.Second
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AccessLogShipper batches, compresses and ships access logs to a sink.",
+	Results:     []string{},
+	Effects:     []string{filters.EffectWrite},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			QueueSize:     defaultQueueSize,
+			BatchSize:     defaultBatchSize,
+			FlushInterval: defaultFlushInterval.String(),
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AccessLogShipper{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AccessLogShipper batches, compresses and ships access logs to a sink.
+	AccessLogShipper struct {
+		spec *Spec
+
+		sink          sink
+		queue         chan *Record
+		flushInterval time.Duration
+		done          chan struct{}
+		wg            sync.WaitGroup
+
+		// records of requests finished after Close are handed to the
+		// next generation, or dropped if there is none.
+		lock   sync.RWMutex
+		closed bool
+		next   *AccessLogShipper
+
+		numOfShipped int64
+		numOfDropped int64
+		numOfFailed  int64
+	}
+
+	// Spec describes the AccessLogShipper.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		File          *FileSinkSpec   `json:"file,omitempty" jsonschema:"omitempty"`
+		Syslog        *SyslogSinkSpec `json:"syslog,omitempty" jsonschema:"omitempty"`
+		HTTP          *HTTPSinkSpec   `json:"http,omitempty" jsonschema:"omitempty"`
+		Compress      bool            `json:"compress" jsonschema:"omitempty"`
+		QueueSize     int             `json:"queueSize" jsonschema:"omitempty,minimum=1"`
+		BatchSize     int             `json:"batchSize" jsonschema:"omitempty,minimum=1"`
+		FlushInterval string          `json:"flushInterval" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of AccessLogShipper.
+	Status struct {
+		NumOfShipped int64 `json:"numOfShipped"`
+		NumOfDropped int64 `json:"numOfDropped"`
+		NumOfFailed  int64 `json:"numOfFailed"`
+	}
+
+	// Record is an access log record.
+	Record struct {
+		Time       string `json:"time"`
+		RemoteAddr string `json:"remoteAddr"`
+		RealIP     string `json:"realIP"`
+		Method     string `json:"method"`
+		Host       string `json:"host"`
+		URI        string `json:"uri"`
+		Proto      string `json:"proto"`
+		StatusCode int    `json:"statusCode"`
+		Duration   int64  `json:"durationMs"`
+	}
+)
+
+var _ filters.Filter = (*AccessLogShipper)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	n := 0
+	if spec.File != nil {
+		n++
+	}
+	if spec.Syslog != nil {
+		n++
+	}
+	if spec.HTTP != nil {
+		n++
+	}
+	if n != 1 {
+		return fmt.Errorf("one and only one of file, syslog and http sink is required")
+	}
+	return nil
+}
+
+// Name returns the name of the AccessLogShipper filter instance.
+func (als *AccessLogShipper) Name() string {
+	return als.spec.Name()
+}
+
+// Kind returns the kind of AccessLogShipper.
+func (als *AccessLogShipper) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AccessLogShipper
+func (als *AccessLogShipper) Spec() filters.Spec {
+	return als.spec
+}
+
+// Init initializes AccessLogShipper.
+func (als *AccessLogShipper) Init() {
+	als.reload()
+}
+
+// Inherit inherits previous generation of AccessLogShipper.
+//
+// The counters start from zero, and the records of requests handled by
+// the previous generation but finished after it is closed are shipped by
+// the new generation.
+func (als *AccessLogShipper) Inherit(previousGeneration filters.Filter) {
+	als.reload()
+
+	prev := previousGeneration.(*AccessLogShipper)
+	prev.lock.Lock()
+	prev.next = als
+	prev.lock.Unlock()
+}
+
+func (als *AccessLogShipper) reload() {
+	switch {
+	case als.spec.File != nil:
+		als.sink = newFileSink(als.spec.File, als.spec.Compress)
+	case als.spec.Syslog != nil:
+		als.sink = newSyslogSink(als.spec.Syslog)
+	default:
+		als.sink = newHTTPSink(als.spec.HTTP, als.spec.Compress)
+	}
+
+	queueSize := als.spec.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	als.queue = make(chan *Record, queueSize)
+
+	als.flushInterval, _ = time.ParseDuration(als.spec.FlushInterval)
+	if als.flushInterval <= 0 {
+		als.flushInterval = defaultFlushInterval
+	}
+
+	als.done = make(chan struct{})
+	als.wg.Add(1)
+	go als.run()
+}
+
+func (als *AccessLogShipper) run() {
+	defer als.wg.Done()
+
+	batchSize := als.spec.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	batch := make([]*Record, 0, batchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := als.sink.ship(batch); err != nil {
+			logger.Errorf("%s: failed to ship %d access logs: %v", als.Name(), len(batch), err)
+			atomic.AddInt64(&als.numOfFailed, int64(len(batch)))
+		} else {
+			atomic.AddInt64(&als.numOfShipped, int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	ticker := time.NewTicker(als.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case r := <-als.queue:
+			batch = append(batch, r)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-als.done:
+			// ship the remaining records before exit.
+			for {
+				select {
+				case r := <-als.queue:
+					batch = append(batch, r)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// enqueue adds the record to the queue, and drops it if the queue is full,
+// so that request processing is never blocked.
+func (als *AccessLogShipper) enqueue(r *Record) {
+	als.lock.RLock()
+	defer als.lock.RUnlock()
+
+	if als.closed {
+		if als.next != nil {
+			als.next.enqueue(r)
+		} else {
+			atomic.AddInt64(&als.numOfDropped, 1)
+		}
+		return
+	}
+
+	select {
+	case als.queue <- r:
+	default:
+		atomic.AddInt64(&als.numOfDropped, 1)
+	}
+}
+
+// Handle registers a callback to ship the access log when the request
+// finishes.
+func (als *AccessLogShipper) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	startAt := fasttime.Now()
+
+	// the request could be modified by the following filters, so collect
+	// its fields now.
+	r := &Record{
+		Time:       fasttime.Format(startAt, fasttime.RFC3339Milli),
+		RemoteAddr: req.Std().RemoteAddr,
+		RealIP:     req.RealIP(),
+		Method:     req.Method(),
+		Host:       req.Host(),
+		URI:        req.URL().RequestURI(),
+		Proto:      req.Proto(),
+	}
+
+	ctx.OnFinish(func() {
+		r.Duration = fasttime.Since(startAt).Milliseconds()
+		if resp, _ := ctx.GetOutputResponse().(*httpprot.Response); resp != nil {
+			r.StatusCode = resp.StatusCode()
+		}
+		if lr, ok := ctx.GetData(httpprot.LogRedactorDataKey).(httpprot.LogRedactor); ok {
+			r.URI = lr.RedactString(r.URI)
+		}
+		als.enqueue(r)
+	})
+
+	return ""
+}
+
+// Status returns status.
+func (als *AccessLogShipper) Status() interface{} {
+	return &Status{
+		NumOfShipped: atomic.LoadInt64(&als.numOfShipped),
+		NumOfDropped: atomic.LoadInt64(&als.numOfDropped),
+		NumOfFailed:  atomic.LoadInt64(&als.numOfFailed),
+	}
+}
+
+// Close closes AccessLogShipper, the records in the queue are shipped
+// before it returns.
+func (als *AccessLogShipper) Close() {
+	// no records are added to the queue once closed is set, so all of
+	// them are shipped by run.
+	als.lock.Lock()
+	als.closed = true
+	als.lock.Unlock()
+
+	close(als.done)
+	als.wg.Wait()
+	als.sink.close()
+}
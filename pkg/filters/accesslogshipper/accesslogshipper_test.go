@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogshipper
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createShipper(t *testing.T, yamlConfig string) *AccessLogShipper {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	als := kind.CreateInstance(spec).(*AccessLogShipper)
+	als.Init()
+	return als
+}
+
+func handleRequest(t *testing.T, als *AccessLogShipper, path string, code int) {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	assert.Equal(t, "", als.Handle(ctx))
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	ctx.SetOutputResponse(resp)
+	ctx.Finish()
+}
+
+func decodeRecords(t *testing.T, r io.Reader) []*Record {
+	var records []*Record
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		rec := &Record{}
+		assert.NoError(t, codectool.UnmarshalJSON(scanner.Bytes(), rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := map[string]interface{}{
+		"name": "shipper",
+		"kind": Kind,
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["file"] = map[string]interface{}{"path": "/tmp/access.log"}
+	rawSpec["http"] = map[string]interface{}{"url": "http://127.0.0.1/logs"}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	delete(rawSpec, "http")
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "access.log.gz")
+	als := createShipper(t, `
+name: shipper
+kind: AccessLogShipper
+compress: true
+batchSize: 2
+file:
+  path: `+path)
+
+	handleRequest(t, als, "/a", 200)
+	handleRequest(t, als, "/b", 404)
+	handleRequest(t, als, "/c", 503)
+
+	// Close flushes the remaining record.
+	als.Close()
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	assert.NoError(err)
+
+	records := decodeRecords(t, zr)
+	assert.Len(records, 3)
+	assert.Equal("/a", records[0].URI)
+	assert.Equal(404, records[1].StatusCode)
+	assert.Equal(503, records[2].StatusCode)
+
+	status := als.Status().(*Status)
+	assert.Equal(int64(3), status.NumOfShipped)
+	assert.Equal(int64(0), status.NumOfDropped)
+}
+
+func TestHTTPSink(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	var records []*Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal("secret", r.Header.Get("X-Token"))
+		zr, err := gzip.NewReader(r.Body)
+		assert.NoError(err)
+
+		lock.Lock()
+		records = append(records, decodeRecords(t, zr)...)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	als := createShipper(t, `
+name: shipper
+kind: AccessLogShipper
+compress: true
+http:
+  url: `+server.URL+`
+  headers:
+    X-Token: secret
+`)
+
+	for i := 0; i < 10; i++ {
+		handleRequest(t, als, "/", 200)
+	}
+	als.Close()
+
+	lock.Lock()
+	assert.Len(records, 10)
+	lock.Unlock()
+	assert.Equal(int64(10), als.Status().(*Status).NumOfShipped)
+}
+
+func TestDropOnOverflow(t *testing.T) {
+	als := &AccessLogShipper{queue: make(chan *Record, 1)}
+
+	als.enqueue(&Record{})
+	als.enqueue(&Record{})
+	als.enqueue(&Record{})
+
+	status := als.Status().(*Status)
+	assert.Equal(t, int64(2), status.NumOfDropped)
+}
+
+func TestInherit(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	als := createShipper(t, `
+name: shipper
+kind: AccessLogShipper
+file:
+  path: `+filepath.Join(dir, "access1.log"))
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/a", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(err)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	assert.Equal("", als.Handle(ctx))
+
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(`
+name: shipper
+kind: AccessLogShipper
+file:
+  path: `+filepath.Join(dir, "access2.log")), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+	als2 := kind.CreateInstance(spec).(*AccessLogShipper)
+	als2.Inherit(als)
+	als.Close()
+
+	// the request finishes after the previous generation is closed, its
+	// record is shipped by the new generation.
+	ctx.Finish()
+	als2.Close()
+
+	f, err := os.Open(filepath.Join(dir, "access2.log"))
+	assert.NoError(err)
+	defer f.Close()
+	records := decodeRecords(t, f)
+	assert.Len(records, 1)
+	assert.Equal("/a", records[0].URI)
+	assert.Equal(int64(1), als2.Status().(*Status).NumOfShipped)
+
+	// records are dropped if there is no next generation.
+	handleRequest(t, als2, "/b", 200)
+	assert.Equal(int64(1), als2.Status().(*Status).NumOfDropped)
+}
@@ -0,0 +1,232 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package accesslogshipper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	defaultHTTPSinkTimeout = 10 * time.Second
+	defaultSyslogTag       = "easegress"
+
+	// syslog priority of facility local0 and severity info.
+	syslogPriority = 16*8 + 6
+)
+
+type (
+	// FileSinkSpec is the spec of the file sink.
+	FileSinkSpec struct {
+		Path string `json:"path" jsonschema:"required"`
+	}
+
+	// SyslogSinkSpec is the spec of the syslog sink.
+	SyslogSinkSpec struct {
+		Network string `json:"network" jsonschema:"omitempty,enum=,enum=udp,enum=tcp"`
+		Address string `json:"address" jsonschema:"required"`
+		Tag     string `json:"tag" jsonschema:"omitempty"`
+	}
+
+	// HTTPSinkSpec is the spec of the HTTP sink.
+	HTTPSinkSpec struct {
+		URL     string            `json:"url" jsonschema:"required,format=uri"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		Timeout string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	sink interface {
+		ship(records []*Record) error
+		close()
+	}
+
+	fileSink struct {
+		spec     *FileSinkSpec
+		compress bool
+	}
+
+	syslogSink struct {
+		spec     *SyslogSinkSpec
+		hostname string
+		conn     net.Conn
+	}
+
+	httpSink struct {
+		spec     *HTTPSinkSpec
+		compress bool
+		client   *http.Client
+	}
+)
+
+// encodeRecords encodes records to newline delimited JSON, and compresses
+// the result with gzip if required.
+func encodeRecords(records []*Record, compress bool) ([]byte, error) {
+	var buf bytes.Buffer
+
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+
+	for _, r := range records {
+		if err := codectool.EncodeJSON(w, r); err != nil {
+			return nil, err
+		}
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newFileSink(spec *FileSinkSpec, compress bool) *fileSink {
+	return &fileSink{spec: spec, compress: compress}
+}
+
+// ship appends the records to the file, when compression is enabled, each
+// batch is appended as a gzip member, and the result is still a valid gzip
+// file.
+func (fs *fileSink) ship(records []*Record) error {
+	data, err := encodeRecords(records, fs.compress)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fs.spec.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(data)
+	return err
+}
+
+func (fs *fileSink) close() {
+}
+
+func newSyslogSink(spec *SyslogSinkSpec) *syslogSink {
+	hostname, _ := os.Hostname()
+	return &syslogSink{spec: spec, hostname: hostname}
+}
+
+// ship sends the records to syslog in RFC 3164 format, one message for each
+// record, syslog messages are never compressed.
+func (ss *syslogSink) ship(records []*Record) error {
+	if ss.conn == nil {
+		network := ss.spec.Network
+		if network == "" {
+			network = "udp"
+		}
+		conn, err := net.DialTimeout(network, ss.spec.Address, 5*time.Second)
+		if err != nil {
+			return err
+		}
+		ss.conn = conn
+	}
+
+	tag := ss.spec.Tag
+	if tag == "" {
+		tag = defaultSyslogTag
+	}
+
+	for _, r := range records {
+		data, err := codectool.MarshalJSON(r)
+		if err != nil {
+			return err
+		}
+		timestamp := time.Now().Format(time.Stamp)
+		msg := fmt.Sprintf("<%d>%s %s %s: %s\n", syslogPriority, timestamp, ss.hostname, tag, data)
+		if _, err = io.WriteString(ss.conn, msg); err != nil {
+			// reconnect in the next ship.
+			ss.conn.Close()
+			ss.conn = nil
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ss *syslogSink) close() {
+	if ss.conn != nil {
+		ss.conn.Close()
+	}
+}
+
+func newHTTPSink(spec *HTTPSinkSpec, compress bool) *httpSink {
+	timeout, _ := time.ParseDuration(spec.Timeout)
+	if timeout <= 0 {
+		timeout = defaultHTTPSinkTimeout
+	}
+	return &httpSink{
+		spec:     spec,
+		compress: compress,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// ship posts the records to the HTTP endpoint in one request.
+func (hs *httpSink) ship(records []*Record) error {
+	data, err := encodeRecords(records, hs.compress)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hs.spec.URL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range hs.spec.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if hs.compress {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (hs *httpSink) close() {
+	hs.client.CloseIdleConnections()
+}
@@ -0,0 +1,300 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adaptivelimiter
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of AdaptiveLimiter.
+	Kind = "AdaptiveLimiter"
+
+	defaultInitialLimit = 20
+	defaultMinLimit     = 1
+	defaultMaxLimit     = 1000
+	defaultWindow       = time.Second
+	defaultTolerance    = 1.5
+	defaultSmoothing    = 0.2
+
+	// longWindows is the number of windows the long term RTT is averaged
+	// over.
+	longWindows = 600
+
+	resultLimited = "limited"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AdaptiveLimiter limits the number of concurrent requests by a limit estimated from the latency.",
+	Results:     []string{resultLimited},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			InitialLimit: defaultInitialLimit,
+			MinLimit:     defaultMinLimit,
+			MaxLimit:     defaultMaxLimit,
+			Window:       defaultWindow.String(),
+			Tolerance:    defaultTolerance,
+			Smoothing:    defaultSmoothing,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AdaptiveLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AdaptiveLimiter is filter AdaptiveLimiter.
+	//
+	// The limit is estimated by the gradient algorithm: the average
+	// latency of requests in each window (the short term RTT) is compared
+	// with the average latency of a long period (the long term RTT), the
+	// limit decreases when the short term RTT increases, and increases by
+	// a queue size of sqrt(limit) otherwise.
+	AdaptiveLimiter struct {
+		spec   *Spec
+		window time.Duration
+
+		lock        sync.Mutex
+		limit       float64
+		inflight    int
+		maxInflight int
+		windowStart time.Time
+		samples     int
+		sumRTT      time.Duration
+		shortRTT    time.Duration
+		longRTT     float64
+
+		numOfRejected int64
+	}
+
+	// Spec describes the AdaptiveLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		InitialLimit int     `json:"initialLimit" jsonschema:"omitempty,minimum=1"`
+		MinLimit     int     `json:"minLimit" jsonschema:"omitempty,minimum=1"`
+		MaxLimit     int     `json:"maxLimit" jsonschema:"omitempty,minimum=1"`
+		Window       string  `json:"window" jsonschema:"omitempty,format=duration"`
+		Tolerance    float64 `json:"tolerance" jsonschema:"omitempty"`
+		Smoothing    float64 `json:"smoothing" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of AdaptiveLimiter.
+	Status struct {
+		Limit         int    `json:"limit"`
+		Inflight      int    `json:"inflight"`
+		ShortRTT      string `json:"shortRTT"`
+		LongRTT       string `json:"longRTT"`
+		NumOfRejected int64  `json:"numOfRejected"`
+	}
+)
+
+var _ filters.Filter = (*AdaptiveLimiter)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.MinLimit > spec.MaxLimit {
+		return fmt.Errorf("minLimit must not be greater than maxLimit")
+	}
+	if spec.InitialLimit < spec.MinLimit || spec.InitialLimit > spec.MaxLimit {
+		return fmt.Errorf("initialLimit must be between minLimit and maxLimit")
+	}
+	if spec.Window != "" {
+		if d, err := time.ParseDuration(spec.Window); err != nil || d <= 0 {
+			return fmt.Errorf("invalid window: %s", spec.Window)
+		}
+	}
+	if spec.Tolerance < 1 {
+		return fmt.Errorf("tolerance must not be less than 1")
+	}
+	if spec.Smoothing <= 0 || spec.Smoothing > 1 {
+		return fmt.Errorf("smoothing must be in (0, 1]")
+	}
+	return nil
+}
+
+// Name returns the name of the AdaptiveLimiter filter instance.
+func (al *AdaptiveLimiter) Name() string {
+	return al.spec.Name()
+}
+
+// Kind returns the kind of AdaptiveLimiter.
+func (al *AdaptiveLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AdaptiveLimiter
+func (al *AdaptiveLimiter) Spec() filters.Spec {
+	return al.spec
+}
+
+// Init initializes AdaptiveLimiter.
+func (al *AdaptiveLimiter) Init() {
+	al.reload()
+	al.limit = float64(al.spec.InitialLimit)
+}
+
+// Inherit inherits previous generation of AdaptiveLimiter.
+//
+// The estimated limit and the long term RTT are inherited, so the limit
+// does not restart from the initial one. Requests admitted by the previous
+// generation are still counted by it.
+func (al *AdaptiveLimiter) Inherit(previousGeneration filters.Filter) {
+	al.reload()
+
+	prev := previousGeneration.(*AdaptiveLimiter)
+	prev.lock.Lock()
+	al.limit = prev.limit
+	al.shortRTT = prev.shortRTT
+	al.longRTT = prev.longRTT
+	prev.lock.Unlock()
+
+	al.limit = math.Max(float64(al.spec.MinLimit), math.Min(float64(al.spec.MaxLimit), al.limit))
+}
+
+func (al *AdaptiveLimiter) reload() {
+	al.window = defaultWindow
+	if al.spec.Window != "" {
+		al.window, _ = time.ParseDuration(al.spec.Window)
+	}
+	al.windowStart = time.Now()
+}
+
+// acquire acquires a slot, false is returned if the number of inflight
+// requests reaches the limit.
+func (al *AdaptiveLimiter) acquire() bool {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	if al.inflight >= int(al.limit) {
+		al.numOfRejected++
+		return false
+	}
+
+	al.inflight++
+	if al.inflight > al.maxInflight {
+		al.maxInflight = al.inflight
+	}
+	return true
+}
+
+// release releases a slot and records the RTT of the request, the limit
+// is updated at the end of each window.
+func (al *AdaptiveLimiter) release(rtt time.Duration, now time.Time) {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	al.inflight--
+	al.samples++
+	al.sumRTT += rtt
+
+	if now.Sub(al.windowStart) >= al.window {
+		al.update()
+		al.windowStart = now
+		al.samples, al.sumRTT = 0, 0
+		al.maxInflight = al.inflight
+	}
+}
+
+// update updates the limit with the samples of the window, the caller
+// must hold the lock.
+func (al *AdaptiveLimiter) update() {
+	if al.samples == 0 {
+		return
+	}
+
+	al.shortRTT = al.sumRTT / time.Duration(al.samples)
+	short := float64(al.shortRTT)
+	if al.longRTT == 0 {
+		al.longRTT = short
+	} else {
+		al.longRTT += (short - al.longRTT) * 2 / (longWindows + 1)
+	}
+
+	// The backend recovers from an overload, let the long term RTT
+	// catch up quickly.
+	if al.longRTT/short > 2 {
+		al.longRTT *= 0.95
+	}
+
+	// Do not increase the limit if it was not reached, otherwise the
+	// limit keeps growing when the traffic is low.
+	if float64(al.maxInflight) < al.limit/2 {
+		return
+	}
+
+	gradient := math.Max(0.5, math.Min(1, al.spec.Tolerance*al.longRTT/short))
+	newLimit := al.limit*gradient + math.Sqrt(al.limit)
+	newLimit = al.limit*(1-al.spec.Smoothing) + newLimit*al.spec.Smoothing
+	al.limit = math.Max(float64(al.spec.MinLimit), math.Min(float64(al.spec.MaxLimit), newLimit))
+}
+
+// Handle limits the concurrent requests by the estimated limit, the RTT
+// of the request is recorded after it is finished.
+func (al *AdaptiveLimiter) Handle(ctx *context.Context) string {
+	if !al.acquire() {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusServiceUnavailable)
+		resp.HTTPHeader().Set("Retry-After", strconv.Itoa(int(math.Ceil(al.window.Seconds()))))
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("adaptiveLimiter: concurrency limit reached")
+		return resultLimited
+	}
+
+	start := time.Now()
+	ctx.OnFinish(func() {
+		now := time.Now()
+		al.release(now.Sub(start), now)
+	})
+	return ""
+}
+
+// Status returns status.
+func (al *AdaptiveLimiter) Status() interface{} {
+	al.lock.Lock()
+	defer al.lock.Unlock()
+
+	return &Status{
+		Limit:         int(al.limit),
+		Inflight:      al.inflight,
+		ShortRTT:      al.shortRTT.String(),
+		LongRTT:       time.Duration(al.longRTT).String(),
+		NumOfRejected: al.numOfRejected,
+	}
+}
+
+// Close closes AdaptiveLimiter.
+func (al *AdaptiveLimiter) Close() {}
@@ -0,0 +1,179 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package adaptivelimiter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createLimiter(t *testing.T, yamlConfig string, prev *AdaptiveLimiter) *AdaptiveLimiter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	al := kind.CreateInstance(spec).(*AdaptiveLimiter)
+	if prev == nil {
+		al.Init()
+	} else {
+		al.Inherit(prev)
+	}
+	return al
+}
+
+func newContext(t *testing.T) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const yamlConfig = `
+name: limiter
+kind: AdaptiveLimiter
+initialLimit: 10
+minLimit: 2
+maxLimit: 100
+`
+
+// runWindow runs a window in which the limit is reached and all requests
+// have the same RTT, and returns the new limit.
+func runWindow(al *AdaptiveLimiter, now time.Time, rtt time.Duration) int {
+	n := int(al.limit)
+	for i := 0; i < n; i++ {
+		al.acquire()
+	}
+	for i := 0; i < n; i++ {
+		al.release(rtt, now)
+	}
+	return al.Status().(*Status).Limit
+}
+
+func TestAdaptiveLimiter(t *testing.T) {
+	assert := assert.New(t)
+	al := createLimiter(t, yamlConfig, nil)
+
+	ctxs := []*context.Context{}
+	for i := 0; i < 10; i++ {
+		ctx := newContext(t)
+		assert.Equal("", al.Handle(ctx))
+		ctxs = append(ctxs, ctx)
+	}
+
+	ctx := newContext(t)
+	assert.Equal(resultLimited, al.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	for _, ctx := range ctxs {
+		ctx.Finish()
+	}
+	status := al.Status().(*Status)
+	assert.Equal(0, status.Inflight)
+	assert.Equal(int64(1), status.NumOfRejected)
+}
+
+func TestGradient(t *testing.T) {
+	assert := assert.New(t)
+	al := createLimiter(t, yamlConfig, nil)
+
+	// the limit increases while the latency is stable
+	now := time.Now()
+	limit := 10
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Second)
+		l := runWindow(al, now, 10*time.Millisecond)
+		assert.GreaterOrEqual(l, limit)
+		limit = l
+	}
+	assert.Greater(limit, 20)
+
+	// and decreases when the latency increases
+	for i := 0; i < 40; i++ {
+		now = now.Add(time.Second)
+		limit = runWindow(al, now, 100*time.Millisecond)
+	}
+	assert.Less(limit, 10)
+
+	// the limit is inherited
+	al = createLimiter(t, yamlConfig, al)
+	assert.Equal(limit, al.Status().(*Status).Limit)
+
+	// the limit does not increase if it was not reached
+	al.limit = 50
+	for i := 0; i < 20; i++ {
+		now = now.Add(time.Second)
+		al.acquire()
+		al.release(time.Millisecond, now)
+	}
+	assert.Equal(50, al.Status().(*Status).Limit)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	newSpec := func() *Spec {
+		return &Spec{
+			InitialLimit: 10,
+			MinLimit:     1,
+			MaxLimit:     100,
+			Tolerance:    1.5,
+			Smoothing:    0.2,
+		}
+	}
+
+	spec := newSpec()
+	assert.NoError(spec.Validate())
+
+	spec.MinLimit = 200
+	assert.Error(spec.Validate())
+
+	spec = newSpec()
+	spec.InitialLimit = 200
+	assert.Error(spec.Validate())
+
+	spec = newSpec()
+	spec.Window = "0s"
+	assert.Error(spec.Validate())
+
+	spec = newSpec()
+	spec.Tolerance = 0.5
+	assert.Error(spec.Validate())
+
+	spec = newSpec()
+	spec.Smoothing = 2
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,415 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admissionqueue
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+)
+
+const (
+	// Kind is the kind of AdmissionQueue.
+	Kind = "AdmissionQueue"
+
+	// DisciplineFIFO serves the oldest waiting request first.
+	DisciplineFIFO = "fifo"
+	// DisciplineLIFO serves the newest waiting request first.
+	DisciplineLIFO = "lifo"
+
+	resultRejected = "rejected"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "AdmissionQueue limits the number of concurrent requests and queues the others by priority in FIFO or LIFO order.",
+	Results:     []string{resultRejected},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Discipline: DisciplineFIFO,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &AdmissionQueue{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// AdmissionQueue is filter AdmissionQueue.
+	AdmissionQueue struct {
+		spec        *Spec
+		maxQueueAge time.Duration
+		trusted     *ipfilter.IPFilter
+
+		lock     sync.Mutex
+		inflight int
+		waiters  *list.List
+
+		numOfAdmitted     int64
+		numOfDroppedByAge int64
+		numOfRejected     int64
+		numOfPreempted    int64
+		numOfCanceled     int64
+	}
+
+	// Spec describes the AdmissionQueue.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxConcurrency int    `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		QueueSize      int    `json:"queueSize" jsonschema:"omitempty"`
+		Discipline     string `json:"discipline" jsonschema:"omitempty,enum=,enum=fifo,enum=lifo"`
+		MaxQueueAge    string `json:"maxQueueAge" jsonschema:"omitempty,format=duration"`
+		PriorityHeader string `json:"priorityHeader" jsonschema:"omitempty"`
+		// MaxPriority is the max priority a request could get, values of
+		// the priority header are clamped to [0, MaxPriority].
+		MaxPriority int `json:"maxPriority" jsonschema:"omitempty"`
+		// PriorityTrustedIPs are the IPs or CIDRs of clients whose priority
+		// header is honored, the header is honored for all clients if empty.
+		PriorityTrustedIPs []string `json:"priorityTrustedIPs" jsonschema:"omitempty,uniqueItems=true,format=ipcidr-array"`
+	}
+
+	// Status is the status of AdmissionQueue.
+	Status struct {
+		Discipline        string `json:"discipline"`
+		QueueDepth        int    `json:"queueDepth"`
+		Inflight          int    `json:"inflight"`
+		NumOfAdmitted     int64  `json:"numOfAdmitted"`
+		NumOfDroppedByAge int64  `json:"numOfDroppedByAge"`
+		NumOfRejected     int64  `json:"numOfRejected"`
+		NumOfPreempted    int64  `json:"numOfPreempted"`
+		NumOfCanceled     int64  `json:"numOfCanceled"`
+	}
+
+	// waiter is a request waiting in the queue, the admission result is
+	// sent to ch once it is admitted or dropped.
+	waiter struct {
+		priority int
+		enqueued time.Time
+		ch       chan bool
+		elem     *list.Element
+	}
+)
+
+var _ filters.Filter = (*AdmissionQueue)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.QueueSize < 0 {
+		return fmt.Errorf("queueSize must not be negative")
+	}
+	if spec.PriorityHeader != "" && spec.MaxPriority <= 0 {
+		return fmt.Errorf("maxPriority must be positive when priorityHeader is set")
+	}
+	if spec.MaxQueueAge == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(spec.MaxQueueAge); err != nil || d <= 0 {
+		return fmt.Errorf("invalid maxQueueAge %q", spec.MaxQueueAge)
+	}
+	return nil
+}
+
+// Name returns the name of the AdmissionQueue filter instance.
+func (aq *AdmissionQueue) Name() string {
+	return aq.spec.Name()
+}
+
+// Kind returns the kind of AdmissionQueue.
+func (aq *AdmissionQueue) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the AdmissionQueue
+func (aq *AdmissionQueue) Spec() filters.Spec {
+	return aq.spec
+}
+
+// Init initializes AdmissionQueue.
+func (aq *AdmissionQueue) Init() {
+	aq.reload()
+}
+
+// Inherit inherits previous generation of AdmissionQueue.
+//
+// Requests admitted or queued by the previous generation are still
+// managed by it, the new generation starts with an empty queue.
+func (aq *AdmissionQueue) Inherit(previousGeneration filters.Filter) {
+	aq.reload()
+}
+
+func (aq *AdmissionQueue) reload() {
+	aq.waiters = list.New()
+	aq.maxQueueAge, _ = time.ParseDuration(aq.spec.MaxQueueAge)
+	if len(aq.spec.PriorityTrustedIPs) > 0 {
+		aq.trusted = ipfilter.New(&ipfilter.Spec{
+			BlockByDefault: true,
+			AllowIPs:       aq.spec.PriorityTrustedIPs,
+		})
+	}
+}
+
+func (aq *AdmissionQueue) lifo() bool {
+	return aq.spec.Discipline == DisciplineLIFO
+}
+
+// expired reports whether the waiter has waited longer than maxQueueAge.
+func (aq *AdmissionQueue) expired(w *waiter, now time.Time) bool {
+	return aq.maxQueueAge > 0 && now.Sub(w.enqueued) >= aq.maxQueueAge
+}
+
+// remove removes the waiter from the queue and sends the result to it,
+// the caller must hold the lock.
+func (aq *AdmissionQueue) remove(w *waiter, admitted bool) {
+	aq.waiters.Remove(w.elem)
+	w.elem = nil
+	if admitted {
+		aq.inflight++
+		aq.numOfAdmitted++
+	}
+	w.ch <- admitted
+}
+
+// next returns the next waiter to admit, that's, the first (FIFO) or the
+// last (LIFO) waiter of the highest priority, the caller must hold the
+// lock.
+func (aq *AdmissionQueue) next() *waiter {
+	var next *waiter
+	for e := aq.waiters.Front(); e != nil; e = e.Next() {
+		w := e.Value.(*waiter)
+		if next == nil || w.priority > next.priority || (aq.lifo() && w.priority == next.priority) {
+			next = w
+		}
+	}
+	return next
+}
+
+// lowest returns the oldest waiter of the lowest priority, the caller must
+// hold the lock.
+func (aq *AdmissionQueue) lowest() *waiter {
+	var lowest *waiter
+	for e := aq.waiters.Front(); e != nil; e = e.Next() {
+		w := e.Value.(*waiter)
+		if lowest == nil || w.priority < lowest.priority {
+			lowest = w
+		}
+	}
+	return lowest
+}
+
+// release releases the slot of a finished request and passes it to the
+// next waiter, waiters exceeding maxQueueAge are dropped on the way.
+func (aq *AdmissionQueue) release() {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	aq.inflight--
+	now := fasttime.Now()
+	for aq.inflight < aq.spec.MaxConcurrency && aq.waiters.Len() > 0 {
+		w := aq.next()
+		if aq.expired(w, now) {
+			aq.numOfDroppedByAge++
+			aq.remove(w, false)
+			continue
+		}
+		aq.remove(w, true)
+	}
+}
+
+// enqueue admits the request directly if there is a free slot, otherwise,
+// it puts the request into the queue. A nil waiter is returned if the
+// request is admitted directly, and an error is returned if the request
+// is rejected because the queue is full.
+func (aq *AdmissionQueue) enqueue(priority int) (*waiter, error) {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	if aq.inflight < aq.spec.MaxConcurrency && aq.waiters.Len() == 0 {
+		aq.inflight++
+		aq.numOfAdmitted++
+		return nil, nil
+	}
+
+	if aq.waiters.Len() >= aq.spec.QueueSize {
+		// a waiter of lower priority is preempted by the new request.
+		// Otherwise, FIFO rejects the new request, while LIFO drops the
+		// oldest one of the same priority to make room for the new
+		// request, as the oldest one has the least chance to be served
+		// before the client gives up.
+		lowest := aq.lowest()
+		switch {
+		case lowest != nil && lowest.priority < priority:
+			aq.numOfPreempted++
+		case aq.lifo() && lowest != nil && lowest.priority == priority:
+			aq.numOfRejected++
+		default:
+			aq.numOfRejected++
+			return nil, fmt.Errorf("queue is full")
+		}
+		aq.remove(lowest, false)
+	}
+
+	w := &waiter{priority: priority, enqueued: fasttime.Now(), ch: make(chan bool, 1)}
+	w.elem = aq.waiters.PushBack(w)
+	return w, nil
+}
+
+// wait waits until the waiter is admitted or dropped, the waiter is
+// removed from the queue if the request is canceled by the client.
+func (aq *AdmissionQueue) wait(w *waiter, done <-chan struct{}) bool {
+	var expired <-chan time.Time
+	if aq.maxQueueAge > 0 {
+		timer := time.NewTimer(aq.maxQueueAge)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	select {
+	case admitted := <-w.ch:
+		return admitted
+	case <-expired:
+		aq.lock.Lock()
+		if w.elem != nil {
+			aq.numOfDroppedByAge++
+			aq.remove(w, false)
+		}
+		aq.lock.Unlock()
+	case <-done:
+		aq.lock.Lock()
+		if w.elem != nil {
+			aq.numOfCanceled++
+			aq.remove(w, false)
+		}
+		aq.lock.Unlock()
+	}
+
+	// the waiter may be admitted right before it is removed, the result
+	// is always available in the channel now.
+	return <-w.ch
+}
+
+// done returns the done channel of the request context, nil is returned
+// if the request is not an HTTP request.
+func done(ctx *context.Context) <-chan struct{} {
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return nil
+	}
+	return req.Context().Done()
+}
+
+func (aq *AdmissionQueue) reject(ctx *context.Context, reason string) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusServiceUnavailable)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("admissionQueue: " + reason)
+	return resultRejected
+}
+
+// peerIP returns the IP of the direct peer of the request, headers like
+// X-Forwarded-For are not used as they can be forged by clients.
+func peerIP(req *httpprot.Request) string {
+	host, _, err := net.SplitHostPort(req.Std().RemoteAddr)
+	if err != nil {
+		return req.Std().RemoteAddr
+	}
+	return host
+}
+
+// priority returns the priority of the request, which is the integer value
+// of the priority header clamped to [0, maxPriority]. Requests without a
+// valid value, or from untrusted clients, have priority 0.
+func (aq *AdmissionQueue) priority(ctx *context.Context) int {
+	if aq.spec.PriorityHeader == "" {
+		return 0
+	}
+	req, ok := ctx.GetInputRequest().(*httpprot.Request)
+	if !ok {
+		return 0
+	}
+	if !aq.trusted.Allow(peerIP(req)) {
+		return 0
+	}
+	priority, _ := strconv.Atoi(req.HTTPHeader().Get(aq.spec.PriorityHeader))
+	switch {
+	case priority < 0:
+		return 0
+	case priority > aq.spec.MaxPriority:
+		return aq.spec.MaxPriority
+	}
+	return priority
+}
+
+// Handle admits the request or queues it until there is a free slot, the
+// slot is released after the request is finished.
+func (aq *AdmissionQueue) Handle(ctx *context.Context) string {
+	w, err := aq.enqueue(aq.priority(ctx))
+	if err != nil {
+		return aq.reject(ctx, err.Error())
+	}
+
+	if w != nil && !aq.wait(w, done(ctx)) {
+		return aq.reject(ctx, "dropped from queue")
+	}
+
+	ctx.OnFinish(aq.release)
+	return ""
+}
+
+// Status returns status.
+func (aq *AdmissionQueue) Status() interface{} {
+	aq.lock.Lock()
+	defer aq.lock.Unlock()
+
+	discipline := aq.spec.Discipline
+	if discipline == "" {
+		discipline = DisciplineFIFO
+	}
+
+	return &Status{
+		Discipline:        discipline,
+		QueueDepth:        aq.waiters.Len(),
+		Inflight:          aq.inflight,
+		NumOfAdmitted:     aq.numOfAdmitted,
+		NumOfDroppedByAge: aq.numOfDroppedByAge,
+		NumOfRejected:     aq.numOfRejected,
+		NumOfPreempted:    aq.numOfPreempted,
+		NumOfCanceled:     aq.numOfCanceled,
+	}
+}
+
+// Close closes AdmissionQueue.
+func (aq *AdmissionQueue) Close() {}
@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admissionqueue
+
+import (
+	stdcontext "context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createQueue(t *testing.T, yamlConfig string) *AdmissionQueue {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	aq := kind.CreateInstance(spec).(*AdmissionQueue)
+	aq.Init()
+	return aq
+}
+
+func newContext(t *testing.T) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// handleAsync handles a new request in a goroutine and waits until the
+// request is handled by the queue, that is, admitted, queued or rejected.
+func handleAsync(t *testing.T, aq *AdmissionQueue) (*context.Context, chan string) {
+	return handleContextAsync(t, aq, newContext(t))
+}
+
+func handleContextAsync(t *testing.T, aq *AdmissionQueue, ctx *context.Context) (*context.Context, chan string) {
+	handled := func() int64 {
+		s := aq.Status().(*Status)
+		return int64(s.QueueDepth) + s.NumOfAdmitted + s.NumOfRejected + s.NumOfDroppedByAge + s.NumOfPreempted
+	}
+
+	result := make(chan string, 1)
+	n := handled()
+	go func() {
+		result <- aq.Handle(ctx)
+	}()
+	assert.Eventually(t, func() bool {
+		return handled() > n
+	}, time.Second, time.Millisecond)
+	return ctx, result
+}
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := map[string]interface{}{
+		"name":           "aq",
+		"kind":           Kind,
+		"maxConcurrency": 1,
+		"queueSize":      -1,
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["queueSize"] = 10
+	rawSpec["maxQueueAge"] = "-1s"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["maxQueueAge"] = "1s"
+	rawSpec["discipline"] = "random"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["discipline"] = "lifo"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	rawSpec["priorityHeader"] = "X-Priority"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["maxPriority"] = 10
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+}
+
+func TestFIFO(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+queueSize: 2
+`)
+
+	ctx1, r1 := handleAsync(t, aq)
+	assert.Equal("", <-r1)
+
+	ctx2, r2 := handleAsync(t, aq)
+	ctx3, r3 := handleAsync(t, aq)
+
+	// the queue is full
+	ctx := newContext(t)
+	assert.Equal(resultRejected, aq.Handle(ctx))
+	assert.Equal(http.StatusServiceUnavailable, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx1.Finish()
+	assert.Equal("", <-r2)
+	assert.Empty(r3)
+	ctx2.Finish()
+	assert.Equal("", <-r3)
+	ctx3.Finish()
+
+	status := aq.Status().(*Status)
+	assert.Equal(DisciplineFIFO, status.Discipline)
+	assert.Equal(0, status.QueueDepth)
+	assert.Equal(0, status.Inflight)
+	assert.Equal(int64(3), status.NumOfAdmitted)
+	assert.Equal(int64(1), status.NumOfRejected)
+}
+
+func TestLIFO(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+queueSize: 2
+discipline: lifo
+`)
+
+	ctx1, r1 := handleAsync(t, aq)
+	assert.Equal("", <-r1)
+
+	_, r2 := handleAsync(t, aq)
+	_, r3 := handleAsync(t, aq)
+
+	// the oldest waiting request is dropped for the new one
+	ctx4, r4 := handleAsync(t, aq)
+	assert.Equal(resultRejected, <-r2)
+
+	ctx1.Finish()
+	assert.Equal("", <-r4)
+	assert.Empty(r3)
+	ctx4.Finish()
+	assert.Equal("", <-r3)
+
+	status := aq.Status().(*Status)
+	assert.Equal(DisciplineLIFO, status.Discipline)
+	assert.Equal(1, status.Inflight)
+	assert.Equal(int64(3), status.NumOfAdmitted)
+	assert.Equal(int64(1), status.NumOfRejected)
+}
+
+func TestMaxQueueAge(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+queueSize: 10
+maxQueueAge: 50ms
+`)
+
+	ctx1, r1 := handleAsync(t, aq)
+	assert.Equal("", <-r1)
+
+	ctx2, r2 := handleAsync(t, aq)
+	assert.Equal(resultRejected, <-r2)
+	assert.Equal(http.StatusServiceUnavailable, ctx2.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx1.Finish()
+	_, r3 := handleAsync(t, aq)
+	assert.Equal("", <-r3)
+
+	status := aq.Status().(*Status)
+	assert.Equal(0, status.QueueDepth)
+	assert.Equal(int64(2), status.NumOfAdmitted)
+	assert.Equal(int64(1), status.NumOfDroppedByAge)
+}
+
+func TestPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+queueSize: 2
+priorityHeader: X-Priority
+maxPriority: 10
+`)
+
+	handle := func(priority string) (*context.Context, chan string) {
+		ctx := newContext(t)
+		ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Priority", priority)
+		return handleContextAsync(t, aq, ctx)
+	}
+
+	ctx1, r1 := handle("0")
+	assert.Equal("", <-r1)
+
+	_, r2 := handle("1")
+	_, r3 := handle("0")
+
+	// the waiter of the lowest priority is preempted by a request of
+	// higher priority, but not by one of the same priority.
+	ctx4, r4 := handle("2")
+	assert.Equal(resultRejected, <-r3)
+	_, r5 := handle("1")
+	assert.Equal(resultRejected, <-r5)
+
+	// waiters of higher priority are admitted first.
+	ctx1.Finish()
+	assert.Equal("", <-r4)
+	assert.Empty(r2)
+	ctx4.Finish()
+	assert.Equal("", <-r2)
+
+	status := aq.Status().(*Status)
+	assert.Equal(int64(3), status.NumOfAdmitted)
+	assert.Equal(int64(1), status.NumOfRejected)
+	assert.Equal(int64(1), status.NumOfPreempted)
+}
+
+func TestPriorityTrust(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+priorityHeader: X-Priority
+maxPriority: 10
+priorityTrustedIPs:
+- 10.0.0.0/8
+`)
+
+	priority := func(remoteAddr, value string) int {
+		ctx := newContext(t)
+		req := ctx.GetInputRequest().(*httpprot.Request)
+		req.Std().RemoteAddr = remoteAddr
+		req.HTTPHeader().Set("X-Priority", value)
+		return aq.priority(ctx)
+	}
+
+	assert.Equal(5, priority("10.0.0.1:1234", "5"))
+	assert.Equal(10, priority("10.0.0.1:1234", "100"))
+	assert.Equal(0, priority("10.0.0.1:1234", "-5"))
+	assert.Equal(0, priority("10.0.0.1:1234", "high"))
+
+	// the header from untrusted clients is ignored.
+	assert.Equal(0, priority("192.168.0.1:1234", "5"))
+	assert.Equal(0, priority("", "5"))
+}
+
+func TestCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	aq := createQueue(t, `
+name: aq
+kind: AdmissionQueue
+maxConcurrency: 1
+queueSize: 10
+`)
+
+	ctx1, r1 := handleAsync(t, aq)
+	assert.Equal("", <-r1)
+
+	cancelCtx, cancel := stdcontext.WithCancel(stdcontext.Background())
+	stdr, _ := http.NewRequestWithContext(cancelCtx, http.MethodGet, "http://example.com/", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(err)
+	ctx2 := context.New(nil)
+	ctx2.SetInputRequest(req)
+	_, r2 := handleContextAsync(t, aq, ctx2)
+
+	// the canceled waiter is removed from the queue.
+	cancel()
+	assert.Equal(resultRejected, <-r2)
+	status := aq.Status().(*Status)
+	assert.Equal(0, status.QueueDepth)
+	assert.Equal(int64(1), status.NumOfCanceled)
+
+	ctx1.Finish()
+	status = aq.Status().(*Status)
+	assert.Equal(0, status.Inflight)
+	assert.Equal(int64(1), status.NumOfAdmitted)
+}
@@ -0,0 +1,412 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package apiaggregator implements the APIAggregator filter, which sends
+// sub-requests to pipelines concurrently and aggregates their responses.
+package apiaggregator
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/rawconfigtrafficcontroller"
+	"github.com/megaease/easegress/pkg/object/trafficcontroller"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of APIAggregator.
+	Kind = "APIAggregator"
+
+	resultFailed = "failed"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "APIAggregator sends sub-requests to pipelines concurrently and aggregates their responses.",
+	Results:     []string{resultFailed},
+	// sub-requests are handled by other pipelines, which may send them to
+	// backends.
+	Effects: []string{filters.EffectBackend},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &APIAggregator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// APIAggregator is filter APIAggregator.
+	APIAggregator struct {
+		spec    *Spec
+		timeout time.Duration
+		stats   []*httpstat.HTTPStat
+
+		// getHandler returns the handler of the pipeline.
+		getHandler func(name string) (context.Handler, bool)
+	}
+
+	// Spec describes the APIAggregator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Requests    []*RequestSpec `json:"requests" jsonschema:"required,minItems=1"`
+		Partial     bool           `json:"partial" jsonschema:"omitempty"`
+		Timeout     string         `json:"timeout" jsonschema:"omitempty,format=duration"`
+		MaxBodySize int64          `json:"maxBodySize" jsonschema:"omitempty"`
+	}
+
+	// RequestSpec describes a sub-request.
+	RequestSpec struct {
+		Name     string            `json:"name" jsonschema:"required"`
+		Pipeline string            `json:"pipeline" jsonschema:"required"`
+		Method   string            `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		Path     string            `json:"path" jsonschema:"omitempty"`
+		Fields   map[string]string `json:"fields" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of APIAggregator.
+	Status struct {
+		Requests map[string]*httpstat.Status `json:"requests"`
+	}
+
+	// result is the result of a sub-request.
+	result struct {
+		index int
+		value interface{}
+		err   error
+	}
+)
+
+var _ filters.Filter = (*APIAggregator)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	names := map[string]bool{}
+	for _, r := range spec.Requests {
+		if names[r.Name] {
+			return fmt.Errorf("duplicated request name %q", r.Name)
+		}
+		names[r.Name] = true
+		if r.Path != "" && !strings.HasPrefix(r.Path, "/") {
+			return fmt.Errorf("request %q: path must start with '/'", r.Name)
+		}
+	}
+	if spec.Timeout != "" {
+		if d, err := time.ParseDuration(spec.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", spec.Timeout)
+		}
+	}
+	if spec.MaxBodySize < 0 {
+		return fmt.Errorf("maxBodySize must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name of the APIAggregator filter instance.
+func (aa *APIAggregator) Name() string {
+	return aa.spec.Name()
+}
+
+// Kind returns the kind of APIAggregator.
+func (aa *APIAggregator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the APIAggregator
+func (aa *APIAggregator) Spec() filters.Spec {
+	return aa.spec
+}
+
+// Init initializes APIAggregator.
+func (aa *APIAggregator) Init() {
+	aa.reload()
+}
+
+// Inherit inherits previous generation of APIAggregator.
+func (aa *APIAggregator) Inherit(previousGeneration filters.Filter) {
+	aa.reload()
+}
+
+func (aa *APIAggregator) reload() {
+	aa.timeout, _ = time.ParseDuration(aa.spec.Timeout)
+	aa.stats = make([]*httpstat.HTTPStat, len(aa.spec.Requests))
+	for i := range aa.stats {
+		aa.stats[i] = httpstat.New()
+	}
+	aa.getHandler = aa.getPipeline
+}
+
+// getPipeline returns the pipeline in the namespace of the pipelines
+// created by users.
+func (aa *APIAggregator) getPipeline(name string) (context.Handler, bool) {
+	super := aa.spec.Super()
+	if super == nil {
+		return nil, false
+	}
+	entity, ok := super.GetSystemController(trafficcontroller.Kind)
+	if !ok {
+		return nil, false
+	}
+	tc := entity.Instance().(*trafficcontroller.TrafficController)
+	pipeline, ok := tc.GetPipeline(rawconfigtrafficcontroller.DefaultNamespace, name)
+	if !ok {
+		return nil, false
+	}
+	handler, ok := pipeline.Instance().(context.Handler)
+	return handler, ok
+}
+
+func (aa *APIAggregator) maxBodySize() int64 {
+	if aa.spec.MaxBodySize == 0 {
+		return httpprot.DefaultMaxPayloadSize
+	}
+	return aa.spec.MaxBodySize
+}
+
+// buildRequest builds the sub-request from the request, the body of the
+// request is sent to all sub-requests unless it is a stream.
+func buildRequest(tctx stdcontext.Context, req *httpprot.Request, rs *RequestSpec) (*httpprot.Request, error) {
+	method := rs.Method
+	if method == "" {
+		method = req.Method()
+	}
+
+	url := req.Path()
+	if rq := req.Std().URL.RawQuery; rq != "" {
+		url += "?" + rq
+	}
+	if rs.Path != "" {
+		url = rs.Path
+	}
+
+	var body []byte
+	if !req.IsStream() && method != http.MethodGet && method != http.MethodHead {
+		body = req.RawPayload()
+	}
+
+	stdr, err := http.NewRequestWithContext(tctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	stdr.Header = req.HTTPHeader().Clone()
+	stdr.Header.Del("Content-Length")
+	stdr.ContentLength = int64(len(body))
+	stdr.Host = req.Host()
+	stdr.RemoteAddr = req.Std().RemoteAddr
+
+	subReq, _ := httpprot.NewRequest(stdr)
+	subReq.SetPayload(body)
+	return subReq, nil
+}
+
+// call sends the i-th sub-request to its pipeline, and returns the parsed
+// JSON body of the response. It must not access the request or its
+// context, as it may be still running after the request is finished.
+func (aa *APIAggregator) call(subReq *httpprot.Request, parent *tracing.Span, i int) (interface{}, error) {
+	rs := aa.spec.Requests[i]
+	startAt := fasttime.Now()
+	metric := &httpstat.Metric{
+		StatusCode: http.StatusServiceUnavailable,
+		ReqSize:    uint64(subReq.PayloadSize()),
+	}
+	defer func() {
+		metric.Duration = fasttime.Since(startAt)
+		aa.stats[i].Stat(metric)
+	}()
+
+	handler, ok := aa.getHandler(rs.Pipeline)
+	if !ok {
+		return nil, fmt.Errorf("pipeline %s not found", rs.Pipeline)
+	}
+
+	span := parent.NewChild(aa.Name() + "#" + rs.Name)
+	defer span.End()
+	subCtx := context.New(span)
+	defer subCtx.Finish()
+	subCtx.SetRequest(context.DefaultNamespace, subReq)
+
+	handler.Handle(subCtx)
+
+	resp, _ := subCtx.GetResponse(context.DefaultNamespace).(*httpprot.Response)
+	if resp == nil {
+		return nil, fmt.Errorf("no response")
+	}
+	metric.StatusCode = resp.StatusCode()
+
+	maxBodySize := aa.maxBodySize()
+	body, err := io.ReadAll(io.LimitReader(resp.GetPayload(), maxBodySize+1))
+	metric.RespSize = uint64(len(body))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return nil, fmt.Errorf("status code %d", resp.StatusCode())
+	}
+	if int64(len(body)) > maxBodySize {
+		return nil, fmt.Errorf("body is larger than %d bytes", maxBodySize)
+	}
+
+	var value interface{}
+	if err = json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return value, nil
+}
+
+// lookup returns the value of the field path, fields of the path are
+// separated by dots.
+func lookup(value interface{}, path string) (interface{}, bool) {
+	for _, field := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[field]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// compose composes the aggregated body from the results.
+func (aa *APIAggregator) compose(results []*result) map[string]interface{} {
+	body := map[string]interface{}{}
+	for i, r := range results {
+		rs := aa.spec.Requests[i]
+		if r.err != nil {
+			body[rs.Name] = map[string]interface{}{"error": r.err.Error()}
+			continue
+		}
+		if len(rs.Fields) == 0 {
+			body[rs.Name] = r.value
+			continue
+		}
+		for key, path := range rs.Fields {
+			if v, ok := lookup(r.value, path); ok {
+				body[key] = v
+			}
+		}
+	}
+	return body
+}
+
+// Handle sends the sub-requests concurrently and aggregates the responses.
+func (aa *APIAggregator) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	tctx, cancel := stdcontext.WithCancel(req.Context())
+	if aa.timeout > 0 {
+		tctx, cancel = stdcontext.WithTimeout(req.Context(), aa.timeout)
+	}
+	defer cancel()
+
+	// the channel is buffered, so that the goroutines of the sub-requests
+	// which are not finished before the deadline won't be blocked.
+	n := len(aa.spec.Requests)
+	ch := make(chan *result, n)
+	results := make([]*result, n)
+	started, span := 0, ctx.Span()
+	for i, rs := range aa.spec.Requests {
+		subReq, err := buildRequest(tctx, req, rs)
+		if err != nil {
+			results[i] = &result{index: i, err: err}
+			continue
+		}
+		started++
+		go func(i int) {
+			value, err := aa.call(subReq, span, i)
+			ch <- &result{index: i, value: value, err: err}
+		}(i)
+	}
+
+wait:
+	for received := 0; received < started; received++ {
+		select {
+		case r := <-ch:
+			results[r.index] = r
+		case <-tctx.Done():
+			break wait
+		}
+	}
+
+	failed := 0
+	for i, r := range results {
+		if r == nil {
+			results[i] = &result{index: i, err: fmt.Errorf("deadline exceeded")}
+		}
+		if results[i].err != nil {
+			failed++
+			logger.Debugf("%s: sub-request %s failed: %v", aa.Name(), aa.spec.Requests[i].Name, results[i].err)
+		}
+	}
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	ctx.SetOutputResponse(resp)
+
+	if failed > 0 {
+		ctx.AddTag(fmt.Sprintf("apiAggregator: %d of %d sub-requests failed", failed, n))
+		if !aa.spec.Partial {
+			resp.SetStatusCode(http.StatusBadGateway)
+			return resultFailed
+		}
+	}
+
+	data, err := json.Marshal(aa.compose(results))
+	if err != nil {
+		logger.Errorf("%s: BUG: failed to marshal aggregated body: %v", aa.Name(), err)
+		resp.SetStatusCode(http.StatusInternalServerError)
+		return resultFailed
+	}
+
+	resp.SetStatusCode(http.StatusOK)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(data)
+	return ""
+}
+
+// Status returns status.
+func (aa *APIAggregator) Status() interface{} {
+	s := &Status{Requests: map[string]*httpstat.Status{}}
+	for i, r := range aa.spec.Requests {
+		s.Requests[r.Name] = aa.stats[i].Status()
+	}
+	return s
+}
+
+// Close closes APIAggregator.
+func (aa *APIAggregator) Close() {}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package apiaggregator
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/context/contexttest"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/object/pipeline"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createAPIAggregator(t *testing.T, yamlConfig string) *APIAggregator {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	aa := kind.CreateInstance(spec).(*APIAggregator)
+	aa.Init()
+	aa.getHandler = func(name string) (context.Handler, bool) {
+		if name == "missing" {
+			return nil, false
+		}
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req := ctx.GetInputRequest().(*httpprot.Request)
+				resp, _ := httpprot.NewResponse(nil)
+				switch name {
+				case "users":
+					resp.SetPayload(`{"id": 1, "name": "alice", "address": {"city": "Beijing"}}`)
+				case "orders":
+					resp.SetPayload(`[{"id": "` + req.Method() + " " + req.Path() + `"}]`)
+				case "slow":
+					<-req.Context().Done()
+					resp.SetStatusCode(http.StatusGatewayTimeout)
+				default:
+					resp.SetStatusCode(http.StatusInternalServerError)
+				}
+				ctx.SetOutputResponse(resp)
+				return ""
+			},
+		}, true
+	}
+	return aa
+}
+
+func handle(aa *APIAggregator) (*httpprot.Response, string) {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/profile", strings.NewReader("{}"))
+	req, _ := httpprot.NewRequest(stdr)
+	req.FetchPayload(0)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	result := aa.Handle(ctx)
+	return ctx.GetOutputResponse().(*httpprot.Response), result
+}
+
+func TestAPIAggregator(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: APIAggregator
+name: aggregator
+requests:
+- name: user
+  pipeline: users
+  method: GET
+  path: /users/1
+  fields:
+    userName: name
+    city: address.city
+    zip: address.zip
+- name: orders
+  pipeline: orders
+`
+	aa := createAPIAggregator(t, yamlConfig)
+	resp, result := handle(aa)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+
+	body := map[string]interface{}{}
+	assert.NoError(json.Unmarshal(resp.RawPayload(), &body))
+	assert.Equal(map[string]interface{}{
+		"userName": "alice",
+		"city":     "Beijing",
+		"orders":   []interface{}{map[string]interface{}{"id": "POST /profile"}},
+	}, body)
+
+	// fail the whole request
+	aa = createAPIAggregator(t, yamlConfig+`
+- name: broken
+  pipeline: broken
+`)
+	resp, result = handle(aa)
+	assert.Equal(resultFailed, result)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+
+	status := aa.Status().(*Status)
+	assert.Equal(uint64(1), status.Requests["user"].Count)
+	assert.Equal(uint64(0), status.Requests["user"].ErrCount)
+	assert.Equal(uint64(1), status.Requests["broken"].ErrCount)
+}
+
+func TestAPIAggregatorPartial(t *testing.T) {
+	assert := assert.New(t)
+
+	aa := createAPIAggregator(t, `
+kind: APIAggregator
+name: aggregator
+partial: true
+timeout: 50ms
+requests:
+- name: user
+  pipeline: users
+- name: slow
+  pipeline: slow
+- name: missing
+  pipeline: missing
+`)
+
+	start := time.Now()
+	resp, result := handle(aa)
+	assert.Less(time.Since(start), time.Second)
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+
+	body := map[string]interface{}{}
+	assert.NoError(json.Unmarshal(resp.RawPayload(), &body))
+	assert.Equal("alice", body["user"].(map[string]interface{})["name"])
+	assert.NotEmpty(body["slow"].(map[string]interface{})["error"])
+	assert.Equal("pipeline missing not found", body["missing"].(map[string]interface{})["error"])
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Requests: []*RequestSpec{{Name: "a"}, {Name: "a"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Requests: []*RequestSpec{{Name: "a", Path: "abc"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Requests: []*RequestSpec{{Name: "a"}}, Timeout: "abc"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Requests: []*RequestSpec{{Name: "a", Path: "/abc"}}, Timeout: "1s"}
+	assert.NoError(spec.Validate())
+}
+
+func TestPreview(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: aggregate-pipeline
+kind: Pipeline
+flow:
+- filter: aggregator
+filters:
+- name: aggregator
+  kind: APIAggregator
+  requests:
+  - name: user
+    pipeline: users
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+
+	p := &pipeline.Pipeline{}
+	p.Init(superSpec, nil)
+	defer p.Close()
+
+	called := 0
+	aa := pipeline.MockGetFilter(p, "aggregator").(*APIAggregator)
+	aa.getHandler = func(name string) (context.Handler, bool) {
+		called++
+		return nil, false
+	}
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/profile", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+
+	// the sub-pipelines are not called in a preview.
+	pr := p.Preview(ctx)
+	assert.Len(pr.Steps, 1)
+	assert.True(pr.Steps[0].Stubbed)
+	assert.Equal([]string{filters.EffectBackend}, pr.Steps[0].Effects)
+	assert.Equal(0, called)
+}
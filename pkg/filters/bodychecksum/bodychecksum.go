@@ -0,0 +1,250 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodychecksum
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of BodyChecksum.
+	Kind = "BodyChecksum"
+
+	// AlgorithmMD5 is the MD5 algorithm.
+	AlgorithmMD5 = "md5"
+	// AlgorithmSHA1 is the SHA-1 algorithm.
+	AlgorithmSHA1 = "sha1"
+	// AlgorithmSHA256 is the SHA-256 algorithm.
+	AlgorithmSHA256 = "sha256"
+
+	defaultHeader = "Content-MD5"
+
+	resultMismatch = "mismatch"
+	resultMissing  = "missing"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "BodyChecksum validates the checksum of the request body against the declared one.",
+	Results:     []string{resultMismatch, resultMissing},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Algorithm: AlgorithmMD5,
+			Header:    defaultHeader,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &BodyChecksum{spec: spec.(*Spec)}
+	},
+}
+
+// errChecksumMismatch is returned by the reader of a stream body when the
+// checksum mismatches.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// BodyChecksum is filter BodyChecksum.
+	BodyChecksum struct {
+		spec *Spec
+
+		numOfVerified   int64
+		numOfMismatched int64
+		numOfMissing    int64
+	}
+
+	// Spec describes the BodyChecksum.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Algorithm string `json:"algorithm" jsonschema:"omitempty,enum=,enum=md5,enum=sha1,enum=sha256"`
+		Header    string `json:"header" jsonschema:"omitempty"`
+		Required  bool   `json:"required" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of BodyChecksum.
+	Status struct {
+		NumOfVerified   int64 `json:"numOfVerified"`
+		NumOfMismatched int64 `json:"numOfMismatched"`
+		NumOfMissing    int64 `json:"numOfMissing"`
+	}
+
+	// checksumReader computes the checksum of the data read from the
+	// underlying reader, and returns errChecksumMismatch instead of EOF if
+	// the checksum mismatches.
+	checksumReader struct {
+		r        io.Reader
+		h        hash.Hash
+		expected []byte
+		done     bool
+		bc       *BodyChecksum
+	}
+)
+
+var _ filters.Filter = (*BodyChecksum)(nil)
+
+// Name returns the name of the BodyChecksum filter instance.
+func (bc *BodyChecksum) Name() string {
+	return bc.spec.Name()
+}
+
+// Kind returns the kind of BodyChecksum.
+func (bc *BodyChecksum) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the BodyChecksum
+func (bc *BodyChecksum) Spec() filters.Spec {
+	return bc.spec
+}
+
+// Init initializes BodyChecksum.
+func (bc *BodyChecksum) Init() {
+}
+
+// Inherit inherits previous generation of BodyChecksum.
+func (bc *BodyChecksum) Inherit(previousGeneration filters.Filter) {
+}
+
+func (bc *BodyChecksum) newHash() hash.Hash {
+	switch bc.spec.Algorithm {
+	case AlgorithmSHA1:
+		return sha1.New()
+	case AlgorithmSHA256:
+		return sha256.New()
+	default:
+		return md5.New()
+	}
+}
+
+// decodeChecksum decodes the declared checksum, which could be encoded in
+// hex or base64.
+func decodeChecksum(s string, size int) ([]byte, error) {
+	if len(s) == size*2 {
+		if b, err := hex.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil && len(b) == size {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid checksum %q", s)
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.h.Write(p[:n])
+	if err == io.EOF && !cr.done {
+		cr.done = true
+		if !bytes.Equal(cr.h.Sum(nil), cr.expected) {
+			atomic.AddInt64(&cr.bc.numOfMismatched, 1)
+			return n, errChecksumMismatch
+		}
+		atomic.AddInt64(&cr.bc.numOfVerified, 1)
+	}
+	return n, err
+}
+
+func (bc *BodyChecksum) reject(ctx *context.Context, result, reason string) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusBadRequest)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("bodyChecksum: " + reason)
+	return result
+}
+
+// Handle validates the checksum of the request body. The body is rejected
+// directly if it is not a stream, otherwise, the checksum is validated
+// while the body is being read, and the read fails if it mismatches.
+func (bc *BodyChecksum) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	header := bc.spec.Header
+	if header == "" {
+		header = defaultHeader
+	}
+	declared := req.HTTPHeader().Get(header)
+	if declared == "" {
+		if !bc.spec.Required {
+			return ""
+		}
+		atomic.AddInt64(&bc.numOfMissing, 1)
+		return bc.reject(ctx, resultMissing, "missing checksum header "+header)
+	}
+
+	h := bc.newHash()
+	expected, err := decodeChecksum(declared, h.Size())
+	if err != nil {
+		atomic.AddInt64(&bc.numOfMismatched, 1)
+		return bc.reject(ctx, resultMismatch, err.Error())
+	}
+
+	if req.IsStream() {
+		req.SetPayload(&checksumReader{
+			r:        req.GetPayload(),
+			h:        h,
+			expected: expected,
+			bc:       bc,
+		})
+		return ""
+	}
+
+	h.Write(req.RawPayload())
+	if !bytes.Equal(h.Sum(nil), expected) {
+		atomic.AddInt64(&bc.numOfMismatched, 1)
+		return bc.reject(ctx, resultMismatch, "checksum mismatch")
+	}
+
+	atomic.AddInt64(&bc.numOfVerified, 1)
+	return ""
+}
+
+// Status returns status.
+func (bc *BodyChecksum) Status() interface{} {
+	return &Status{
+		NumOfVerified:   atomic.LoadInt64(&bc.numOfVerified),
+		NumOfMismatched: atomic.LoadInt64(&bc.numOfMismatched),
+		NumOfMissing:    atomic.LoadInt64(&bc.numOfMissing),
+	}
+}
+
+// Close closes BodyChecksum.
+func (bc *BodyChecksum) Close() {}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package bodychecksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createBodyChecksum(t *testing.T, yamlConfig string) *BodyChecksum {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	bc := kind.CreateInstance(spec).(*BodyChecksum)
+	bc.Init()
+	return bc
+}
+
+func newContext(t *testing.T, header, checksum, body string, stream bool) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPut, "http://example.com/", strings.NewReader(body))
+	if checksum != "" {
+		stdr.Header.Set(header, checksum)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	if stream {
+		assert.NoError(t, req.FetchPayload(-1))
+	} else {
+		assert.NoError(t, req.FetchPayload(0))
+	}
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestMD5(t *testing.T) {
+	assert := assert.New(t)
+
+	bc := createBodyChecksum(t, `
+name: checksum
+kind: BodyChecksum
+`)
+
+	body := "hello world"
+	sum := md5.Sum([]byte(body))
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+
+	assert.Equal("", bc.Handle(newContext(t, "Content-MD5", checksum, body, false)))
+	assert.Equal("", bc.Handle(newContext(t, "Content-MD5", hex.EncodeToString(sum[:]), body, false)))
+
+	ctx := newContext(t, "Content-MD5", checksum, "hello world!", false)
+	assert.Equal(resultMismatch, bc.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal(resultMismatch, bc.Handle(newContext(t, "Content-MD5", "abc", body, false)))
+
+	// the header is optional
+	assert.Equal("", bc.Handle(newContext(t, "Content-MD5", "", body, false)))
+
+	status := bc.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfVerified)
+	assert.Equal(int64(2), status.NumOfMismatched)
+	assert.Equal(int64(0), status.NumOfMissing)
+}
+
+func TestStream(t *testing.T) {
+	assert := assert.New(t)
+
+	bc := createBodyChecksum(t, `
+name: checksum
+kind: BodyChecksum
+algorithm: sha256
+header: X-Content-SHA256
+required: true
+`)
+
+	body := strings.Repeat("hello world", 1000)
+	sum := sha256.Sum256([]byte(body))
+	checksum := hex.EncodeToString(sum[:])
+
+	ctx := newContext(t, "X-Content-SHA256", checksum, body, true)
+	assert.Equal("", bc.Handle(ctx))
+	data, err := io.ReadAll(ctx.GetInputRequest().(*httpprot.Request).GetPayload())
+	assert.NoError(err)
+	assert.Equal(body, string(data))
+
+	ctx = newContext(t, "X-Content-SHA256", checksum, body+"!", true)
+	assert.Equal("", bc.Handle(ctx))
+	data, err = io.ReadAll(ctx.GetInputRequest().(*httpprot.Request).GetPayload())
+	assert.ErrorIs(err, errChecksumMismatch)
+	assert.Equal(body+"!", string(data))
+
+	ctx = newContext(t, "X-Content-SHA256", "", body, true)
+	assert.Equal(resultMissing, bc.Handle(ctx))
+
+	status := bc.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfVerified)
+	assert.Equal(int64(1), status.NumOfMismatched)
+	assert.Equal(int64(1), status.NumOfMissing)
+}
@@ -46,13 +46,20 @@ type (
 
 // Validate validates the Builder Spec.
 func (spec *Spec) Validate() error {
-	return nil
+	_, err := NewTemplate(spec)
+	return err
 }
 
-func (b *Builder) reload(spec *Spec) {
+// NewTemplate creates a template from the spec, the functions available
+// to builder filters are also available to the template.
+func NewTemplate(spec *Spec) (*template.Template, error) {
 	t := template.New("").Delims(spec.LeftDelim, spec.RightDelim)
 	t.Funcs(sprig.TxtFuncMap()).Funcs(extraFuncs)
-	b.template = template.Must(t.Parse(spec.Template))
+	return t.Parse(spec.Template)
+}
+
+func (b *Builder) reload(spec *Spec) {
+	b.template = template.Must(NewTemplate(spec))
 }
 
 func (b *Builder) build(data map[string]interface{}, v interface{}) error {
@@ -74,7 +81,9 @@ func (b *Builder) Status() interface{} {
 func (b *Builder) Close() {
 }
 
-func prepareBuilderData(ctx *context.Context) (map[string]interface{}, error) {
+// PrepareBuilderData prepares the data for executing the template of
+// builder filters.
+func PrepareBuilderData(ctx *context.Context) (map[string]interface{}, error) {
 	requests := make(map[string]interface{})
 	responses := make(map[string]interface{})
 
@@ -0,0 +1,288 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cachecontrol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of CacheControl.
+	Kind = "CacheControl"
+
+	defaultMaxETagBodySize = 64 * 1024
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CacheControl sets caching headers of responses according to rules.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxETagBodySize: defaultMaxETagBodySize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CacheControl{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CacheControl is filter CacheControl.
+	CacheControl struct {
+		spec *Spec
+
+		numOfModified    int64
+		numOfNotModified int64
+	}
+
+	// Spec describes the CacheControl.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Rules               []*Rule `json:"rules" jsonschema:"required"`
+		MaxETagBodySize     int64   `json:"maxETagBodySize" jsonschema:"omitempty"`
+		ConditionalRequests bool    `json:"conditionalRequests" jsonschema:"omitempty"`
+	}
+
+	// Rule describes the caching headers of the matching responses.
+	Rule struct {
+		StatusCodes  []int    `json:"statusCodes" jsonschema:"omitempty,uniqueItems=true"`
+		ContentTypes []string `json:"contentTypes" jsonschema:"omitempty,uniqueItems=true"`
+		PathPrefixes []string `json:"pathPrefixes" jsonschema:"omitempty,uniqueItems=true"`
+
+		CacheControl string `json:"cacheControl" jsonschema:"omitempty"`
+		Expires      string `json:"expires" jsonschema:"omitempty,format=duration"`
+		ETag         bool   `json:"etag" jsonschema:"omitempty"`
+		Override     bool   `json:"override" jsonschema:"omitempty"`
+
+		expires time.Duration
+	}
+
+	// Status is the status of CacheControl.
+	Status struct {
+		NumOfModified    int64 `json:"numOfModified"`
+		NumOfNotModified int64 `json:"numOfNotModified"`
+	}
+)
+
+var _ filters.Filter = (*CacheControl)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for i, r := range spec.Rules {
+		if r.CacheControl == "" && r.Expires == "" && !r.ETag {
+			return fmt.Errorf("rule %d: at least one of cacheControl, expires and etag is required", i)
+		}
+		if r.Expires != "" {
+			if d, err := time.ParseDuration(r.Expires); err != nil || d < 0 {
+				return fmt.Errorf("rule %d: invalid expires %q", i, r.Expires)
+			}
+		}
+		for _, code := range r.StatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("rule %d: invalid status code %d", i, code)
+			}
+		}
+	}
+	if spec.MaxETagBodySize < 0 {
+		return fmt.Errorf("maxETagBodySize must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name of the CacheControl filter instance.
+func (cc *CacheControl) Name() string {
+	return cc.spec.Name()
+}
+
+// Kind returns the kind of CacheControl.
+func (cc *CacheControl) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CacheControl
+func (cc *CacheControl) Spec() filters.Spec {
+	return cc.spec
+}
+
+// Init initializes CacheControl.
+func (cc *CacheControl) Init() {
+	cc.reload()
+}
+
+// Inherit inherits previous generation of CacheControl.
+func (cc *CacheControl) Inherit(previousGeneration filters.Filter) {
+	cc.reload()
+}
+
+func (cc *CacheControl) reload() {
+	for _, r := range cc.spec.Rules {
+		r.expires, _ = time.ParseDuration(r.Expires)
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Rule) match(req *httpprot.Request, resp *httpprot.Response) bool {
+	if len(r.StatusCodes) > 0 {
+		matched := false
+		for _, code := range r.StatusCodes {
+			if code == resp.StatusCode() {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(r.ContentTypes) > 0 && !hasAnyPrefix(resp.HTTPHeader().Get("Content-Type"), r.ContentTypes) {
+		return false
+	}
+
+	if len(r.PathPrefixes) > 0 && !hasAnyPrefix(req.Path(), r.PathPrefixes) {
+		return false
+	}
+
+	return true
+}
+
+// computeETag returns a strong ETag of the body.
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func (cc *CacheControl) maxETagBodySize() int64 {
+	if cc.spec.MaxETagBodySize == 0 {
+		return defaultMaxETagBodySize
+	}
+	return cc.spec.MaxETagBodySize
+}
+
+// apply sets the caching headers of the response according to the rule,
+// and returns whether the response is modified.
+func (cc *CacheControl) apply(r *Rule, resp *httpprot.Response) bool {
+	h := resp.HTTPHeader()
+	modified := false
+
+	set := func(key, value string) {
+		if r.Override || h.Get(key) == "" {
+			h.Set(key, value)
+			modified = true
+		}
+	}
+
+	if r.CacheControl != "" {
+		set("Cache-Control", r.CacheControl)
+	}
+
+	if r.Expires != "" {
+		set("Expires", fasttime.Now().Add(r.expires).UTC().Format(http.TimeFormat))
+	}
+
+	// ETag is only computed for small bodies, as the body must be read
+	// into memory, stream responses are skipped.
+	if r.ETag && !resp.IsStream() && resp.PayloadSize() <= cc.maxETagBodySize() {
+		if r.Override || h.Get("ETag") == "" {
+			h.Set("ETag", computeETag(resp.RawPayload()))
+			modified = true
+		}
+	}
+
+	return modified
+}
+
+// notModified returns whether the response could be replaced by a 304
+// response, i.e. the request is a conditional GET or HEAD request and its
+// If-None-Match header matches the ETag of the response.
+func notModified(req *httpprot.Request, resp *httpprot.Response) bool {
+	if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+		return false
+	}
+	// the body of a stream response is not read, so it is passed through.
+	if resp.StatusCode() != http.StatusOK || resp.IsStream() {
+		return false
+	}
+	return req.IfNoneMatch(resp.HTTPHeader().Get("ETag"))
+}
+
+// Handle sets the caching headers of the response according to the first
+// matching rule, and replaces the response with a 304 response if the
+// client already has it and conditional requests are enabled.
+func (cc *CacheControl) Handle(ctx *context.Context) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return ""
+	}
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	for _, r := range cc.spec.Rules {
+		if !r.match(req, resp) {
+			continue
+		}
+		if cc.apply(r, resp) {
+			atomic.AddInt64(&cc.numOfModified, 1)
+		}
+		break
+	}
+
+	if cc.spec.ConditionalRequests && notModified(req, resp) {
+		resp.HTTPHeader().Del("Content-Length")
+		resp.SetStatusCode(http.StatusNotModified)
+		resp.SetPayload(nil)
+		atomic.AddInt64(&cc.numOfNotModified, 1)
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (cc *CacheControl) Status() interface{} {
+	return &Status{
+		NumOfModified:    atomic.LoadInt64(&cc.numOfModified),
+		NumOfNotModified: atomic.LoadInt64(&cc.numOfNotModified),
+	}
+}
+
+// Close closes CacheControl.
+func (cc *CacheControl) Close() {}
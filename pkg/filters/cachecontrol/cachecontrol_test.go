@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cachecontrol
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createCacheControl(t *testing.T, yamlConfig string) *CacheControl {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	cc := kind.CreateInstance(spec).(*CacheControl)
+	cc.Init()
+	return cc
+}
+
+func newContext(t *testing.T, path string, code int, header http.Header, body string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	for k, v := range header {
+		resp.HTTPHeader()[k] = v
+	}
+	resp.SetPayload([]byte(body))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	ctx.SetOutputResponse(resp)
+	return ctx
+}
+
+const yamlConfig = `
+name: cache-control
+kind: CacheControl
+maxETagBodySize: 16
+rules:
+- statusCodes: [200]
+  pathPrefixes: ["/static/"]
+  cacheControl: public, max-age=86400
+  expires: 24h
+  etag: true
+  override: true
+- statusCodes: [200]
+  contentTypes: ["application/json"]
+  cacheControl: no-cache
+  etag: true
+`
+
+func TestCacheControl(t *testing.T) {
+	assert := assert.New(t)
+
+	cc := createCacheControl(t, yamlConfig)
+
+	// the first rule overrides existing headers.
+	ctx := newContext(t, "/static/a.js", http.StatusOK, http.Header{"Cache-Control": {"no-store"}}, "abc")
+	assert.Equal("", cc.Handle(ctx))
+	h := ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+	assert.Equal("public, max-age=86400", h.Get("Cache-Control"))
+	assert.Equal(computeETag([]byte("abc")), h.Get("ETag"))
+	expires, err := http.ParseTime(h.Get("Expires"))
+	assert.NoError(err)
+	assert.InDelta(24*time.Hour, time.Until(expires), float64(time.Minute))
+
+	// the second rule only sets absent headers.
+	ctx = newContext(t, "/api/users", http.StatusOK, http.Header{
+		"Content-Type": {"application/json; charset=utf-8"},
+		"Etag":         {`"v1"`},
+	}, "{}")
+	assert.Equal("", cc.Handle(ctx))
+	h = ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+	assert.Equal("no-cache", h.Get("Cache-Control"))
+	assert.Equal(`"v1"`, h.Get("ETag"))
+	assert.Equal("", h.Get("Expires"))
+
+	// the body is too large to compute the ETag.
+	ctx = newContext(t, "/api/users", http.StatusOK, http.Header{
+		"Content-Type": {"application/json"},
+	}, `{"name": "a large body"}`)
+	assert.Equal("", cc.Handle(ctx))
+	h = ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader()
+	assert.Equal("no-cache", h.Get("Cache-Control"))
+	assert.Equal("", h.Get("ETag"))
+
+	// no rule matches.
+	ctx = newContext(t, "/static/a.js", http.StatusNotFound, nil, "")
+	assert.Equal("", cc.Handle(ctx))
+	assert.Equal("", ctx.GetOutputResponse().(*httpprot.Response).HTTPHeader().Get("Cache-Control"))
+
+	// nothing is modified.
+	ctx = newContext(t, "/api/users", http.StatusOK, http.Header{
+		"Content-Type":  {"application/json"},
+		"Cache-Control": {"private"},
+		"Etag":          {`"v1"`},
+	}, "{}")
+	assert.Equal("", cc.Handle(ctx))
+
+	assert.Equal(int64(3), cc.Status().(*Status).NumOfModified)
+}
+
+func TestCacheControlConditionalRequests(t *testing.T) {
+	assert := assert.New(t)
+
+	cc := createCacheControl(t, yamlConfig+"conditionalRequests: true\n")
+
+	// the ETag computed by the filter matches.
+	ctx := newContext(t, "/static/a.js", http.StatusOK, nil, "abc")
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	req.HTTPHeader().Set("If-None-Match", computeETag([]byte("abc")))
+	assert.Equal("", cc.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusNotModified, resp.StatusCode())
+	assert.Equal(int64(0), resp.PayloadSize())
+	assert.Equal(computeETag([]byte("abc")), resp.HTTPHeader().Get("ETag"))
+
+	// the ETag of the backend matches.
+	ctx = newContext(t, "/api/users", http.StatusOK, http.Header{"Etag": {`"v1"`}}, "{}")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("If-None-Match", `W/"v1"`)
+	cc.Handle(ctx)
+	assert.Equal(http.StatusNotModified, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the ETag does not match.
+	ctx = newContext(t, "/api/users", http.StatusOK, http.Header{"Etag": {`"v2"`}}, "{}")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("If-None-Match", `"v1"`)
+	cc.Handle(ctx)
+	assert.Equal(http.StatusOK, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// only 200 responses are replaced.
+	ctx = newContext(t, "/api/users", http.StatusCreated, http.Header{"Etag": {`"v1"`}}, "{}")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("If-None-Match", `"v1"`)
+	cc.Handle(ctx)
+	assert.Equal(http.StatusCreated, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal(int64(2), cc.Status().(*Status).NumOfNotModified)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{Rules: []*Rule{{}}}).Validate())
+	assert.Error((&Spec{Rules: []*Rule{{ETag: true, Expires: "abc"}}}).Validate())
+	assert.Error((&Spec{Rules: []*Rule{{ETag: true, StatusCodes: []int{1000}}}}).Validate())
+	assert.NoError((&Spec{Rules: []*Rule{{CacheControl: "no-cache", StatusCodes: []int{200}}}}).Validate())
+}
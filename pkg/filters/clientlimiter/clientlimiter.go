@@ -0,0 +1,257 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientlimiter
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ClientLimiter.
+	Kind = "ClientLimiter"
+
+	defaultRetryAfter = 1
+	defaultMaxClients = 100000
+
+	// maxReportedClients is the max number of clients whose rejections
+	// are reported in status, rejections of other clients are reported
+	// under otherClients.
+	maxReportedClients = 100
+	otherClients       = "other"
+
+	resultLimited = "limited"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ClientLimiter limits the number of concurrent requests of each client.",
+	Results:     []string{resultLimited},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			RetryAfter: defaultRetryAfter,
+			MaxClients: defaultMaxClients,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ClientLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ClientLimiter is filter ClientLimiter.
+	ClientLimiter struct {
+		spec *Spec
+
+		lock       sync.Mutex
+		inflight   map[string]int
+		rejections map[string]int64
+
+		numOfRejected           int64
+		numOfRejectedByCapacity int64
+	}
+
+	// Spec describes the ClientLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxConcurrency int    `json:"maxConcurrency" jsonschema:"required,minimum=1"`
+		HeaderKey      string `json:"headerKey" jsonschema:"omitempty"`
+		RetryAfter     int    `json:"retryAfter" jsonschema:"omitempty"`
+		MaxClients     int    `json:"maxClients" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ClientLimiter.
+	Status struct {
+		Clients                 int              `json:"clients"`
+		NumOfRejected           int64            `json:"numOfRejected"`
+		NumOfRejectedByCapacity int64            `json:"numOfRejectedByCapacity"`
+		Rejections              map[string]int64 `json:"rejections"`
+	}
+)
+
+var _ filters.Filter = (*ClientLimiter)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.RetryAfter < 0 {
+		return fmt.Errorf("retryAfter must not be negative")
+	}
+	if spec.MaxClients < 0 {
+		return fmt.Errorf("maxClients must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name of the ClientLimiter filter instance.
+func (cl *ClientLimiter) Name() string {
+	return cl.spec.Name()
+}
+
+// Kind returns the kind of ClientLimiter.
+func (cl *ClientLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ClientLimiter
+func (cl *ClientLimiter) Spec() filters.Spec {
+	return cl.spec
+}
+
+// Init initializes ClientLimiter.
+func (cl *ClientLimiter) Init() {
+	cl.reload()
+}
+
+// Inherit inherits previous generation of ClientLimiter.
+//
+// Requests admitted by the previous generation are still counted by it,
+// the new generation starts with no inflight requests.
+func (cl *ClientLimiter) Inherit(previousGeneration filters.Filter) {
+	cl.reload()
+}
+
+func (cl *ClientLimiter) reload() {
+	cl.inflight = make(map[string]int)
+	cl.rejections = make(map[string]int64)
+}
+
+func (cl *ClientLimiter) maxClients() int {
+	if cl.spec.MaxClients == 0 {
+		return defaultMaxClients
+	}
+	return cl.spec.MaxClients
+}
+
+// clientID returns the identifier of the client, which is the value of
+// the header if headerKey is configured and the header is present, or the
+// real IP of the client otherwise.
+func (cl *ClientLimiter) clientID(req *httpprot.Request) string {
+	if cl.spec.HeaderKey != "" {
+		if v := req.HTTPHeader().Get(cl.spec.HeaderKey); v != "" {
+			return v
+		}
+	}
+	return req.RealIP()
+}
+
+// acquire acquires a slot for the client, an error is returned if the
+// client reaches its limit, or there are too many clients being tracked.
+//
+// Only clients with inflight requests are tracked, so the number of
+// tracked clients never exceeds the number of inflight requests, and
+// maxClients guards against the unlikely case of a flood of requests
+// from distinct clients.
+func (cl *ClientLimiter) acquire(id string) error {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	n, ok := cl.inflight[id]
+	switch {
+	case n >= cl.spec.MaxConcurrency:
+		cl.numOfRejected++
+		cl.recordRejection(id)
+		return fmt.Errorf("client %s reaches the concurrency limit", id)
+	case !ok && len(cl.inflight) >= cl.maxClients():
+		cl.numOfRejectedByCapacity++
+		return fmt.Errorf("too many clients")
+	}
+
+	cl.inflight[id] = n + 1
+	return nil
+}
+
+// release releases a slot of the client, the client is no longer tracked
+// when all of its slots are released.
+func (cl *ClientLimiter) release(id string) {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if n := cl.inflight[id]; n > 1 {
+		cl.inflight[id] = n - 1
+	} else {
+		delete(cl.inflight, id)
+	}
+}
+
+// recordRejection records a rejection of the client, the caller must hold
+// the lock.
+func (cl *ClientLimiter) recordRejection(id string) {
+	if _, ok := cl.rejections[id]; !ok && len(cl.rejections) >= maxReportedClients {
+		id = otherClients
+	}
+	cl.rejections[id]++
+}
+
+// Handle limits the concurrent requests of the client, the slot of the
+// request is released after the request is finished, no matter it
+// succeeds or not.
+func (cl *ClientLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	id := cl.clientID(req)
+
+	if err := cl.acquire(id); err != nil {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusTooManyRequests)
+		if cl.spec.RetryAfter > 0 {
+			resp.HTTPHeader().Set("Retry-After", strconv.Itoa(cl.spec.RetryAfter))
+		}
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("clientLimiter: " + err.Error())
+		return resultLimited
+	}
+
+	ctx.OnFinish(func() {
+		cl.release(id)
+	})
+	return ""
+}
+
+// Status returns status.
+func (cl *ClientLimiter) Status() interface{} {
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	s := &Status{
+		Clients:                 len(cl.inflight),
+		NumOfRejected:           cl.numOfRejected,
+		NumOfRejectedByCapacity: cl.numOfRejectedByCapacity,
+		Rejections:              make(map[string]int64, len(cl.rejections)),
+	}
+	for k, v := range cl.rejections {
+		s.Rejections[k] = v
+	}
+	return s
+}
+
+// Close closes ClientLimiter.
+func (cl *ClientLimiter) Close() {}
@@ -0,0 +1,141 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package clientlimiter
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createLimiter(t *testing.T, yamlConfig string) *ClientLimiter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	cl := kind.CreateInstance(spec).(*ClientLimiter)
+	cl.Init()
+	return cl
+}
+
+func newContext(t *testing.T, ip string, apiKey string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.RemoteAddr = ip + ":12345"
+	if apiKey != "" {
+		stdr.Header.Set("X-Api-Key", apiKey)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestClientLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	cl := createLimiter(t, `
+name: limiter
+kind: ClientLimiter
+maxConcurrency: 2
+headerKey: X-Api-Key
+retryAfter: 5
+`)
+
+	ctx1 := newContext(t, "10.0.0.1", "")
+	assert.Equal("", cl.Handle(ctx1))
+	ctx2 := newContext(t, "10.0.0.1", "")
+	assert.Equal("", cl.Handle(ctx2))
+
+	// the third request of the same client is rejected
+	ctx := newContext(t, "10.0.0.1", "")
+	assert.Equal(resultLimited, cl.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.Equal("5", resp.HTTPHeader().Get("Retry-After"))
+
+	// other clients are not affected, and the API key takes precedence
+	// over the IP
+	ctx3 := newContext(t, "10.0.0.1", "key")
+	assert.Equal("", cl.Handle(ctx3))
+	assert.Equal("", cl.Handle(newContext(t, "10.0.0.2", "")))
+
+	status := cl.Status().(*Status)
+	assert.Equal(3, status.Clients)
+	assert.Equal(int64(1), status.NumOfRejected)
+	assert.Equal(int64(1), status.Rejections["10.0.0.1"])
+
+	// the slot is released after the request is finished, and the client
+	// is no longer tracked after all its requests are finished
+	ctx1.Finish()
+	assert.Equal("", cl.Handle(newContext(t, "10.0.0.1", "")))
+	ctx3.Finish()
+	assert.Equal(2, cl.Status().(*Status).Clients)
+}
+
+func TestMaxClients(t *testing.T) {
+	assert := assert.New(t)
+
+	cl := createLimiter(t, `
+name: limiter
+kind: ClientLimiter
+maxConcurrency: 1
+maxClients: 2
+`)
+
+	ctx := newContext(t, "10.0.0.1", "")
+	assert.Equal("", cl.Handle(ctx))
+	assert.Equal("", cl.Handle(newContext(t, "10.0.0.2", "")))
+	assert.Equal(resultLimited, cl.Handle(newContext(t, "10.0.0.3", "")))
+	assert.Equal(int64(1), cl.Status().(*Status).NumOfRejectedByCapacity)
+
+	ctx.Finish()
+	assert.Equal("", cl.Handle(newContext(t, "10.0.0.3", "")))
+
+	// rejections of too many clients are reported together
+	for i := 0; i < maxReportedClients+10; i++ {
+		cl.recordRejection(fmt.Sprintf("client-%d", i))
+	}
+	status := cl.Status().(*Status)
+	assert.Len(status.Rejections, maxReportedClients+1)
+	assert.Equal(int64(10), status.Rejections[otherClients])
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{MaxConcurrency: 1, RetryAfter: -1}).Validate())
+	assert.Error((&Spec{MaxConcurrency: 1, MaxClients: -1}).Validate())
+	assert.NoError((&Spec{MaxConcurrency: 1}).Validate())
+}
@@ -0,0 +1,385 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package contentnegotiator implements the ContentNegotiator filter, which
+// transcodes responses to the representation accepted by clients.
+package contentnegotiator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of ContentNegotiator.
+	Kind = "ContentNegotiator"
+
+	typeJSON = "application/json"
+	typeXML  = "application/xml"
+	typeText = "text/xml"
+
+	defaultRootElement = "response"
+	defaultMaxBodySize = 4 * 1024 * 1024
+
+	resultNotAcceptable = "notAcceptable"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ContentNegotiator transcodes responses to the representation accepted by clients.",
+	Results:     []string{resultNotAcceptable},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Representations: []string{typeJSON, typeXML},
+			RootElement:     defaultRootElement,
+			MaxBodySize:     defaultMaxBodySize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ContentNegotiator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ContentNegotiator is filter ContentNegotiator.
+	ContentNegotiator struct {
+		spec *Spec
+
+		// counters of the representations, the map is read only after
+		// initialization.
+		served map[string]*int64
+
+		numOfNotAcceptable int64
+		numOfTranscoded    int64
+		numOfSkipped       int64
+		numOfFailed        int64
+	}
+
+	// Spec describes the ContentNegotiator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Representations []string `json:"representations" jsonschema:"omitempty,uniqueItems=true"`
+		RootElement     string   `json:"rootElement" jsonschema:"omitempty"`
+		MaxBodySize     int64    `json:"maxBodySize" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ContentNegotiator.
+	Status struct {
+		Representations    map[string]int64 `json:"representations"`
+		NumOfNotAcceptable int64            `json:"numOfNotAcceptable"`
+		NumOfTranscoded    int64            `json:"numOfTranscoded"`
+		NumOfSkipped       int64            `json:"numOfSkipped"`
+		NumOfFailed        int64            `json:"numOfFailed"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for _, r := range spec.Representations {
+		switch r {
+		case typeJSON, typeXML, typeText:
+		default:
+			return fmt.Errorf("unsupported representation %q", r)
+		}
+	}
+	if spec.RootElement != "" && !isValidName(spec.RootElement) {
+		return fmt.Errorf("invalid root element %q", spec.RootElement)
+	}
+	return nil
+}
+
+var _ filters.Filter = (*ContentNegotiator)(nil)
+
+// Name returns the name of the ContentNegotiator filter instance.
+func (cn *ContentNegotiator) Name() string {
+	return cn.spec.Name()
+}
+
+// Kind returns the kind of ContentNegotiator.
+func (cn *ContentNegotiator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ContentNegotiator
+func (cn *ContentNegotiator) Spec() filters.Spec {
+	return cn.spec
+}
+
+// Init initializes ContentNegotiator.
+func (cn *ContentNegotiator) Init() {
+	cn.reload()
+}
+
+// Inherit inherits previous generation of ContentNegotiator.
+func (cn *ContentNegotiator) Inherit(previousGeneration filters.Filter) {
+	cn.reload()
+}
+
+func (cn *ContentNegotiator) reload() {
+	cn.served = make(map[string]*int64, len(cn.representations()))
+	for _, r := range cn.representations() {
+		cn.served[r] = new(int64)
+	}
+}
+
+func (cn *ContentNegotiator) representations() []string {
+	if len(cn.spec.Representations) == 0 {
+		return []string{typeJSON, typeXML}
+	}
+	return cn.spec.Representations
+}
+
+func (cn *ContentNegotiator) rootElement() string {
+	if cn.spec.RootElement == "" {
+		return defaultRootElement
+	}
+	return cn.spec.RootElement
+}
+
+func (cn *ContentNegotiator) maxBodySize() int64 {
+	if cn.spec.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return cn.spec.MaxBodySize
+}
+
+// dataKey is the key of the context data to record the representation
+// chosen for the request, so that the filter knows the response should be
+// transcoded when it is called again.
+func (cn *ContentNegotiator) dataKey() string {
+	return "CONTENT_NEGOTIATOR/" + cn.Name()
+}
+
+// Handle chooses the representation of the response when it is called the
+// first time in a pipeline, and transcodes the response when it is called
+// again after the backend.
+func (cn *ContentNegotiator) Handle(ctx *context.Context) string {
+	if r, ok := ctx.GetData(cn.dataKey()).(string); ok {
+		cn.handleResponse(ctx, r)
+		return ""
+	}
+	return cn.handleRequest(ctx)
+}
+
+func (cn *ContentNegotiator) handleRequest(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	accept := strings.Join(req.HTTPHeader().Values("Accept"), ",")
+	r := negotiate(accept, cn.representations())
+	if r == "" {
+		atomic.AddInt64(&cn.numOfNotAcceptable, 1)
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusNotAcceptable)
+		resp.SetPayload([]byte("supported representations: " + strings.Join(cn.representations(), ", ")))
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("contentNegotiator: not acceptable")
+		return resultNotAcceptable
+	}
+
+	ctx.SetData(cn.dataKey(), r)
+	return ""
+}
+
+// negotiate returns the representation most preferred by the Accept header,
+// representations are preferred in their order if their qualities are the
+// same. The first representation is returned if the header is empty, and
+// an empty string is returned if none of them is acceptable.
+func negotiate(accept string, representations []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return representations[0]
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := "", 0.0
+	for _, r := range representations {
+		if q := quality(ranges, r); q > bestQ {
+			best, bestQ = r, q
+		}
+	}
+	return best
+}
+
+type mediaRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, item := range strings.Split(accept, ",") {
+		params := strings.Split(item, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok {
+			continue
+		}
+
+		mr := mediaRange{typ: strings.TrimSpace(typ), subtype: strings.TrimSpace(subtype), q: 1}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(p, "=")
+			if strings.TrimSpace(k) != "q" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q >= 0 && q <= 1 {
+				mr.q = q
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// quality returns the quality of the media type, which is the quality of
+// the most specific media range matching it.
+func quality(ranges []mediaRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+func mediaType(contentType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+}
+
+func isJSON(mt string) bool {
+	return mt == typeJSON || strings.HasSuffix(mt, "+json")
+}
+
+func isXML(mt string) bool {
+	return mt == typeXML || mt == typeText || strings.HasSuffix(mt, "+xml")
+}
+
+// readBody reads the body of the response, it returns false if the body
+// is larger than maxBodySize, and the response is left unchanged.
+func (cn *ContentNegotiator) readBody(resp *httpprot.Response) ([]byte, bool) {
+	if !resp.IsStream() {
+		body := resp.RawPayload()
+		return body, int64(len(body)) <= cn.maxBodySize()
+	}
+
+	stream := resp.GetPayload()
+	body, err := io.ReadAll(io.LimitReader(stream, cn.maxBodySize()+1))
+	if err == nil && int64(len(body)) <= cn.maxBodySize() {
+		return body, true
+	}
+
+	// put back the bytes read, so that the response is not changed.
+	resp.SetPayload(io.MultiReader(bytes.NewReader(body), stream))
+	return nil, false
+}
+
+func (cn *ContentNegotiator) handleResponse(ctx *context.Context, r string) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return
+	}
+
+	h := resp.HTTPHeader()
+	h.Add("Vary", "Accept")
+	atomic.AddInt64(cn.served[r], 1)
+
+	mt := mediaType(h.Get("Content-Type"))
+	toXML := isXML(r) && isJSON(mt)
+	toJSON := isJSON(r) && isXML(mt)
+	if !toXML && !toJSON {
+		if isXML(r) && isXML(mt) && mt != r {
+			h.Set("Content-Type", r+"; charset=utf-8")
+		}
+		return
+	}
+
+	if h.Get("Content-Encoding") != "" {
+		atomic.AddInt64(&cn.numOfSkipped, 1)
+		return
+	}
+
+	body, ok := cn.readBody(resp)
+	if !ok {
+		atomic.AddInt64(&cn.numOfSkipped, 1)
+		return
+	}
+
+	var data []byte
+	var err error
+	if toXML {
+		data, err = jsonToXML(body, cn.rootElement())
+	} else {
+		data, err = xmlToJSON(body)
+	}
+	if err != nil {
+		atomic.AddInt64(&cn.numOfFailed, 1)
+		resp.SetPayload(body)
+		ctx.AddTag(fmt.Sprintf("contentNegotiator: failed to transcode %s to %s: %v", mt, r, err))
+		return
+	}
+
+	resp.SetPayload(data)
+	resp.ContentLength = int64(len(data))
+	h.Set("Content-Type", r+"; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	atomic.AddInt64(&cn.numOfTranscoded, 1)
+}
+
+// Status returns status.
+func (cn *ContentNegotiator) Status() interface{} {
+	s := &Status{
+		Representations:    make(map[string]int64, len(cn.served)),
+		NumOfNotAcceptable: atomic.LoadInt64(&cn.numOfNotAcceptable),
+		NumOfTranscoded:    atomic.LoadInt64(&cn.numOfTranscoded),
+		NumOfSkipped:       atomic.LoadInt64(&cn.numOfSkipped),
+		NumOfFailed:        atomic.LoadInt64(&cn.numOfFailed),
+	}
+	for r, n := range cn.served {
+		s.Representations[r] = atomic.LoadInt64(n)
+	}
+	return s
+}
+
+// Close closes ContentNegotiator.
+func (cn *ContentNegotiator) Close() {}
@@ -0,0 +1,201 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contentnegotiator
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createContentNegotiator(t *testing.T, yamlConfig string) *ContentNegotiator {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	cn := kind.CreateInstance(spec).(*ContentNegotiator)
+	cn.Init()
+	return cn
+}
+
+func newContext(t *testing.T, accept string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/orders", nil)
+	if accept != "" {
+		stdr.Header.Set("Accept", accept)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func setResponse(ctx *context.Context, contentType string, body interface{}) *httpprot.Response {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", contentType)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func TestNegotiate(t *testing.T) {
+	assert := assert.New(t)
+
+	reps := []string{typeJSON, typeXML}
+	assert.Equal(typeJSON, negotiate("", reps))
+	assert.Equal(typeJSON, negotiate("*/*", reps))
+	assert.Equal(typeXML, negotiate("application/xml", reps))
+	assert.Equal(typeXML, negotiate("text/html, application/xml;q=0.9, */*;q=0.8", reps))
+	assert.Equal(typeJSON, negotiate("application/xml;q=0.5, application/*", reps))
+	assert.Equal(typeXML, negotiate("application/json;q=0, */*", reps))
+	assert.Equal(typeXML, negotiate("Application/XML", reps))
+	assert.Equal("", negotiate("text/html", reps))
+	assert.Equal("", negotiate("application/json;q=0", reps))
+	assert.Equal(typeText, negotiate("text/*", []string{typeJSON, typeText}))
+}
+
+func TestJSONToXML(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := jsonToXML([]byte(`{"id":1,"name":"a<b","tags":["x","y"],"@version":"2","none":null,"ok":true}`), "order")
+	assert.NoError(err)
+	assert.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<order version="2"><id>1</id><name>a&lt;b</name><none/><ok>true</ok><tags>x</tags><tags>y</tags></order>`, string(data))
+
+	data, err = jsonToXML([]byte(`[{"id":1},[2,3]]`), "orders")
+	assert.NoError(err)
+	assert.Equal(`<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<orders><item><id>1</id></item><item><item>2</item><item>3</item></item></orders>`, string(data))
+
+	_, err = jsonToXML([]byte(`{"1a":1}`), "order")
+	assert.Error(err)
+	_, err = jsonToXML([]byte(`{"@a":{"b":1}}`), "order")
+	assert.Error(err)
+	_, err = jsonToXML([]byte(`{`), "order")
+	assert.Error(err)
+}
+
+func TestXMLToJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := xmlToJSON([]byte(`<?xml version="1.0"?>
+<order xmlns="http://example.com" version="2">
+  <id>1</id>
+  <tags>x</tags>
+  <tags>y</tags>
+  <price currency="USD">10</price>
+</order>`))
+	assert.NoError(err)
+	assert.JSONEq(`{"@version":"2","id":"1","tags":["x","y"],"price":{"@currency":"USD","#text":"10"}}`, string(data))
+
+	_, err = xmlToJSON([]byte(``))
+	assert.Error(err)
+	_, err = xmlToJSON([]byte(`<a></a><b></b>`))
+	assert.Error(err)
+}
+
+func TestContentNegotiator(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: ContentNegotiator
+name: negotiator
+rootElement: order
+maxBodySize: 64
+`
+	cn := createContentNegotiator(t, yamlConfig)
+
+	// JSON to XML
+	ctx := newContext(t, "application/xml")
+	assert.Equal("", cn.Handle(ctx))
+	resp := setResponse(ctx, "application/json", []byte(`{"id":1}`))
+	assert.Equal("", cn.Handle(ctx))
+	assert.Equal("application/xml; charset=utf-8", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal("Accept", resp.HTTPHeader().Get("Vary"))
+	assert.Contains(string(resp.RawPayload()), "<order><id>1</id></order>")
+
+	// XML to JSON, from a stream
+	ctx = newContext(t, "application/json")
+	assert.Equal("", cn.Handle(ctx))
+	resp = setResponse(ctx, "text/xml", strings.NewReader(`<order><id>1</id></order>`))
+	assert.Equal("", cn.Handle(ctx))
+	assert.Equal("application/json; charset=utf-8", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal(`{"id":"1"}`, string(resp.RawPayload()))
+
+	// no transcoding needed
+	ctx = newContext(t, "")
+	assert.Equal("", cn.Handle(ctx))
+	resp = setResponse(ctx, "application/json", []byte(`{"id":1}`))
+	assert.Equal("", cn.Handle(ctx))
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+
+	// too large stream, passed through
+	body := `{"data":"` + strings.Repeat("a", 100) + `"}`
+	ctx = newContext(t, "application/xml")
+	assert.Equal("", cn.Handle(ctx))
+	resp = setResponse(ctx, "application/json", strings.NewReader(body))
+	assert.Equal("", cn.Handle(ctx))
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	data, _ := io.ReadAll(resp.GetPayload())
+	assert.Equal(body, string(data))
+
+	// invalid JSON
+	ctx = newContext(t, "application/xml")
+	assert.Equal("", cn.Handle(ctx))
+	resp = setResponse(ctx, "application/json", []byte(`{`))
+	assert.Equal("", cn.Handle(ctx))
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal(`{`, string(resp.RawPayload()))
+
+	// not acceptable
+	ctx = newContext(t, "text/html")
+	assert.Equal(resultNotAcceptable, cn.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusNotAcceptable, resp.StatusCode())
+
+	status := cn.Status().(*Status)
+	assert.Equal(map[string]int64{typeJSON: 2, typeXML: 3}, status.Representations)
+	assert.Equal(int64(1), status.NumOfNotAcceptable)
+	assert.Equal(int64(2), status.NumOfTranscoded)
+	assert.Equal(int64(1), status.NumOfSkipped)
+	assert.Equal(int64(1), status.NumOfFailed)
+
+	spec := &Spec{Representations: []string{"text/html"}}
+	assert.Error(spec.Validate())
+	spec = &Spec{RootElement: "1a"}
+	assert.Error(spec.Validate())
+	spec = &Spec{Representations: []string{typeText, typeJSON}, RootElement: "data"}
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,258 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contentnegotiator
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	// attributes are converted to object fields prefixed with attrPrefix,
+	// and the text of elements with attributes or children to textKey.
+	attrPrefix = "@"
+	textKey    = "#text"
+
+	// itemElement is the element name of the items of nested arrays.
+	itemElement = "item"
+)
+
+// xmlNode is a generic XML element.
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     strings.Builder
+}
+
+// isValidName reports whether s could be used as an XML element name.
+func isValidName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// jsonToXML converts the JSON document to an XML document whose root
+// element is root.
+func jsonToXML(data []byte, root string) ([]byte, error) {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(xml.Header)
+	if items, ok := v.([]interface{}); ok {
+		v = map[string]interface{}{itemElement: items}
+	}
+	if err := writeElement(buf, root, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeElement writes v as element name, objects are written as child
+// elements in the order of their keys, and arrays as repeated elements.
+func writeElement(buf *bytes.Buffer, name string, v interface{}) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid element name %q", name)
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if items, ok := item.([]interface{}); ok {
+				item = map[string]interface{}{itemElement: items}
+			}
+			if err := writeElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		buf.WriteString("<" + name + "/>")
+		return nil
+	case map[string]interface{}:
+		return writeObject(buf, name, v)
+	}
+
+	buf.WriteString("<" + name + ">")
+	writeText(buf, v)
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+func writeText(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		xml.EscapeText(buf, []byte(v))
+	case nil:
+	default:
+		// json.Number and bool
+		fmt.Fprint(buf, v)
+	}
+}
+
+func writeObject(buf *bytes.Buffer, name string, m map[string]interface{}) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf.WriteString("<" + name)
+	for _, k := range keys {
+		if !strings.HasPrefix(k, attrPrefix) {
+			continue
+		}
+		attr := strings.TrimPrefix(k, attrPrefix)
+		if !isValidName(attr) {
+			return fmt.Errorf("invalid attribute name %q", attr)
+		}
+		switch m[k].(type) {
+		case map[string]interface{}, []interface{}:
+			return fmt.Errorf("attribute %q is not a scalar", attr)
+		}
+		buf.WriteString(" " + attr + `="`)
+		writeText(buf, m[k])
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+
+	for _, k := range keys {
+		switch {
+		case strings.HasPrefix(k, attrPrefix):
+		case k == textKey:
+			writeText(buf, m[k])
+		default:
+			if err := writeElement(buf, k, m[k]); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+// xmlToJSON converts the XML document to a JSON document, the root element
+// is dropped.
+func xmlToJSON(data []byte) ([]byte, error) {
+	root, err := parseXML(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(root.toJSON())
+}
+
+// parseXML parses the XML document into a tree of xmlNode.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name.Local}
+			for _, attr := range t.Attr {
+				// namespace declarations are not part of the data
+				if attr.Name.Space != "xmlns" && attr.Name.Local != "xmlns" {
+					node.attrs = append(node.attrs, attr)
+				}
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			} else {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("empty document")
+	}
+	return root, nil
+}
+
+// toJSON converts the element to a JSON value, elements with attributes
+// or children are converted to objects, repeated children to arrays, and
+// others to strings.
+func (n *xmlNode) toJSON() interface{} {
+	text := strings.TrimSpace(n.text.String())
+	if len(n.children) == 0 && len(n.attrs) == 0 {
+		return text
+	}
+
+	m := make(map[string]interface{}, len(n.children)+len(n.attrs))
+	for _, attr := range n.attrs {
+		m[attrPrefix+attr.Name.Local] = attr.Value
+	}
+	if text != "" {
+		m[textKey] = text
+	}
+	for _, c := range n.children {
+		v := c.toJSON()
+		switch old := m[c.name].(type) {
+		case nil:
+			m[c.name] = v
+		case []interface{}:
+			m[c.name] = append(old, v)
+		default:
+			m[c.name] = []interface{}{old, v}
+		}
+	}
+	return m
+}
@@ -0,0 +1,278 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contenttype
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of ContentType.
+	Kind = "ContentType"
+
+	resultUnsupported = "unsupported"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ContentType normalizes the Content-Type of requests and validates it against allowlists.",
+	Results:     []string{resultUnsupported},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ContentType{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ContentType is filter ContentType.
+	ContentType struct {
+		spec *Spec
+
+		numOfNormalized int64
+		numOfRejected   int64
+	}
+
+	// Spec describes the ContentType.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		DefaultType string  `json:"defaultType" jsonschema:"omitempty"`
+		Rules       []*Rule `json:"rules" jsonschema:"omitempty"`
+	}
+
+	// Rule is the allowlist of media types of the requests matching the
+	// methods and path prefixes.
+	Rule struct {
+		Methods      []string `json:"methods" jsonschema:"omitempty,uniqueItems=true,format=httpmethod-array"`
+		PathPrefixes []string `json:"pathPrefixes" jsonschema:"omitempty"`
+		Types        []string `json:"types" jsonschema:"required,minItems=1"`
+	}
+
+	// Status is the status of ContentType.
+	Status struct {
+		NumOfNormalized int64 `json:"numOfNormalized"`
+		NumOfRejected   int64 `json:"numOfRejected"`
+	}
+)
+
+var _ filters.Filter = (*ContentType)(nil)
+
+// validateMediaType validates a media type of the allowlist, the subtype
+// could be '*', and the type could be '*' only if the subtype is '*'.
+func validateMediaType(t string) error {
+	mt, params, err := mime.ParseMediaType(t)
+	if err != nil {
+		return fmt.Errorf("invalid media type %q: %v", t, err)
+	}
+	if len(params) > 0 {
+		return fmt.Errorf("media type %q should not have parameters", t)
+	}
+	parts := strings.Split(mt, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid media type %q", t)
+	}
+	if parts[0] == "*" && parts[1] != "*" {
+		return fmt.Errorf("invalid media type %q", t)
+	}
+	return nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.DefaultType != "" {
+		if _, err := normalize(spec.DefaultType); err != nil {
+			return fmt.Errorf("invalid defaultType: %v", err)
+		}
+	}
+	for i, rule := range spec.Rules {
+		if len(rule.Types) == 0 {
+			return fmt.Errorf("rule %d: types must not be empty", i)
+		}
+		for _, t := range rule.Types {
+			if err := validateMediaType(t); err != nil {
+				return fmt.Errorf("rule %d: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// normalize parses the content type, and returns it with the media type,
+// the parameter names and the charset in lower case.
+func normalize(ct string) (string, error) {
+	mt, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return "", err
+	}
+	if !strings.Contains(mt, "/") {
+		return "", fmt.Errorf("invalid media type %q", mt)
+	}
+	if cs, ok := params["charset"]; ok {
+		params["charset"] = strings.ToLower(cs)
+	}
+	return mime.FormatMediaType(mt, params), nil
+}
+
+func (rule *Rule) match(req *httpprot.Request) bool {
+	if len(rule.Methods) > 0 && !stringtool.StrInSlice(req.Method(), rule.Methods) {
+		return false
+	}
+	if len(rule.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range rule.PathPrefixes {
+		if strings.HasPrefix(req.Path(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allow reports whether the media type is allowed by the rule. Besides
+// exact match, 'type/*' matches all subtypes of the type, and
+// 'type/*+suffix' matches all subtypes with the structured syntax suffix.
+func (rule *Rule) allow(mt string) bool {
+	for _, t := range rule.Types {
+		t = strings.ToLower(t)
+		if t == mt || t == "*/*" {
+			return true
+		}
+		idx := strings.Index(t, "/*")
+		if idx < 0 || !strings.HasPrefix(mt, t[:idx+1]) {
+			continue
+		}
+		suffix := t[idx+2:]
+		if suffix == "" || strings.HasPrefix(suffix, "+") && strings.HasSuffix(mt, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Name returns the name of the ContentType filter instance.
+func (c *ContentType) Name() string {
+	return c.spec.Name()
+}
+
+// Kind returns the kind of ContentType.
+func (c *ContentType) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ContentType
+func (c *ContentType) Spec() filters.Spec {
+	return c.spec
+}
+
+// Init initializes ContentType.
+func (c *ContentType) Init() {
+}
+
+// Inherit inherits previous generation of ContentType.
+func (c *ContentType) Inherit(previousGeneration filters.Filter) {
+}
+
+func hasBody(req *httpprot.Request) bool {
+	stdr := req.Std()
+	return stdr.ContentLength != 0 || len(stdr.TransferEncoding) > 0
+}
+
+func (c *ContentType) reject(ctx *context.Context, reason string) string {
+	atomic.AddInt64(&c.numOfRejected, 1)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusUnsupportedMediaType)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("contentType: " + reason)
+	return resultUnsupported
+}
+
+// Handle normalizes the Content-Type of the request, and validates it
+// against the first rule matching the request.
+func (c *ContentType) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	h := req.HTTPHeader()
+
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		// requests without a body don't need a content type.
+		if !hasBody(req) {
+			return ""
+		}
+		ct = c.spec.DefaultType
+	}
+
+	var rule *Rule
+	for _, r := range c.spec.Rules {
+		if r.match(req) {
+			rule = r
+			break
+		}
+	}
+
+	if ct == "" {
+		if rule == nil {
+			return ""
+		}
+		return c.reject(ctx, "missing content type")
+	}
+
+	normalized, err := normalize(ct)
+	if err != nil {
+		return c.reject(ctx, fmt.Sprintf("invalid content type %q", ct))
+	}
+
+	mt, _, _ := mime.ParseMediaType(normalized)
+	if rule != nil && !rule.allow(mt) {
+		return c.reject(ctx, fmt.Sprintf("content type %q is not allowed", mt))
+	}
+
+	if normalized != h.Get("Content-Type") {
+		atomic.AddInt64(&c.numOfNormalized, 1)
+		h.Set("Content-Type", normalized)
+	}
+	return ""
+}
+
+// Status returns status.
+func (c *ContentType) Status() interface{} {
+	return &Status{
+		NumOfNormalized: atomic.LoadInt64(&c.numOfNormalized),
+		NumOfRejected:   atomic.LoadInt64(&c.numOfRejected),
+	}
+}
+
+// Close closes ContentType.
+func (c *ContentType) Close() {}
@@ -0,0 +1,168 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package contenttype
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createContentType(t *testing.T, yamlConfig string) *ContentType {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	c := kind.CreateInstance(spec).(*ContentType)
+	c.Init()
+	return c
+}
+
+func handle(t *testing.T, c *ContentType, method, path, ct string, body string) (string, *context.Context) {
+	stdr, _ := http.NewRequest(method, "http://example.com"+path, strings.NewReader(body))
+	if ct != "" {
+		stdr.Header.Set("Content-Type", ct)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return c.Handle(ctx), ctx
+}
+
+func contentType(ctx *context.Context) string {
+	return ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("Content-Type")
+}
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+
+	for ct, expected := range map[string]string{
+		"application/json":                    "application/json",
+		"Application/JSON; Charset=UTF-8":     "application/json; charset=utf-8",
+		"text/plain;charset=\"ISO-8859-1\"":   "text/plain; charset=iso-8859-1",
+		"multipart/form-data; boundary=AbCd;": "multipart/form-data; boundary=AbCd",
+	} {
+		normalized, err := normalize(ct)
+		assert.NoError(err)
+		assert.Equal(expected, normalized)
+	}
+
+	for _, ct := range []string{"json", "application/json; charset", ";"} {
+		_, err := normalize(ct)
+		assert.Error(err, ct)
+	}
+}
+
+func TestContentType(t *testing.T) {
+	assert := assert.New(t)
+
+	c := createContentType(t, `
+name: ct
+kind: ContentType
+rules:
+- methods: [POST, PUT]
+  pathPrefixes: [/api/]
+  types: [application/json, "application/*+json"]
+- pathPrefixes: [/upload/]
+  types: ["image/*", multipart/form-data]
+`)
+
+	result, ctx := handle(t, c, http.MethodPost, "/api/users", "Application/JSON;charset=UTF-8", "{}")
+	assert.Equal("", result)
+	assert.Equal("application/json; charset=utf-8", contentType(ctx))
+
+	result, ctx = handle(t, c, http.MethodPost, "/api/users", "text/plain", "{}")
+	assert.Equal(resultUnsupported, result)
+	assert.Equal(http.StatusUnsupportedMediaType, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	result, _ = handle(t, c, http.MethodPost, "/api/users", "application/vnd.api+json", "{}")
+	assert.Equal("", result)
+	result, _ = handle(t, c, http.MethodPost, "/api/users", "application/vnd.api+xml", "{}")
+	assert.Equal(resultUnsupported, result)
+
+	// missing content type
+	result, _ = handle(t, c, http.MethodPut, "/api/users", "", "{}")
+	assert.Equal(resultUnsupported, result)
+
+	// requests without a body are not checked
+	result, _ = handle(t, c, http.MethodPost, "/api/users", "", "")
+	assert.Equal("", result)
+
+	// wildcards
+	result, _ = handle(t, c, http.MethodPost, "/upload/a", "image/PNG", "x")
+	assert.Equal("", result)
+	result, _ = handle(t, c, http.MethodPost, "/upload/a", "application/json", "{}")
+	assert.Equal(resultUnsupported, result)
+
+	// invalid content type
+	result, _ = handle(t, c, http.MethodPost, "/other", "json", "{}")
+	assert.Equal(resultUnsupported, result)
+
+	// no rule matches
+	result, ctx = handle(t, c, http.MethodPost, "/other", "TEXT/Plain", "x")
+	assert.Equal("", result)
+	assert.Equal("text/plain", contentType(ctx))
+
+	status := c.Status().(*Status)
+	assert.Equal(int64(3), status.NumOfNormalized)
+	assert.Equal(int64(5), status.NumOfRejected)
+}
+
+func TestDefaultType(t *testing.T) {
+	assert := assert.New(t)
+
+	c := createContentType(t, `
+name: ct
+kind: ContentType
+defaultType: application/json
+rules:
+- types: [application/json]
+`)
+
+	result, ctx := handle(t, c, http.MethodPost, "/api/users", "", "{}")
+	assert.Equal("", result)
+	assert.Equal("application/json", contentType(ctx))
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{DefaultType: "json"}).Validate())
+	assert.Error((&Spec{Rules: []*Rule{{}}}).Validate())
+	for _, mt := range []string{"json", "*/json", "application/json; charset=utf-8", "/json"} {
+		assert.Error((&Spec{Rules: []*Rule{{Types: []string{mt}}}}).Validate(), mt)
+	}
+	assert.NoError((&Spec{Rules: []*Rule{{Types: []string{"*/*", "text/*", "application/json"}}}}).Validate())
+}
@@ -0,0 +1,229 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package correlationid implements the CorrelationID filter, which makes
+// sure every request has a correlation ID.
+package correlationid
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// Kind is the kind of CorrelationID.
+	Kind = "CorrelationID"
+
+	// DataKey is the key of the context data of the correlation ID.
+	DataKey = "CORRELATION_ID"
+
+	generatorUUID  = "uuid"
+	generatorFlake = "flake"
+
+	defaultHeader = "X-Correlation-Id"
+
+	// maxIDLength is the max length of an inbound correlation ID, longer
+	// ones are replaced.
+	maxIDLength = 128
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CorrelationID makes sure every request has a correlation ID, and propagates it to the backend.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Headers:   []string{defaultHeader},
+			Generator: generatorUUID,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CorrelationID{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CorrelationID is filter CorrelationID.
+	CorrelationID struct {
+		spec  *Spec
+		flake *flake
+
+		numOfGenerated  int64
+		numOfPropagated int64
+		numOfReplaced   int64
+	}
+
+	// Spec describes the CorrelationID.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Headers   []string `json:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		Generator string   `json:"generator" jsonschema:"omitempty,enum=,enum=uuid,enum=flake"`
+		NodeID    int64    `json:"nodeId" jsonschema:"omitempty,minimum=0,maximum=1023"`
+	}
+
+	// Status is the status of CorrelationID.
+	Status struct {
+		NumOfGenerated  int64 `json:"numOfGenerated"`
+		NumOfPropagated int64 `json:"numOfPropagated"`
+		NumOfReplaced   int64 `json:"numOfReplaced"`
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for _, h := range spec.Headers {
+		if h == "" {
+			return fmt.Errorf("empty header name")
+		}
+	}
+	return nil
+}
+
+var _ filters.Filter = (*CorrelationID)(nil)
+
+// Name returns the name of the CorrelationID filter instance.
+func (ci *CorrelationID) Name() string {
+	return ci.spec.Name()
+}
+
+// Kind returns the kind of CorrelationID.
+func (ci *CorrelationID) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CorrelationID
+func (ci *CorrelationID) Spec() filters.Spec {
+	return ci.spec
+}
+
+// Init initializes CorrelationID.
+func (ci *CorrelationID) Init() {
+	if ci.spec.Generator == generatorFlake {
+		ci.flake = newFlake(ci.spec.NodeID)
+	}
+}
+
+// Inherit inherits previous generation of CorrelationID.
+func (ci *CorrelationID) Inherit(previousGeneration filters.Filter) {
+	ci.Init()
+
+	// take over the flake generator, so that no duplicated IDs are
+	// generated in the same millisecond.
+	prev := previousGeneration.(*CorrelationID)
+	if ci.flake != nil && prev.flake != nil && prev.flake.node == ci.flake.node {
+		ci.flake = prev.flake
+	}
+}
+
+func (ci *CorrelationID) headers() []string {
+	if len(ci.spec.Headers) == 0 {
+		return []string{defaultHeader}
+	}
+	return ci.spec.Headers
+}
+
+func (ci *CorrelationID) generate() string {
+	if ci.flake != nil {
+		return ci.flake.next()
+	}
+	return uuid.NewString()
+}
+
+// isValidID reports whether the inbound correlation ID could be
+// propagated, it must be a short string of visible ASCII characters.
+func isValidID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Handle makes sure the request has a correlation ID.
+func (ci *CorrelationID) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	h := req.HTTPHeader()
+	headers := ci.headers()
+
+	id := ""
+	for _, name := range headers {
+		if v := h.Get(name); v != "" {
+			id = v
+			break
+		}
+	}
+
+	switch {
+	case isValidID(id):
+		atomic.AddInt64(&ci.numOfPropagated, 1)
+	case id == "":
+		id = ci.generate()
+		atomic.AddInt64(&ci.numOfGenerated, 1)
+	default:
+		id = ci.generate()
+		atomic.AddInt64(&ci.numOfReplaced, 1)
+	}
+
+	// the first header is the one propagated to the backend.
+	h.Set(headers[0], id)
+	ctx.SetData(DataKey, id)
+
+	// echo the ID to the client, the header is set to the response writer,
+	// so that it is echoed no matter which filter builds the response.
+	if w, ok := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter); ok {
+		w.Header().Set(headers[0], id)
+	}
+
+	// link the correlation ID and the trace ID.
+	span := ctx.Span()
+	if !span.IsNoop() {
+		span.SetAttributes(attribute.String("correlation.id", id))
+		ctx.AddTag("correlationID: " + id + ", traceID: " + span.SpanContext().TraceID().String())
+	} else {
+		ctx.AddTag("correlationID: " + id)
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (ci *CorrelationID) Status() interface{} {
+	return &Status{
+		NumOfGenerated:  atomic.LoadInt64(&ci.numOfGenerated),
+		NumOfPropagated: atomic.LoadInt64(&ci.numOfPropagated),
+		NumOfReplaced:   atomic.LoadInt64(&ci.numOfReplaced),
+	}
+}
+
+// Close closes CorrelationID.
+func (ci *CorrelationID) Close() {}
@@ -0,0 +1,175 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package correlationid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createCorrelationID(t *testing.T, yamlConfig string, prev *CorrelationID) *CorrelationID {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ci := kind.CreateInstance(spec).(*CorrelationID)
+	if prev == nil {
+		ci.Init()
+	} else {
+		ci.Inherit(prev)
+	}
+	return ci
+}
+
+func newContext(t *testing.T, header http.Header) (*context.Context, *httptest.ResponseRecorder) {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetInputRequest(req)
+	ctx.SetData("HTTP_RESPONSE_WRITER", w)
+	return ctx, w
+}
+
+func TestCorrelationID(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: CorrelationID
+name: correlation
+headers: ["X-Correlation-Id", "X-Request-Id"]
+`
+	ci := createCorrelationID(t, yamlConfig, nil)
+
+	// generated
+	ctx, w := newContext(t, nil)
+	assert.Equal("", ci.Handle(ctx))
+	id := ctx.GetData(DataKey).(string)
+	assert.Len(id, 36)
+	assert.Equal(id, ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Correlation-Id"))
+	assert.Equal(id, w.Header().Get("X-Correlation-Id"))
+	assert.Contains(ctx.Tags(), "correlationID: "+id)
+
+	// propagated from the second header
+	ctx, w = newContext(t, http.Header{"X-Request-Id": {"req-1"}})
+	assert.Equal("", ci.Handle(ctx))
+	assert.Equal("req-1", ctx.GetData(DataKey))
+	assert.Equal("req-1", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Correlation-Id"))
+	assert.Equal("req-1", w.Header().Get("X-Correlation-Id"))
+
+	// the first header takes precedence
+	ctx, _ = newContext(t, http.Header{"X-Request-Id": {"req-1"}, "X-Correlation-Id": {"cor-1"}})
+	assert.Equal("", ci.Handle(ctx))
+	assert.Equal("cor-1", ctx.GetData(DataKey))
+
+	// invalid ones are replaced
+	ctx, _ = newContext(t, http.Header{"X-Correlation-Id": {strings.Repeat("a", 200)}})
+	assert.Equal("", ci.Handle(ctx))
+	assert.Len(ctx.GetData(DataKey), 36)
+	ctx, _ = newContext(t, http.Header{"X-Correlation-Id": {"a b"}})
+	assert.Equal("", ci.Handle(ctx))
+	assert.Len(ctx.GetData(DataKey), 36)
+
+	status := ci.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfGenerated)
+	assert.Equal(int64(2), status.NumOfPropagated)
+	assert.Equal(int64(2), status.NumOfReplaced)
+
+	// flake
+	const flakeConfig = `
+kind: CorrelationID
+name: correlation
+generator: flake
+nodeId: 5
+`
+	ci = createCorrelationID(t, flakeConfig, nil)
+	prevFlake := ci.flake
+	ci = createCorrelationID(t, flakeConfig, ci)
+	assert.Same(prevFlake, ci.flake)
+
+	ctx, w = newContext(t, nil)
+	assert.Equal("", ci.Handle(ctx))
+	id = w.Header().Get("X-Correlation-Id")
+	n, err := strconv.ParseInt(id, 10, 64)
+	assert.NoError(err)
+	assert.Equal(int64(5), n>>flakeSequenceBits&(1<<flakeNodeBits-1))
+}
+
+func TestFlake(t *testing.T) {
+	assert := assert.New(t)
+
+	f := newFlake(1)
+	now := flakeEpoch.Add(time.Hour)
+	var lock sync.Mutex
+	f.now = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+
+	ids := map[string]bool{}
+	for i := 0; i <= flakeMaxSequence; i++ {
+		ids[f.next()] = true
+	}
+	assert.Len(ids, flakeMaxSequence+1)
+
+	// the sequence is exhausted, wait for the next millisecond.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		lock.Lock()
+		now = now.Add(time.Millisecond)
+		lock.Unlock()
+	}()
+	id, _ := strconv.ParseInt(f.next(), 10, 64)
+	assert.Equal(time.Hour.Milliseconds()+1, id>>(flakeNodeBits+flakeSequenceBits))
+	assert.Equal(int64(0), id&flakeMaxSequence)
+
+	// the clock moves backwards.
+	lock.Lock()
+	now = now.Add(-time.Second)
+	lock.Unlock()
+	prev := id
+	id, _ = strconv.ParseInt(f.next(), 10, 64)
+	assert.Greater(id, prev)
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package correlationid
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	flakeNodeBits     = 10
+	flakeSequenceBits = 12
+	flakeMaxSequence  = 1<<flakeSequenceBits - 1
+)
+
+// flakeEpoch is the epoch of flake IDs, 2022-01-01T00:00:00Z.
+var flakeEpoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// flake generates roughly time ordered 64 bits IDs, which consist of a 41
+// bits timestamp in milliseconds since flakeEpoch, a 10 bits node ID and a
+// 12 bits sequence number.
+type flake struct {
+	lock     sync.Mutex
+	node     int64
+	lastTime int64
+	sequence int64
+	now      func() time.Time
+}
+
+func newFlake(node int64) *flake {
+	return &flake{node: node & (1<<flakeNodeBits - 1), now: time.Now}
+}
+
+func (f *flake) millis() int64 {
+	return f.now().Sub(flakeEpoch).Milliseconds()
+}
+
+func (f *flake) next() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ms := f.millis()
+	// the clock moves backwards, keep using the last time to avoid
+	// duplicated IDs.
+	if ms < f.lastTime {
+		ms = f.lastTime
+	}
+
+	if ms == f.lastTime {
+		f.sequence = (f.sequence + 1) & flakeMaxSequence
+		// the sequence is exhausted, wait for the next millisecond.
+		if f.sequence == 0 {
+			for ms <= f.lastTime {
+				time.Sleep(100 * time.Microsecond)
+				ms = f.millis()
+			}
+		}
+	} else {
+		f.sequence = 0
+	}
+	f.lastTime = ms
+
+	id := ms<<(flakeNodeBits+flakeSequenceBits) | f.node<<flakeSequenceBits | f.sequence
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,351 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package costquota
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of CostQuota.
+	Kind = "CostQuota"
+
+	defaultDefaultCost = 1
+	defaultPeriod      = time.Minute
+	defaultMaxClients  = 100000
+
+	// maxReportedClients is the max number of clients reported in status,
+	// clients consumed the most are reported.
+	maxReportedClients = 100
+
+	resultExhausted = "exhausted"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "CostQuota limits the cost units consumed by each client in a period.",
+	Results:     []string{resultExhausted},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			DefaultCost: defaultDefaultCost,
+			Period:      defaultPeriod.String(),
+			MaxClients:  defaultMaxClients,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &CostQuota{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// CostQuota is filter CostQuota.
+	CostQuota struct {
+		spec   *Spec
+		period time.Duration
+
+		state *state
+	}
+
+	// Spec describes the CostQuota.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Budget      int64   `json:"budget" jsonschema:"required,minimum=1"`
+		Period      string  `json:"period" jsonschema:"omitempty,format=duration"`
+		DefaultCost int64   `json:"defaultCost" jsonschema:"omitempty,minimum=0"`
+		Costs       []*Cost `json:"costs" jsonschema:"omitempty"`
+		HeaderKey   string  `json:"headerKey" jsonschema:"omitempty"`
+		MaxClients  int     `json:"maxClients" jsonschema:"omitempty"`
+	}
+
+	// Cost defines the cost of requests matching a URL pattern.
+	Cost struct {
+		urlrule.URLRule `json:",inline"`
+		Cost            int64 `json:"cost" jsonschema:"minimum=0"`
+	}
+
+	// Status is the status of CostQuota.
+	Status struct {
+		Clients                 int            `json:"clients"`
+		NumOfRejected           int64          `json:"numOfRejected"`
+		NumOfRejectedByCapacity int64          `json:"numOfRejectedByCapacity"`
+		Consumption             []*Consumption `json:"consumption"`
+	}
+
+	// Consumption is the cost consumption of a client.
+	Consumption struct {
+		Client      string    `json:"client"`
+		WindowStart time.Time `json:"windowStart"`
+		Consumed    int64     `json:"consumed"`
+		Remaining   int64     `json:"remaining"`
+		Total       int64     `json:"total"`
+		Rejected    int64     `json:"rejected"`
+	}
+
+	// state is the quota state of the clients, it is shared between
+	// generations of the filter, so that the consumption is kept when the
+	// costs or budget is updated.
+	state struct {
+		lock    sync.Mutex
+		clients map[string]*usage
+
+		numOfRejected           int64
+		numOfRejectedByCapacity int64
+	}
+
+	usage struct {
+		windowStart time.Time
+		consumed    int64
+		total       int64
+		rejected    int64
+	}
+)
+
+var _ filters.Filter = (*CostQuota)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.Period != "" {
+		d, err := time.ParseDuration(spec.Period)
+		if err != nil {
+			return fmt.Errorf("invalid period: %v", err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("period must be positive")
+		}
+	}
+	if spec.DefaultCost < 0 {
+		return fmt.Errorf("defaultCost must not be negative")
+	}
+	if spec.MaxClients < 0 {
+		return fmt.Errorf("maxClients must not be negative")
+	}
+	for i, c := range spec.Costs {
+		if err := c.URL.Validate(); err != nil {
+			return fmt.Errorf("costs[%d]: %v", i, err)
+		}
+		if c.Cost < 0 {
+			return fmt.Errorf("costs[%d]: cost must not be negative", i)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the CostQuota filter instance.
+func (cq *CostQuota) Name() string {
+	return cq.spec.Name()
+}
+
+// Kind returns the kind of CostQuota.
+func (cq *CostQuota) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the CostQuota
+func (cq *CostQuota) Spec() filters.Spec {
+	return cq.spec
+}
+
+// Init initializes CostQuota.
+func (cq *CostQuota) Init() {
+	cq.state = &state{clients: make(map[string]*usage)}
+	cq.reload()
+}
+
+// Inherit inherits previous generation of CostQuota.
+//
+// The quota state is taken over from the previous generation, so clients
+// keep their consumption in the current period, and the new costs and
+// budget take effect immediately.
+func (cq *CostQuota) Inherit(previousGeneration filters.Filter) {
+	cq.state = previousGeneration.(*CostQuota).state
+	cq.reload()
+}
+
+func (cq *CostQuota) reload() {
+	cq.period = defaultPeriod
+	if cq.spec.Period != "" {
+		cq.period, _ = time.ParseDuration(cq.spec.Period)
+	}
+	for _, c := range cq.spec.Costs {
+		c.Init()
+	}
+}
+
+func (cq *CostQuota) maxClients() int {
+	if cq.spec.MaxClients == 0 {
+		return defaultMaxClients
+	}
+	return cq.spec.MaxClients
+}
+
+// clientID returns the identifier of the client, which is the value of
+// the header if headerKey is configured and the header is present, or the
+// real IP of the client otherwise.
+func (cq *CostQuota) clientID(req *httpprot.Request) string {
+	if cq.spec.HeaderKey != "" {
+		if v := req.HTTPHeader().Get(cq.spec.HeaderKey); v != "" {
+			return v
+		}
+	}
+	return req.RealIP()
+}
+
+// cost returns the cost of the request, which is the cost of the first
+// matching rule, or the default cost if no rule matches.
+func (cq *CostQuota) cost(req *httpprot.Request) int64 {
+	for _, c := range cq.spec.Costs {
+		if c.Match(req.Std()) {
+			return c.Cost
+		}
+	}
+	return cq.spec.DefaultCost
+}
+
+// consume consumes cost units from the budget of the client. If the
+// budget is exhausted, an error is returned together with the duration
+// until the budget is refilled.
+func (cq *CostQuota) consume(id string, cost int64, now time.Time) (time.Duration, error) {
+	s := cq.state
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	u := s.clients[id]
+	if u == nil {
+		if len(s.clients) >= cq.maxClients() {
+			s.evictExpired(now, cq.period)
+		}
+		if len(s.clients) >= cq.maxClients() {
+			s.numOfRejectedByCapacity++
+			return cq.period, fmt.Errorf("too many clients")
+		}
+		u = &usage{windowStart: now}
+		s.clients[id] = u
+	} else if now.Sub(u.windowStart) >= cq.period {
+		u.windowStart = now
+		u.consumed = 0
+	}
+
+	if u.consumed+cost > cq.spec.Budget {
+		u.rejected++
+		s.numOfRejected++
+		return u.windowStart.Add(cq.period).Sub(now), fmt.Errorf("client %s exhausts its budget", id)
+	}
+
+	u.consumed += cost
+	u.total += cost
+	return 0, nil
+}
+
+// evictExpired removes clients whose period has passed, the caller must
+// hold the lock.
+func (s *state) evictExpired(now time.Time, period time.Duration) {
+	for id, u := range s.clients {
+		if now.Sub(u.windowStart) >= period {
+			delete(s.clients, id)
+		}
+	}
+}
+
+// Handle consumes the cost of the request from the budget of the client,
+// and rejects the request if the budget is exhausted.
+func (cq *CostQuota) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	id := cq.clientID(req)
+
+	wait, err := cq.consume(id, cq.cost(req), time.Now())
+	if err == nil {
+		return ""
+	}
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusTooManyRequests)
+	retryAfter := int((wait + time.Second - 1) / time.Second)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	resp.HTTPHeader().Set("Retry-After", strconv.Itoa(retryAfter))
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("costQuota: " + err.Error())
+	return resultExhausted
+}
+
+// Status returns status.
+func (cq *CostQuota) Status() interface{} {
+	s := cq.state
+	now := time.Now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	status := &Status{
+		Clients:                 len(s.clients),
+		NumOfRejected:           s.numOfRejected,
+		NumOfRejectedByCapacity: s.numOfRejectedByCapacity,
+		Consumption:             make([]*Consumption, 0, len(s.clients)),
+	}
+	for id, u := range s.clients {
+		c := &Consumption{
+			Client:      id,
+			WindowStart: u.windowStart,
+			Consumed:    u.consumed,
+			Total:       u.total,
+			Rejected:    u.rejected,
+		}
+		if now.Sub(u.windowStart) >= cq.period {
+			c.Consumed = 0
+		}
+		if c.Remaining = cq.spec.Budget - c.Consumed; c.Remaining < 0 {
+			c.Remaining = 0
+		}
+		status.Consumption = append(status.Consumption, c)
+	}
+
+	sort.Slice(status.Consumption, func(i, j int) bool {
+		ci, cj := status.Consumption[i], status.Consumption[j]
+		if ci.Consumed != cj.Consumed {
+			return ci.Consumed > cj.Consumed
+		}
+		return ci.Client < cj.Client
+	})
+	if len(status.Consumption) > maxReportedClients {
+		status.Consumption = status.Consumption[:maxReportedClients]
+	}
+	return status
+}
+
+// Close closes CostQuota.
+func (cq *CostQuota) Close() {}
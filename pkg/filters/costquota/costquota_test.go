@@ -0,0 +1,186 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package costquota
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createQuota(t *testing.T, yamlConfig string, prev *CostQuota) *CostQuota {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	cq := kind.CreateInstance(spec).(*CostQuota)
+	if prev == nil {
+		cq.Init()
+	} else {
+		cq.Inherit(prev)
+	}
+	return cq
+}
+
+func newContext(t *testing.T, method, path, apiKey string) *context.Context {
+	stdr, _ := http.NewRequest(method, "http://example.com"+path, nil)
+	stdr.RemoteAddr = "10.0.0.1:12345"
+	if apiKey != "" {
+		stdr.Header.Set("X-Api-Key", apiKey)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const yamlConfig = `
+name: quota
+kind: CostQuota
+budget: 10
+period: 1h
+headerKey: X-Api-Key
+costs:
+- methods: [POST]
+  url:
+    prefix: /reports
+  cost: 5
+- url:
+    exact: /health
+  cost: 0
+`
+
+func TestCostQuota(t *testing.T) {
+	assert := assert.New(t)
+	cq := createQuota(t, yamlConfig, nil)
+
+	// free requests never consume the budget
+	for i := 0; i < 20; i++ {
+		assert.Equal("", cq.Handle(newContext(t, http.MethodGet, "/health", "alice")))
+	}
+
+	assert.Equal("", cq.Handle(newContext(t, http.MethodPost, "/reports/1", "alice")))
+	assert.Equal("", cq.Handle(newContext(t, http.MethodPost, "/reports/2", "alice")))
+
+	ctx := newContext(t, http.MethodGet, "/users", "alice")
+	assert.Equal(resultExhausted, cq.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusTooManyRequests, resp.StatusCode())
+	assert.NotEmpty(resp.HTTPHeader().Get("Retry-After"))
+
+	// budget of other clients is not affected, and the real IP is used
+	// if the header is absent
+	assert.Equal("", cq.Handle(newContext(t, http.MethodGet, "/users", "bob")))
+	assert.Equal("", cq.Handle(newContext(t, http.MethodGet, "/users", "")))
+
+	status := cq.Status().(*Status)
+	assert.Equal(3, status.Clients)
+	assert.Equal(int64(1), status.NumOfRejected)
+	assert.Equal("alice", status.Consumption[0].Client)
+	assert.Equal(int64(10), status.Consumption[0].Consumed)
+	assert.Equal(int64(0), status.Consumption[0].Remaining)
+	assert.Equal(int64(1), status.Consumption[0].Rejected)
+
+	// the consumption is kept after the budget is updated
+	cq = createQuota(t, yamlConfig+"\ndefaultCost: 2\n", cq)
+	cq.spec.Budget = 12
+	assert.Equal("", cq.Handle(newContext(t, http.MethodGet, "/users", "alice")))
+	assert.Equal(resultExhausted, cq.Handle(newContext(t, http.MethodGet, "/users", "alice")))
+
+	// the budget is refilled in the next period
+	now := time.Now()
+	_, err := cq.consume("alice", 1, now.Add(time.Hour))
+	assert.NoError(err)
+}
+
+func TestConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	cq := createQuota(t, yamlConfig, nil)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	passed := 0
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cq.Handle(newContext(t, http.MethodGet, "/users", "alice")) == "" {
+				lock.Lock()
+				passed++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(10, passed)
+}
+
+func TestMaxClients(t *testing.T) {
+	assert := assert.New(t)
+	cq := createQuota(t, yamlConfig+"\nmaxClients: 2\n", nil)
+
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		_, err := cq.consume(fmt.Sprintf("client-%d", i), 1, now)
+		assert.NoError(err)
+	}
+	_, err := cq.consume("client-2", 1, now)
+	assert.Error(err)
+	assert.Equal(int64(1), cq.Status().(*Status).NumOfRejectedByCapacity)
+
+	// clients whose period has passed are evicted
+	_, err = cq.consume("client-2", 1, now.Add(time.Hour))
+	assert.NoError(err)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Budget: 1, Period: "-1s"}
+	assert.Error(spec.Validate())
+	spec = &Spec{Budget: 1, Period: "abc"}
+	assert.Error(spec.Validate())
+	spec = &Spec{Budget: 1, DefaultCost: -1}
+	assert.Error(spec.Validate())
+	spec = &Spec{Budget: 1, Costs: []*Cost{{Cost: 1}}}
+	assert.Error(spec.Validate())
+	spec = &Spec{Budget: 1, Costs: []*Cost{{Cost: -1}}}
+	spec.Costs[0].URL.Prefix = "/"
+	assert.Error(spec.Validate())
+	spec.Costs[0].Cost = 1
+	assert.NoError(spec.Validate())
+}
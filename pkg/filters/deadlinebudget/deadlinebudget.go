@@ -0,0 +1,301 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadlinebudget
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of DeadlineBudget.
+	Kind = "DeadlineBudget"
+
+	// FormatGRPCTimeout is the format of the grpc-timeout header, e.g. 100m.
+	FormatGRPCTimeout = "grpcTimeout"
+	// FormatMilliseconds is the format of a timeout in milliseconds.
+	FormatMilliseconds = "milliseconds"
+	// FormatUnixMilli is the format of a deadline in Unix milliseconds.
+	FormatUnixMilli = "unixMilli"
+
+	defaultHeaderKey = "Grpc-Timeout"
+
+	resultInvalid         = "invalid"
+	resultBudgetExhausted = "budgetExhausted"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "DeadlineBudget sets the deadline of a request from a header and propagates the remaining budget to backends.",
+	Results:     []string{resultInvalid, resultBudgetExhausted},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			HeaderKey: defaultHeaderKey,
+			Format:    FormatGRPCTimeout,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &DeadlineBudget{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// DeadlineBudget is filter DeadlineBudget.
+	DeadlineBudget struct {
+		spec          *Spec
+		reserve       time.Duration
+		defaultBudget time.Duration
+		maxBudget     time.Duration
+
+		numOfBudgetExhausted  int64
+		numOfDeadlineExceeded int64
+	}
+
+	// Spec describes the DeadlineBudget.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		HeaderKey     string `json:"headerKey" jsonschema:"omitempty"`
+		Format        string `json:"format" jsonschema:"omitempty,enum=,enum=grpcTimeout,enum=milliseconds,enum=unixMilli"`
+		Reserve       string `json:"reserve" jsonschema:"omitempty,format=duration"`
+		DefaultBudget string `json:"defaultBudget" jsonschema:"omitempty,format=duration"`
+		MaxBudget     string `json:"maxBudget" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of DeadlineBudget.
+	Status struct {
+		NumOfBudgetExhausted  int64 `json:"numOfBudgetExhausted"`
+		NumOfDeadlineExceeded int64 `json:"numOfDeadlineExceeded"`
+	}
+)
+
+var _ filters.Filter = (*DeadlineBudget)(nil)
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses a timeout in the format of the grpc-timeout
+// header, which is at most 8 digits followed by a unit.
+func parseGRPCTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, fmt.Errorf("malformed timeout %q", s)
+	}
+	unit, ok := grpcTimeoutUnits[s[len(s)-1]]
+	if !ok {
+		return 0, fmt.Errorf("malformed timeout %q", s)
+	}
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("malformed timeout %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// formatGRPCTimeout formats a timeout in the format of the grpc-timeout
+// header, using the most precise unit which fits in 8 digits.
+func formatGRPCTimeout(d time.Duration) string {
+	const maxValue = 99999999
+	for _, u := range []struct {
+		unit byte
+		d    time.Duration
+	}{{'n', time.Nanosecond}, {'u', time.Microsecond}, {'m', time.Millisecond}, {'S', time.Second}, {'M', time.Minute}} {
+		if v := d / u.d; v <= maxValue {
+			return strconv.FormatInt(int64(v), 10) + string(u.unit)
+		}
+	}
+	return strconv.FormatInt(int64(d/time.Hour), 10) + "H"
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for name, v := range map[string]string{
+		"reserve":       spec.Reserve,
+		"defaultBudget": spec.DefaultBudget,
+		"maxBudget":     spec.MaxBudget,
+	} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the DeadlineBudget filter instance.
+func (db *DeadlineBudget) Name() string {
+	return db.spec.Name()
+}
+
+// Kind returns the kind of DeadlineBudget.
+func (db *DeadlineBudget) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the DeadlineBudget
+func (db *DeadlineBudget) Spec() filters.Spec {
+	return db.spec
+}
+
+// Init initializes DeadlineBudget.
+func (db *DeadlineBudget) Init() {
+	db.reload()
+}
+
+// Inherit inherits previous generation of DeadlineBudget.
+func (db *DeadlineBudget) Inherit(previousGeneration filters.Filter) {
+	db.reload()
+}
+
+func (db *DeadlineBudget) reload() {
+	db.reserve, _ = time.ParseDuration(db.spec.Reserve)
+	db.defaultBudget, _ = time.ParseDuration(db.spec.DefaultBudget)
+	db.maxBudget, _ = time.ParseDuration(db.spec.MaxBudget)
+}
+
+func (db *DeadlineBudget) headerKey() string {
+	if db.spec.HeaderKey == "" {
+		return defaultHeaderKey
+	}
+	return db.spec.HeaderKey
+}
+
+// parseDeadline parses the deadline from the header value.
+func (db *DeadlineBudget) parseDeadline(v string, now time.Time) (time.Time, error) {
+	switch db.spec.Format {
+	case FormatMilliseconds:
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || ms < 0 {
+			return time.Time{}, fmt.Errorf("malformed timeout %q", v)
+		}
+		return now.Add(time.Duration(ms) * time.Millisecond), nil
+	case FormatUnixMilli:
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("malformed deadline %q", v)
+		}
+		return time.UnixMilli(ms), nil
+	default:
+		d, err := parseGRPCTimeout(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return now.Add(d), nil
+	}
+}
+
+// formatDeadline formats the deadline to be propagated to backends.
+func (db *DeadlineBudget) formatDeadline(deadline time.Time, now time.Time) string {
+	switch db.spec.Format {
+	case FormatMilliseconds:
+		return strconv.FormatInt(deadline.Sub(now).Milliseconds(), 10)
+	case FormatUnixMilli:
+		return strconv.FormatInt(deadline.UnixMilli(), 10)
+	default:
+		return formatGRPCTimeout(deadline.Sub(now))
+	}
+}
+
+func buildFailureResponse(ctx *context.Context, code int, reason string) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("deadlineBudget: " + reason)
+}
+
+// Handle sets the deadline of the request according to the header, and
+// updates the header with the remaining budget, which is reduced by the
+// reserve, for backends.
+func (db *DeadlineBudget) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	now := fasttime.Now()
+
+	var deadline time.Time
+	if v := req.HTTPHeader().Get(db.headerKey()); v != "" {
+		d, err := db.parseDeadline(v, now)
+		if err != nil {
+			buildFailureResponse(ctx, http.StatusBadRequest, err.Error())
+			return resultInvalid
+		}
+		deadline = d
+	} else if db.defaultBudget > 0 {
+		deadline = now.Add(db.defaultBudget)
+	} else {
+		return ""
+	}
+
+	if db.maxBudget > 0 && deadline.Sub(now) > db.maxBudget {
+		deadline = now.Add(db.maxBudget)
+	}
+
+	// the budget for backends is reduced by the reserve, so that there
+	// is enough time to process the response.
+	backendDeadline := deadline.Add(-db.reserve)
+	if !backendDeadline.After(now) {
+		atomic.AddInt64(&db.numOfBudgetExhausted, 1)
+		buildFailureResponse(ctx, http.StatusGatewayTimeout, "budget exhausted at entry")
+		return resultBudgetExhausted
+	}
+
+	stdctx, cancel := stdcontext.WithDeadline(req.Context(), backendDeadline)
+	req.SetContext(stdctx)
+	req.HTTPHeader().Set(db.headerKey(), db.formatDeadline(backendDeadline, now))
+
+	ctx.OnFinish(func() {
+		if stdctx.Err() == stdcontext.DeadlineExceeded {
+			atomic.AddInt64(&db.numOfDeadlineExceeded, 1)
+		}
+		cancel()
+	})
+
+	return ""
+}
+
+// Status returns status.
+func (db *DeadlineBudget) Status() interface{} {
+	return &Status{
+		NumOfBudgetExhausted:  atomic.LoadInt64(&db.numOfBudgetExhausted),
+		NumOfDeadlineExceeded: atomic.LoadInt64(&db.numOfDeadlineExceeded),
+	}
+}
+
+// Close closes DeadlineBudget.
+func (db *DeadlineBudget) Close() {}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deadlinebudget
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createBudget(t *testing.T, yamlConfig string) *DeadlineBudget {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	db := kind.CreateInstance(spec).(*DeadlineBudget)
+	db.Init()
+	return db
+}
+
+func newContext(t *testing.T, header, value string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if value != "" {
+		stdr.Header.Set(header, value)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestGRPCTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	d, err := parseGRPCTimeout("100m")
+	assert.NoError(err)
+	assert.Equal(100*time.Millisecond, d)
+
+	d, err = parseGRPCTimeout("2S")
+	assert.NoError(err)
+	assert.Equal(2*time.Second, d)
+
+	for _, s := range []string{"", "m", "100", "100x", "123456789m", "-1m"} {
+		_, err = parseGRPCTimeout(s)
+		assert.Error(err, s)
+	}
+
+	assert.Equal("1500000u", formatGRPCTimeout(1500*time.Millisecond))
+	assert.Equal("99999999n", formatGRPCTimeout(99999999*time.Nanosecond))
+	assert.Equal("100000S", formatGRPCTimeout(100000*time.Second))
+}
+
+func TestDeadlineBudget(t *testing.T) {
+	assert := assert.New(t)
+
+	db := createBudget(t, `
+name: budget
+kind: DeadlineBudget
+reserve: 100ms
+maxBudget: 10s
+`)
+
+	// no header, no deadline
+	ctx := newContext(t, "", "")
+	assert.Equal("", db.Handle(ctx))
+	_, ok := ctx.GetInputRequest().(*httpprot.Request).Context().Deadline()
+	assert.False(ok)
+
+	ctx = newContext(t, "Grpc-Timeout", "2S")
+	assert.Equal("", db.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	deadline, ok := req.Context().Deadline()
+	assert.True(ok)
+	assert.InDelta(1900*time.Millisecond, time.Until(deadline), float64(50*time.Millisecond))
+	d, err := parseGRPCTimeout(req.HTTPHeader().Get("Grpc-Timeout"))
+	assert.NoError(err)
+	assert.InDelta(1900*time.Millisecond, d, float64(50*time.Millisecond))
+	ctx.Finish()
+
+	// the budget is capped by maxBudget
+	ctx = newContext(t, "Grpc-Timeout", "1H")
+	assert.Equal("", db.Handle(ctx))
+	deadline, _ = ctx.GetInputRequest().(*httpprot.Request).Context().Deadline()
+	assert.Less(time.Until(deadline), 10*time.Second)
+	ctx.Finish()
+
+	// the budget is less than the reserve
+	ctx = newContext(t, "Grpc-Timeout", "50m")
+	assert.Equal(resultBudgetExhausted, db.Handle(ctx))
+	assert.Equal(http.StatusGatewayTimeout, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, "Grpc-Timeout", "abc")
+	assert.Equal(resultInvalid, db.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the deadline is exceeded before the request finishes
+	ctx = newContext(t, "Grpc-Timeout", "150m")
+	assert.Equal("", db.Handle(ctx))
+	<-ctx.GetInputRequest().(*httpprot.Request).Context().Done()
+	ctx.Finish()
+
+	status := db.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfBudgetExhausted)
+	assert.Equal(int64(1), status.NumOfDeadlineExceeded)
+}
+
+func TestUnixMilli(t *testing.T) {
+	assert := assert.New(t)
+
+	db := createBudget(t, `
+name: budget
+kind: DeadlineBudget
+headerKey: X-Deadline
+format: unixMilli
+`)
+
+	deadline := time.Now().Add(time.Second).UnixMilli()
+	ctx := newContext(t, "X-Deadline", strconv.FormatInt(deadline, 10))
+	assert.Equal("", db.Handle(ctx))
+	assert.Equal(strconv.FormatInt(deadline, 10), ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Deadline"))
+	ctx.Finish()
+
+	deadline = time.Now().Add(-time.Second).UnixMilli()
+	ctx = newContext(t, "X-Deadline", strconv.FormatInt(deadline, 10))
+	assert.Equal(resultBudgetExhausted, db.Handle(ctx))
+}
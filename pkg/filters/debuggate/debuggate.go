@@ -0,0 +1,235 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package debuggate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of DebugGate.
+	Kind = "DebugGate"
+
+	// DefaultDataKey is the default key to mark a debug request.
+	DefaultDataKey = "DEBUG_REQUEST"
+
+	defaultHeaderKey = "X-Debug-Token"
+	defaultMaxTTL    = time.Hour
+
+	resultNormal = "normal"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "DebugGate lets requests with a signed debug token go through extra filters.",
+	Results:     []string{resultNormal},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			HeaderKey: defaultHeaderKey,
+			MaxTTL:    defaultMaxTTL.String(),
+			DataKey:   DefaultDataKey,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &DebugGate{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// DebugGate is filter DebugGate.
+	DebugGate struct {
+		spec   *Spec
+		maxTTL time.Duration
+
+		numOfDebug   int64
+		numOfNormal  int64
+		numOfInvalid int64
+	}
+
+	// Spec describes the DebugGate.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Key       string `json:"key" jsonschema:"required,minLength=16"`
+		HeaderKey string `json:"headerKey" jsonschema:"omitempty"`
+		MaxTTL    string `json:"maxTTL" jsonschema:"omitempty,format=duration"`
+		DataKey   string `json:"dataKey" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of DebugGate.
+	Status struct {
+		NumOfDebug   int64 `json:"numOfDebug"`
+		NumOfNormal  int64 `json:"numOfNormal"`
+		NumOfInvalid int64 `json:"numOfInvalid"`
+	}
+)
+
+var _ filters.Filter = (*DebugGate)(nil)
+
+func sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignToken creates a debug token which expires at the given time, the
+// token is in format of '<expires>.<signature>', where 'expires' is a Unix
+// timestamp in seconds, and 'signature' is the hex encoded HMAC-SHA256 of
+// 'expires' with the key.
+func SignToken(key string, expires time.Time) string {
+	s := strconv.FormatInt(expires.Unix(), 10)
+	return s + "." + sign(key, s)
+}
+
+// verifyToken verifies the token, the token must be signed with the key,
+// not expired, and must not expire later than maxTTL from now.
+func verifyToken(key string, token string, maxTTL time.Duration) error {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return fmt.Errorf("malformed token")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(sign(key, expires))) {
+		return fmt.Errorf("invalid signature")
+	}
+
+	sec, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiration: %v", err)
+	}
+
+	now := fasttime.Now()
+	exp := time.Unix(sec, 0)
+	if exp.Before(now) {
+		return fmt.Errorf("token expired")
+	}
+	if exp.Sub(now) > maxTTL {
+		return fmt.Errorf("token lives too long")
+	}
+
+	return nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.MaxTTL == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(spec.MaxTTL); err != nil || d <= 0 {
+		return fmt.Errorf("invalid maxTTL %q", spec.MaxTTL)
+	}
+	return nil
+}
+
+// Name returns the name of the DebugGate filter instance.
+func (dg *DebugGate) Name() string {
+	return dg.spec.Name()
+}
+
+// Kind returns the kind of DebugGate.
+func (dg *DebugGate) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the DebugGate
+func (dg *DebugGate) Spec() filters.Spec {
+	return dg.spec
+}
+
+// Init initializes DebugGate.
+func (dg *DebugGate) Init() {
+	dg.reload()
+}
+
+// Inherit inherits previous generation of DebugGate.
+func (dg *DebugGate) Inherit(previousGeneration filters.Filter) {
+	dg.reload()
+}
+
+func (dg *DebugGate) reload() {
+	dg.maxTTL, _ = time.ParseDuration(dg.spec.MaxTTL)
+	if dg.maxTTL <= 0 {
+		dg.maxTTL = defaultMaxTTL
+	}
+}
+
+// Handle checks the debug token of the request, it returns an empty result
+// for debug requests, so that they go through the following filters, and
+// returns 'normal' for other requests, which could be used to skip the
+// debug filters with 'jumpIf'.
+func (dg *DebugGate) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	headerKey := dg.spec.HeaderKey
+	if headerKey == "" {
+		headerKey = defaultHeaderKey
+	}
+
+	token := req.HTTPHeader().Get(headerKey)
+	if token == "" {
+		atomic.AddInt64(&dg.numOfNormal, 1)
+		return resultNormal
+	}
+
+	if err := verifyToken(dg.spec.Key, token, dg.maxTTL); err != nil {
+		// an invalid token is never an error, the request is handled as
+		// a normal one.
+		atomic.AddInt64(&dg.numOfInvalid, 1)
+		atomic.AddInt64(&dg.numOfNormal, 1)
+		ctx.AddTag("debugGate: " + err.Error())
+		return resultNormal
+	}
+
+	dataKey := dg.spec.DataKey
+	if dataKey == "" {
+		dataKey = DefaultDataKey
+	}
+	ctx.SetData(dataKey, true)
+	ctx.AddTag("debug request")
+	atomic.AddInt64(&dg.numOfDebug, 1)
+
+	return ""
+}
+
+// Status returns status.
+func (dg *DebugGate) Status() interface{} {
+	return &Status{
+		NumOfDebug:   atomic.LoadInt64(&dg.numOfDebug),
+		NumOfNormal:  atomic.LoadInt64(&dg.numOfNormal),
+		NumOfInvalid: atomic.LoadInt64(&dg.numOfInvalid),
+	}
+}
+
+// Close closes DebugGate.
+func (dg *DebugGate) Close() {}
@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package debuggate
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+const testKey = "0123456789abcdef"
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createGate(t *testing.T, yamlConfig string) *DebugGate {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	dg := kind.CreateInstance(spec).(*DebugGate)
+	dg.Init()
+	return dg
+}
+
+func newContext(t *testing.T, token string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if token != "" {
+		stdr.Header.Set("X-Debug", token)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := map[string]interface{}{
+		"name": "gate",
+		"kind": Kind,
+		"key":  "short",
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["key"] = testKey
+	rawSpec["maxTTL"] = "-1h"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["maxTTL"] = "10m"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+}
+
+func TestDebugGate(t *testing.T) {
+	assert := assert.New(t)
+
+	dg := createGate(t, `
+name: gate
+kind: DebugGate
+key: `+testKey+`
+headerKey: X-Debug
+maxTTL: 10m
+`)
+
+	ctx := newContext(t, "")
+	assert.Equal(resultNormal, dg.Handle(ctx))
+	assert.Nil(ctx.GetData(DefaultDataKey))
+
+	ctx = newContext(t, SignToken(testKey, time.Now().Add(time.Minute)))
+	assert.Equal("", dg.Handle(ctx))
+	assert.Equal(true, ctx.GetData(DefaultDataKey))
+
+	// signed with another key
+	ctx = newContext(t, SignToken("fedcba9876543210", time.Now().Add(time.Minute)))
+	assert.Equal(resultNormal, dg.Handle(ctx))
+
+	// expired
+	ctx = newContext(t, SignToken(testKey, time.Now().Add(-time.Minute)))
+	assert.Equal(resultNormal, dg.Handle(ctx))
+
+	// lives too long
+	ctx = newContext(t, SignToken(testKey, time.Now().Add(time.Hour)))
+	assert.Equal(resultNormal, dg.Handle(ctx))
+
+	ctx = newContext(t, "malformed")
+	assert.Equal(resultNormal, dg.Handle(ctx))
+
+	status := dg.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfDebug)
+	assert.Equal(int64(5), status.NumOfNormal)
+	assert.Equal(int64(4), status.NumOfInvalid)
+}
@@ -0,0 +1,344 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deprecation
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/urlrule"
+)
+
+const (
+	// Kind is the kind of Deprecation.
+	Kind = "Deprecation"
+
+	// maxReportedClients is the max number of clients reported for each
+	// endpoint, calls of other clients are reported under otherClients.
+	maxReportedClients = 100
+	otherClients       = "other"
+
+	resultGone = "gone"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Deprecation announces the deprecation of endpoints and tracks their usage.",
+	Results:     []string{resultGone},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Deprecation{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Deprecation is filter Deprecation.
+	Deprecation struct {
+		spec      *Spec
+		endpoints []*endpoint
+	}
+
+	// Spec describes the Deprecation.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Endpoints       []*Endpoint `json:"endpoints" jsonschema:"required,minItems=1"`
+		ClientHeaderKey string      `json:"clientHeaderKey" jsonschema:"omitempty"`
+	}
+
+	// Endpoint describes a deprecated endpoint.
+	Endpoint struct {
+		urlrule.URLRule `json:",inline"`
+		Deprecation     string `json:"deprecation" jsonschema:"required,format=date-time"`
+		Sunset          string `json:"sunset" jsonschema:"omitempty"`
+		Link            string `json:"link" jsonschema:"omitempty"`
+		GoneAfterSunset bool   `json:"goneAfterSunset" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Deprecation.
+	Status struct {
+		Endpoints []*EndpointStatus `json:"endpoints"`
+	}
+
+	// EndpointStatus is the usage of a deprecated endpoint.
+	EndpointStatus struct {
+		Methods    []string         `json:"methods,omitempty"`
+		URL        string           `json:"url"`
+		NumOfCalls int64            `json:"numOfCalls"`
+		NumOfGone  int64            `json:"numOfGone"`
+		Clients    map[string]int64 `json:"clients,omitempty"`
+	}
+
+	endpoint struct {
+		spec *Endpoint
+
+		deprecation string
+		sunset      string
+		link        string
+		sunsetTime  time.Time
+
+		usage *usage
+	}
+
+	// usage is the usage of an endpoint, it is inherited by the next
+	// generation if the endpoint is still deprecated.
+	usage struct {
+		numOfCalls int64
+		numOfGone  int64
+
+		lock    sync.Mutex
+		clients map[string]int64
+	}
+)
+
+var _ filters.Filter = (*Deprecation)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for i, e := range spec.Endpoints {
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("endpoints[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (e *Endpoint) validate() error {
+	if err := e.URL.Validate(); err != nil {
+		return err
+	}
+
+	deprecation, err := time.Parse(time.RFC3339, e.Deprecation)
+	if err != nil {
+		return fmt.Errorf("invalid deprecation: %v", err)
+	}
+
+	if e.Sunset != "" {
+		sunset, err := time.Parse(time.RFC3339, e.Sunset)
+		if err != nil {
+			return fmt.Errorf("invalid sunset: %v", err)
+		}
+		if sunset.Before(deprecation) {
+			return fmt.Errorf("sunset must not be earlier than deprecation")
+		}
+	} else if e.GoneAfterSunset {
+		return fmt.Errorf("sunset is required when goneAfterSunset is true")
+	}
+
+	if e.Link != "" {
+		if u, err := url.Parse(e.Link); err != nil || !u.IsAbs() {
+			return fmt.Errorf("invalid link: %s", e.Link)
+		}
+	}
+	return nil
+}
+
+// key returns the key of the endpoint to inherit the usage.
+func (e *Endpoint) key() string {
+	return fmt.Sprintf("%v %s %s %s", e.Methods, e.URL.Exact, e.URL.Prefix, e.URL.RegEx)
+}
+
+// Name returns the name of the Deprecation filter instance.
+func (d *Deprecation) Name() string {
+	return d.spec.Name()
+}
+
+// Kind returns the kind of Deprecation.
+func (d *Deprecation) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Deprecation
+func (d *Deprecation) Spec() filters.Spec {
+	return d.spec
+}
+
+// Init initializes Deprecation.
+func (d *Deprecation) Init() {
+	d.reload(nil)
+}
+
+// Inherit inherits previous generation of Deprecation, the usage of
+// endpoints which are still deprecated is kept.
+func (d *Deprecation) Inherit(previousGeneration filters.Filter) {
+	d.reload(previousGeneration.(*Deprecation))
+}
+
+func (d *Deprecation) reload(prev *Deprecation) {
+	usages := map[string]*usage{}
+	if prev != nil {
+		for _, e := range prev.endpoints {
+			usages[e.spec.key()] = e.usage
+		}
+	}
+
+	d.endpoints = make([]*endpoint, 0, len(d.spec.Endpoints))
+	for _, spec := range d.spec.Endpoints {
+		spec.Init()
+
+		e := &endpoint{spec: spec, usage: usages[spec.key()]}
+		if e.usage == nil {
+			e.usage = &usage{clients: map[string]int64{}}
+		}
+
+		// RFC 9745
+		deprecation, _ := time.Parse(time.RFC3339, spec.Deprecation)
+		e.deprecation = "@" + strconv.FormatInt(deprecation.Unix(), 10)
+
+		// RFC 8594
+		if spec.Sunset != "" {
+			e.sunsetTime, _ = time.Parse(time.RFC3339, spec.Sunset)
+			e.sunset = e.sunsetTime.UTC().Format(http.TimeFormat)
+		}
+
+		if spec.Link != "" {
+			e.link = fmt.Sprintf(`<%s>; rel="deprecation"`, spec.Link)
+		}
+
+		d.endpoints = append(d.endpoints, e)
+	}
+}
+
+// dataKey is the key of the context data to record the deprecated
+// endpoint of the request, so that the filter knows the headers should be
+// added to the response when it is called again.
+func (d *Deprecation) dataKey() string {
+	return "DEPRECATION/" + d.Name()
+}
+
+func (d *Deprecation) match(req *httpprot.Request) *endpoint {
+	for _, e := range d.endpoints {
+		if e.spec.Match(req.Std()) {
+			return e
+		}
+	}
+	return nil
+}
+
+// record records a call of the client to the endpoint.
+func (u *usage) record(client string) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if _, ok := u.clients[client]; !ok && len(u.clients) >= maxReportedClients {
+		client = otherClients
+	}
+	u.clients[client]++
+}
+
+// setHeaders sets the deprecation headers to the response.
+func (e *endpoint) setHeaders(resp *httpprot.Response) {
+	h := resp.HTTPHeader()
+	h.Set("Deprecation", e.deprecation)
+	if e.sunset != "" {
+		h.Set("Sunset", e.sunset)
+	}
+	if e.link != "" {
+		h.Add("Link", e.link)
+	}
+}
+
+// Handle records the call to a deprecated endpoint and rejects it if the
+// endpoint is gone when it is called the first time in a pipeline, and
+// adds the deprecation headers to the response when it is called again
+// after the backend.
+func (d *Deprecation) Handle(ctx *context.Context) string {
+	if e, ok := ctx.GetData(d.dataKey()).(*endpoint); ok {
+		if resp, _ := ctx.GetOutputResponse().(*httpprot.Response); resp != nil {
+			e.setHeaders(resp)
+		}
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	e := d.match(req)
+	if e == nil {
+		return ""
+	}
+
+	atomic.AddInt64(&e.usage.numOfCalls, 1)
+	client := ""
+	if d.spec.ClientHeaderKey != "" {
+		if client = req.HTTPHeader().Get(d.spec.ClientHeaderKey); client != "" {
+			e.usage.record(client)
+		}
+	}
+	ctx.LazyAddTag(func() string {
+		if client == "" {
+			return "deprecation: deprecated endpoint " + e.spec.ID()
+		}
+		return fmt.Sprintf("deprecation: deprecated endpoint %s called by %s", e.spec.ID(), client)
+	})
+
+	if e.spec.GoneAfterSunset && !time.Now().Before(e.sunsetTime) {
+		atomic.AddInt64(&e.usage.numOfGone, 1)
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusGone)
+		e.setHeaders(resp)
+		ctx.SetOutputResponse(resp)
+		return resultGone
+	}
+
+	ctx.SetData(d.dataKey(), e)
+	return ""
+}
+
+// Status returns status.
+func (d *Deprecation) Status() interface{} {
+	s := &Status{Endpoints: make([]*EndpointStatus, 0, len(d.endpoints))}
+	for _, e := range d.endpoints {
+		es := &EndpointStatus{
+			Methods:    e.spec.Methods,
+			URL:        e.spec.ID(),
+			NumOfCalls: atomic.LoadInt64(&e.usage.numOfCalls),
+			NumOfGone:  atomic.LoadInt64(&e.usage.numOfGone),
+		}
+
+		e.usage.lock.Lock()
+		if len(e.usage.clients) > 0 {
+			es.Clients = make(map[string]int64, len(e.usage.clients))
+			for k, v := range e.usage.clients {
+				es.Clients[k] = v
+			}
+		}
+		e.usage.lock.Unlock()
+
+		s.Endpoints = append(s.Endpoints, es)
+	}
+	return s
+}
+
+// Close closes Deprecation.
+func (d *Deprecation) Close() {}
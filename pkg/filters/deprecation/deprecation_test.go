@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package deprecation
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createDeprecation(t *testing.T, yamlConfig string, prev *Deprecation) *Deprecation {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	d := kind.CreateInstance(spec).(*Deprecation)
+	if prev == nil {
+		d.Init()
+	} else {
+		d.Inherit(prev)
+	}
+	return d
+}
+
+func newContext(t *testing.T, path, client string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	if client != "" {
+		stdr.Header.Set("X-Api-Key", client)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+// handle calls the filter before and after the backend.
+func handle(d *Deprecation, ctx *context.Context) (string, *httpprot.Response) {
+	if result := d.Handle(ctx); result != "" {
+		return result, ctx.GetOutputResponse().(*httpprot.Response)
+	}
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Link", `<https://example.com/next>; rel="next"`)
+	ctx.SetOutputResponse(resp)
+	return d.Handle(ctx), resp
+}
+
+var yamlConfig = fmt.Sprintf(`
+name: deprecation
+kind: Deprecation
+clientHeaderKey: X-Api-Key
+endpoints:
+- url:
+    prefix: /v1/
+  deprecation: "2023-01-01T00:00:00Z"
+  sunset: "%s"
+  link: https://example.com/migration
+- methods: [GET]
+  url:
+    prefix: /v0/
+  deprecation: "2022-01-01T00:00:00Z"
+  sunset: "2022-06-01T00:00:00Z"
+  goneAfterSunset: true
+`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+
+func TestDeprecation(t *testing.T) {
+	assert := assert.New(t)
+	d := createDeprecation(t, yamlConfig, nil)
+
+	result, resp := handle(d, newContext(t, "/v2/users", "alice"))
+	assert.Equal("", result)
+	assert.Empty(resp.HTTPHeader().Get("Deprecation"))
+
+	result, resp = handle(d, newContext(t, "/v1/users", "alice"))
+	assert.Equal("", result)
+	assert.Equal("@1672531200", resp.HTTPHeader().Get("Deprecation"))
+	assert.NotEmpty(resp.HTTPHeader().Get("Sunset"))
+	assert.Equal([]string{
+		`<https://example.com/next>; rel="next"`,
+		`<https://example.com/migration>; rel="deprecation"`,
+	}, resp.HTTPHeader().Values("Link"))
+
+	handle(d, newContext(t, "/v1/orders", "bob"))
+	handle(d, newContext(t, "/v1/orders", ""))
+
+	result, resp = handle(d, newContext(t, "/v0/users", "alice"))
+	assert.Equal(resultGone, result)
+	assert.Equal(http.StatusGone, resp.StatusCode())
+	assert.Equal("Wed, 01 Jun 2022 00:00:00 GMT", resp.HTTPHeader().Get("Sunset"))
+
+	status := d.Status().(*Status)
+	assert.Equal(2, len(status.Endpoints))
+	assert.Equal("/v1/", status.Endpoints[0].URL)
+	assert.Equal(int64(3), status.Endpoints[0].NumOfCalls)
+	assert.Equal(map[string]int64{"alice": 1, "bob": 1}, status.Endpoints[0].Clients)
+	assert.Equal(int64(1), status.Endpoints[1].NumOfCalls)
+	assert.Equal(int64(1), status.Endpoints[1].NumOfGone)
+
+	// usage of unchanged endpoints is inherited
+	d = createDeprecation(t, yamlConfig, d)
+	status = d.Status().(*Status)
+	assert.Equal(int64(3), status.Endpoints[0].NumOfCalls)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	e := &Endpoint{Deprecation: "2023-01-01T00:00:00Z"}
+	spec := &Spec{Endpoints: []*Endpoint{e}}
+	assert.Error(spec.Validate())
+
+	e.URL.Prefix = "/v1/"
+	assert.NoError(spec.Validate())
+
+	e.Deprecation = "2023-01-01"
+	assert.Error(spec.Validate())
+	e.Deprecation = "2023-01-01T00:00:00Z"
+
+	e.GoneAfterSunset = true
+	assert.Error(spec.Validate())
+	e.Sunset = "2022-01-01T00:00:00Z"
+	assert.Error(spec.Validate())
+	e.Sunset = "2024-01-01T00:00:00Z"
+	assert.NoError(spec.Validate())
+
+	e.Link = "/migration"
+	assert.Error(spec.Validate())
+}
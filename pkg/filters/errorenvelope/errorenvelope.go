@@ -0,0 +1,268 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package errorenvelope
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/builder"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+)
+
+const (
+	// Kind is the kind of ErrorEnvelope.
+	Kind = "ErrorEnvelope"
+
+	defaultStatusCodes     = "400-599"
+	defaultRequestIDHeader = "X-Request-Id"
+
+	defaultTemplate = `{"code": {{.error.code}}, "message": {{toJson .error.message}}, "requestID": {{toJson .error.requestID}}, "timestamp": {{toJson .error.timestamp}}}`
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ErrorEnvelope wraps the bodies of error responses into a uniform JSON envelope.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			StatusCodes:     []string{defaultStatusCodes},
+			RequestIDHeader: defaultRequestIDHeader,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ErrorEnvelope{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// ErrorEnvelope is filter ErrorEnvelope.
+	ErrorEnvelope struct {
+		spec     *Spec
+		ranges   []statusCodeRange
+		template *template.Template
+
+		numOfNormalized int64
+		numOfFailed     int64
+	}
+
+	// Spec describes the ErrorEnvelope.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		StatusCodes     []string      `json:"statusCodes" jsonschema:"omitempty"`
+		RequestIDHeader string        `json:"requestIDHeader" jsonschema:"omitempty"`
+		Template        *builder.Spec `json:"template,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ErrorEnvelope.
+	Status struct {
+		NumOfNormalized int64 `json:"numOfNormalized"`
+		NumOfFailed     int64 `json:"numOfFailed"`
+	}
+
+	statusCodeRange struct {
+		min, max int
+	}
+)
+
+var _ filters.Filter = (*ErrorEnvelope)(nil)
+
+// parseStatusCodeRange parses a status code like "404" or a range of
+// status codes like "500-599".
+func parseStatusCodeRange(s string) (statusCodeRange, error) {
+	var r statusCodeRange
+
+	min, max, found := strings.Cut(s, "-")
+	var err error
+	if r.min, err = strconv.Atoi(strings.TrimSpace(min)); err != nil {
+		return r, fmt.Errorf("invalid status code range %q", s)
+	}
+	r.max = r.min
+	if found {
+		if r.max, err = strconv.Atoi(strings.TrimSpace(max)); err != nil {
+			return r, fmt.Errorf("invalid status code range %q", s)
+		}
+	}
+
+	if r.min < 100 || r.max > 599 || r.min > r.max {
+		return r, fmt.Errorf("invalid status code range %q", s)
+	}
+	return r, nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for _, s := range spec.StatusCodes {
+		if _, err := parseStatusCodeRange(s); err != nil {
+			return err
+		}
+	}
+	if spec.Template != nil {
+		if err := spec.Template.Validate(); err != nil {
+			return fmt.Errorf("invalid template: %v", err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the ErrorEnvelope filter instance.
+func (ee *ErrorEnvelope) Name() string {
+	return ee.spec.Name()
+}
+
+// Kind returns the kind of ErrorEnvelope.
+func (ee *ErrorEnvelope) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ErrorEnvelope
+func (ee *ErrorEnvelope) Spec() filters.Spec {
+	return ee.spec
+}
+
+// Init initializes ErrorEnvelope.
+func (ee *ErrorEnvelope) Init() {
+	ee.reload()
+}
+
+// Inherit inherits previous generation of ErrorEnvelope.
+func (ee *ErrorEnvelope) Inherit(previousGeneration filters.Filter) {
+	ee.reload()
+}
+
+func (ee *ErrorEnvelope) reload() {
+	codes := ee.spec.StatusCodes
+	if len(codes) == 0 {
+		codes = []string{defaultStatusCodes}
+	}
+	ee.ranges = make([]statusCodeRange, 0, len(codes))
+	for _, s := range codes {
+		r, _ := parseStatusCodeRange(s)
+		ee.ranges = append(ee.ranges, r)
+	}
+
+	spec := ee.spec.Template
+	if spec == nil {
+		spec = &builder.Spec{Template: defaultTemplate}
+	}
+	ee.template = template.Must(builder.NewTemplate(spec))
+}
+
+func (ee *ErrorEnvelope) isError(code int) bool {
+	for _, r := range ee.ranges {
+		if code >= r.min && code <= r.max {
+			return true
+		}
+	}
+	return false
+}
+
+func (ee *ErrorEnvelope) requestID(req *httpprot.Request, resp *httpprot.Response) string {
+	key := ee.spec.RequestIDHeader
+	if key == "" {
+		key = defaultRequestIDHeader
+	}
+	if id := resp.HTTPHeader().Get(key); id != "" {
+		return id
+	}
+	if req != nil {
+		return req.HTTPHeader().Get(key)
+	}
+	return ""
+}
+
+// originalBody returns the body of the response, which is decoded if it
+// is a JSON. nil is returned if the body is a stream or is encoded.
+func originalBody(resp *httpprot.Response) interface{} {
+	if resp.IsStream() || resp.HTTPHeader().Get("Content-Encoding") != "" {
+		return nil
+	}
+	raw := resp.RawPayload()
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var body interface{}
+	if codectool.UnmarshalJSON(raw, &body) == nil {
+		return body
+	}
+	return string(raw)
+}
+
+// Handle replaces the body of error responses with the envelope built by
+// the template. Besides the data available to builder filters, the error
+// is available to the template as '.error'.
+func (ee *ErrorEnvelope) Handle(ctx *context.Context) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil || !ee.isError(resp.StatusCode()) {
+		return ""
+	}
+	req, _ := ctx.GetInputRequest().(*httpprot.Request)
+
+	data, err := builder.PrepareBuilderData(ctx)
+	if err == nil {
+		data["error"] = map[string]interface{}{
+			"code":      resp.StatusCode(),
+			"message":   http.StatusText(resp.StatusCode()),
+			"requestID": ee.requestID(req, resp),
+			"timestamp": time.Now().UTC().Format(time.RFC3339),
+			"body":      originalBody(resp),
+		}
+
+		var buf bytes.Buffer
+		if err = ee.template.Execute(&buf, data); err == nil {
+			resp.SetPayload(buf.Bytes())
+			h := resp.HTTPHeader()
+			h.Set("Content-Type", "application/json")
+			h.Set("Content-Length", strconv.Itoa(buf.Len()))
+			h.Del("Content-Encoding")
+			atomic.AddInt64(&ee.numOfNormalized, 1)
+			return ""
+		}
+	}
+
+	atomic.AddInt64(&ee.numOfFailed, 1)
+	logger.Errorf("%s: failed to build error envelope: %v", ee.Name(), err)
+	return ""
+}
+
+// Status returns status.
+func (ee *ErrorEnvelope) Status() interface{} {
+	return &Status{
+		NumOfNormalized: atomic.LoadInt64(&ee.numOfNormalized),
+		NumOfFailed:     atomic.LoadInt64(&ee.numOfFailed),
+	}
+}
+
+// Close closes ErrorEnvelope.
+func (ee *ErrorEnvelope) Close() {}
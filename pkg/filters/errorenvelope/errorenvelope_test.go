@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package errorenvelope
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/builder"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createEnvelope(t *testing.T, yamlConfig string) *ErrorEnvelope {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ee := kind.CreateInstance(spec).(*ErrorEnvelope)
+	ee.Init()
+	return ee
+}
+
+func newContext(t *testing.T, code int, body string) (*context.Context, *httpprot.Response) {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.Header.Set("X-Request-Id", "req-1")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.SetPayload(body)
+	resp.HTTPHeader().Set("Content-Type", "text/plain")
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	ctx.SetOutputResponse(resp)
+	return ctx, resp
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	ee := createEnvelope(t, `
+name: envelope
+kind: ErrorEnvelope
+`)
+
+	ctx, resp := newContext(t, http.StatusOK, "ok")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal("ok", string(resp.RawPayload()))
+
+	ctx, resp = newContext(t, http.StatusNotFound, "not found")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+
+	var body map[string]interface{}
+	assert.NoError(codectool.UnmarshalJSON(resp.RawPayload(), &body))
+	assert.Equal(float64(404), body["code"])
+	assert.Equal("Not Found", body["message"])
+	assert.Equal("req-1", body["requestID"])
+	assert.NotEmpty(body["timestamp"])
+
+	// request id of the response takes precedence
+	ctx, resp = newContext(t, http.StatusBadGateway, "")
+	resp.HTTPHeader().Set("X-Request-Id", "req-2")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Contains(string(resp.RawPayload()), `"requestID": "req-2"`)
+
+	assert.Equal(int64(2), ee.Status().(*Status).NumOfNormalized)
+}
+
+func TestCustomTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	ee := createEnvelope(t, `
+name: envelope
+kind: ErrorEnvelope
+statusCodes: ["500-599", "429"]
+requestIDHeader: X-Trace-Id
+template:
+  template: |
+    {"error": {"status": {{.error.code}}, "detail": {{toJson (.error.body.reason | default .error.message)}}, "trace": {{toJson .error.requestID}}}}
+`)
+
+	ctx, resp := newContext(t, http.StatusNotFound, "not found")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal("not found", string(resp.RawPayload()))
+
+	ctx, resp = newContext(t, http.StatusServiceUnavailable, `{"reason": "overloaded"}`)
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal(`{"error": {"status": 503, "detail": "overloaded", "trace": ""}}`, strings.TrimSpace(string(resp.RawPayload())))
+
+	ctx, resp = newContext(t, http.StatusTooManyRequests, "{}")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal(`{"error": {"status": 429, "detail": "Too Many Requests", "trace": ""}}`, strings.TrimSpace(string(resp.RawPayload())))
+
+	// failed to execute the template
+	ee = createEnvelope(t, `
+name: envelope
+kind: ErrorEnvelope
+template:
+  template: '{{panic "oops"}}'
+`)
+	ctx, resp = newContext(t, http.StatusNotFound, "not found")
+	assert.Equal("", ee.Handle(ctx))
+	assert.Equal("not found", string(resp.RawPayload()))
+	assert.Equal(int64(1), ee.Status().(*Status).NumOfFailed)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, s := range []string{"abc", "600", "500-400", "99", "400-abc"} {
+		spec := &Spec{StatusCodes: []string{s}}
+		assert.Error(spec.Validate(), s)
+	}
+
+	spec := &Spec{StatusCodes: []string{"404", "500 - 599"}}
+	assert.NoError(spec.Validate())
+
+	spec.Template = &builder.Spec{Template: "{{"}
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,325 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of FeatureFlag.
+	Kind = "FeatureFlag"
+
+	// DataKey is the key of the context data to store the values of the
+	// evaluated flags, the value is a map[string]bool.
+	DataKey = "FEATURE_FLAGS"
+
+	defaultCacheTTL = 10 * time.Second
+	maxCacheEntries = 10000
+
+	evalContextIP    = "ip"
+	evalContextHost  = "host"
+	evalContextPath  = "path"
+	evalHeaderPrefix = "header."
+
+	resultDisabled = "disabled"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FeatureFlag evaluates feature flags by a flag provider for requests.",
+	Results:     []string{resultDisabled},
+	// the HTTP provider fetches flags from a remote service.
+	Effects: []string{filters.EffectBackend},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			CacheTTL: defaultCacheTTL.String(),
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FeatureFlag{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// FeatureFlag is filter FeatureFlag.
+	FeatureFlag struct {
+		spec     *Spec
+		provider Provider
+		cacheTTL time.Duration
+
+		lock  sync.Mutex
+		cache map[string]*cacheEntry
+
+		stats map[string]*flagStat
+	}
+
+	// Spec describes the FeatureFlag.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Provider       *ProviderSpec `json:"provider" jsonschema:"required"`
+		Flags          []*FlagSpec   `json:"flags" jsonschema:"required,minItems=1"`
+		ContextHeaders []string      `json:"contextHeaders" jsonschema:"omitempty"`
+		CacheTTL       string        `json:"cacheTTL" jsonschema:"omitempty,format=duration"`
+		Gate           string        `json:"gate" jsonschema:"omitempty"`
+	}
+
+	// FlagSpec describes a flag to evaluate.
+	FlagSpec struct {
+		Key     string `json:"key" jsonschema:"required"`
+		Default bool   `json:"default" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of FeatureFlag.
+	Status struct {
+		Flags map[string]*FlagStatus `json:"flags"`
+	}
+
+	// FlagStatus is the status of a flag.
+	FlagStatus struct {
+		NumOfEvaluations int64 `json:"numOfEvaluations"`
+		NumOfCacheHits   int64 `json:"numOfCacheHits"`
+		NumOfErrors      int64 `json:"numOfErrors"`
+		NumOfEnabled     int64 `json:"numOfEnabled"`
+	}
+
+	flagStat struct {
+		numOfEvaluations int64
+		numOfCacheHits   int64
+		numOfErrors      int64
+		numOfEnabled     int64
+	}
+
+	cacheEntry struct {
+		value    bool
+		expireAt time.Time
+	}
+)
+
+var _ filters.Filter = (*FeatureFlag)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if err := spec.Provider.Validate(); err != nil {
+		return fmt.Errorf("provider: %v", err)
+	}
+
+	keys := map[string]struct{}{}
+	for _, f := range spec.Flags {
+		if f.Key == "" {
+			return fmt.Errorf("flag key must not be empty")
+		}
+		if _, ok := keys[f.Key]; ok {
+			return fmt.Errorf("duplicated flag %s", f.Key)
+		}
+		keys[f.Key] = struct{}{}
+	}
+	if _, ok := keys[spec.Gate]; spec.Gate != "" && !ok {
+		return fmt.Errorf("gate %s is not a flag", spec.Gate)
+	}
+
+	if spec.CacheTTL != "" {
+		if d, err := time.ParseDuration(spec.CacheTTL); err != nil || d < 0 {
+			return fmt.Errorf("invalid cacheTTL %q", spec.CacheTTL)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the FeatureFlag filter instance.
+func (ff *FeatureFlag) Name() string {
+	return ff.spec.Name()
+}
+
+// Kind returns the kind of FeatureFlag.
+func (ff *FeatureFlag) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FeatureFlag
+func (ff *FeatureFlag) Spec() filters.Spec {
+	return ff.spec
+}
+
+// Init initializes FeatureFlag.
+func (ff *FeatureFlag) Init() {
+	ff.reload()
+}
+
+// Inherit inherits previous generation of FeatureFlag.
+func (ff *FeatureFlag) Inherit(previousGeneration filters.Filter) {
+	ff.reload()
+}
+
+func (ff *FeatureFlag) reload() {
+	ff.provider = newProvider(ff.spec.Provider)
+	ff.cacheTTL = defaultCacheTTL
+	if ff.spec.CacheTTL != "" {
+		ff.cacheTTL, _ = time.ParseDuration(ff.spec.CacheTTL)
+	}
+	ff.cache = make(map[string]*cacheEntry)
+
+	ff.stats = make(map[string]*flagStat, len(ff.spec.Flags))
+	for _, f := range ff.spec.Flags {
+		ff.stats[f.Key] = &flagStat{}
+	}
+}
+
+// evalContext builds the evaluation context of the request.
+func (ff *FeatureFlag) evalContext(req *httpprot.Request) map[string]string {
+	evalCtx := map[string]string{
+		evalContextIP:   req.RealIP(),
+		evalContextHost: req.Host(),
+		evalContextPath: req.Path(),
+	}
+	for _, h := range ff.spec.ContextHeaders {
+		evalCtx[evalHeaderPrefix+strings.ToLower(h)] = req.HTTPHeader().Get(h)
+	}
+	return evalCtx
+}
+
+// cacheKey returns the cache key of the flag and the evaluation context.
+func cacheKey(key string, evalCtx map[string]string) string {
+	names := make([]string, 0, len(evalCtx))
+	for k := range evalCtx {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	sb.WriteString(key)
+	for _, k := range names {
+		sb.WriteByte(0)
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(evalCtx[k])
+	}
+	return sb.String()
+}
+
+func (ff *FeatureFlag) getCache(key string, now time.Time) (bool, bool) {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	e := ff.cache[key]
+	if e == nil || now.After(e.expireAt) {
+		return false, false
+	}
+	return e.value, true
+}
+
+func (ff *FeatureFlag) setCache(key string, value bool, now time.Time) {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	// drop all entries if the cache is full, the entries are short-lived
+	// and it is cheap to evaluate them again.
+	if len(ff.cache) >= maxCacheEntries {
+		ff.cache = make(map[string]*cacheEntry)
+	}
+	ff.cache[key] = &cacheEntry{value: value, expireAt: now.Add(ff.cacheTTL)}
+}
+
+// evaluate evaluates the flag, the default value is returned if the
+// provider fails.
+func (ff *FeatureFlag) evaluate(f *FlagSpec, evalCtx map[string]string) bool {
+	stat := ff.stats[f.Key]
+	atomic.AddInt64(&stat.numOfEvaluations, 1)
+
+	now := fasttime.Now()
+	key := cacheKey(f.Key, evalCtx)
+	value, ok := false, false
+	if ff.cacheTTL > 0 {
+		value, ok = ff.getCache(key, now)
+	}
+
+	if ok {
+		atomic.AddInt64(&stat.numOfCacheHits, 1)
+	} else if v, err := ff.provider.Evaluate(f.Key, evalCtx); err != nil {
+		logger.Warnf("%s: failed to evaluate flag %s: %v", ff.Name(), f.Key, err)
+		atomic.AddInt64(&stat.numOfErrors, 1)
+		value = f.Default
+	} else {
+		value = v
+		if ff.cacheTTL > 0 {
+			ff.setCache(key, value, now)
+		}
+	}
+
+	if value {
+		atomic.AddInt64(&stat.numOfEnabled, 1)
+	}
+	return value
+}
+
+// Handle evaluates the flags for the request, and stores the values in
+// the context data, so that other filters could check them. If gate is
+// configured and the gate flag is off, it returns resultDisabled.
+func (ff *FeatureFlag) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	evalCtx := ff.evalContext(req)
+
+	values, _ := ctx.GetData(DataKey).(map[string]bool)
+	if values == nil {
+		values = make(map[string]bool, len(ff.spec.Flags))
+		ctx.SetData(DataKey, values)
+	}
+
+	for _, f := range ff.spec.Flags {
+		values[f.Key] = ff.evaluate(f, evalCtx)
+	}
+
+	if ff.spec.Gate != "" && !values[ff.spec.Gate] {
+		ctx.AddTag("featureFlag: " + ff.spec.Gate + " is disabled")
+		return resultDisabled
+	}
+	return ""
+}
+
+// Status returns status.
+func (ff *FeatureFlag) Status() interface{} {
+	s := &Status{Flags: make(map[string]*FlagStatus, len(ff.stats))}
+	for key, stat := range ff.stats {
+		s.Flags[key] = &FlagStatus{
+			NumOfEvaluations: atomic.LoadInt64(&stat.numOfEvaluations),
+			NumOfCacheHits:   atomic.LoadInt64(&stat.numOfCacheHits),
+			NumOfErrors:      atomic.LoadInt64(&stat.numOfErrors),
+			NumOfEnabled:     atomic.LoadInt64(&stat.numOfEnabled),
+		}
+	}
+	return s
+}
+
+// Close closes FeatureFlag.
+func (ff *FeatureFlag) Close() {}
@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createFeatureFlag(t *testing.T, yamlConfig string) *FeatureFlag {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	ff := kind.CreateInstance(spec).(*FeatureFlag)
+	ff.Init()
+	return ff
+}
+
+func newContext(t *testing.T, user string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.Header.Set("X-User", user)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestStaticProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	ff := createFeatureFlag(t, `
+name: ff
+kind: FeatureFlag
+provider:
+  kind: static
+  flags:
+    newCheckout: true
+    darkMode: false
+flags:
+- key: newCheckout
+- key: darkMode
+- key: unknown
+  default: true
+gate: darkMode
+`)
+
+	ctx := newContext(t, "alice")
+	assert.Equal(resultDisabled, ff.Handle(ctx))
+	assert.Equal(map[string]bool{
+		"newCheckout": true,
+		"darkMode":    false,
+		"unknown":     true,
+	}, ctx.GetData(DataKey))
+
+	ff.Handle(newContext(t, "alice"))
+	status := ff.Status().(*Status)
+	assert.Equal(int64(2), status.Flags["newCheckout"].NumOfEvaluations)
+	assert.Equal(int64(1), status.Flags["newCheckout"].NumOfCacheHits)
+	assert.Equal(int64(2), status.Flags["newCheckout"].NumOfEnabled)
+	assert.Equal(int64(2), status.Flags["unknown"].NumOfErrors)
+	assert.Equal(int64(2), status.Flags["unknown"].NumOfEnabled)
+}
+
+func TestHTTPProvider(t *testing.T) {
+	assert := assert.New(t)
+
+	var calls int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		assert.Equal("token", r.Header.Get("Authorization"))
+
+		var req httpEvalRequest
+		assert.NoError(json.NewDecoder(r.Body).Decode(&req))
+		switch req.Context["header.x-user"] {
+		case "alice":
+			w.Write([]byte(`{"value": true}`))
+		case "bob":
+			w.Write([]byte(`{"value": false}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	ff := createFeatureFlag(t, `
+name: ff
+kind: FeatureFlag
+provider:
+  kind: http
+  url: `+server.URL+`
+  headers:
+    Authorization: token
+flags:
+- key: beta
+  default: true
+contextHeaders: [X-User]
+gate: beta
+`)
+
+	assert.Equal("", ff.Handle(newContext(t, "alice")))
+	assert.Equal("", ff.Handle(newContext(t, "alice")))
+	assert.Equal(resultDisabled, ff.Handle(newContext(t, "bob")))
+
+	// fail to the default value
+	assert.Equal("", ff.Handle(newContext(t, "carol")))
+
+	assert.Equal(int64(3), atomic.LoadInt64(&calls))
+	stat := ff.Status().(*Status).Flags["beta"]
+	assert.Equal(int64(4), stat.NumOfEvaluations)
+	assert.Equal(int64(1), stat.NumOfCacheHits)
+	assert.Equal(int64(1), stat.NumOfErrors)
+	assert.Equal(int64(3), stat.NumOfEnabled)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Provider: &ProviderSpec{Kind: "unknown"}}
+	assert.Error(spec.Validate())
+
+	spec.Provider = &ProviderSpec{Kind: ProviderHTTP}
+	assert.Error(spec.Validate())
+
+	spec.Provider = &ProviderSpec{Kind: ProviderStatic}
+	spec.Flags = []*FlagSpec{{Key: "a"}, {Key: "a"}}
+	assert.Error(spec.Validate())
+
+	spec.Flags = []*FlagSpec{{Key: "a"}}
+	spec.Gate = "b"
+	assert.Error(spec.Validate())
+
+	spec.Gate = "a"
+	spec.CacheTTL = "abc"
+	assert.Error(spec.Validate())
+
+	spec.CacheTTL = "1s"
+	assert.NoError(spec.Validate())
+}
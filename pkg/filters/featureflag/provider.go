@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package featureflag
+
+import (
+	"bytes"
+	stdcontext "context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	// ProviderStatic is the kind of the in-process provider.
+	ProviderStatic = "static"
+	// ProviderHTTP is the kind of the HTTP provider.
+	ProviderHTTP = "http"
+
+	defaultProviderTimeout = time.Second
+	maxResponseSize        = 64 * 1024
+)
+
+type (
+	// Provider evaluates feature flags.
+	Provider interface {
+		// Evaluate evaluates the flag with the evaluation context, which
+		// is attributes of the request.
+		Evaluate(key string, evalCtx map[string]string) (bool, error)
+	}
+
+	// ProviderSpec describes the provider of feature flags.
+	ProviderSpec struct {
+		Kind    string            `json:"kind" jsonschema:"required,enum=static,enum=http"`
+		Flags   map[string]bool   `json:"flags" jsonschema:"omitempty"`
+		URL     string            `json:"url" jsonschema:"omitempty,format=url"`
+		Headers map[string]string `json:"headers" jsonschema:"omitempty"`
+		Timeout string            `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// staticProvider evaluates flags from the values in the spec, the
+	// evaluation context is ignored.
+	staticProvider struct {
+		flags map[string]bool
+	}
+
+	// httpProvider evaluates flags by an external service. It sends a
+	// POST request with body {"key": "...", "context": {...}} to the URL,
+	// and the service responds with body {"value": true|false}.
+	httpProvider struct {
+		spec    *ProviderSpec
+		client  *http.Client
+		timeout time.Duration
+	}
+
+	httpEvalRequest struct {
+		Key     string            `json:"key"`
+		Context map[string]string `json:"context"`
+	}
+
+	httpEvalResponse struct {
+		Value *bool `json:"value"`
+	}
+)
+
+// Validate validates ProviderSpec.
+func (spec *ProviderSpec) Validate() error {
+	switch spec.Kind {
+	case ProviderStatic:
+	case ProviderHTTP:
+		if spec.URL == "" {
+			return fmt.Errorf("url is required for http provider")
+		}
+		if spec.Timeout != "" {
+			if d, err := time.ParseDuration(spec.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("invalid timeout %q", spec.Timeout)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown provider kind %q", spec.Kind)
+	}
+	return nil
+}
+
+// newProvider creates a provider according to the spec.
+func newProvider(spec *ProviderSpec) Provider {
+	if spec.Kind == ProviderHTTP {
+		p := &httpProvider{spec: spec, client: http.DefaultClient}
+		p.timeout, _ = time.ParseDuration(spec.Timeout)
+		if p.timeout <= 0 {
+			p.timeout = defaultProviderTimeout
+		}
+		return p
+	}
+	return &staticProvider{flags: spec.Flags}
+}
+
+// Evaluate implements Provider.
+func (p *staticProvider) Evaluate(key string, evalCtx map[string]string) (bool, error) {
+	v, ok := p.flags[key]
+	if !ok {
+		return false, fmt.Errorf("flag %s not found", key)
+	}
+	return v, nil
+}
+
+// Evaluate implements Provider.
+func (p *httpProvider) Evaluate(key string, evalCtx map[string]string) (bool, error) {
+	body, err := json.Marshal(&httpEvalRequest{Key: key, Context: evalCtx})
+	if err != nil {
+		return false, err
+	}
+
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), p.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.spec.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range p.spec.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("provider responds with status code %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return false, err
+	}
+
+	var result httpEvalResponse
+	if err = json.Unmarshal(data, &result); err != nil {
+		return false, err
+	}
+	if result.Value == nil {
+		return false, fmt.Errorf("provider responds without value")
+	}
+	return *result.Value, nil
+}
@@ -0,0 +1,241 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fieldprojector
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of FieldProjector.
+	Kind = "FieldProjector"
+
+	defaultQueryKey    = "fields"
+	defaultMaxBodySize = 4 * 1024 * 1024
+
+	resultInvalid = "invalid"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "FieldProjector filters JSON responses to the fields selected by clients.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			QueryKey:    defaultQueryKey,
+			MaxBodySize: defaultMaxBodySize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &FieldProjector{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// FieldProjector is filter FieldProjector.
+	FieldProjector struct {
+		spec *Spec
+
+		numOfProjected int64
+		numOfInvalid   int64
+		numOfSkipped   int64
+	}
+
+	// Spec describes the FieldProjector.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		QueryKey    string `json:"queryKey" jsonschema:"omitempty"`
+		HeaderKey   string `json:"headerKey" jsonschema:"omitempty"`
+		MaxBodySize int64  `json:"maxBodySize" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of FieldProjector.
+	Status struct {
+		NumOfProjected int64 `json:"numOfProjected"`
+		NumOfInvalid   int64 `json:"numOfInvalid"`
+		NumOfSkipped   int64 `json:"numOfSkipped"`
+	}
+)
+
+var _ filters.Filter = (*FieldProjector)(nil)
+
+// Name returns the name of the FieldProjector filter instance.
+func (fp *FieldProjector) Name() string {
+	return fp.spec.Name()
+}
+
+// Kind returns the kind of FieldProjector.
+func (fp *FieldProjector) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the FieldProjector
+func (fp *FieldProjector) Spec() filters.Spec {
+	return fp.spec
+}
+
+// Init initializes FieldProjector.
+func (fp *FieldProjector) Init() {
+}
+
+// Inherit inherits previous generation of FieldProjector.
+func (fp *FieldProjector) Inherit(previousGeneration filters.Filter) {
+}
+
+// dataKey is the key of the context data to record the selection of the
+// request, so that the filter knows the response should be projected when
+// it is called again.
+func (fp *FieldProjector) dataKey() string {
+	return "FIELD_PROJECTOR/" + fp.Name()
+}
+
+func (fp *FieldProjector) maxBodySize() int64 {
+	if fp.spec.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return fp.spec.MaxBodySize
+}
+
+// Handle parses the selection of the request when it is called the first
+// time in a pipeline, and projects the response when it is called again
+// after the backend.
+func (fp *FieldProjector) Handle(ctx *context.Context) string {
+	if sel, ok := ctx.GetData(fp.dataKey()).(selection); ok {
+		fp.handleResponse(ctx, sel)
+		return ""
+	}
+	return fp.handleRequest(ctx)
+}
+
+func (fp *FieldProjector) handleRequest(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var value string
+	if fp.spec.HeaderKey != "" {
+		value = req.HTTPHeader().Get(fp.spec.HeaderKey)
+	}
+	if value == "" && fp.spec.QueryKey != "" {
+		value = req.URL().Query().Get(fp.spec.QueryKey)
+	}
+	if value == "" {
+		return ""
+	}
+
+	sel, err := parseSelection(value)
+	if err != nil {
+		atomic.AddInt64(&fp.numOfInvalid, 1)
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusBadRequest)
+		resp.SetPayload([]byte(err.Error()))
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("fieldProjector: " + err.Error())
+		return resultInvalid
+	}
+
+	ctx.SetData(fp.dataKey(), sel)
+	return ""
+}
+
+func isJSON(contentType string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return ct == "application/json" || strings.HasSuffix(ct, "+json")
+}
+
+// readBody reads the body of the response, it returns false if the body
+// is larger than maxBodySize, and the response is left unchanged.
+func (fp *FieldProjector) readBody(resp *httpprot.Response) ([]byte, bool) {
+	if !resp.IsStream() {
+		body := resp.RawPayload()
+		return body, int64(len(body)) <= fp.maxBodySize()
+	}
+
+	stream := resp.GetPayload()
+	body, err := io.ReadAll(io.LimitReader(stream, fp.maxBodySize()+1))
+	if err == nil && int64(len(body)) <= fp.maxBodySize() {
+		return body, true
+	}
+
+	// put back the bytes read, so that the response is not changed.
+	resp.SetPayload(io.MultiReader(bytes.NewReader(body), stream))
+	return nil, false
+}
+
+func (fp *FieldProjector) handleResponse(ctx *context.Context, sel selection) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return
+	}
+
+	h := resp.HTTPHeader()
+	code := resp.StatusCode()
+	if code < 200 || code >= 300 || !isJSON(h.Get("Content-Type")) || h.Get("Content-Encoding") != "" {
+		atomic.AddInt64(&fp.numOfSkipped, 1)
+		return
+	}
+
+	body, ok := fp.readBody(resp)
+	if !ok {
+		atomic.AddInt64(&fp.numOfSkipped, 1)
+		return
+	}
+
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		atomic.AddInt64(&fp.numOfSkipped, 1)
+		resp.SetPayload(body)
+		return
+	}
+
+	data, _ := json.Marshal(sel.project(v))
+	resp.SetPayload(data)
+	resp.ContentLength = int64(len(data))
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	atomic.AddInt64(&fp.numOfProjected, 1)
+}
+
+// Status returns status.
+func (fp *FieldProjector) Status() interface{} {
+	return &Status{
+		NumOfProjected: atomic.LoadInt64(&fp.numOfProjected),
+		NumOfInvalid:   atomic.LoadInt64(&fp.numOfInvalid),
+		NumOfSkipped:   atomic.LoadInt64(&fp.numOfSkipped),
+	}
+}
+
+// Close closes FieldProjector.
+func (fp *FieldProjector) Close() {}
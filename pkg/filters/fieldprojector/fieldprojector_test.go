@@ -0,0 +1,172 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fieldprojector
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createFieldProjector(t *testing.T, yamlConfig string) *FieldProjector {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	fp := kind.CreateInstance(spec).(*FieldProjector)
+	fp.Init()
+	return fp
+}
+
+func newContext(t *testing.T, url string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func setResponse(ctx *context.Context, contentType string, body interface{}) *httpprot.Response {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", contentType)
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return resp
+}
+
+func TestParseSelection(t *testing.T) {
+	assert := assert.New(t)
+
+	sel, err := parseSelection("id, name,address.city,address")
+	assert.NoError(err)
+	assert.Equal(selection{"id": nil, "name": nil, "address": nil}, sel)
+
+	sel, err = parseSelection("address.city,address.geo.lat")
+	assert.NoError(err)
+	assert.Equal(selection{"address": {"city": nil, "geo": {"lat": nil}}}, sel)
+
+	for _, s := range []string{"", "id,", "a..b", ".a", "a b", "a.*", strings.Repeat("a.", 20) + "a"} {
+		_, err = parseSelection(s)
+		assert.Error(err, s)
+	}
+}
+
+func TestFieldProjector(t *testing.T) {
+	assert := assert.New(t)
+
+	fp := createFieldProjector(t, `
+name: projector
+kind: FieldProjector
+headerKey: X-Fields
+`)
+
+	// no selection, the response is not changed
+	ctx := newContext(t, "http://example.com/users")
+	assert.Equal("", fp.Handle(ctx))
+	assert.Nil(ctx.GetData(fp.dataKey()))
+
+	// invalid selection
+	ctx = newContext(t, "http://example.com/users?fields=id,,name")
+	assert.Equal(resultInvalid, fp.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// project a JSON response
+	ctx = newContext(t, "http://example.com/users?fields=id,address.city")
+	assert.Equal("", fp.Handle(ctx))
+	resp := setResponse(ctx, "application/json; charset=utf-8",
+		`[{"id":1,"name":"a","address":{"city":"x","zip":"1"}},{"id":2,"name":"b"}]`)
+	assert.Equal("", fp.Handle(ctx))
+	assert.JSONEq(`[{"id":1,"address":{"city":"x"}},{"id":2}]`, string(resp.RawPayload()))
+	assert.Equal(int64(len(resp.RawPayload())), resp.ContentLength)
+
+	// the header takes precedence over the query
+	ctx = newContext(t, "http://example.com/users?fields=id")
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Fields", "name")
+	fp.Handle(ctx)
+	resp = setResponse(ctx, "application/vnd.api+json", `{"id":12345678901234567890,"name":"a"}`)
+	fp.Handle(ctx)
+	assert.JSONEq(`{"name":"a"}`, string(resp.RawPayload()))
+
+	// non JSON responses are not changed
+	ctx = newContext(t, "http://example.com/users?fields=id")
+	fp.Handle(ctx)
+	resp = setResponse(ctx, "text/plain", `{"id":1,"name":"a"}`)
+	fp.Handle(ctx)
+	assert.Equal(`{"id":1,"name":"a"}`, string(resp.RawPayload()))
+
+	status := fp.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfProjected)
+	assert.Equal(int64(1), status.NumOfInvalid)
+	assert.Equal(int64(1), status.NumOfSkipped)
+}
+
+func TestStream(t *testing.T) {
+	assert := assert.New(t)
+
+	fp := createFieldProjector(t, `
+name: projector
+kind: FieldProjector
+maxBodySize: 32
+`)
+
+	// a stream within the size limit is projected
+	ctx := newContext(t, "http://example.com/?fields=id")
+	fp.Handle(ctx)
+	resp := setResponse(ctx, "application/json", strings.NewReader(`{"id":1,"name":"a"}`))
+	fp.Handle(ctx)
+	assert.False(resp.IsStream())
+	assert.JSONEq(`{"id":1}`, string(resp.RawPayload()))
+
+	// a stream exceeding the size limit is passed through
+	body := `{"id":1,"name":"` + strings.Repeat("a", 64) + `"}`
+	ctx = newContext(t, "http://example.com/?fields=id")
+	fp.Handle(ctx)
+	resp = setResponse(ctx, "application/json", strings.NewReader(body))
+	fp.Handle(ctx)
+	assert.True(resp.IsStream())
+	data, err := io.ReadAll(resp.GetPayload())
+	assert.NoError(err)
+	assert.Equal(body, string(data))
+
+	// so is a non-stream body
+	ctx = newContext(t, "http://example.com/?fields=id")
+	fp.Handle(ctx)
+	resp = setResponse(ctx, "application/json", body)
+	fp.Handle(ctx)
+	assert.Equal(body, string(resp.RawPayload()))
+
+	assert.Equal(int64(2), fp.Status().(*Status).NumOfSkipped)
+}
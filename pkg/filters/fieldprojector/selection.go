@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fieldprojector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxSelectionDepth is the max depth of a field path in a selection.
+const maxSelectionDepth = 16
+
+// selection is a tree of selected fields, a field with no children is
+// selected as a whole.
+type selection map[string]selection
+
+func isValidField(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '$', r == '@':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseSelection parses a comma separated list of field paths, and the
+// fields of a path are separated by dots, e.g. 'id,name,address.city'.
+func parseSelection(s string) (selection, error) {
+	root := selection{}
+
+	for _, path := range strings.Split(s, ",") {
+		path = strings.TrimSpace(path)
+		fields := strings.Split(path, ".")
+		if len(fields) > maxSelectionDepth {
+			return nil, fmt.Errorf("field path %q is too deep", path)
+		}
+
+		node := root
+		for i, field := range fields {
+			if !isValidField(field) {
+				return nil, fmt.Errorf("invalid field path %q", path)
+			}
+
+			child, ok := node[field]
+			if ok && child == nil {
+				// the field is already selected as a whole.
+				break
+			}
+			if i == len(fields)-1 {
+				// select the field as a whole.
+				node[field] = nil
+				break
+			}
+			if !ok {
+				child = selection{}
+				node[field] = child
+			}
+			node = child
+		}
+	}
+
+	return root, nil
+}
+
+// project returns the selected fields of v, the selection is applied to
+// each element of an array, and values other than objects and arrays are
+// returned as is.
+func (sel selection) project(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(sel))
+		for field, child := range sel {
+			fv, ok := v[field]
+			if !ok {
+				continue
+			}
+			if child == nil {
+				result[field] = fv
+			} else {
+				result[field] = child.project(fv)
+			}
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = sel.project(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
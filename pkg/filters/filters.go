@@ -27,6 +27,16 @@ import (
 	"github.com/megaease/easegress/pkg/v"
 )
 
+const (
+	// EffectBackend means the filter sends requests to backends.
+	EffectBackend = "backend"
+	// EffectWrite means the filter writes to external systems.
+	EffectWrite = "write"
+	// EffectState means the filter changes the runtime state shared by
+	// requests, e.g. consumes rate limit budget or concurrency slots.
+	EffectState = "state"
+)
+
 type (
 	// Kind contains the meta data and functions of a filter kind.
 	Kind struct {
@@ -47,6 +57,11 @@ type (
 		// function should always return a new spec copy, because the caller
 		// may modify the returned spec.
 		DefaultSpec func() Spec
+
+		// Effects lists the side effects of the filter, e.g. sending
+		// requests to backends. Filters with side effects are stubbed
+		// when previewing a pipeline.
+		Effects []string
 	}
 
 	// Filter is the interface of filters handling traffic of various protocols.
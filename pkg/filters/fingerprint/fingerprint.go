@@ -0,0 +1,260 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fingerprint
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// Kind is the kind of Fingerprint.
+	Kind = "Fingerprint"
+
+	// DefaultDataKey is the default key of the context data to store the
+	// fingerprint.
+	DefaultDataKey = "FINGERPRINT"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Fingerprint computes a stable fingerprint of the request from configured fields.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			DataKey: DefaultDataKey,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Fingerprint{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Fingerprint is filter Fingerprint.
+	Fingerprint struct {
+		spec *Spec
+		hll  *hyperLogLog
+
+		numOfComputed int64
+		numOfJA3      int64
+	}
+
+	// Spec describes the Fingerprint.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		JA3         bool     `json:"ja3" jsonschema:"omitempty"`
+		HeaderNames bool     `json:"headerNames" jsonschema:"omitempty"`
+		Headers     []string `json:"headers" jsonschema:"omitempty,uniqueItems=true"`
+		DataKey     string   `json:"dataKey" jsonschema:"omitempty"`
+		HeaderKey   string   `json:"headerKey" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Fingerprint.
+	Status struct {
+		NumOfComputed int64  `json:"numOfComputed"`
+		NumOfJA3      int64  `json:"numOfJA3"`
+		Cardinality   uint64 `json:"cardinality"`
+	}
+)
+
+var _ filters.Filter = (*Fingerprint)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if !spec.JA3 && !spec.HeaderNames && len(spec.Headers) == 0 {
+		return fmt.Errorf("at least one of ja3, headerNames and headers is required")
+	}
+	return nil
+}
+
+// isGREASE reports whether v is a GREASE value defined in RFC 8701, which
+// must be ignored by JA3.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func joinUint16(values []uint16) string {
+	var sb strings.Builder
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(strconv.Itoa(int(v)))
+	}
+	return sb.String()
+}
+
+// JA3String returns the JA3 string of the ClientHello, in the format of
+// 'SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats'.
+//
+// The standard library doesn't expose the extensions of a ClientHello, so
+// the extensions field is always empty, and the version is the legacy
+// version derived from the supported versions.
+func JA3String(chi *tls.ClientHelloInfo) string {
+	var version uint16
+	for _, v := range chi.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	if version > tls.VersionTLS12 {
+		version = tls.VersionTLS12
+	}
+
+	points := make([]uint16, len(chi.SupportedPoints))
+	for i, p := range chi.SupportedPoints {
+		points[i] = uint16(p)
+	}
+
+	curves := make([]uint16, len(chi.SupportedCurves))
+	for i, c := range chi.SupportedCurves {
+		curves[i] = uint16(c)
+	}
+
+	return strings.Join([]string{
+		strconv.Itoa(int(version)),
+		joinUint16(chi.CipherSuites),
+		"",
+		joinUint16(curves),
+		joinUint16(points),
+	}, ",")
+}
+
+// JA3Hash returns the MD5 hash of the JA3 string.
+func JA3Hash(chi *tls.ClientHelloInfo) string {
+	sum := md5.Sum([]byte(JA3String(chi)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Name returns the name of the Fingerprint filter instance.
+func (f *Fingerprint) Name() string {
+	return f.spec.Name()
+}
+
+// Kind returns the kind of Fingerprint.
+func (f *Fingerprint) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Fingerprint
+func (f *Fingerprint) Spec() filters.Spec {
+	return f.spec
+}
+
+// Init initializes Fingerprint.
+func (f *Fingerprint) Init() {
+	f.reload()
+}
+
+// Inherit inherits previous generation of Fingerprint.
+func (f *Fingerprint) Inherit(previousGeneration filters.Filter) {
+	f.reload()
+}
+
+func (f *Fingerprint) reload() {
+	f.hll = newHyperLogLog()
+}
+
+// compute computes the fingerprint of the request.
+func (f *Fingerprint) compute(req *httpprot.Request) string {
+	var parts []string
+
+	if f.spec.JA3 {
+		ja3 := ""
+		if chi := req.ClientHello(); chi != nil {
+			ja3 = JA3Hash(chi)
+			atomic.AddInt64(&f.numOfJA3, 1)
+		}
+		parts = append(parts, "ja3="+ja3)
+	}
+
+	// the HTTP server doesn't keep the order of headers, so the sorted
+	// header names are used instead.
+	if f.spec.HeaderNames {
+		names := make([]string, 0, len(req.HTTPHeader()))
+		for name := range req.HTTPHeader() {
+			names = append(names, strings.ToLower(name))
+		}
+		sort.Strings(names)
+		parts = append(parts, "names="+strings.Join(names, ","))
+	}
+
+	for _, name := range f.spec.Headers {
+		v := strings.Join(req.HTTPHeader().Values(name), ",")
+		parts = append(parts, http.CanonicalHeaderKey(name)+"="+v)
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Handle computes the fingerprint of the request and stores it into the
+// context data, and the request header if configured.
+func (f *Fingerprint) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	fp := f.compute(req)
+	atomic.AddInt64(&f.numOfComputed, 1)
+	f.hll.add(murmur3.Sum64([]byte(fp)))
+
+	dataKey := f.spec.DataKey
+	if dataKey == "" {
+		dataKey = DefaultDataKey
+	}
+	ctx.SetData(dataKey, fp)
+
+	if f.spec.HeaderKey != "" {
+		req.HTTPHeader().Set(f.spec.HeaderKey, fp)
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (f *Fingerprint) Status() interface{} {
+	return &Status{
+		NumOfComputed: atomic.LoadInt64(&f.numOfComputed),
+		NumOfJA3:      atomic.LoadInt64(&f.numOfJA3),
+		Cardinality:   f.hll.estimate(),
+	}
+}
+
+// Close closes Fingerprint.
+func (f *Fingerprint) Close() {}
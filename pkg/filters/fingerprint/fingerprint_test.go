@@ -0,0 +1,132 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fingerprint
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/spaolacci/murmur3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createFingerprint(t *testing.T, yamlConfig string) *Fingerprint {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	f := kind.CreateInstance(spec).(*Fingerprint)
+	f.Init()
+	return f
+}
+
+func newContext(t *testing.T, header map[string]string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	for k, v := range header {
+		stdr.Header.Set(k, v)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestJA3(t *testing.T) {
+	assert := assert.New(t)
+
+	chi := &tls.ClientHelloInfo{
+		CipherSuites:      []uint16{0x0a0a, 4865, 4866, 49195},
+		SupportedCurves:   []tls.CurveID{0x1a1a, tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+		SupportedVersions: []uint16{0x2a2a, tls.VersionTLS13, tls.VersionTLS12},
+	}
+	assert.Equal("771,4865-4866-49195,,29-23,0", JA3String(chi))
+	assert.Len(JA3Hash(chi), 32)
+
+	assert.True(isGREASE(0xfafa))
+	assert.False(isGREASE(0x0a0b))
+}
+
+func TestFingerprint(t *testing.T) {
+	assert := assert.New(t)
+
+	f := createFingerprint(t, `
+name: fp
+kind: Fingerprint
+ja3: true
+headerNames: true
+headers: [User-Agent]
+headerKey: X-Fingerprint
+`)
+
+	header := map[string]string{"User-Agent": "curl", "Accept": "*/*"}
+	ctx := newContext(t, header)
+	assert.Equal("", f.Handle(ctx))
+	fp := ctx.GetData(DefaultDataKey).(string)
+	assert.Len(fp, 32)
+	assert.Equal(fp, ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Fingerprint"))
+
+	// the fingerprint is stable.
+	ctx = newContext(t, header)
+	f.Handle(ctx)
+	assert.Equal(fp, ctx.GetData(DefaultDataKey))
+
+	header["User-Agent"] = "wget"
+	ctx = newContext(t, header)
+	f.Handle(ctx)
+	assert.NotEqual(fp, ctx.GetData(DefaultDataKey))
+
+	delete(header, "Accept")
+	ctx = newContext(t, header)
+	f.Handle(ctx)
+	assert.NotEqual(fp, ctx.GetData(DefaultDataKey))
+
+	status := f.Status().(*Status)
+	assert.Equal(int64(4), status.NumOfComputed)
+	assert.Equal(int64(0), status.NumOfJA3)
+	assert.Equal(uint64(3), status.Cardinality)
+
+	rawSpec := map[string]interface{}{"name": "fp", "kind": Kind}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+}
+
+func TestHyperLogLog(t *testing.T) {
+	hll := newHyperLogLog()
+	for i := 0; i < 100000; i++ {
+		hll.add(murmur3.Sum64([]byte(fmt.Sprintf("fp-%d", i%50000))))
+	}
+	assert.InEpsilon(t, 50000, hll.estimate(), 0.03)
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package fingerprint
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+)
+
+// hllPrecision is the precision of the HyperLogLog, there are 2^14
+// registers, and the standard error is about 0.8%.
+const hllPrecision = 14
+
+// hyperLogLog estimates the number of distinct fingerprints with fixed
+// memory.
+type hyperLogLog struct {
+	lock      sync.Mutex
+	registers []uint8
+}
+
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{registers: make([]uint8, 1<<hllPrecision)}
+}
+
+// add adds a 64-bit hash to the HyperLogLog.
+func (h *hyperLogLog) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+
+	h.lock.Lock()
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+	h.lock.Unlock()
+}
+
+// estimate returns the estimated cardinality.
+func (h *hyperLogLog) estimate() uint64 {
+	m := float64(len(h.registers))
+
+	h.lock.Lock()
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+	h.lock.Unlock()
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+
+	// small range correction.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(e + 0.5)
+}
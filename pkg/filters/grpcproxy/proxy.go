@@ -47,6 +47,7 @@ var kind = &filters.Kind{
 		resultServerError,
 		resultShortCircuited,
 	},
+	Effects: []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -0,0 +1,160 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerlimiter
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of HeaderLimiter.
+	Kind = "HeaderLimiter"
+
+	resultTooLarge = "tooLarge"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "HeaderLimiter rejects requests whose headers exceed the configured size or count.",
+	Results:     []string{resultTooLarge},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &HeaderLimiter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// HeaderLimiter is filter HeaderLimiter.
+	HeaderLimiter struct {
+		spec *Spec
+
+		numOfTooLarge int64
+		numOfTooMany  int64
+	}
+
+	// Spec describes the HeaderLimiter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		MaxHeaderBytes int64 `json:"maxHeaderBytes" jsonschema:"omitempty"`
+		MaxHeaderCount int   `json:"maxHeaderCount" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of HeaderLimiter.
+	Status struct {
+		NumOfTooLarge int64 `json:"numOfTooLarge"`
+		NumOfTooMany  int64 `json:"numOfTooMany"`
+	}
+)
+
+var _ filters.Filter = (*HeaderLimiter)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.MaxHeaderBytes < 0 || spec.MaxHeaderCount < 0 {
+		return fmt.Errorf("maxHeaderBytes and maxHeaderCount must not be negative")
+	}
+	if spec.MaxHeaderBytes == 0 && spec.MaxHeaderCount == 0 {
+		return fmt.Errorf("at least one of maxHeaderBytes and maxHeaderCount is required")
+	}
+	return nil
+}
+
+// Name returns the name of the HeaderLimiter filter instance.
+func (hl *HeaderLimiter) Name() string {
+	return hl.spec.Name()
+}
+
+// Kind returns the kind of HeaderLimiter.
+func (hl *HeaderLimiter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the HeaderLimiter
+func (hl *HeaderLimiter) Spec() filters.Spec {
+	return hl.spec
+}
+
+// Init initializes HeaderLimiter.
+func (hl *HeaderLimiter) Init() {
+}
+
+// Inherit inherits previous generation of HeaderLimiter.
+func (hl *HeaderLimiter) Inherit(previousGeneration filters.Filter) {
+}
+
+// measure returns the number of header lines and their total size in the
+// wire format, that is, 'Name: Value\r\n' for each value.
+func measure(h http.Header) (count int, size int64) {
+	for name, values := range h {
+		for _, v := range values {
+			count++
+			size += int64(len(name) + len(v) + 4)
+		}
+	}
+	return
+}
+
+// Handle rejects the request with 431 if its headers exceed the limits.
+func (hl *HeaderLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	count, size := measure(req.HTTPHeader())
+
+	var reason string
+	if hl.spec.MaxHeaderCount > 0 && count > hl.spec.MaxHeaderCount {
+		atomic.AddInt64(&hl.numOfTooMany, 1)
+		reason = fmt.Sprintf("header count %d exceeds %d", count, hl.spec.MaxHeaderCount)
+	} else if hl.spec.MaxHeaderBytes > 0 && size > hl.spec.MaxHeaderBytes {
+		atomic.AddInt64(&hl.numOfTooLarge, 1)
+		reason = fmt.Sprintf("header size %d exceeds %d", size, hl.spec.MaxHeaderBytes)
+	} else {
+		return ""
+	}
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusRequestHeaderFieldsTooLarge)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("headerLimiter: " + reason)
+	return resultTooLarge
+}
+
+// Status returns status.
+func (hl *HeaderLimiter) Status() interface{} {
+	return &Status{
+		NumOfTooLarge: atomic.LoadInt64(&hl.numOfTooLarge),
+		NumOfTooMany:  atomic.LoadInt64(&hl.numOfTooMany),
+	}
+}
+
+// Close closes HeaderLimiter.
+func (hl *HeaderLimiter) Close() {}
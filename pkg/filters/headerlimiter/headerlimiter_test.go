@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package headerlimiter
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createLimiter(t *testing.T, yamlConfig string) *HeaderLimiter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	hl := kind.CreateInstance(spec).(*HeaderLimiter)
+	hl.Init()
+	return hl
+}
+
+func newContext(t *testing.T, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.Header = header
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestHeaderLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	hl := createLimiter(t, `
+name: limiter
+kind: HeaderLimiter
+maxHeaderBytes: 100
+maxHeaderCount: 3
+`)
+
+	count, size := measure(http.Header{"X-A": {"1", "22"}})
+	assert.Equal(2, count)
+	assert.Equal(int64(17), size)
+
+	ctx := newContext(t, http.Header{"X-A": {"1"}, "X-B": {"2"}})
+	assert.Equal("", hl.Handle(ctx))
+
+	header := http.Header{}
+	for i := 0; i < 4; i++ {
+		header.Add("X-"+strconv.Itoa(i), "v")
+	}
+	ctx = newContext(t, header)
+	assert.Equal(resultTooLarge, hl.Handle(ctx))
+	assert.Equal(http.StatusRequestHeaderFieldsTooLarge, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.Header{"X-A": {strings.Repeat("a", 100)}})
+	assert.Equal(resultTooLarge, hl.Handle(ctx))
+
+	status := hl.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfTooMany)
+	assert.Equal(int64(1), status.NumOfTooLarge)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{}).Validate())
+	assert.Error((&Spec{MaxHeaderBytes: -1, MaxHeaderCount: 1}).Validate())
+	assert.NoError((&Spec{MaxHeaderCount: 10}).Validate())
+}
@@ -38,6 +38,7 @@ var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Kafka is a backend of MQTTProxy",
 	Results:     []string{resultGetDataFailed},
+	Effects:     []string{filters.EffectWrite},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -40,6 +40,7 @@ var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Kafka is a backend of MQTTProxy",
 	Results:     []string{resultParseErr},
+	Effects:     []string{filters.EffectWrite},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
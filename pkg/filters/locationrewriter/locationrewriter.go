@@ -0,0 +1,297 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locationrewriter
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of LocationRewriter.
+	Kind = "LocationRewriter"
+)
+
+// rewrittenHeaders are the response headers which may point to upstreams.
+var rewrittenHeaders = []string{"Location", "Content-Location", "Refresh"}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "LocationRewriter rewrites URLs of upstreams in response headers to the gateway.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &LocationRewriter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// LocationRewriter is filter LocationRewriter.
+	LocationRewriter struct {
+		spec     *Spec
+		mappings []*mapping
+	}
+
+	// Spec describes the LocationRewriter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Mappings []*Mapping `json:"mappings" jsonschema:"required,minItems=1"`
+	}
+
+	// Mapping maps an upstream URL prefix to a gateway URL prefix.
+	Mapping struct {
+		From string `json:"from" jsonschema:"required"`
+		To   string `json:"to" jsonschema:"required"`
+	}
+
+	// Status is the status of LocationRewriter.
+	Status struct {
+		NumOfRewritten int64            `json:"numOfRewritten"`
+		Mappings       map[string]int64 `json:"mappings"`
+	}
+
+	mapping struct {
+		from *url.URL
+		to   *url.URL
+
+		numOfRewritten int64
+	}
+)
+
+var _ filters.Filter = (*LocationRewriter)(nil)
+
+func parseFrom(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("host is required")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("query and fragment are not allowed")
+	}
+	return u, nil
+}
+
+func parseTo(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" && !strings.HasPrefix(u.Path, "/") {
+		return nil, fmt.Errorf("must be an absolute URL or a path starting with '/'")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return nil, fmt.Errorf("query and fragment are not allowed")
+	}
+	return u, nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	froms := map[string]bool{}
+	for i, m := range spec.Mappings {
+		if _, err := parseFrom(m.From); err != nil {
+			return fmt.Errorf("mappings[%d]: invalid from %q: %v", i, m.From, err)
+		}
+		if _, err := parseTo(m.To); err != nil {
+			return fmt.Errorf("mappings[%d]: invalid to %q: %v", i, m.To, err)
+		}
+		if froms[m.From] {
+			return fmt.Errorf("mappings[%d]: duplicated from %q", i, m.From)
+		}
+		froms[m.From] = true
+	}
+	return nil
+}
+
+// Name returns the name of the LocationRewriter filter instance.
+func (lr *LocationRewriter) Name() string {
+	return lr.spec.Name()
+}
+
+// Kind returns the kind of LocationRewriter.
+func (lr *LocationRewriter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the LocationRewriter
+func (lr *LocationRewriter) Spec() filters.Spec {
+	return lr.spec
+}
+
+// Init initializes LocationRewriter.
+func (lr *LocationRewriter) Init() {
+	lr.reload()
+}
+
+// Inherit inherits previous generation of LocationRewriter.
+func (lr *LocationRewriter) Inherit(previousGeneration filters.Filter) {
+	lr.reload()
+}
+
+func (lr *LocationRewriter) reload() {
+	lr.mappings = make([]*mapping, 0, len(lr.spec.Mappings))
+	for _, m := range lr.spec.Mappings {
+		from, _ := parseFrom(m.From)
+		to, _ := parseTo(m.To)
+		lr.mappings = append(lr.mappings, &mapping{from: from, to: to})
+	}
+}
+
+// match checks whether u is under the upstream URL of the mapping, and
+// returns the remaining path if it is.
+func (m *mapping) match(u *url.URL) (string, bool) {
+	if !strings.EqualFold(u.Host, m.from.Host) {
+		return "", false
+	}
+	if m.from.Scheme != "" && !strings.EqualFold(u.Scheme, m.from.Scheme) {
+		return "", false
+	}
+
+	prefix := strings.TrimSuffix(m.from.Path, "/")
+	if prefix == "" {
+		return u.Path, true
+	}
+	if u.Path == prefix {
+		return "", true
+	}
+	if strings.HasPrefix(u.Path, prefix+"/") {
+		return u.Path[len(prefix):], true
+	}
+	return "", false
+}
+
+// rewrite rewrites u with the mapping, rest is the path after the prefix
+// of the upstream URL.
+func (m *mapping) rewrite(u *url.URL, rest string) string {
+	result := *u
+	result.Scheme, result.Host, result.User = m.to.Scheme, m.to.Host, m.to.User
+	result.Path = strings.TrimSuffix(m.to.Path, "/") + rest
+	result.RawPath = ""
+	if result.Path == "" && result.Host == "" {
+		result.Path = "/"
+	}
+	return result.String()
+}
+
+// rewriteURL rewrites the URL with the mapping with the longest matching
+// prefix. URLs which are relative or not under any upstream URL are left
+// untouched.
+func (lr *LocationRewriter) rewriteURL(s string) (string, bool) {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return s, false
+	}
+
+	var matched *mapping
+	var matchedRest string
+	for _, m := range lr.mappings {
+		rest, ok := m.match(u)
+		if !ok {
+			continue
+		}
+		if matched == nil || len(m.from.Path) > len(matched.from.Path) {
+			matched, matchedRest = m, rest
+		}
+	}
+	if matched == nil {
+		return s, false
+	}
+
+	atomic.AddInt64(&matched.numOfRewritten, 1)
+	return matched.rewrite(u, matchedRest), true
+}
+
+// rewriteRefresh rewrites the URL in a Refresh header, which is in the
+// form of "5; url=http://example.com/".
+func (lr *LocationRewriter) rewriteRefresh(s string) (string, bool) {
+	idx := strings.Index(strings.ToLower(s), "url=")
+	if idx < 0 {
+		return s, false
+	}
+	idx += len("url=")
+
+	target := strings.TrimSpace(s[idx:])
+	quote := ""
+	if len(target) >= 2 && (target[0] == '\'' || target[0] == '"') && target[len(target)-1] == target[0] {
+		quote, target = target[:1], target[1:len(target)-1]
+	}
+
+	rewritten, ok := lr.rewriteURL(target)
+	if !ok {
+		return s, false
+	}
+	return s[:idx] + quote + rewritten + quote, true
+}
+
+// Handle rewrites the URLs in the response headers.
+func (lr *LocationRewriter) Handle(ctx *context.Context) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return ""
+	}
+
+	h := resp.HTTPHeader()
+	for _, name := range rewrittenHeaders {
+		v := h.Get(name)
+		if v == "" {
+			continue
+		}
+
+		var rewritten string
+		var ok bool
+		if name == "Refresh" {
+			rewritten, ok = lr.rewriteRefresh(v)
+		} else {
+			rewritten, ok = lr.rewriteURL(v)
+		}
+		if ok {
+			h.Set(name, rewritten)
+		}
+	}
+	return ""
+}
+
+// Status returns status.
+func (lr *LocationRewriter) Status() interface{} {
+	s := &Status{Mappings: make(map[string]int64, len(lr.mappings))}
+	for i, m := range lr.mappings {
+		n := atomic.LoadInt64(&m.numOfRewritten)
+		s.NumOfRewritten += n
+		s.Mappings[lr.spec.Mappings[i].From] = n
+	}
+	return s
+}
+
+// Close closes LocationRewriter.
+func (lr *LocationRewriter) Close() {}
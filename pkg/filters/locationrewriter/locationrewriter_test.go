@@ -0,0 +1,127 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package locationrewriter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createRewriter(t *testing.T, yamlConfig string) *LocationRewriter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	lr := kind.CreateInstance(spec).(*LocationRewriter)
+	lr.Init()
+	return lr
+}
+
+func TestLocationRewriter(t *testing.T) {
+	assert := assert.New(t)
+
+	lr := createRewriter(t, `
+name: rewriter
+kind: LocationRewriter
+mappings:
+- from: http://users.internal:8080/
+  to: https://api.example.com/users
+- from: http://users.internal:8080/admin
+  to: /admin-users
+- from: //orders.internal
+  to: https://api.example.com/orders/
+`)
+
+	cases := []struct {
+		header string
+		value  string
+		expect string
+	}{
+		{"Location", "http://users.internal:8080/1?x=y", "https://api.example.com/users/1?x=y"},
+		{"Location", "http://USERS.internal:8080/", "https://api.example.com/users/"},
+		{"Location", "https://users.internal:8080/1", "https://users.internal:8080/1"},
+		{"Location", "http://users.internal:8080/admin/2#top", "/admin-users/2#top"},
+		{"Location", "http://users.internal:8080/admin", "/admin-users"},
+		{"Location", "http://users.internal:8080/administrator", "https://api.example.com/users/administrator"},
+		{"Location", "https://orders.internal/3", "https://api.example.com/orders/3"},
+		{"Location", "https://orders.internal", "https://api.example.com/orders"},
+		{"Location", "https://www.google.com/", "https://www.google.com/"},
+		{"Location", "/relative", "/relative"},
+		{"Content-Location", "http://users.internal:8080/4", "https://api.example.com/users/4"},
+		{"Refresh", "5; URL='http://users.internal:8080/5'", "5; URL='https://api.example.com/users/5'"},
+		{"Refresh", "5;url=https://www.google.com/", "5;url=https://www.google.com/"},
+		{"Refresh", "5", "5"},
+	}
+
+	for _, c := range cases {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(http.StatusFound)
+		resp.HTTPHeader().Set(c.header, c.value)
+		ctx := context.New(nil)
+		ctx.SetOutputResponse(resp)
+
+		assert.Equal("", lr.Handle(ctx))
+		assert.Equal(c.expect, resp.HTTPHeader().Get(c.header), c.value)
+	}
+
+	status := lr.Status().(*Status)
+	assert.Equal(int64(9), status.NumOfRewritten)
+	assert.Equal(int64(5), status.Mappings["http://users.internal:8080/"])
+	assert.Equal(int64(2), status.Mappings["http://users.internal:8080/admin"])
+	assert.Equal(int64(2), status.Mappings["//orders.internal"])
+
+	// no response
+	assert.Equal("", lr.Handle(context.New(nil)))
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Mappings: []*Mapping{{From: "http://a/", To: "/b"}}}
+	assert.NoError(spec.Validate())
+
+	spec.Mappings[0].From = "/a"
+	assert.Error(spec.Validate())
+	spec.Mappings[0].From = "http://a/?x=1"
+	assert.Error(spec.Validate())
+	spec.Mappings[0].From = "http://a/"
+
+	spec.Mappings[0].To = "b"
+	assert.Error(spec.Validate())
+	spec.Mappings[0].To = "http://b/#x"
+	assert.Error(spec.Validate())
+	spec.Mappings[0].To = "http://b/"
+
+	spec.Mappings = append(spec.Mappings, &Mapping{From: "http://a/", To: "/c"})
+	assert.Error(spec.Validate())
+}
@@ -0,0 +1,281 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// Kind is the kind of Maintenance.
+	Kind = "Maintenance"
+
+	// maxMergedStarts is the max number of overlapped starts merged into
+	// one window, to limit the cost of finding the end of a window.
+	maxMergedStarts = 100
+
+	defaultBody = "Service is under maintenance, please retry later.\n"
+
+	resultMaintenance = "maintenance"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Maintenance short-circuits requests during scheduled maintenance windows.",
+	Results:     []string{resultMaintenance},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			StatusCode: http.StatusServiceUnavailable,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Maintenance{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Maintenance is filter Maintenance.
+	Maintenance struct {
+		spec    *Spec
+		windows []*window
+
+		numOfShortCircuited int64
+	}
+
+	// Spec describes the Maintenance.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Windows      []*WindowSpec `json:"windows" jsonschema:"required"`
+		PathPrefixes []string      `json:"pathPrefixes" jsonschema:"omitempty,uniqueItems=true"`
+		StatusCode   int           `json:"statusCode" jsonschema:"omitempty"`
+		Body         string        `json:"body" jsonschema:"omitempty"`
+		ContentType  string        `json:"contentType" jsonschema:"omitempty"`
+	}
+
+	// WindowSpec describes a maintenance window, which starts at the time
+	// of the cron schedule, and lasts for the duration.
+	WindowSpec struct {
+		Schedule string `json:"schedule" jsonschema:"required"`
+		Duration string `json:"duration" jsonschema:"required,format=duration"`
+		Timezone string `json:"timezone" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Maintenance.
+	Status struct {
+		Active              bool   `json:"active"`
+		End                 string `json:"end,omitempty"`
+		NumOfShortCircuited int64  `json:"numOfShortCircuited"`
+	}
+
+	window struct {
+		schedule cron.Schedule
+		duration time.Duration
+	}
+)
+
+var _ filters.Filter = (*Maintenance)(nil)
+
+func (ws *WindowSpec) parse() (*window, error) {
+	d, err := time.ParseDuration(ws.Duration)
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("invalid duration %q", ws.Duration)
+	}
+
+	// the timezone is set by the CRON_TZ prefix of the schedule.
+	schedule := ws.Schedule
+	if ws.Timezone != "" {
+		if _, err := time.LoadLocation(ws.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %v", ws.Timezone, err)
+		}
+		schedule = "CRON_TZ=" + ws.Timezone + " " + schedule
+	}
+
+	s, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %v", ws.Schedule, err)
+	}
+
+	return &window{schedule: s, duration: d}, nil
+}
+
+// end returns the end time of the window if it is active at t.
+func (w *window) end(t time.Time) (time.Time, bool) {
+	// the first start after t-duration is the only start which could
+	// make the window active at t.
+	start := w.schedule.Next(t.Add(-w.duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+
+	// the window is extended if the next start is before its end.
+	end := start.Add(w.duration)
+	for i := 0; i < maxMergedStarts; i++ {
+		next := w.schedule.Next(start)
+		if next.IsZero() || next.After(end) {
+			break
+		}
+		start, end = next, next.Add(w.duration)
+	}
+	return end, true
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for i, ws := range spec.Windows {
+		if _, err := ws.parse(); err != nil {
+			return fmt.Errorf("window %d: %v", i, err)
+		}
+	}
+	if spec.StatusCode != 0 && (spec.StatusCode < 100 || spec.StatusCode > 599) {
+		return fmt.Errorf("invalid statusCode %d", spec.StatusCode)
+	}
+	return nil
+}
+
+// Name returns the name of the Maintenance filter instance.
+func (m *Maintenance) Name() string {
+	return m.spec.Name()
+}
+
+// Kind returns the kind of Maintenance.
+func (m *Maintenance) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Maintenance
+func (m *Maintenance) Spec() filters.Spec {
+	return m.spec
+}
+
+// Init initializes Maintenance.
+func (m *Maintenance) Init() {
+	m.reload()
+}
+
+// Inherit inherits previous generation of Maintenance.
+func (m *Maintenance) Inherit(previousGeneration filters.Filter) {
+	m.reload()
+}
+
+func (m *Maintenance) reload() {
+	m.windows = make([]*window, 0, len(m.spec.Windows))
+	for _, ws := range m.spec.Windows {
+		// the spec is already validated.
+		w, _ := ws.parse()
+		m.windows = append(m.windows, w)
+	}
+}
+
+// activeEnd returns the latest end time of the active windows at t.
+func (m *Maintenance) activeEnd(t time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, w := range m.windows {
+		if e, ok := w.end(t); ok && e.After(end) {
+			end = e
+		}
+	}
+	return end, !end.IsZero()
+}
+
+func (m *Maintenance) match(req *httpprot.Request) bool {
+	if len(m.spec.PathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range m.spec.PathPrefixes {
+		if strings.HasPrefix(req.Path(), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle short-circuits matching requests if a maintenance window is
+// active, the Retry-After header is set to the end of the window.
+func (m *Maintenance) Handle(ctx *context.Context) string {
+	now := fasttime.Now()
+	end, active := m.activeEnd(now)
+	if !active {
+		return ""
+	}
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	if !m.match(req) {
+		return ""
+	}
+
+	atomic.AddInt64(&m.numOfShortCircuited, 1)
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	statusCode := m.spec.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusServiceUnavailable
+	}
+	resp.SetStatusCode(statusCode)
+
+	body, contentType := m.spec.Body, m.spec.ContentType
+	if body == "" {
+		body = defaultBody
+	}
+	if contentType == "" {
+		contentType = "text/plain; charset=utf-8"
+	}
+	resp.HTTPHeader().Set("Content-Type", contentType)
+
+	retryAfter := int64((end.Sub(now) + time.Second - 1) / time.Second)
+	resp.HTTPHeader().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	resp.SetPayload([]byte(body))
+
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("maintenance: in maintenance window")
+	return resultMaintenance
+}
+
+// Status returns status.
+func (m *Maintenance) Status() interface{} {
+	s := &Status{
+		NumOfShortCircuited: atomic.LoadInt64(&m.numOfShortCircuited),
+	}
+	if end, ok := m.activeEnd(fasttime.Now()); ok {
+		s.Active = true
+		s.End = end.Format(time.RFC3339)
+	}
+	return s
+}
+
+// Close closes Maintenance.
+func (m *Maintenance) Close() {}
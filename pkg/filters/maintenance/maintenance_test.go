@@ -0,0 +1,157 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package maintenance
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createMaintenance(t *testing.T, yamlConfig string) *Maintenance {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	m := kind.CreateInstance(spec).(*Maintenance)
+	m.Init()
+	return m
+}
+
+func newContext(t *testing.T, path string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	w, err := (&WindowSpec{Schedule: "0 2 * * SUN", Duration: "2h", Timezone: "Asia/Shanghai"}).parse()
+	assert.NoError(err)
+
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+
+	// 2023-01-01 is a Sunday.
+	_, ok := w.end(time.Date(2023, 1, 1, 1, 59, 0, 0, loc))
+	assert.False(ok)
+
+	end, ok := w.end(time.Date(2023, 1, 1, 2, 0, 0, 0, loc))
+	assert.True(ok)
+	assert.True(end.Equal(time.Date(2023, 1, 1, 4, 0, 0, 0, loc)))
+
+	_, ok = w.end(time.Date(2023, 1, 1, 3, 59, 59, 0, loc))
+	assert.True(ok)
+
+	_, ok = w.end(time.Date(2023, 1, 1, 4, 0, 0, 0, loc))
+	assert.False(ok)
+
+	// the same time in UTC is not in the window.
+	_, ok = w.end(time.Date(2023, 1, 1, 2, 30, 0, 0, time.UTC))
+	assert.False(ok)
+
+	// overlapped windows are merged.
+	w, err = (&WindowSpec{Schedule: "0,30 * * * *", Duration: "40m"}).parse()
+	assert.NoError(err)
+	end, ok = w.end(time.Date(2023, 1, 1, 0, 35, 0, 0, time.Local))
+	assert.True(ok)
+	assert.True(end.Sub(time.Date(2023, 1, 1, 0, 35, 0, 0, time.Local)) > 30*time.Minute)
+}
+
+func TestMaintenance(t *testing.T) {
+	assert := assert.New(t)
+
+	// the window is always active.
+	m := createMaintenance(t, `
+name: maintenance
+kind: Maintenance
+windows:
+- schedule: "* * * * *"
+  duration: 2m
+pathPrefixes: ["/api/"]
+body: '{"message": "maintenance"}'
+contentType: application/json
+`)
+
+	ctx := newContext(t, "/static/a.js")
+	assert.Equal("", m.Handle(ctx))
+
+	ctx = newContext(t, "/api/users")
+	assert.Equal(resultMaintenance, m.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusServiceUnavailable, resp.StatusCode())
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	assert.Equal(`{"message": "maintenance"}`, string(resp.RawPayload()))
+
+	retryAfter, err := strconv.Atoi(resp.HTTPHeader().Get("Retry-After"))
+	assert.NoError(err)
+	// the overlapped windows are merged.
+	assert.Greater(retryAfter, 120)
+
+	status := m.Status().(*Status)
+	assert.True(status.Active)
+	assert.Equal(int64(1), status.NumOfShortCircuited)
+
+	// the window is never active.
+	m = createMaintenance(t, `
+name: maintenance
+kind: Maintenance
+windows:
+- schedule: "0 0 30 2 *"
+  duration: 1h
+`)
+	ctx = newContext(t, "/api/users")
+	assert.Equal("", m.Handle(ctx))
+	assert.False(m.Status().(*Status).Active)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Windows: []*WindowSpec{{Schedule: "abc", Duration: "1h"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Windows: []*WindowSpec{{Schedule: "0 2 * * *", Duration: "-1h"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Windows: []*WindowSpec{{Schedule: "0 2 * * *", Duration: "1h", Timezone: "Mars/Base"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Windows: []*WindowSpec{{Schedule: "0 2 * * *", Duration: "1h", Timezone: "UTC"}}}
+	assert.NoError(spec.Validate())
+}
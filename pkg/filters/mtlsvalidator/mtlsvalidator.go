@@ -0,0 +1,471 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mtlsvalidator
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of MTLSValidator.
+	Kind = "MTLSValidator"
+
+	resultInvalid = "invalid"
+
+	// DefaultDataKey is the default key of the context data to store the
+	// client identity.
+	DefaultDataKey = "MTLS_CLIENT_IDENTITY"
+
+	defaultOCSPTimeout   = 3 * time.Second
+	defaultOCSPCacheTime = time.Hour
+	// maxOCSPCacheSize bounds the OCSP cache, as every distinct client
+	// certificate adds an entry to it.
+	maxOCSPCacheSize = 10000
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "MTLSValidator verifies the TLS client certificate of HTTP requests.",
+	Results:     []string{resultInvalid},
+	// revocation is checked with OCSP responders.
+	Effects: []string{filters.EffectBackend},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{DataKey: DefaultDataKey}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &MTLSValidator{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// MTLSValidator verifies the TLS client certificate of HTTP requests.
+	MTLSValidator struct {
+		spec *Spec
+
+		roots      *x509.CertPool
+		subjects   map[string]struct{}
+		sans       map[string]struct{}
+		revoked    map[string]struct{}
+		ocspClient *http.Client
+
+		ocspLock  sync.Mutex
+		ocspCache map[string]*ocspResult
+
+		numOfSuccess int64
+		numOfFailure int64
+	}
+
+	// Spec describes the MTLSValidator.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		CACertBase64      string    `json:"caCertBase64" jsonschema:"required,format=base64"`
+		AllowedSubjects   []string  `json:"allowedSubjects" jsonschema:"omitempty,uniqueItems=true"`
+		AllowedSANs       []string  `json:"allowedSANs" jsonschema:"omitempty,uniqueItems=true"`
+		CRLBase64         []string  `json:"crlBase64" jsonschema:"omitempty"`
+		OCSP              *OCSPSpec `json:"ocsp,omitempty" jsonschema:"omitempty"`
+		IdentityHeaderKey string    `json:"identityHeaderKey" jsonschema:"omitempty"`
+		DataKey           string    `json:"dataKey" jsonschema:"omitempty"`
+	}
+
+	// OCSPSpec describes how to check certificate revocation via OCSP.
+	OCSPSpec struct {
+		Timeout  string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		FailOpen bool   `json:"failOpen" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of MTLSValidator.
+	Status struct {
+		NumOfSuccess int64 `json:"numOfSuccess"`
+		NumOfFailure int64 `json:"numOfFailure"`
+	}
+
+	ocspResult struct {
+		err    error
+		expire time.Time
+	}
+)
+
+var _ filters.Filter = (*MTLSValidator)(nil)
+
+func parseCertificates(b64 string) ([]*x509.Certificate, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	return certs, nil
+}
+
+func parseRevocationList(b64 string, cas []*x509.Certificate) (*x509.RevocationList, error) {
+	data, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, err
+	}
+
+	// the CRL could be either PEM or DER encoded.
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ca := range cas {
+		if crl.CheckSignatureFrom(ca) == nil {
+			return crl, nil
+		}
+	}
+	return nil, fmt.Errorf("CRL is not signed by any of the CA certificates")
+}
+
+// Validate validates the Spec.
+func (spec *Spec) Validate() error {
+	cas, err := parseCertificates(spec.CACertBase64)
+	if err != nil {
+		return fmt.Errorf("invalid caCertBase64: %v", err)
+	}
+
+	for i, crl := range spec.CRLBase64 {
+		if _, err := parseRevocationList(crl, cas); err != nil {
+			return fmt.Errorf("invalid crlBase64 %d: %v", i, err)
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the MTLSValidator filter instance.
+func (mv *MTLSValidator) Name() string {
+	return mv.spec.Name()
+}
+
+// Kind returns the kind of MTLSValidator.
+func (mv *MTLSValidator) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the MTLSValidator
+func (mv *MTLSValidator) Spec() filters.Spec {
+	return mv.spec
+}
+
+// Init initializes MTLSValidator.
+func (mv *MTLSValidator) Init() {
+	mv.reload()
+}
+
+// Inherit inherits previous generation of MTLSValidator.
+func (mv *MTLSValidator) Inherit(previousGeneration filters.Filter) {
+	mv.reload()
+}
+
+func (mv *MTLSValidator) reload() {
+	// the spec is validated, so errors are impossible here.
+	cas, _ := parseCertificates(mv.spec.CACertBase64)
+	mv.roots = x509.NewCertPool()
+	for _, ca := range cas {
+		mv.roots.AddCert(ca)
+	}
+
+	mv.subjects = make(map[string]struct{})
+	for _, s := range mv.spec.AllowedSubjects {
+		mv.subjects[s] = struct{}{}
+	}
+
+	mv.sans = make(map[string]struct{})
+	for _, s := range mv.spec.AllowedSANs {
+		mv.sans[s] = struct{}{}
+	}
+
+	mv.revoked = make(map[string]struct{})
+	for _, b64 := range mv.spec.CRLBase64 {
+		crl, _ := parseRevocationList(b64, cas)
+		for _, rc := range crl.RevokedCertificates {
+			mv.revoked[revocationKey(crl.RawIssuer, rc.SerialNumber)] = struct{}{}
+		}
+	}
+
+	if mv.spec.OCSP != nil {
+		timeout, _ := time.ParseDuration(mv.spec.OCSP.Timeout)
+		if timeout <= 0 {
+			timeout = defaultOCSPTimeout
+		}
+		mv.ocspClient = &http.Client{Timeout: timeout}
+		mv.ocspCache = make(map[string]*ocspResult)
+	}
+
+	if mv.spec.DataKey == "" {
+		mv.spec.DataKey = DefaultDataKey
+	}
+}
+
+// revocationKey returns the key to look up the revocation state of a
+// certificate, serial numbers are only unique among the certificates of
+// the same issuer.
+func revocationKey(rawIssuer []byte, serial *big.Int) string {
+	return string(rawIssuer) + ":" + serial.String()
+}
+
+func (mv *MTLSValidator) isAllowed(cert *x509.Certificate) bool {
+	if len(mv.subjects) == 0 && len(mv.sans) == 0 {
+		return true
+	}
+
+	if _, ok := mv.subjects[cert.Subject.CommonName]; ok {
+		return true
+	}
+	if _, ok := mv.subjects[cert.Subject.String()]; ok {
+		return true
+	}
+
+	for _, name := range cert.DNSNames {
+		if _, ok := mv.sans[name]; ok {
+			return true
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if _, ok := mv.sans[email]; ok {
+			return true
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if _, ok := mv.sans[ip.String()]; ok {
+			return true
+		}
+	}
+	for _, uri := range cert.URIs {
+		if _, ok := mv.sans[uri.String()]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (mv *MTLSValidator) queryOCSP(leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	reqBody, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, server := range leaf.OCSPServer {
+		resp, err := mv.ocspClient.Post(server, "application/ocsp-request", bytes.NewReader(reqBody))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return ocsp.ParseResponseForCert(body, leaf, issuer)
+	}
+
+	return nil, lastErr
+}
+
+func (mv *MTLSValidator) checkOCSP(leaf, issuer *x509.Certificate) error {
+	if len(leaf.OCSPServer) == 0 {
+		return nil
+	}
+
+	key := revocationKey(leaf.RawIssuer, leaf.SerialNumber)
+	now := time.Now()
+
+	mv.ocspLock.Lock()
+	r := mv.ocspCache[key]
+	mv.ocspLock.Unlock()
+	if r != nil && now.Before(r.expire) {
+		return r.err
+	}
+
+	resp, err := mv.queryOCSP(leaf, issuer)
+	if err != nil {
+		logger.Warnf("%s: failed to query OCSP responder: %v", mv.Name(), err)
+		if mv.spec.OCSP.FailOpen {
+			return nil
+		}
+		return fmt.Errorf("failed to query OCSP responder: %v", err)
+	}
+
+	r = &ocspResult{expire: now.Add(defaultOCSPCacheTime)}
+	if !resp.NextUpdate.IsZero() {
+		r.expire = resp.NextUpdate
+	}
+	switch resp.Status {
+	case ocsp.Good:
+	case ocsp.Revoked:
+		r.err = fmt.Errorf("certificate %s is revoked", leaf.SerialNumber.String())
+	default:
+		r.err = fmt.Errorf("certificate %s has unknown OCSP status", leaf.SerialNumber.String())
+	}
+
+	mv.putOCSPResult(key, r, now)
+	return r.err
+}
+
+// putOCSPResult puts the result into the OCSP cache. When the cache is
+// full, expired results are evicted, and an arbitrary one is evicted if
+// none of them is expired.
+func (mv *MTLSValidator) putOCSPResult(key string, r *ocspResult, now time.Time) {
+	mv.ocspLock.Lock()
+	defer mv.ocspLock.Unlock()
+
+	if _, ok := mv.ocspCache[key]; !ok && len(mv.ocspCache) >= maxOCSPCacheSize {
+		for k, v := range mv.ocspCache {
+			if !now.Before(v.expire) {
+				delete(mv.ocspCache, k)
+			}
+		}
+		for k := range mv.ocspCache {
+			if len(mv.ocspCache) < maxOCSPCacheSize {
+				break
+			}
+			delete(mv.ocspCache, k)
+		}
+	}
+
+	mv.ocspCache[key] = r
+}
+
+func (mv *MTLSValidator) verify(req *httpprot.Request) (*x509.Certificate, error) {
+	state := req.Std().TLS
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("no client certificate")
+	}
+
+	leaf := state.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         mv.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !mv.isAllowed(leaf) {
+		return nil, fmt.Errorf("certificate %q is not allowed", leaf.Subject.String())
+	}
+
+	if _, ok := mv.revoked[revocationKey(leaf.RawIssuer, leaf.SerialNumber)]; ok {
+		return nil, fmt.Errorf("certificate %s is revoked", leaf.SerialNumber.String())
+	}
+
+	if mv.ocspClient != nil && len(chains[0]) > 1 {
+		if err := mv.checkOCSP(leaf, chains[0][1]); err != nil {
+			return nil, err
+		}
+	}
+
+	return leaf, nil
+}
+
+// Handle verifies the client certificate of the request.
+func (mv *MTLSValidator) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	cert, err := mv.verify(req)
+	if err != nil {
+		atomic.AddInt64(&mv.numOfFailure, 1)
+
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusForbidden)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag(stringtool.Cat("mtlsValidator: ", err.Error()))
+		return resultInvalid
+	}
+
+	atomic.AddInt64(&mv.numOfSuccess, 1)
+
+	identity := cert.Subject.CommonName
+	ctx.SetData(mv.spec.DataKey, identity)
+	if mv.spec.IdentityHeaderKey != "" {
+		req.HTTPHeader().Set(mv.spec.IdentityHeaderKey, identity)
+	}
+
+	return ""
+}
+
+// Status returns status.
+func (mv *MTLSValidator) Status() interface{} {
+	return &Status{
+		NumOfSuccess: atomic.LoadInt64(&mv.numOfSuccess),
+		NumOfFailure: atomic.LoadInt64(&mv.numOfFailure),
+	}
+}
+
+// Close closes MTLSValidator.
+func (mv *MTLSValidator) Close() {
+}
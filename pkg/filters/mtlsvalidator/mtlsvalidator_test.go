@@ -0,0 +1,290 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package mtlsvalidator
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, cn string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, dnsNames ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	return cert
+}
+
+func (ca *testCA) crl(t *testing.T, serials ...int64) []byte {
+	tmpl := &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Hour),
+		NextUpdate: time.Now().Add(time.Hour),
+	}
+	for _, s := range serials {
+		tmpl.RevokedCertificates = append(tmpl.RevokedCertificates, pkix.RevokedCertificate{
+			SerialNumber:   big.NewInt(s),
+			RevocationTime: time.Now(),
+		})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, ca.cert, ca.key)
+	assert.NoError(t, err)
+	return der
+}
+
+func createValidator(t *testing.T, yamlConfig string, prev *MTLSValidator) *MTLSValidator {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	mv := kind.CreateInstance(spec).(*MTLSValidator)
+	if prev == nil {
+		mv.Init()
+	} else {
+		mv.Inherit(prev)
+	}
+	return mv
+}
+
+func newContext(t *testing.T, certs ...*x509.Certificate) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	if len(certs) > 0 {
+		stdr.TLS = &tls.ConnectionState{PeerCertificates: certs}
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+
+	rawSpec := map[string]interface{}{
+		"name":         "mtls",
+		"kind":         Kind,
+		"caCertBase64": base64.StdEncoding.EncodeToString([]byte("not a certificate")),
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	rawSpec["caCertBase64"] = base64.StdEncoding.EncodeToString(ca.pem)
+	rawSpec["crlBase64"] = []string{base64.StdEncoding.EncodeToString(other.crl(t, 2))}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	rawSpec["crlBase64"] = []string{base64.StdEncoding.EncodeToString(ca.crl(t, 2))}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+}
+
+func TestMTLSValidator(t *testing.T) {
+	assert := assert.New(t)
+
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+
+	good := ca.issue(t, 2, "partner-a", "a.partner.com")
+	unlisted := ca.issue(t, 3, "partner-b", "b.partner.com")
+	revoked := ca.issue(t, 4, "partner-c", "c.partner.com")
+	untrusted := other.issue(t, 2, "partner-a", "a.partner.com")
+
+	yamlConfig := `
+name: mtls
+kind: MTLSValidator
+caCertBase64: ` + base64.StdEncoding.EncodeToString(ca.pem) + `
+allowedSubjects: ["partner-a"]
+allowedSANs: ["c.partner.com"]
+crlBase64: [` + base64.StdEncoding.EncodeToString(ca.crl(t, 4)) + `]
+identityHeaderKey: X-Client-Identity
+`
+	mv := createValidator(t, yamlConfig, nil)
+
+	// no client certificate
+	ctx := newContext(t)
+	assert.Equal(resultInvalid, mv.Handle(ctx))
+	assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// valid certificate
+	ctx = newContext(t, good)
+	assert.Equal("", mv.Handle(ctx))
+	assert.Equal("partner-a", ctx.GetData(DefaultDataKey))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("partner-a", req.HTTPHeader().Get("X-Client-Identity"))
+
+	// not in allow list
+	ctx = newContext(t, unlisted)
+	assert.Equal(resultInvalid, mv.Handle(ctx))
+
+	// allowed by SAN but revoked
+	ctx = newContext(t, revoked)
+	assert.Equal(resultInvalid, mv.Handle(ctx))
+
+	// signed by another CA
+	ctx = newContext(t, untrusted)
+	assert.Equal(resultInvalid, mv.Handle(ctx))
+
+	status := mv.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfSuccess)
+	assert.Equal(int64(4), status.NumOfFailure)
+
+	// reload with a new allow list, counters are reset.
+	yamlConfig = `
+name: mtls
+kind: MTLSValidator
+caCertBase64: ` + base64.StdEncoding.EncodeToString(ca.pem) + `
+allowedSANs: ["b.partner.com"]
+`
+	mv2 := createValidator(t, yamlConfig, mv)
+	mv.Close()
+
+	ctx = newContext(t, unlisted)
+	assert.Equal("", mv2.Handle(ctx))
+	ctx = newContext(t, good)
+	assert.Equal(resultInvalid, mv2.Handle(ctx))
+
+	status = mv2.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfSuccess)
+	assert.Equal(int64(1), status.NumOfFailure)
+	mv2.Close()
+}
+
+func TestRevocationByIssuer(t *testing.T) {
+	assert := assert.New(t)
+
+	ca1 := newTestCA(t, "ca1")
+	ca2 := newTestCA(t, "ca2")
+	revoked := ca1.issue(t, 4, "partner-a")
+	// same serial number, but issued by another CA.
+	good := ca2.issue(t, 4, "partner-b")
+
+	yamlConfig := `
+name: mtls
+kind: MTLSValidator
+caCertBase64: ` + base64.StdEncoding.EncodeToString(append(ca1.pem, ca2.pem...)) + `
+crlBase64: [` + base64.StdEncoding.EncodeToString(ca1.crl(t, 4)) + `]
+`
+	mv := createValidator(t, yamlConfig, nil)
+	defer mv.Close()
+
+	assert.Equal(resultInvalid, mv.Handle(newContext(t, revoked)))
+	assert.Equal("", mv.Handle(newContext(t, good)))
+}
+
+func TestOCSPCacheBound(t *testing.T) {
+	assert := assert.New(t)
+
+	mv := &MTLSValidator{ocspCache: make(map[string]*ocspResult)}
+	now := time.Now()
+
+	// half of the results are expired, they are evicted when the cache
+	// is full.
+	for i := 0; i < maxOCSPCacheSize; i++ {
+		r := &ocspResult{expire: now.Add(time.Hour)}
+		if i%2 == 0 {
+			r.expire = now.Add(-time.Hour)
+		}
+		mv.putOCSPResult(fmt.Sprint(i), r, now)
+	}
+	assert.Len(mv.ocspCache, maxOCSPCacheSize)
+
+	mv.putOCSPResult("new", &ocspResult{expire: now.Add(time.Hour)}, now)
+	assert.Len(mv.ocspCache, maxOCSPCacheSize/2+1)
+
+	// none of the results is expired, an arbitrary one is evicted.
+	for i := 0; len(mv.ocspCache) < maxOCSPCacheSize; i++ {
+		mv.putOCSPResult(fmt.Sprint("more", i), &ocspResult{expire: now.Add(time.Hour)}, now)
+	}
+	mv.putOCSPResult("new2", &ocspResult{expire: now.Add(time.Hour)}, now)
+	assert.Len(mv.ocspCache, maxOCSPCacheSize)
+	assert.Contains(mv.ocspCache, "new2")
+}
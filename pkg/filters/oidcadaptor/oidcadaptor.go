@@ -54,6 +54,7 @@ var kind = &filters.Kind{
 	Name:        kindName,
 	Description: "OIDCAdaptor implement OpenID Connect authorization code flow spec",
 	Results:     []string{resultFiltered},
+	Effects:     []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
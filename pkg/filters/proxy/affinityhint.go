@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"net"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/ipfilter"
+	"github.com/spaolacci/murmur3"
+)
+
+type (
+	// AffinityHintSpec is the spec to honor the affinity key hinted by
+	// clients.
+	AffinityHintSpec struct {
+		// HeaderKey is the header carrying the affinity key.
+		HeaderKey string `json:"headerKey" jsonschema:"required"`
+		// TrustedIPs are the IPs or CIDRs of clients whose hints are honored.
+		TrustedIPs []string `json:"trustedIPs" jsonschema:"required,minItems=1,uniqueItems=true,format=ipcidr-array"`
+	}
+
+	// AffinityHintStatus is the status of the affinity hint.
+	AffinityHintStatus struct {
+		NumOfHonored    int64 `json:"numOfHonored"`
+		NumOfOverridden int64 `json:"numOfOverridden"`
+		NumOfAbsent     int64 `json:"numOfAbsent"`
+	}
+
+	// affinityHintLoadBalancer chooses servers by the affinity key in
+	// requests from trusted clients, and delegates to the load balancer of
+	// the configured policy otherwise.
+	affinityHintLoadBalancer struct {
+		LoadBalancer
+		spec    *AffinityHintSpec
+		trusted *ipfilter.IPFilter
+
+		numOfHonored    int64
+		numOfOverridden int64
+		numOfAbsent     int64
+	}
+)
+
+func newAffinityHintLoadBalancer(spec *AffinityHintSpec, lb LoadBalancer) *affinityHintLoadBalancer {
+	return &affinityHintLoadBalancer{
+		LoadBalancer: lb,
+		spec:         spec,
+		trusted: ipfilter.New(&ipfilter.Spec{
+			BlockByDefault: true,
+			AllowIPs:       spec.TrustedIPs,
+		}),
+	}
+}
+
+// peerIP returns the IP of the direct peer of the request, headers like
+// X-Forwarded-For are not used as they can be forged by clients.
+func peerIP(req *httpprot.Request) string {
+	host, _, err := net.SplitHostPort(req.Std().RemoteAddr)
+	if err != nil {
+		return req.Std().RemoteAddr
+	}
+	return host
+}
+
+// ChooseServer chooses the server by the affinity key if the request
+// carries one and comes from a trusted client.
+func (lb *affinityHintLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	key := req.HTTPHeader().Get(lb.spec.HeaderKey)
+	if key == "" {
+		atomic.AddInt64(&lb.numOfAbsent, 1)
+		return lb.LoadBalancer.ChooseServer(req)
+	}
+
+	if !lb.trusted.Allow(peerIP(req)) {
+		atomic.AddInt64(&lb.numOfOverridden, 1)
+		return lb.LoadBalancer.ChooseServer(req)
+	}
+
+	atomic.AddInt64(&lb.numOfHonored, 1)
+	svr := chooseServerByKey(lb.HealthyServers(), key)
+	if svr != nil {
+		// the server is not chosen by the wrapped load balancer, acquire
+		// it to balance the release after the request is done.
+		lb.acquireServer(svr)
+	}
+	return svr
+}
+
+// chooseServerByKey chooses a server for the key with rendezvous hashing,
+// so that only keys on the removed server are affected when the healthy
+// servers change.
+func chooseServerByKey(servers []*Server, key string) *Server {
+	var chosen *Server
+	var maxScore uint64
+	for _, s := range servers {
+		score := murmur3.Sum64([]byte(s.ID() + "/" + key))
+		if chosen == nil || score > maxScore {
+			chosen, maxScore = s, score
+		}
+	}
+	return chosen
+}
+
+// acquireServer implements the serverLoadTracker interface, so that the
+// load tracked by the wrapped load balancer is acquired.
+func (lb *affinityHintLoadBalancer) acquireServer(server *Server) {
+	if lt, ok := lb.LoadBalancer.(serverLoadTracker); ok {
+		lt.acquireServer(server)
+	}
+}
+
+// releaseServer implements the serverLoadTracker interface, so that the
+// load tracked by the wrapped load balancer is released.
+func (lb *affinityHintLoadBalancer) releaseServer(server *Server) {
+	if lt, ok := lb.LoadBalancer.(serverLoadTracker); ok {
+		lt.releaseServer(server)
+	}
+}
+
+func (lb *affinityHintLoadBalancer) status() *AffinityHintStatus {
+	return &AffinityHintStatus{
+		NumOfHonored:    atomic.LoadInt64(&lb.numOfHonored),
+		NumOfOverridden: atomic.LoadInt64(&lb.numOfOverridden),
+		NumOfAbsent:     atomic.LoadInt64(&lb.numOfAbsent),
+	}
+}
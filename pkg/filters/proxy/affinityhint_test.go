@@ -0,0 +1,136 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAffinityHintLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var servers []*Server
+	for i := 0; i < 5; i++ {
+		servers = append(servers, &Server{URL: fmt.Sprintf("http://server-%d", i)})
+	}
+
+	spec := &LoadBalanceSpec{
+		Policy: LoadBalancePolicyRoundRobin,
+		AffinityHint: &AffinityHintSpec{
+			HeaderKey:  "X-Affinity-Key",
+			TrustedIPs: []string{"10.0.0.0/8"},
+		},
+	}
+	lb := newAffinityHintLoadBalancer(spec.AffinityHint, NewLoadBalancer(spec, servers))
+	defer lb.Close()
+
+	newRequest := func(ip, key string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		stdr.RemoteAddr = ip + ":12345"
+		stdr.Header.Set("X-Forwarded-For", "10.0.0.1")
+		if key != "" {
+			stdr.Header.Set("X-Affinity-Key", key)
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	// trusted clients are routed by the affinity key
+	for _, key := range []string{"a", "b", "c"} {
+		svr := lb.ChooseServer(newRequest("10.0.0.1", key))
+		for i := 0; i < 10; i++ {
+			assert.Equal(svr, lb.ChooseServer(newRequest("10.1.2.3", key)))
+		}
+	}
+
+	// only keys on the removed server are affected
+	chosen := map[string]*Server{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		chosen[key] = lb.ChooseServer(newRequest("10.0.0.1", key))
+	}
+	lb.LoadBalancer.(*roundRobinLoadBalancer).healthyServers.Store(servers[1:])
+	for key, svr := range chosen {
+		if svr != servers[0] {
+			assert.Equal(svr, lb.ChooseServer(newRequest("10.0.0.1", key)))
+		}
+	}
+	lb.LoadBalancer.(*roundRobinLoadBalancer).healthyServers.Store(servers)
+
+	// hints from untrusted clients are overridden by the default policy,
+	// and forwarded headers are not trusted.
+	used := map[*Server]bool{}
+	for i := 0; i < 5; i++ {
+		used[lb.ChooseServer(newRequest("192.168.0.1", "a"))] = true
+	}
+	assert.Len(used, 5)
+
+	used = map[*Server]bool{}
+	for i := 0; i < 5; i++ {
+		used[lb.ChooseServer(newRequest("10.0.0.1", ""))] = true
+	}
+	assert.Len(used, 5)
+
+	status := lb.status()
+	assert.Greater(status.NumOfHonored, int64(133))
+	assert.Equal(int64(5), status.NumOfOverridden)
+	assert.Equal(int64(5), status.NumOfAbsent)
+}
+
+func TestAffinityHintLoadBalancerReleaseLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(3)
+	spec := &LoadBalanceSpec{
+		Policy:        "boundedLoadHash",
+		HeaderHashKey: "X-Header",
+		AffinityHint: &AffinityHintSpec{
+			HeaderKey:  "X-Affinity-Key",
+			TrustedIPs: []string{"10.0.0.0/8"},
+		},
+	}
+	inner := NewLoadBalancer(spec, servers)
+	lb := newAffinityHintLoadBalancer(spec.AffinityHint, inner)
+	defer lb.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.RemoteAddr = "10.0.0.1:12345"
+	stdr.Header.Set("X-Affinity-Key", "a")
+	req, _ := httpprot.NewRequest(stdr)
+
+	// hinted requests acquire the load of the server in the wrapped load
+	// balancer, and release it after they are done.
+	var chosen []*Server
+	for i := 0; i < 5; i++ {
+		chosen = append(chosen, lb.ChooseServer(req))
+	}
+	loads := inner.(*boundedLoadHashLoadBalancer).status().Loads
+	assert.Equal(int64(5), loads[chosen[0].ID()])
+
+	for _, svr := range chosen {
+		lb.releaseServer(svr)
+	}
+	for _, load := range inner.(*boundedLoadHashLoadBalancer).status().Loads {
+		assert.Equal(int64(0), load)
+	}
+}
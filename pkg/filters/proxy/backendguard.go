@@ -0,0 +1,40 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"github.com/megaease/easegress/pkg/context"
+)
+
+// BackendGuardDataKey is the key of the context data of a BackendGuard.
+const BackendGuardDataKey = "PROXY_BACKEND_GUARD"
+
+// BackendGuard checks whether a request is allowed to be sent to a backend,
+// which is identified by the name of the Proxy and the index of the pool in
+// the form of "{proxy}/{index}", or "{proxy}/mirror" for the mirror pool.
+// Filters in front of the Proxy could set a BackendGuard to the context
+// data with key BackendGuardDataKey, and the request is rejected if the
+// guard returns an error.
+type BackendGuard func(backend string) error
+
+func checkBackendGuard(ctx *context.Context, backend string) error {
+	if guard, ok := ctx.GetData(BackendGuardDataKey).(BackendGuard); ok {
+		return guard(backend)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackendGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+- filter:
+    headers:
+      X-Tenant:
+        exact: b
+  servers:
+  - url: http://127.0.0.1:9096
+mirrorPool:
+  filter:
+    headers:
+      X-Mirror:
+        exact: mirror
+  servers:
+  - url: http://127.0.0.1:9097
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+	defer proxy.Close()
+
+	var numOfMirrored int32
+	proxy.sendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		if r.URL.Port() == "9097" {
+			atomic.AddInt32(&numOfMirrored, 1)
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	var backends []string
+	guard := BackendGuard(func(backend string) error {
+		backends = append(backends, backend)
+		if backend == "proxy/0" {
+			return nil
+		}
+		return fmt.Errorf("%s is not allowed", backend)
+	})
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com", nil)
+	stdr.Header.Set("X-Mirror", "mirror")
+	ctx := getCtx(stdr)
+	ctx.SetData(BackendGuardDataKey, guard)
+	assert.Equal("", proxy.Handle(ctx))
+	assert.Equal([]string{"proxy/mirror", "proxy/0"}, backends)
+
+	backends = nil
+	stdr, _ = http.NewRequest(http.MethodGet, "http://www.megaease.com", nil)
+	stdr.Header.Set("X-Tenant", "b")
+	ctx = getCtx(stdr)
+	ctx.SetData(BackendGuardDataKey, guard)
+	assert.Equal(resultInternalError, proxy.Handle(ctx))
+	assert.Equal([]string{"proxy/1"}, backends)
+	assert.Equal(http.StatusInternalServerError, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the mirror request is never sent.
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(int32(0), atomic.LoadInt32(&numOfMirrored))
+}
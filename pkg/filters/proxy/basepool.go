@@ -68,6 +68,19 @@ func (sps *BaseServerPoolSpec) Validate() error {
 		return fmt.Errorf("can not open health check for service discovery")
 	}
 
+	if sps.LoadBalance != nil && sps.LoadBalance.BoundedLoadFactor != 0 && sps.LoadBalance.BoundedLoadFactor < 1 {
+		return fmt.Errorf("boundedLoadFactor must not be less than 1")
+	}
+
+	if sps.LoadBalance != nil && sps.LoadBalance.Policy == LoadBalancePolicyRegionFailover {
+		if sps.LoadBalance.RegionFailover == nil {
+			return fmt.Errorf("regionFailover is required for policy regionFailover")
+		}
+		if err := sps.LoadBalance.RegionFailover.Validate(); err != nil {
+			return fmt.Errorf("regionFailover: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -132,6 +145,12 @@ func (bsp *BaseServerPool) createLoadBalancer(spec *LoadBalanceSpec, servers []*
 	}
 
 	lb := NewLoadBalancer(spec, servers)
+	if spec.AffinityHint != nil {
+		lb = newAffinityHintLoadBalancer(spec.AffinityHint, lb)
+	}
+	if spec.ForceUpstream != nil {
+		lb = newForceUpstreamLoadBalancer(spec.ForceUpstream, lb, servers)
+	}
 	if old := bsp.loadBalancer.Swap(lb); old != nil {
 		old.(LoadBalancer).Close()
 	}
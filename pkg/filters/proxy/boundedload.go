@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/spaolacci/murmur3"
+)
+
+const (
+	// DefaultBoundedLoadFactor is the default load factor of the bounded
+	// load hash load balancer.
+	DefaultBoundedLoadFactor = 1.25
+
+	boundedLoadVirtualNodes = 100
+)
+
+// serverLoadTracker is implemented by load balancers which track the load
+// of servers, a server chosen by ChooseServer must be released after the
+// request is done. Load balancers wrapping a tracker must acquire the
+// servers they choose without calling the ChooseServer of the tracker, so
+// that the release is balanced.
+type serverLoadTracker interface {
+	acquireServer(server *Server)
+	releaseServer(server *Server)
+}
+
+// BoundedLoadStatus is the status of the bounded load hash load balancer.
+type BoundedLoadStatus struct {
+	Loads           map[string]int64 `json:"loads"`
+	NumOfReassigned int64            `json:"numOfReassigned"`
+}
+
+type hashRing struct {
+	servers []*Server
+	hashes  []uint64
+	owners  []*Server
+}
+
+// boundedLoadHashLoadBalancer does load balancing with consistent hashing
+// with bounded loads, that's, keys are assigned to servers by consistent
+// hashing, but a server is skipped if its load exceeds the load factor
+// times the average load, and the next server on the ring is tried.
+type boundedLoadHashLoadBalancer struct {
+	BaseLoadBalancer
+	key        string
+	loadFactor float64
+
+	ring            atomic.Value
+	loads           map[*Server]*int64
+	totalLoad       int64
+	numOfReassigned int64
+}
+
+func newBoundedLoadHashLoadBalancer(spec *LoadBalanceSpec, servers []*Server) *boundedLoadHashLoadBalancer {
+	lb := &boundedLoadHashLoadBalancer{}
+	lb.init(spec, servers)
+	lb.key = spec.HeaderHashKey
+
+	lb.loadFactor = spec.BoundedLoadFactor
+	if lb.loadFactor < 1 {
+		lb.loadFactor = DefaultBoundedLoadFactor
+	}
+
+	lb.loads = make(map[*Server]*int64, len(servers))
+	for _, s := range servers {
+		lb.loads[s] = new(int64)
+	}
+	return lb
+}
+
+// getRing returns the hash ring of the healthy servers, the ring is
+// rebuilt when the healthy servers changes.
+func (lb *boundedLoadHashLoadBalancer) getRing() *hashRing {
+	servers := lb.HealthyServers()
+	if v := lb.ring.Load(); v != nil {
+		ring := v.(*hashRing)
+		// the healthy servers is always replaced as a whole, so comparing
+		// the backing array is enough.
+		if len(ring.servers) == len(servers) && (len(servers) == 0 || &ring.servers[0] == &servers[0]) {
+			return ring
+		}
+	}
+
+	ring := &hashRing{servers: servers}
+	type node struct {
+		hash   uint64
+		server *Server
+	}
+	nodes := make([]node, 0, len(servers)*boundedLoadVirtualNodes)
+	for _, s := range servers {
+		for i := 0; i < boundedLoadVirtualNodes; i++ {
+			h := murmur3.Sum64([]byte(s.ID() + "#" + strconv.Itoa(i)))
+			nodes = append(nodes, node{hash: h, server: s})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].hash < nodes[j].hash })
+
+	ring.hashes = make([]uint64, len(nodes))
+	ring.owners = make([]*Server, len(nodes))
+	for i, n := range nodes {
+		ring.hashes[i] = n.hash
+		ring.owners[i] = n.server
+	}
+
+	lb.ring.Store(ring)
+	return ring
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *boundedLoadHashLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.HealthyServers()) == 0 {
+		return nil
+	}
+
+	if server := lb.BaseLoadBalancer.ChooseServer(req); server != nil {
+		atomic.AddInt64(lb.loads[server], 1)
+		atomic.AddInt64(&lb.totalLoad, 1)
+		return server
+	}
+
+	key := req.HTTPHeader().Get(lb.key)
+	if key == "" {
+		key = req.RealIP()
+	}
+
+	ring := lb.getRing()
+	n := len(ring.servers)
+	avg := float64(atomic.LoadInt64(&lb.totalLoad)+1) / float64(n)
+	capacity := int64(math.Ceil(avg * lb.loadFactor))
+
+	hash := murmur3.Sum64([]byte(key))
+	start := sort.Search(len(ring.hashes), func(i int) bool { return ring.hashes[i] >= hash })
+
+	var first *Server
+	for i := 0; i < len(ring.owners); i++ {
+		server := ring.owners[(start+i)%len(ring.owners)]
+		if first == nil {
+			first = server
+		}
+		if atomic.LoadInt64(lb.loads[server]) < capacity {
+			if server != first {
+				atomic.AddInt64(&lb.numOfReassigned, 1)
+			}
+			atomic.AddInt64(lb.loads[server], 1)
+			atomic.AddInt64(&lb.totalLoad, 1)
+			return server
+		}
+	}
+
+	// should not reach here as there's always a server with load less
+	// than the average, but concurrent requests may break this.
+	atomic.AddInt64(lb.loads[first], 1)
+	atomic.AddInt64(&lb.totalLoad, 1)
+	return first
+}
+
+// acquireServer implements the serverLoadTracker interface.
+func (lb *boundedLoadHashLoadBalancer) acquireServer(server *Server) {
+	if load := lb.loads[server]; load != nil {
+		atomic.AddInt64(load, 1)
+		atomic.AddInt64(&lb.totalLoad, 1)
+	}
+}
+
+// releaseServer implements the serverLoadTracker interface.
+func (lb *boundedLoadHashLoadBalancer) releaseServer(server *Server) {
+	if load := lb.loads[server]; load != nil {
+		atomic.AddInt64(load, -1)
+		atomic.AddInt64(&lb.totalLoad, -1)
+	}
+}
+
+func (lb *boundedLoadHashLoadBalancer) status() *BoundedLoadStatus {
+	s := &BoundedLoadStatus{
+		Loads:           make(map[string]int64, len(lb.loads)),
+		NumOfReassigned: atomic.LoadInt64(&lb.numOfReassigned),
+	}
+	for server, load := range lb.loads {
+		s.Loads[server.ID()] = atomic.LoadInt64(load)
+	}
+	return s
+}
@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultCohortMinRequests = 100
+	cohortCheckInterval      = time.Second
+	// cohortErrorRateWindow is the window to calculate the error rate,
+	// errors happened long ago should not roll back the cohort.
+	cohortErrorRateWindow = time.Minute
+)
+
+type (
+	// CohortExpansionSpec is the spec to expand a canary cohort by
+	// schedule.
+	CohortExpansionSpec struct {
+		StartAt      string               `json:"startAt" jsonschema:"required,format=date-time"`
+		Steps        []*ExpansionStepSpec `json:"steps" jsonschema:"required,minItems=1"`
+		MaxErrorRate float64              `json:"maxErrorRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		MinRequests  uint64               `json:"minRequests" jsonschema:"omitempty"`
+	}
+
+	// ExpansionStepSpec is a step of the cohort expansion.
+	ExpansionStepSpec struct {
+		After  string `json:"after" jsonschema:"required,format=duration"`
+		Permil uint32 `json:"permil" jsonschema:"required,minimum=0,maximum=1000"`
+	}
+
+	// CohortStatus is the status of the canary cohort.
+	CohortStatus struct {
+		Permil           uint32 `json:"permil"`
+		NumOfEnrolled    int64  `json:"numOfEnrolled"`
+		NumOfNotEnrolled int64  `json:"numOfNotEnrolled"`
+		RolledBack       bool   `json:"rolledBack"`
+		RollbackReason   string `json:"rollbackReason,omitempty"`
+	}
+
+	// cohortMatcher matches requests whose hash value is less than the
+	// permil of the current step, as the permil never decreases, requests
+	// in the cohort stay in it.
+	cohortMatcher struct {
+		key     func(req *httpprot.Request) string
+		permil  uint32
+		startAt time.Time
+		steps   []cohortStep
+		spec    *CohortExpansionSpec
+
+		// stat is the stat of the pool, used to roll back the cohort.
+		stat      *httpstat.HTTPStat
+		lastCheck int64
+
+		lock           sync.Mutex
+		samples        []cohortSample
+		rolledBack     int32
+		rollbackReason string
+
+		numOfEnrolled    int64
+		numOfNotEnrolled int64
+	}
+
+	cohortStep struct {
+		after  time.Duration
+		permil uint32
+	}
+
+	// cohortSample is a sample of the request counters of the pool.
+	cohortSample struct {
+		at       time.Time
+		count    uint64
+		errCount uint64
+	}
+)
+
+// Validate validates the CohortExpansionSpec, the permil of the steps must
+// not decrease.
+func (s *CohortExpansionSpec) Validate(permil uint32) error {
+	if _, err := time.Parse(time.RFC3339, s.StartAt); err != nil {
+		return fmt.Errorf("invalid startAt %q", s.StartAt)
+	}
+
+	var last time.Duration
+	for i, step := range s.Steps {
+		d, err := time.ParseDuration(step.After)
+		if err != nil || d < last {
+			return fmt.Errorf("step %d: invalid after %q, it must not be less than the previous one", i, step.After)
+		}
+		if step.Permil < permil || step.Permil > 1000 {
+			return fmt.Errorf("step %d: invalid permil %d, it must not be less than the previous one", i, step.Permil)
+		}
+		last, permil = d, step.Permil
+	}
+	return nil
+}
+
+func newCohortMatcher(spec *RequestMatcherSpec, key func(req *httpprot.Request) string) *cohortMatcher {
+	m := &cohortMatcher{
+		key:    key,
+		permil: spec.Permil,
+		spec:   spec.Expansion,
+	}
+	m.startAt, _ = time.Parse(time.RFC3339, spec.Expansion.StartAt)
+	for _, s := range spec.Expansion.Steps {
+		d, _ := time.ParseDuration(s.After)
+		m.steps = append(m.steps, cohortStep{after: d, permil: s.Permil})
+	}
+	return m
+}
+
+// inherit inherits the counters of the previous generation, the rollback
+// state is also inherited unless the expansion spec is updated, so that
+// updating other parts of the proxy doesn't resume a rolled back cohort.
+func (m *cohortMatcher) inherit(prev *cohortMatcher) {
+	m.numOfEnrolled = atomic.LoadInt64(&prev.numOfEnrolled)
+	m.numOfNotEnrolled = atomic.LoadInt64(&prev.numOfNotEnrolled)
+
+	if !reflect.DeepEqual(m.spec, prev.spec) {
+		return
+	}
+	prev.lock.Lock()
+	m.rollbackReason = prev.rollbackReason
+	prev.lock.Unlock()
+	m.rolledBack = atomic.LoadInt32(&prev.rolledBack)
+}
+
+// currentPermil returns the permil of the cohort at the time.
+func (m *cohortMatcher) currentPermil(now time.Time) uint32 {
+	if atomic.LoadInt32(&m.rolledBack) == 1 {
+		return 0
+	}
+	permil := m.permil
+	elapsed := now.Sub(m.startAt)
+	for _, s := range m.steps {
+		if elapsed < s.after {
+			break
+		}
+		permil = s.permil
+	}
+	return permil
+}
+
+// checkRollback rolls back the cohort if the error rate of the pool in
+// the recent window is higher than the threshold, it is checked at most
+// once per interval.
+func (m *cohortMatcher) checkRollback(now time.Time) {
+	if m.spec.MaxErrorRate <= 0 || m.stat == nil || atomic.LoadInt32(&m.rolledBack) == 1 {
+		return
+	}
+
+	last := atomic.LoadInt64(&m.lastCheck)
+	if now.UnixNano()-last < int64(cohortCheckInterval) {
+		return
+	}
+	if !atomic.CompareAndSwapInt64(&m.lastCheck, last, now.UnixNano()) {
+		return
+	}
+
+	minRequests := m.spec.MinRequests
+	if minRequests == 0 {
+		minRequests = defaultCohortMinRequests
+	}
+	s := m.stat.Status()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// the error rate is calculated against the latest sample out of the
+	// window, or the zero counters the pool starts with.
+	if len(m.samples) == 0 {
+		m.samples = append(m.samples, cohortSample{})
+	}
+	m.samples = append(m.samples, cohortSample{at: now, count: s.Count, errCount: s.ErrCount})
+	for len(m.samples) > 1 && now.Sub(m.samples[1].at) >= cohortErrorRateWindow {
+		m.samples = m.samples[1:]
+	}
+
+	base := m.samples[0]
+	count := s.Count - base.count
+	if count < minRequests {
+		return
+	}
+	rate := float64(s.ErrCount-base.errCount) / float64(count)
+	if rate <= m.spec.MaxErrorRate {
+		return
+	}
+
+	m.rollbackReason = fmt.Sprintf("error rate %.4f exceeds %.4f", rate, m.spec.MaxErrorRate)
+	atomic.StoreInt32(&m.rolledBack, 1)
+	logger.Warnf("canary cohort rolled back: %s", m.rollbackReason)
+}
+
+// Match implements RequestMatcher.
+func (m *cohortMatcher) Match(req *httpprot.Request) bool {
+	now := fasttime.Now()
+	m.checkRollback(now)
+
+	hash := fnv.New32()
+	hash.Write([]byte(m.key(req)))
+	if hash.Sum32()%1000 < m.currentPermil(now) {
+		atomic.AddInt64(&m.numOfEnrolled, 1)
+		return true
+	}
+	atomic.AddInt64(&m.numOfNotEnrolled, 1)
+	return false
+}
+
+func (m *cohortMatcher) status() *CohortStatus {
+	m.lock.Lock()
+	reason := m.rollbackReason
+	m.lock.Unlock()
+
+	return &CohortStatus{
+		Permil:           m.currentPermil(fasttime.Now()),
+		NumOfEnrolled:    atomic.LoadInt64(&m.numOfEnrolled),
+		NumOfNotEnrolled: atomic.LoadInt64(&m.numOfNotEnrolled),
+		RolledBack:       atomic.LoadInt32(&m.rolledBack) == 1,
+		RollbackReason:   reason,
+	}
+}
@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCohortMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	startAt := time.Now().Add(-90 * time.Minute)
+	spec := &RequestMatcherSpec{
+		Policy:        "headerHash",
+		HeaderHashKey: "X-User",
+		Permil:        10,
+		Expansion: &CohortExpansionSpec{
+			StartAt: startAt.Format(time.RFC3339),
+			Steps: []*ExpansionStepSpec{
+				{After: "1h", Permil: 50},
+				{After: "2h", Permil: 200},
+			},
+		},
+	}
+	assert.NoError(spec.Validate())
+	m := NewRequestMatcher(spec).(*cohortMatcher)
+
+	assert.Equal(uint32(10), m.currentPermil(startAt))
+	assert.Equal(uint32(50), m.currentPermil(startAt.Add(time.Hour)))
+	assert.Equal(uint32(200), m.currentPermil(startAt.Add(3*time.Hour)))
+
+	newRequest := func(user string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		stdr.Header.Set("X-User", user)
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	// users enrolled in the current step stay enrolled in later steps
+	enrolled := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if m.Match(newRequest(user)) {
+			enrolled[user] = true
+		}
+	}
+	assert.InDelta(50, len(enrolled), 30)
+
+	m.startAt = startAt.Add(-time.Hour)
+	n := 0
+	for i := 0; i < 1000; i++ {
+		user := fmt.Sprintf("user-%d", i)
+		if m.Match(newRequest(user)) {
+			n++
+		} else {
+			assert.False(enrolled[user])
+		}
+	}
+	assert.Greater(n, len(enrolled))
+
+	status := m.status()
+	assert.Equal(uint32(200), status.Permil)
+	assert.Equal(int64(len(enrolled)+n), status.NumOfEnrolled)
+	assert.Equal(int64(2000), status.NumOfEnrolled+status.NumOfNotEnrolled)
+
+	// the counters are inherited
+	m2 := NewRequestMatcher(spec).(*cohortMatcher)
+	m2.inherit(m)
+	assert.Equal(status.NumOfEnrolled, m2.status().NumOfEnrolled)
+}
+
+func TestCohortMatcherRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &RequestMatcherSpec{
+		Policy: "ipHash",
+		Permil: 1000,
+		Expansion: &CohortExpansionSpec{
+			StartAt:      time.Now().Format(time.RFC3339),
+			Steps:        []*ExpansionStepSpec{{After: "1h", Permil: 1000}},
+			MaxErrorRate: 0.1,
+			MinRequests:  10,
+		},
+	}
+	m := NewRequestMatcher(spec).(*cohortMatcher)
+	m.stat = httpstat.New()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+
+	for i := 0; i < 9; i++ {
+		m.stat.Stat(&httpstat.Metric{StatusCode: http.StatusInternalServerError})
+	}
+	assert.True(m.Match(req))
+
+	// too few requests to roll back
+	m.lastCheck = 0
+	assert.True(m.Match(req))
+
+	m.stat.Stat(&httpstat.Metric{StatusCode: http.StatusOK})
+	m.lastCheck = 0
+	assert.False(m.Match(req))
+
+	status := m.status()
+	assert.True(status.RolledBack)
+	assert.Equal(uint32(0), status.Permil)
+	assert.NotEmpty(status.RollbackReason)
+
+	// the rollback state is kept unless the expansion spec is updated
+	m2 := NewRequestMatcher(spec).(*cohortMatcher)
+	m2.inherit(m)
+	assert.True(m2.status().RolledBack)
+	assert.Equal(status.RollbackReason, m2.status().RollbackReason)
+
+	spec2 := *spec
+	expansion := *spec.Expansion
+	expansion.MaxErrorRate = 0.2
+	spec2.Expansion = &expansion
+	m3 := NewRequestMatcher(&spec2).(*cohortMatcher)
+	m3.inherit(m)
+	assert.False(m3.status().RolledBack)
+}
+
+func TestCohortMatcherErrorRateWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &RequestMatcherSpec{
+		Policy: "ipHash",
+		Permil: 1000,
+		Expansion: &CohortExpansionSpec{
+			StartAt:      time.Now().Format(time.RFC3339),
+			Steps:        []*ExpansionStepSpec{{After: "1h", Permil: 1000}},
+			MaxErrorRate: 0.1,
+			MinRequests:  10,
+		},
+	}
+	m := NewRequestMatcher(spec).(*cohortMatcher)
+	m.stat = httpstat.New()
+
+	now := time.Now()
+	for i := 0; i < 9; i++ {
+		m.stat.Stat(&httpstat.Metric{StatusCode: http.StatusInternalServerError})
+	}
+	m.checkRollback(now)
+	assert.False(m.status().RolledBack)
+
+	// the errors are out of the window, the error rate of the recent
+	// requests is 0.
+	for i := 0; i < 10; i++ {
+		m.stat.Stat(&httpstat.Metric{StatusCode: http.StatusOK})
+	}
+	now = now.Add(2 * cohortErrorRateWindow)
+	m.checkRollback(now)
+	assert.False(m.status().RolledBack)
+
+	for i := 0; i < 10; i++ {
+		m.stat.Stat(&httpstat.Metric{StatusCode: http.StatusInternalServerError})
+	}
+	now = now.Add(cohortCheckInterval)
+	m.checkRollback(now)
+	assert.True(m.status().RolledBack)
+}
+
+func TestCohortExpansionSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Now().Format(time.RFC3339)
+	spec := &RequestMatcherSpec{
+		Policy: "random",
+		Permil: 10,
+		Expansion: &CohortExpansionSpec{
+			StartAt: now,
+			Steps:   []*ExpansionStepSpec{{After: "1h", Permil: 50}},
+		},
+	}
+	assert.Error(spec.Validate())
+
+	spec.Policy = "ipHash"
+	assert.NoError(spec.Validate())
+
+	spec.Expansion.StartAt = "abc"
+	assert.Error(spec.Validate())
+
+	spec.Expansion.StartAt = now
+	spec.Expansion.Steps = []*ExpansionStepSpec{{After: "1h", Permil: 5}}
+	assert.Error(spec.Validate())
+
+	spec.Expansion.Steps = []*ExpansionStepSpec{{After: "2h", Permil: 50}, {After: "1h", Permil: 60}}
+	assert.Error(spec.Validate())
+}
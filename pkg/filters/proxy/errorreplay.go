@@ -0,0 +1,215 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	defaultErrorReplayQueueSize = 100
+	defaultErrorReplayTimeout   = 10 * time.Second
+)
+
+// credentialHeaders are removed from replayed requests unless forwarding
+// them is enabled explicitly, as the sandbox is usually less trusted.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+type (
+	// ErrorReplaySpec describes how to replay failed requests to a sandbox.
+	ErrorReplaySpec struct {
+		URL                string  `json:"url" jsonschema:"required,format=uri"`
+		SamplingRate       float64 `json:"samplingRate" jsonschema:"omitempty,minimum=0,maximum=1"`
+		QueueSize          int     `json:"queueSize" jsonschema:"omitempty"`
+		Timeout            string  `json:"timeout" jsonschema:"omitempty,format=duration"`
+		ForwardCredentials bool    `json:"forwardCredentials" jsonschema:"omitempty"`
+	}
+
+	// ErrorReplayStatus is the status of error replay.
+	ErrorReplayStatus struct {
+		NumOfReplayed int64 `json:"numOfReplayed"`
+		NumOfFailed   int64 `json:"numOfFailed"`
+		NumOfDropped  int64 `json:"numOfDropped"`
+	}
+
+	// errorReplayer replays captured requests to the sandbox in a
+	// background goroutine, so that it is off the critical path.
+	errorReplayer struct {
+		name   string
+		spec   *ErrorReplaySpec
+		client *http.Client
+		queue  chan *capturedRequest
+		done   chan struct{}
+		wg     sync.WaitGroup
+
+		numOfReplayed int64
+		numOfFailed   int64
+		numOfDropped  int64
+	}
+
+	capturedRequest struct {
+		method string
+		uri    string
+		header http.Header
+		body   []byte
+	}
+)
+
+// Validate validates ErrorReplaySpec.
+func (s *ErrorReplaySpec) Validate() error {
+	if s.QueueSize < 0 {
+		return fmt.Errorf("queueSize must not be negative")
+	}
+	if s.Timeout != "" {
+		if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", s.Timeout)
+		}
+	}
+	return nil
+}
+
+func newErrorReplayer(name string, spec *ErrorReplaySpec) *errorReplayer {
+	queueSize := spec.QueueSize
+	if queueSize == 0 {
+		queueSize = defaultErrorReplayQueueSize
+	}
+
+	timeout, _ := time.ParseDuration(spec.Timeout)
+	if timeout <= 0 {
+		timeout = defaultErrorReplayTimeout
+	}
+
+	er := &errorReplayer{
+		name:   name,
+		spec:   spec,
+		client: &http.Client{Timeout: timeout},
+		queue:  make(chan *capturedRequest, queueSize),
+		done:   make(chan struct{}),
+	}
+
+	er.wg.Add(1)
+	go er.run()
+	return er
+}
+
+// isErrorResult reports whether the request is finished with an error, that
+// is, the result is not empty or the status code is 5xx.
+func isErrorResult(ctx *context.Context, result string) bool {
+	if result != "" {
+		return true
+	}
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	return resp != nil && resp.StatusCode() >= 500
+}
+
+// capture captures the request and puts it into the replay queue if it is
+// sampled, the request is dropped if the queue is full. No request is
+// sampled if the sampling rate is 0.
+func (er *errorReplayer) capture(req *httpprot.Request) {
+	if rand.Float64() >= er.spec.SamplingRate {
+		return
+	}
+
+	// the body of a stream request has been consumed.
+	if req.IsStream() {
+		atomic.AddInt64(&er.numOfDropped, 1)
+		return
+	}
+
+	cr := &capturedRequest{
+		method: req.Method(),
+		uri:    req.Std().URL.RequestURI(),
+		header: req.HTTPHeader().Clone(),
+		body:   req.RawPayload(),
+	}
+	removeHopByHopHeaders(cr.header)
+	if !er.spec.ForwardCredentials {
+		for _, h := range credentialHeaders {
+			cr.header.Del(h)
+		}
+	}
+
+	select {
+	case er.queue <- cr:
+	default:
+		atomic.AddInt64(&er.numOfDropped, 1)
+	}
+}
+
+func (er *errorReplayer) run() {
+	defer er.wg.Done()
+
+	for {
+		select {
+		case <-er.done:
+			return
+		case cr := <-er.queue:
+			er.replay(cr)
+		}
+	}
+}
+
+func (er *errorReplayer) replay(cr *capturedRequest) {
+	u := strings.TrimSuffix(er.spec.URL, "/") + cr.uri
+	stdr, err := http.NewRequest(cr.method, u, bytes.NewReader(cr.body))
+	if err != nil {
+		atomic.AddInt64(&er.numOfFailed, 1)
+		logger.Errorf("%s: failed to create replay request: %v", er.name, err)
+		return
+	}
+	stdr.Header = cr.header
+
+	resp, err := er.client.Do(stdr)
+	if err != nil {
+		atomic.AddInt64(&er.numOfFailed, 1)
+		logger.Errorf("%s: failed to replay %s %s: %v", er.name, cr.method, cr.uri, err)
+		return
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+
+	atomic.AddInt64(&er.numOfReplayed, 1)
+	logger.Infof("%s: replayed %s %s to sandbox, status: %d, body: %s",
+		er.name, cr.method, cr.uri, resp.StatusCode, body)
+}
+
+func (er *errorReplayer) status() *ErrorReplayStatus {
+	return &ErrorReplayStatus{
+		NumOfReplayed: atomic.LoadInt64(&er.numOfReplayed),
+		NumOfFailed:   atomic.LoadInt64(&er.numOfFailed),
+		NumOfDropped:  atomic.LoadInt64(&er.numOfDropped),
+	}
+}
+
+func (er *errorReplayer) close() {
+	close(er.done)
+	er.wg.Wait()
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	received := make(chan string, 10)
+	unblock := make(chan struct{})
+	sandbox := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+		body, _ := io.ReadAll(r.Body)
+		received <- r.Method + " " + r.URL.RequestURI() + " " + string(body) +
+			" " + r.Header.Get("Authorization") + r.Header.Get("Cookie") + r.Header.Get("X-Test")
+	}))
+	defer sandbox.Close()
+
+	spec := &ErrorReplaySpec{URL: sandbox.URL, SamplingRate: 1, QueueSize: 1}
+	assert.NoError(spec.Validate())
+	er := newErrorReplayer("test", spec)
+	defer er.close()
+
+	newRequest := func(path string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://example.com"+path, strings.NewReader("hello"))
+		stdr.Header.Set("Authorization", "Bearer token")
+		stdr.Header.Set("Cookie", "session=abc")
+		stdr.Header.Set("X-Test", "test")
+		req, _ := httpprot.NewRequest(stdr)
+		req.FetchPayload(0)
+		return req
+	}
+
+	// the first request is being replayed, the second one waits in the
+	// queue, and the third one is dropped.
+	er.capture(newRequest("/a?x=1"))
+	assert.Eventually(func() bool { return len(er.queue) == 0 }, time.Second, time.Millisecond)
+	er.capture(newRequest("/b"))
+	er.capture(newRequest("/c"))
+
+	// credential headers are not forwarded by default.
+	close(unblock)
+	assert.Equal("POST /a?x=1 hello test", <-received)
+	assert.Equal("POST /b hello test", <-received)
+
+	assert.Eventually(func() bool { return er.status().NumOfReplayed == 2 }, time.Second, time.Millisecond)
+	assert.Equal(int64(1), er.status().NumOfDropped)
+	assert.Equal(int64(0), er.status().NumOfFailed)
+
+	// they are forwarded only if it is enabled.
+	spec.ForwardCredentials = true
+	er.capture(newRequest("/d"))
+	assert.Equal("POST /d hello Bearer tokensession=abctest", <-received)
+
+	// no request is replayed if the sampling rate is 0.
+	spec.SamplingRate = 0
+	er.capture(newRequest("/e"))
+	assert.Equal(0, len(er.queue))
+	assert.Eventually(func() bool { return er.status().NumOfReplayed == 3 }, time.Second, time.Millisecond)
+}
+
+func TestIsErrorResult(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.New(nil)
+	assert.True(isErrorResult(ctx, resultServerError))
+	assert.False(isErrorResult(ctx, ""))
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusBadGateway)
+	ctx.SetOutputResponse(resp)
+	assert.True(isErrorResult(ctx, ""))
+
+	resp.SetStatusCode(http.StatusNotFound)
+	assert.False(isErrorResult(ctx, ""))
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const defaultForceUpstreamHeaderKey = "X-Force-Upstream"
+
+type (
+	// ForceUpstreamSpec is the spec to pin requests to the servers named
+	// in a signed header, it is for debugging only.
+	ForceUpstreamSpec struct {
+		// HeaderKey is the header carrying the signed server ID.
+		HeaderKey string `json:"headerKey" jsonschema:"omitempty"`
+		// Secret is the HMAC-SHA256 key to verify the signature.
+		Secret string `json:"secret" jsonschema:"required,minLength=16"`
+	}
+
+	// ForceUpstreamStatus is the status of the forced routing.
+	ForceUpstreamStatus struct {
+		NumOfForced   int64 `json:"numOfForced"`
+		NumOfInvalid  int64 `json:"numOfInvalid"`
+		NumOfNotFound int64 `json:"numOfNotFound"`
+	}
+
+	// forceUpstreamLoadBalancer chooses the server named in the signed
+	// header of requests, and delegates to the load balancer of the
+	// configured policy otherwise.
+	forceUpstreamLoadBalancer struct {
+		LoadBalancer
+		spec    *ForceUpstreamSpec
+		servers map[string]*Server
+
+		numOfForced   int64
+		numOfInvalid  int64
+		numOfNotFound int64
+	}
+)
+
+func newForceUpstreamLoadBalancer(spec *ForceUpstreamSpec, lb LoadBalancer, servers []*Server) *forceUpstreamLoadBalancer {
+	fulb := &forceUpstreamLoadBalancer{
+		LoadBalancer: lb,
+		spec:         spec,
+		servers:      make(map[string]*Server, len(servers)),
+	}
+	for _, s := range servers {
+		fulb.servers[s.ID()] = s
+	}
+	return fulb
+}
+
+// SignForceUpstream returns the value of the force upstream header which
+// pins requests to the server until the expiration time (unix seconds).
+func SignForceUpstream(secret, id string, expires int64) string {
+	payload := id + ";" + strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return payload + ";" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyForceUpstream verifies the value of the force upstream header, and
+// returns the server ID if the signature is valid and not expired. The
+// value is split from the right as the ID could contain ';'.
+func verifyForceUpstream(secret, value string, now int64) (string, bool) {
+	idx := strings.LastIndexByte(value, ';')
+	if idx < 0 {
+		return "", false
+	}
+	payload, signature := value[:idx], value[idx+1:]
+
+	idx = strings.LastIndexByte(payload, ';')
+	if idx < 0 {
+		return "", false
+	}
+	id := payload[:idx]
+	expires, err := strconv.ParseInt(payload[idx+1:], 10, 64)
+	if err != nil || expires < now {
+		return "", false
+	}
+
+	expected := SignForceUpstream(secret, id, expires)
+	if !hmac.Equal([]byte(expected[len(payload)+1:]), []byte(signature)) {
+		return "", false
+	}
+	return id, true
+}
+
+func (lb *forceUpstreamLoadBalancer) headerKey() string {
+	if lb.spec.HeaderKey == "" {
+		return defaultForceUpstreamHeaderKey
+	}
+	return lb.spec.HeaderKey
+}
+
+// ChooseServer chooses the server named in the force upstream header if
+// the signature is valid and the server exists, the server is chosen even
+// if it is unhealthy, to reproduce issues of the server.
+func (lb *forceUpstreamLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	value := req.HTTPHeader().Get(lb.headerKey())
+	if value == "" {
+		return lb.LoadBalancer.ChooseServer(req)
+	}
+
+	id, ok := verifyForceUpstream(lb.spec.Secret, value, fasttime.Now().Unix())
+	if !ok {
+		atomic.AddInt64(&lb.numOfInvalid, 1)
+		return lb.LoadBalancer.ChooseServer(req)
+	}
+
+	svr := lb.servers[id]
+	if svr == nil {
+		atomic.AddInt64(&lb.numOfNotFound, 1)
+		return lb.LoadBalancer.ChooseServer(req)
+	}
+
+	// the server is not chosen by the wrapped load balancer, acquire it
+	// to balance the release after the request is done.
+	lb.acquireServer(svr)
+	atomic.AddInt64(&lb.numOfForced, 1)
+	return svr
+}
+
+// acquireServer implements the serverLoadTracker interface, so that the
+// load tracked by the wrapped load balancer is acquired.
+func (lb *forceUpstreamLoadBalancer) acquireServer(server *Server) {
+	if lt, ok := lb.LoadBalancer.(serverLoadTracker); ok {
+		lt.acquireServer(server)
+	}
+}
+
+// releaseServer implements the serverLoadTracker interface, so that the
+// load tracked by the wrapped load balancer is released.
+func (lb *forceUpstreamLoadBalancer) releaseServer(server *Server) {
+	if lt, ok := lb.LoadBalancer.(serverLoadTracker); ok {
+		lt.releaseServer(server)
+	}
+}
+
+func (lb *forceUpstreamLoadBalancer) status() *ForceUpstreamStatus {
+	return &ForceUpstreamStatus{
+		NumOfForced:   atomic.LoadInt64(&lb.numOfForced),
+		NumOfInvalid:  atomic.LoadInt64(&lb.numOfInvalid),
+		NumOfNotFound: atomic.LoadInt64(&lb.numOfNotFound),
+	}
+}
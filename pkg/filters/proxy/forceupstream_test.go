@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForceUpstreamLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var servers []*Server
+	for i := 0; i < 3; i++ {
+		servers = append(servers, &Server{URL: fmt.Sprintf("http://server-%d", i)})
+	}
+
+	const secret = "0123456789abcdef"
+	spec := &LoadBalanceSpec{
+		Policy:        LoadBalancePolicyRoundRobin,
+		ForceUpstream: &ForceUpstreamSpec{Secret: secret},
+	}
+	lb := newForceUpstreamLoadBalancer(spec.ForceUpstream, NewLoadBalancer(spec, servers), servers)
+	defer lb.Close()
+
+	newRequest := func(value string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if value != "" {
+			stdr.Header.Set("X-Force-Upstream", value)
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		return req
+	}
+
+	expires := time.Now().Add(time.Hour).Unix()
+
+	// requests are pinned to the named server, even if it is unhealthy
+	lb.LoadBalancer.(*roundRobinLoadBalancer).healthyServers.Store(servers[1:])
+	value := SignForceUpstream(secret, servers[0].ID(), expires)
+	for i := 0; i < 5; i++ {
+		assert.Equal(servers[0], lb.ChooseServer(newRequest(value)))
+	}
+
+	// invalid signatures, expired values and unknown servers fall back to
+	// the load balance policy
+	used := map[*Server]bool{}
+	for _, v := range []string{
+		SignForceUpstream("another secret", servers[0].ID(), expires),
+		SignForceUpstream(secret, servers[0].ID(), time.Now().Add(-time.Minute).Unix()),
+		servers[0].ID() + ";abc;def",
+		"http://server-0",
+		SignForceUpstream(secret, "http://server-9", expires),
+		"",
+	} {
+		used[lb.ChooseServer(newRequest(v))] = true
+	}
+	assert.False(used[servers[0]])
+
+	status := lb.status()
+	assert.Equal(int64(5), status.NumOfForced)
+	assert.Equal(int64(4), status.NumOfInvalid)
+	assert.Equal(int64(1), status.NumOfNotFound)
+
+	id, ok := verifyForceUpstream(secret, SignForceUpstream(secret, "a;b", expires), time.Now().Unix())
+	assert.True(ok)
+	assert.Equal("a;b", id)
+}
+
+func TestForceUpstreamLoadBalancerReleaseLoad(t *testing.T) {
+	assert := assert.New(t)
+
+	servers := prepareServers(3)
+	const secret = "0123456789abcdef"
+	spec := &LoadBalanceSpec{
+		Policy:        "boundedLoadHash",
+		HeaderHashKey: "X-Header",
+		ForceUpstream: &ForceUpstreamSpec{Secret: secret},
+	}
+	inner := NewLoadBalancer(spec, servers)
+	lb := newForceUpstreamLoadBalancer(spec.ForceUpstream, inner, servers)
+	defer lb.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	stdr.Header.Set("X-Force-Upstream", SignForceUpstream(secret, servers[0].ID(), time.Now().Add(time.Hour).Unix()))
+	req, _ := httpprot.NewRequest(stdr)
+
+	// forced requests acquire the load of the server in the wrapped load
+	// balancer, and release it after they are done.
+	var chosen []*Server
+	for i := 0; i < 5; i++ {
+		chosen = append(chosen, lb.ChooseServer(req))
+	}
+	loads := inner.(*boundedLoadHashLoadBalancer).status().Loads
+	assert.Equal(int64(5), loads[servers[0].ID()])
+
+	for _, svr := range chosen {
+		lb.releaseServer(svr)
+	}
+	for _, load := range inner.(*boundedLoadHashLoadBalancer).status().Loads {
+		assert.Equal(int64(0), load)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// sharedProbeSweepInterval is the interval to remove stale probe
+	// results of servers which are no longer probed.
+	sharedProbeSweepInterval = 10 * time.Minute
+)
+
+type (
+	// sharedProber probes servers for all load balancers. A server which
+	// is referenced by more than one server pool, no matter in the same
+	// proxy or not, is probed only once in an interval, and the result is
+	// shared by all the pools.
+	sharedProber struct {
+		lock      sync.Mutex
+		results   map[probeKey]*probeResult
+		lastSweep time.Time
+	}
+
+	// probeKey identifies a probe, only probes with the same URL (which
+	// includes the health check path), timeout and transport (which
+	// carries the TLS config) share results, so that the verdict of a
+	// pool doesn't leak into pools probing in another way.
+	probeKey struct {
+		url       string
+		timeout   time.Duration
+		transport http.RoundTripper
+	}
+
+	// probeResult is the result of a probe, pass is only valid after done
+	// is closed.
+	probeResult struct {
+		start time.Time
+		done  chan struct{}
+		pass  bool
+	}
+
+	// HealthCheckStatus is the status of health check of a server pool.
+	HealthCheckStatus struct {
+		Servers           []*ServerHealthStatus `json:"servers"`
+		NumOfProbes       int64                 `json:"numOfProbes"`
+		NumOfDeduplicated int64                 `json:"numOfDeduplicated"`
+	}
+
+	// ServerHealthStatus is the health status of a server.
+	ServerHealthStatus struct {
+		URL     string `json:"url"`
+		Healthy bool   `json:"healthy"`
+	}
+)
+
+var globalProber = &sharedProber{results: map[probeKey]*probeResult{}}
+
+// probe returns the result of a probe to url by client started within
+// maxAge, it starts a new probe if there is no such one. The returned
+// boolean is true if the result is shared from a probe started by others.
+func (sp *sharedProber) probe(client *http.Client, url string, maxAge time.Duration) (bool, bool) {
+	now := time.Now()
+	key := probeKey{url: url, timeout: client.Timeout, transport: client.Transport}
+
+	sp.lock.Lock()
+	r := sp.results[key]
+	if r != nil && now.Sub(r.start) < maxAge {
+		sp.lock.Unlock()
+		<-r.done
+		return r.pass, true
+	}
+
+	r = &probeResult{start: now, done: make(chan struct{})}
+	sp.results[key] = r
+	if now.Sub(sp.lastSweep) >= sharedProbeSweepInterval {
+		sp.sweep(now)
+	}
+	sp.lock.Unlock()
+
+	r.pass = probeHTTP(client, url)
+	close(r.done)
+	return r.pass, false
+}
+
+// sweep removes probe results which are too old to be shared, the caller
+// must hold the lock.
+func (sp *sharedProber) sweep(now time.Time) {
+	sp.lastSweep = now
+	for key, r := range sp.results {
+		if now.Sub(r.start) >= sharedProbeSweepInterval {
+			delete(sp.results, key)
+		}
+	}
+}
+
+// probeHTTP checks http url status
+func probeHTTP(client *http.Client, url string) bool {
+	res, err := client.Get(url)
+	if err != nil {
+		return false
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+	return res.StatusCode <= 500
+}
+
+// healthCheckStatus returns the status of health check, nil is returned
+// if health check is not enabled.
+func (blb *BaseLoadBalancer) healthCheckStatus() *HealthCheckStatus {
+	if blb.spec == nil || blb.spec.HealthCheck == nil || blb.done == nil {
+		return nil
+	}
+
+	healthy := map[*Server]bool{}
+	for _, s := range blb.HealthyServers() {
+		healthy[s] = true
+	}
+
+	s := &HealthCheckStatus{
+		Servers:           make([]*ServerHealthStatus, 0, len(blb.Servers)),
+		NumOfProbes:       atomic.LoadInt64(&blb.numOfProbes),
+		NumOfDeduplicated: atomic.LoadInt64(&blb.numOfDeduplicatedProbes),
+	}
+	for _, svr := range blb.Servers {
+		s.Servers = append(s.Servers, &ServerHealthStatus{URL: svr.URL, Healthy: healthy[svr]})
+	}
+	return s
+}
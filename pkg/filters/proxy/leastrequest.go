@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+// LeastRequestStatus is the status of the least request load balancer.
+type LeastRequestStatus struct {
+	Loads map[string]int64 `json:"loads"`
+}
+
+// leastRequestLoadBalancer does load balancing by sending requests to the
+// server with the least in-flight requests, ties are broken randomly so
+// that concurrent requests don't pile up on the same server.
+type leastRequestLoadBalancer struct {
+	BaseLoadBalancer
+	loads map[*Server]*int64
+}
+
+func newLeastRequestLoadBalancer(spec *LoadBalanceSpec, servers []*Server) *leastRequestLoadBalancer {
+	lb := &leastRequestLoadBalancer{}
+	lb.init(spec, servers)
+
+	lb.loads = make(map[*Server]*int64, len(servers))
+	for _, s := range servers {
+		lb.loads[s] = new(int64)
+	}
+	return lb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *leastRequestLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	servers := lb.HealthyServers()
+	if len(servers) == 0 {
+		return nil
+	}
+
+	if server := lb.BaseLoadBalancer.ChooseServer(req); server != nil {
+		atomic.AddInt64(lb.loads[server], 1)
+		return server
+	}
+
+	var best *Server
+	bestLoad := int64(0)
+	offset := rand.Intn(len(servers))
+	for i := range servers {
+		server := servers[(offset+i)%len(servers)]
+		load := atomic.LoadInt64(lb.loads[server])
+		if best == nil || load < bestLoad {
+			best, bestLoad = server, load
+		}
+	}
+
+	atomic.AddInt64(lb.loads[best], 1)
+	return best
+}
+
+// acquireServer implements the serverLoadTracker interface.
+func (lb *leastRequestLoadBalancer) acquireServer(server *Server) {
+	if load := lb.loads[server]; load != nil {
+		atomic.AddInt64(load, 1)
+	}
+}
+
+// releaseServer implements the serverLoadTracker interface.
+func (lb *leastRequestLoadBalancer) releaseServer(server *Server) {
+	if load := lb.loads[server]; load != nil {
+		atomic.AddInt64(load, -1)
+	}
+}
+
+func (lb *leastRequestLoadBalancer) status() *LeastRequestStatus {
+	s := &LeastRequestStatus{Loads: make(map[string]int64, len(lb.loads))}
+	for server, load := range lb.loads {
+		s.Loads[server.ID()] = atomic.LoadInt64(load)
+	}
+	return s
+}
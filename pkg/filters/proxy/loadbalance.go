@@ -27,6 +27,7 @@ import (
 	"hash/maphash"
 	"math/rand"
 	"net/http"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -43,10 +44,18 @@ const (
 	LoadBalancePolicyRandom = "random"
 	// LoadBalancePolicyWeightedRandom is the load balance policy of weighted random.
 	LoadBalancePolicyWeightedRandom = "weightedRandom"
+	// LoadBalancePolicyWeightedRoundRobin is the load balance policy of weighted round robin.
+	LoadBalancePolicyWeightedRoundRobin = "weightedRoundRobin"
+	// LoadBalancePolicyLeastRequest is the load balance policy of least in-flight requests.
+	LoadBalancePolicyLeastRequest = "leastRequest"
 	// LoadBalancePolicyIPHash is the load balance policy of IP hash.
 	LoadBalancePolicyIPHash = "ipHash"
 	// LoadBalancePolicyHeaderHash is the load balance policy of HTTP header hash.
 	LoadBalancePolicyHeaderHash = "headerHash"
+	// LoadBalancePolicyBoundedLoadHash is the load balance policy of consistent hash with bounded loads.
+	LoadBalancePolicyBoundedLoadHash = "boundedLoadHash"
+	// LoadBalancePolicyRegionFailover is the load balance policy of region failover.
+	LoadBalancePolicyRegionFailover = "regionFailover"
 	// StickySessionModeCookieConsistentHash is the sticky session mode of consistent hash on app cookie.
 	StickySessionModeCookieConsistentHash = "CookieConsistentHash"
 	// StickySessionModeDurationBased uses a load balancer-generated cookie for stickiness.
@@ -104,10 +113,14 @@ type HealthCheckSpec struct {
 
 // LoadBalanceSpec is the spec to create a load balancer.
 type LoadBalanceSpec struct {
-	Policy        string             `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=ipHash,enum=headerHash"`
-	HeaderHashKey string             `json:"headerHashKey" jsonschema:"omitempty"`
-	StickySession *StickySessionSpec `json:"stickySession" jsonschema:"omitempty"`
-	HealthCheck   *HealthCheckSpec   `json:"healthCheck" jsonschema:"omitempty"`
+	Policy            string              `json:"policy" jsonschema:"omitempty,enum=,enum=roundRobin,enum=random,enum=weightedRandom,enum=weightedRoundRobin,enum=leastRequest,enum=ipHash,enum=headerHash,enum=boundedLoadHash,enum=regionFailover"`
+	HeaderHashKey     string              `json:"headerHashKey" jsonschema:"omitempty"`
+	BoundedLoadFactor float64             `json:"boundedLoadFactor" jsonschema:"omitempty"`
+	StickySession     *StickySessionSpec  `json:"stickySession" jsonschema:"omitempty"`
+	HealthCheck       *HealthCheckSpec    `json:"healthCheck" jsonschema:"omitempty"`
+	RegionFailover    *RegionFailoverSpec `json:"regionFailover,omitempty" jsonschema:"omitempty"`
+	AffinityHint      *AffinityHintSpec   `json:"affinityHint,omitempty" jsonschema:"omitempty"`
+	ForceUpstream     *ForceUpstreamSpec  `json:"forceUpstream,omitempty" jsonschema:"omitempty"`
 }
 
 // NewLoadBalancer creates a load balancer for servers according to spec.
@@ -119,10 +132,18 @@ func NewLoadBalancer(spec *LoadBalanceSpec, servers []*Server) LoadBalancer {
 		return newRandomLoadBalancer(spec, servers)
 	case LoadBalancePolicyWeightedRandom:
 		return newWeightedRandomLoadBalancer(spec, servers)
+	case LoadBalancePolicyWeightedRoundRobin:
+		return newWeightedRoundRobinLoadBalancer(spec, servers)
+	case LoadBalancePolicyLeastRequest:
+		return newLeastRequestLoadBalancer(spec, servers)
 	case LoadBalancePolicyIPHash:
 		return newIPHashLoadBalancer(spec, servers)
 	case LoadBalancePolicyHeaderHash:
 		return newHeaderHashLoadBalancer(spec, servers)
+	case LoadBalancePolicyBoundedLoadHash:
+		return newBoundedLoadHashLoadBalancer(spec, servers)
+	case LoadBalancePolicyRegionFailover:
+		return newRegionFailoverLoadBalancer(spec, servers)
 	default:
 		logger.Errorf("unsupported load balancing policy: %s", spec.Policy)
 		return newRoundRobinLoadBalancer(spec, servers)
@@ -158,6 +179,9 @@ type BaseLoadBalancer struct {
 	probeClient    *http.Client
 	probeInterval  time.Duration
 	probeTimeout   time.Duration
+
+	numOfProbes             int64
+	numOfDeduplicatedProbes int64
 }
 
 // HealthyServers return healthy servers
@@ -246,16 +270,19 @@ func (blb *BaseLoadBalancer) probeServers() {
 	}
 }
 
-// probeHTTP checks http url status
+// probeHTTP checks http url status, the probe is shared with other load
+// balancers probing the same url.
 func (blb *BaseLoadBalancer) probeHTTP(url string) bool {
 	if blb.spec.HealthCheck.Path != "" {
 		url += blb.spec.HealthCheck.Path
 	}
-	res, err := blb.probeClient.Get(url)
-	if err != nil || res.StatusCode > 500 {
-		return false
+	pass, shared := globalProber.probe(blb.probeClient, url, blb.probeInterval)
+	if shared {
+		atomic.AddInt64(&blb.numOfDeduplicatedProbes, 1)
+	} else {
+		atomic.AddInt64(&blb.numOfProbes, 1)
 	}
-	return true
+	return pass
 }
 
 // initConsistentHash initializes for consistent hash mode
@@ -479,6 +506,53 @@ func (lb *WeightedRandomLoadBalancer) ChooseServer(req *httpprot.Request) *Serve
 	panic(fmt.Errorf("BUG: should not run to here, total weight=%d", lb.totalWeight))
 }
 
+// weightedRoundRobinLoadBalancer does load balancing in the smooth
+// weighted round robin manner, that's, servers are chosen in proportion
+// to their weights, and the choices of a server are spread evenly instead
+// of in a burst. Servers without a weight are treated as weight 1.
+type weightedRoundRobinLoadBalancer struct {
+	BaseLoadBalancer
+	lock    sync.Mutex
+	current map[*Server]int
+}
+
+func newWeightedRoundRobinLoadBalancer(spec *LoadBalanceSpec, servers []*Server) *weightedRoundRobinLoadBalancer {
+	lb := &weightedRoundRobinLoadBalancer{current: make(map[*Server]int, len(servers))}
+	lb.init(spec, servers)
+	return lb
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *weightedRoundRobinLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	servers := lb.HealthyServers()
+	if len(servers) == 0 {
+		return nil
+	}
+
+	if server := lb.BaseLoadBalancer.ChooseServer(req); server != nil {
+		return server
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	var best *Server
+	totalWeight := 0
+	for _, server := range servers {
+		weight := server.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		totalWeight += weight
+		lb.current[server] += weight
+		if best == nil || lb.current[server] > lb.current[best] {
+			best = server
+		}
+	}
+	lb.current[best] -= totalWeight
+	return best
+}
+
 // ipHashLoadBalancer does load balancing based on IP hash.
 type ipHashLoadBalancer struct {
 	BaseLoadBalancer
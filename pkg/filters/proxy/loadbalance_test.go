@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"math/rand"
 	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -118,6 +121,72 @@ func TestWeightedRandomLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestWeightedRoundRobinLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	// the total weight is 55, servers are chosen exactly in proportion to
+	// their weights in every 55 choices.
+	svrs = prepareServers(10)
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	counter := [10]int{}
+	for i := 0; i < 550; i++ {
+		svr := lb.ChooseServer(nil)
+		counter[svr.Weight-1]++
+	}
+	for i := 0; i < 10; i++ {
+		assert.Equal((i+1)*10, counter[i])
+	}
+
+	// choices of a server are spread evenly.
+	svrs = []*Server{{URL: "a", Weight: 5}, {URL: "b", Weight: 1}, {URL: "c", Weight: 1}}
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "weightedRoundRobin"}, svrs)
+	order := ""
+	for i := 0; i < 7; i++ {
+		order += lb.ChooseServer(nil).URL
+	}
+	assert.Equal("aabacaa", order)
+}
+
+func TestLeastRequestLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{Policy: "leastRequest"}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	svrs = prepareServers(3)
+	lb = NewLoadBalancer(&LoadBalanceSpec{Policy: "leastRequest"}, svrs)
+	lt := lb.(serverLoadTracker)
+
+	// in-flight requests are spread across all servers.
+	chosen := map[*Server]int{}
+	for i := 0; i < 6; i++ {
+		chosen[lb.ChooseServer(nil)]++
+	}
+	for _, svr := range svrs {
+		assert.Equal(2, chosen[svr])
+	}
+
+	// the next request goes to the server whose requests are done.
+	lt.releaseServer(svrs[1])
+	lt.releaseServer(svrs[1])
+	assert.Equal(svrs[1], lb.ChooseServer(nil))
+
+	status := lb.(*leastRequestLoadBalancer).status()
+	assert.Equal(int64(2), status.Loads[svrs[0].ID()])
+	assert.Equal(int64(1), status.Loads[svrs[1].ID()])
+
+	// servers chosen by wrapping load balancers, e.g. by affinity hints,
+	// are acquired explicitly.
+	lt.acquireServer(svrs[1])
+	status = lb.(*leastRequestLoadBalancer).status()
+	assert.Equal(int64(2), status.Loads[svrs[1].ID()])
+}
+
 func TestIPHashLoadBalancer(t *testing.T) {
 	assert := assert.New(t)
 
@@ -172,6 +241,77 @@ func TestHeaderHashLoadBalancer(t *testing.T) {
 	}
 }
 
+func TestBoundedLoadHashLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var svrs []*Server
+	lb := NewLoadBalancer(&LoadBalanceSpec{
+		Policy:        "boundedLoadHash",
+		HeaderHashKey: "X-Header",
+	}, svrs)
+	assert.Nil(lb.ChooseServer(nil))
+
+	svrs = prepareServers(4)
+	lb = NewLoadBalancer(&LoadBalanceSpec{
+		Policy:            "boundedLoadHash",
+		HeaderHashKey:     "X-Header",
+		BoundedLoadFactor: 1.5,
+	}, svrs)
+	blb := lb.(*boundedLoadHashLoadBalancer)
+
+	newRequest := func(key string) *httpprot.Request {
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Add("X-Header", key)
+		r, _ := httpprot.NewRequest(req)
+		return r
+	}
+
+	// the same key is always routed to the same server without load.
+	svr := lb.ChooseServer(newRequest("hot-key"))
+	blb.releaseServer(svr)
+	for i := 0; i < 10; i++ {
+		s := lb.ChooseServer(newRequest("hot-key"))
+		assert.Equal(svr, s)
+		blb.releaseServer(s)
+	}
+
+	// a hot key is moved to other servers when the load exceeds the bound.
+	chosen := map[*Server]int{}
+	for i := 0; i < 40; i++ {
+		chosen[lb.ChooseServer(newRequest("hot-key"))]++
+	}
+	assert.Greater(len(chosen), 1)
+	for _, n := range chosen {
+		assert.LessOrEqual(n, 15)
+	}
+
+	status := blb.status()
+	assert.Equal(int64(40)-int64(chosen[svr]), status.NumOfReassigned)
+	assert.Equal(int64(chosen[svr]), status.Loads[svr.ID()])
+
+	for s, n := range chosen {
+		for i := 0; i < n; i++ {
+			blb.releaseServer(s)
+		}
+	}
+	for _, load := range blb.status().Loads {
+		assert.Equal(int64(0), load)
+	}
+
+	// the load is released through the wrappers of the load balancer.
+	var wrapped LoadBalancer = newAffinityHintLoadBalancer(&AffinityHintSpec{
+		HeaderKey:  "X-Affinity-Key",
+		TrustedIPs: []string{"10.0.0.0/8"},
+	}, lb)
+	wrapped = newForceUpstreamLoadBalancer(&ForceUpstreamSpec{
+		Secret: "0123456789abcdef",
+	}, wrapped, svrs)
+	svr = wrapped.ChooseServer(newRequest("hot-key"))
+	assert.Equal(int64(1), blb.status().Loads[svr.ID()])
+	wrapped.(serverLoadTracker).releaseServer(svr)
+	assert.Equal(int64(0), blb.status().Loads[svr.ID()])
+}
+
 func TestStickySession_ConsistentHash(t *testing.T) {
 	assert := assert.New(t)
 
@@ -284,3 +424,68 @@ func TestHealthCheck(t *testing.T) {
 	time.Sleep(5 * time.Second)
 	assert.Equal(0, len(lb.HealthyServers()))
 }
+
+func TestSharedHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	var probes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	newLB := func() *BaseLoadBalancer {
+		lb := NewLoadBalancer(&LoadBalanceSpec{
+			HealthCheck: &HealthCheckSpec{Interval: "1h", Path: "/healthz"},
+		}, []*Server{{URL: server.URL}}).(*roundRobinLoadBalancer)
+		return &lb.BaseLoadBalancer
+	}
+	lb1, lb2 := newLB(), newLB()
+	defer lb1.Close()
+	defer lb2.Close()
+
+	// concurrent probes are coalesced
+	var wg sync.WaitGroup
+	for _, lb := range []*BaseLoadBalancer{lb1, lb2, lb1, lb2} {
+		wg.Add(1)
+		go func(lb *BaseLoadBalancer) {
+			defer wg.Done()
+			assert.True(lb.probeHTTP(server.URL))
+		}(lb)
+	}
+	wg.Wait()
+	assert.Equal(int32(1), atomic.LoadInt32(&probes))
+
+	// results within the interval are shared
+	lb2.probeServers()
+	assert.Equal(int32(1), atomic.LoadInt32(&probes))
+
+	status1, status2 := lb1.healthCheckStatus(), lb2.healthCheckStatus()
+	assert.Equal(int64(1), status1.NumOfProbes+status2.NumOfProbes)
+	assert.Equal(int64(4), status1.NumOfDeduplicated+status2.NumOfDeduplicated)
+	assert.True(status1.Servers[0].Healthy)
+
+	// a load balancer with a shorter interval probes again
+	lb3 := newLB()
+	defer lb3.Close()
+	lb3.probeInterval = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	lb3.probeServers()
+	assert.Equal(int32(2), atomic.LoadInt32(&probes))
+	assert.Equal(int64(1), lb3.healthCheckStatus().NumOfProbes)
+
+	// load balancers probing with another path or timeout don't share
+	// the results.
+	for _, hc := range []*HealthCheckSpec{
+		{Interval: "1h", Path: "/ready"},
+		{Interval: "1h", Path: "/healthz", Timeout: "1s"},
+	} {
+		lb := NewLoadBalancer(&LoadBalanceSpec{HealthCheck: hc}, []*Server{{URL: server.URL}}).(*roundRobinLoadBalancer)
+		lb.probeServers()
+		assert.Equal(int64(1), lb.healthCheckStatus().NumOfProbes)
+		assert.Equal(int64(0), lb.healthCheckStatus().NumOfDeduplicated)
+		lb.Close()
+	}
+	assert.Equal(int32(4), atomic.LoadInt32(&probes))
+}
@@ -18,8 +18,12 @@
 package proxy
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	cache "github.com/patrickmn/go-cache"
@@ -32,6 +36,8 @@ import (
 const (
 	minCleanupInterval = time.Minute
 	keyCacheControl    = "Cache-Control"
+	keyCacheTag        = "Cache-Tag"
+	keyETag            = "ETag"
 )
 
 type (
@@ -40,6 +46,16 @@ type (
 		spec *MemoryCacheSpec
 
 		cache *cache.Cache
+
+		// lock protects entries and tags, which index the cache entries by
+		// path and tags for purging.
+		lock    sync.Mutex
+		entries map[string]*cacheIndex
+		tags    map[string]map[string]struct{}
+
+		numOfPurgeRequests int64
+		numOfPurged        int64
+		numOfNotModified   int64
 	}
 
 	// MemoryCacheSpec describes the MemoryCache.
@@ -48,6 +64,22 @@ type (
 		MaxEntryBytes uint32   `json:"maxEntryBytes" jsonschema:"required,minimum=1"`
 		Codes         []int    `json:"codes" jsonschema:"required,minItems=1,uniqueItems=true,format=httpcode-array"`
 		Methods       []string `json:"methods" jsonschema:"required,minItems=1,uniqueItems=true,format=httpmethod-array"`
+		PurgeMethod   string   `json:"purgeMethod,omitempty" jsonschema:"omitempty"`
+		ETag          bool     `json:"etag,omitempty" jsonschema:"omitempty"`
+	}
+
+	// MemoryCacheStatus is the status of the memory cache.
+	MemoryCacheStatus struct {
+		Size               int   `json:"size"`
+		NumOfPurgeRequests int64 `json:"numOfPurgeRequests"`
+		NumOfPurged        int64 `json:"numOfPurged"`
+		NumOfNotModified   int64 `json:"numOfNotModified"`
+	}
+
+	// cacheIndex is the index of a cache entry.
+	cacheIndex struct {
+		path string
+		tags []string
 	}
 
 	// CacheEntry is an item of the memory cache.
@@ -72,10 +104,14 @@ func NewMemoryCache(spec *MemoryCacheSpec) *MemoryCache {
 	}
 	cache := cache.New(expiration, cleanupInterval)
 
-	return &MemoryCache{
-		spec:  spec,
-		cache: cache,
+	mc := &MemoryCache{
+		spec:    spec,
+		cache:   cache,
+		entries: make(map[string]*cacheIndex),
+		tags:    make(map[string]map[string]struct{}),
 	}
+	cache.OnEvicted(mc.onEvicted)
+	return mc
 }
 
 func (mc *MemoryCache) key(req *httpprot.Request) string {
@@ -98,6 +134,11 @@ func (mc *MemoryCache) Load(req *httpprot.Request) *CacheEntry {
 		return nil
 	}
 
+	// the cache key doesn't include the range.
+	if req.HTTPHeader().Get("Range") != "" {
+		return nil
+	}
+
 	for _, value := range req.HTTPHeader().Values(keyCacheControl) {
 		if strings.Contains(value, "no-cache") {
 			return nil
@@ -113,7 +154,7 @@ func (mc *MemoryCache) Load(req *httpprot.Request) *CacheEntry {
 
 // Store tries to cache the response.
 func (mc *MemoryCache) Store(req *httpprot.Request, resp *httpprot.Response) {
-	if resp.IsStream() {
+	if resp.IsStream() || req.HTTPHeader().Get("Range") != "" {
 		return
 	}
 
@@ -161,11 +202,162 @@ func (mc *MemoryCache) Store(req *httpprot.Request, resp *httpprot.Response) {
 		}
 	}
 
+	// the ETag is also sent to the client with this response, so that the
+	// following requests of the client could be conditional.
+	if mc.spec.ETag && resp.HTTPHeader().Get(keyETag) == "" {
+		resp.HTTPHeader().Set(keyETag, computeETag(resp.RawPayload()))
+	}
+
 	key := mc.key(req)
 	entry := &CacheEntry{
 		StatusCode: resp.StatusCode(),
 		Header:     resp.HTTPHeader().Clone(),
 		Body:       resp.RawPayload(),
 	}
+
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
 	mc.cache.SetDefault(key, entry)
+	mc.addIndex(key, &cacheIndex{
+		path: req.Path(),
+		tags: parseCacheTags(resp.HTTPHeader().Values(keyCacheTag)),
+	})
+}
+
+// computeETag returns a strong ETag of the body, it is the same as the one
+// computed by the CacheControl filter.
+func computeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified returns whether the client of the request already has the
+// representation of the cache entry, i.e. the request is a conditional GET
+// or HEAD request and its If-None-Match header matches the ETag of the
+// entry, a 304 response should be sent in this case.
+func (mc *MemoryCache) NotModified(req *httpprot.Request, ce *CacheEntry) bool {
+	if req.Method() != http.MethodGet && req.Method() != http.MethodHead {
+		return false
+	}
+	if ce.StatusCode != http.StatusOK || !req.IfNoneMatch(ce.Header.Get(keyETag)) {
+		return false
+	}
+	atomic.AddInt64(&mc.numOfNotModified, 1)
+	return true
+}
+
+// parseCacheTags parses the values of the Cache-Tag header, tags are
+// separated by commas.
+func parseCacheTags(values []string) []string {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	return tags
+}
+
+// addIndex adds the index of a cache entry, replacing the existing one if
+// there is. The caller must hold the lock.
+func (mc *MemoryCache) addIndex(key string, idx *cacheIndex) {
+	mc.removeIndex(key)
+	mc.entries[key] = idx
+	for _, tag := range idx.tags {
+		keys := mc.tags[tag]
+		if keys == nil {
+			keys = make(map[string]struct{})
+			mc.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// removeIndex removes the index of a cache entry. The caller must hold the
+// lock.
+func (mc *MemoryCache) removeIndex(key string) {
+	idx := mc.entries[key]
+	if idx == nil {
+		return
+	}
+	delete(mc.entries, key)
+	for _, tag := range idx.tags {
+		keys := mc.tags[tag]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(mc.tags, tag)
+		}
+	}
+}
+
+// onEvicted is called when a cache entry is expired or deleted.
+func (mc *MemoryCache) onEvicted(key string, _ interface{}) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	// onEvicted is called after the entry is removed from the cache, the
+	// entry may be stored again in between.
+	if _, ok := mc.cache.Get(key); !ok {
+		mc.removeIndex(key)
+	}
+}
+
+// IsPurgeRequest returns whether the request is a purge request.
+func (mc *MemoryCache) IsPurgeRequest(req *httpprot.Request) bool {
+	return mc.spec.PurgeMethod != "" && req.Method() == mc.spec.PurgeMethod
+}
+
+// Purge removes the cache entries matching the purge request and returns
+// the number of entries removed. If the request has a Cache-Tag header,
+// entries tagged with any of the tags are removed; otherwise, entries
+// whose path matches the path of the request are removed, a path ending
+// with '*' matches all paths with the prefix before the '*'.
+func (mc *MemoryCache) Purge(req *httpprot.Request) int {
+	atomic.AddInt64(&mc.numOfPurgeRequests, 1)
+
+	var keys []string
+	tags := parseCacheTags(req.HTTPHeader().Values(keyCacheTag))
+
+	// only collect the keys with the lock held, so that the lock is not
+	// held for long, and the deletion calls onEvicted which acquires the
+	// lock.
+	mc.lock.Lock()
+	if len(tags) > 0 {
+		for _, tag := range tags {
+			for key := range mc.tags[tag] {
+				keys = append(keys, key)
+			}
+		}
+	} else {
+		path := req.Path()
+		prefix := strings.HasSuffix(path, "*")
+		path = strings.TrimSuffix(path, "*")
+		for key, idx := range mc.entries {
+			if idx.path == path || prefix && strings.HasPrefix(idx.path, path) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	mc.lock.Unlock()
+
+	n := 0
+	for _, key := range keys {
+		if _, ok := mc.cache.Get(key); ok {
+			n++
+		}
+		mc.cache.Delete(key)
+	}
+	atomic.AddInt64(&mc.numOfPurged, int64(n))
+	return n
+}
+
+func (mc *MemoryCache) status() *MemoryCacheStatus {
+	return &MemoryCacheStatus{
+		Size:               mc.cache.ItemCount(),
+		NumOfPurgeRequests: atomic.LoadInt64(&mc.numOfPurgeRequests),
+		NumOfPurged:        atomic.LoadInt64(&mc.numOfPurged),
+		NumOfNotModified:   atomic.LoadInt64(&mc.numOfNotModified),
+	}
 }
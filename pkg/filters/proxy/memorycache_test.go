@@ -77,3 +77,119 @@ func TestMemoryCache(t *testing.T) {
 	mc.Store(req, resp)
 	assert.NotNil(mc.Load(req))
 }
+
+func TestMemoryCachePurge(t *testing.T) {
+	assert := assert.New(t)
+
+	mc := NewMemoryCache(&MemoryCacheSpec{
+		Expiration:    "1m",
+		MaxEntryBytes: 100,
+		Methods:       []string{http.MethodGet},
+		Codes:         []int{http.StatusOK},
+		PurgeMethod:   "PURGE",
+	})
+
+	store := func(url string, tags ...string) *httpprot.Request {
+		stdr, _ := http.NewRequest(http.MethodGet, url, nil)
+		req, _ := httpprot.NewRequest(stdr)
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetPayload([]byte("hello"))
+		for _, tag := range tags {
+			resp.HTTPHeader().Add(keyCacheTag, tag)
+		}
+		mc.Store(req, resp)
+		assert.NotNil(mc.Load(req))
+		return req
+	}
+	purge := func(url string, tags string) int {
+		stdr, _ := http.NewRequest("PURGE", url, nil)
+		if tags != "" {
+			stdr.Header.Set(keyCacheTag, tags)
+		}
+		req, _ := httpprot.NewRequest(stdr)
+		assert.True(mc.IsPurgeRequest(req))
+		return mc.Purge(req)
+	}
+
+	user1 := store("http://megaease.com/users/1", "user, user-1")
+	user2 := store("http://megaease.com/users/2", "user", "user-2")
+	order1 := store("http://megaease.com/orders/1", "order")
+	order2 := store("http://megaease.com/orders/2")
+	assert.Equal(4, mc.status().Size)
+
+	// purge by tags
+	assert.Equal(1, purge("http://megaease.com/", "user-2"))
+	assert.Nil(mc.Load(user2))
+	assert.NotNil(mc.Load(user1))
+	assert.Equal(2, purge("http://megaease.com/", "user,order"))
+	assert.Nil(mc.Load(user1))
+	assert.Nil(mc.Load(order1))
+	assert.Empty(mc.tags)
+
+	// purge by path
+	store("http://megaease.com/orders/1")
+	assert.Equal(0, purge("http://megaease.com/orders", ""))
+	assert.Equal(2, purge("http://megaease.com/orders/*", ""))
+	assert.Nil(mc.Load(order2))
+	assert.Empty(mc.entries)
+
+	// a stored entry replaces the index of the previous one
+	store("http://megaease.com/users/1", "user")
+	store("http://megaease.com/users/1", "admin")
+	assert.Equal(0, purge("http://megaease.com/", "user"))
+	assert.Equal(1, purge("http://megaease.com/users/1", ""))
+
+	status := mc.status()
+	assert.Equal(0, status.Size)
+	assert.Equal(int64(6), status.NumOfPurgeRequests)
+	assert.Equal(int64(6), status.NumOfPurged)
+
+	stdr, _ := http.NewRequest(http.MethodDelete, "http://megaease.com/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	assert.False(mc.IsPurgeRequest(req))
+}
+
+func TestMemoryCacheNotModified(t *testing.T) {
+	assert := assert.New(t)
+
+	mc := NewMemoryCache(&MemoryCacheSpec{
+		Expiration:    "1m",
+		MaxEntryBytes: 100,
+		Methods:       []string{http.MethodGet},
+		Codes:         []int{http.StatusOK, http.StatusNotFound},
+		ETag:          true,
+	})
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/abc", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetPayload([]byte("hello"))
+
+	// the ETag is computed and sent with the response
+	mc.Store(req, resp)
+	etag := resp.HTTPHeader().Get(keyETag)
+	assert.Equal(computeETag([]byte("hello")), etag)
+	ce := mc.Load(req)
+	assert.Equal(etag, ce.Header.Get(keyETag))
+	assert.False(mc.NotModified(req, ce))
+
+	req.HTTPHeader().Set("If-None-Match", etag)
+	assert.True(mc.NotModified(req, ce))
+	req.HTTPHeader().Set("If-None-Match", `"other"`)
+	assert.False(mc.NotModified(req, ce))
+
+	// the ETag of the backend is kept
+	resp.HTTPHeader().Set(keyETag, `"v1"`)
+	mc.Store(req, resp)
+	ce = mc.Load(req)
+	assert.Equal(`"v1"`, ce.Header.Get(keyETag))
+	req.HTTPHeader().Set("If-None-Match", `W/"v1"`)
+	assert.True(mc.NotModified(req, ce))
+
+	// only 200 responses are not modified
+	resp.SetStatusCode(http.StatusNotFound)
+	mc.Store(req, resp)
+	assert.False(mc.NotModified(req, mc.Load(req)))
+
+	assert.Equal(int64(2), mc.status().NumOfNotModified)
+}
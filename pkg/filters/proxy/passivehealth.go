@@ -0,0 +1,210 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultPassiveHealthFailures     = 5
+	defaultPassiveHealthWindow       = 10 * time.Second
+	defaultPassiveHealthEjectionTime = 30 * time.Second
+)
+
+type (
+	// PassiveHealthCheckSpec is the spec of the passive health check, which
+	// ejects a server from the pool after observing failures of the
+	// requests sent to it, and reinstates the server after a while.
+	PassiveHealthCheckSpec struct {
+		// Failures is the number of failures in Window to eject a server.
+		Failures int `json:"failures" jsonschema:"omitempty,minimum=1"`
+		// Window is the duration in which the failures are counted.
+		Window string `json:"window" jsonschema:"omitempty,format=duration"`
+		// EjectionTime is the duration a server is ejected.
+		EjectionTime string `json:"ejectionTime" jsonschema:"omitempty,format=duration"`
+	}
+
+	// PassiveHealthCheckStatus is the status of the passive health check.
+	PassiveHealthCheckStatus struct {
+		EjectedServers  []string `json:"ejectedServers,omitempty"`
+		NumOfEjected    int64    `json:"numOfEjected"`
+		NumOfRerouted   int64    `json:"numOfRerouted"`
+		NumOfPanicRoute int64    `json:"numOfPanicRoute"`
+	}
+
+	// passiveHealth keeps the failures of servers by server ID, so that
+	// the state survives the update of servers from service registries.
+	passiveHealth struct {
+		failures     int
+		window       time.Duration
+		ejectionTime time.Duration
+
+		lock    sync.Mutex
+		servers map[string]*passiveHealthServer
+
+		numOfEjected    int64
+		numOfRerouted   int64
+		numOfPanicRoute int64
+	}
+
+	passiveHealthServer struct {
+		url string
+		// failures are the time of the recent failures, the oldest first.
+		failures  []time.Time
+		ejectedAt time.Time
+	}
+)
+
+// Validate validates the PassiveHealthCheckSpec.
+func (s *PassiveHealthCheckSpec) Validate() error {
+	for _, v := range []struct{ name, value string }{
+		{"window", s.Window},
+		{"ejectionTime", s.EjectionTime},
+	} {
+		if v.value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v.value); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q", v.name, v.value)
+		}
+	}
+	return nil
+}
+
+func newPassiveHealth(spec *PassiveHealthCheckSpec) *passiveHealth {
+	ph := &passiveHealth{
+		failures: spec.Failures,
+		servers:  map[string]*passiveHealthServer{},
+	}
+	if ph.failures <= 0 {
+		ph.failures = defaultPassiveHealthFailures
+	}
+	ph.window, _ = time.ParseDuration(spec.Window)
+	if ph.window <= 0 {
+		ph.window = defaultPassiveHealthWindow
+	}
+	ph.ejectionTime, _ = time.ParseDuration(spec.EjectionTime)
+	if ph.ejectionTime <= 0 {
+		ph.ejectionTime = defaultPassiveHealthEjectionTime
+	}
+	return ph
+}
+
+// ejected reports whether the server is ejected at now, the caller must
+// hold the lock.
+func (ph *passiveHealth) ejected(svr *Server, now time.Time) bool {
+	s := ph.servers[svr.ID()]
+	return s != nil && !s.ejectedAt.IsZero() && now.Sub(s.ejectedAt) < ph.ejectionTime
+}
+
+// choose returns svr if it is not ejected, or another healthy server
+// which is not ejected. If all the servers are ejected, it returns svr
+// anyway, because sending requests to an ejected server is better than
+// a total outage.
+func (ph *passiveHealth) choose(lb LoadBalancer, svr *Server) *Server {
+	now := fasttime.Now()
+
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	if !ph.ejected(svr, now) {
+		return svr
+	}
+
+	servers := lb.HealthyServers()
+	if n := len(servers); n > 0 {
+		offset := rand.Intn(n)
+		for i := 0; i < n; i++ {
+			s := servers[(offset+i)%n]
+			if s != svr && !ph.ejected(s, now) {
+				atomic.AddInt64(&ph.numOfRerouted, 1)
+				return s
+			}
+		}
+	}
+
+	atomic.AddInt64(&ph.numOfPanicRoute, 1)
+	return svr
+}
+
+// record records the result of a request sent to the server, the server
+// is ejected if there are enough failures in the window.
+func (ph *passiveHealth) record(svr *Server, err error) {
+	if err == nil || isNeutralError(err) {
+		return
+	}
+
+	now := fasttime.Now()
+	id := svr.ID()
+
+	ph.lock.Lock()
+	defer ph.lock.Unlock()
+
+	s := ph.servers[id]
+	if s == nil {
+		s = &passiveHealthServer{url: svr.URL}
+		ph.servers[id] = s
+	}
+
+	// requests sent before the server is ejected may fail after it, they
+	// don't extend the ejection.
+	if !s.ejectedAt.IsZero() && now.Sub(s.ejectedAt) < ph.ejectionTime {
+		return
+	}
+
+	// drop the failures out of the window.
+	i := 0
+	for i < len(s.failures) && now.Sub(s.failures[i]) > ph.window {
+		i++
+	}
+	s.failures = append(s.failures[i:], now)
+
+	if len(s.failures) >= ph.failures {
+		s.failures = s.failures[:0]
+		s.ejectedAt = now
+		atomic.AddInt64(&ph.numOfEjected, 1)
+	}
+}
+
+func (ph *passiveHealth) status() *PassiveHealthCheckStatus {
+	s := &PassiveHealthCheckStatus{
+		NumOfEjected:    atomic.LoadInt64(&ph.numOfEjected),
+		NumOfRerouted:   atomic.LoadInt64(&ph.numOfRerouted),
+		NumOfPanicRoute: atomic.LoadInt64(&ph.numOfPanicRoute),
+	}
+
+	now := fasttime.Now()
+	ph.lock.Lock()
+	for _, server := range ph.servers {
+		if !server.ejectedAt.IsZero() && now.Sub(server.ejectedAt) < ph.ejectionTime {
+			s.EjectedServers = append(s.EjectedServers, server.url)
+		}
+	}
+	ph.lock.Unlock()
+
+	sort.Strings(s.EjectedServers)
+	return s
+}
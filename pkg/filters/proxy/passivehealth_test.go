@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassiveHealthCheck(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096
+  loadBalance:
+    policy: roundRobin
+  passiveHealthCheck:
+    failures: 2
+    window: 1m
+    ejectionTime: 50ms
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+	defer proxy.Close()
+
+	healthy := map[string]bool{"127.0.0.1:9095": false, "127.0.0.1:9096": true}
+	sent := map[string]int{}
+
+	proxy.sendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		sent[r.URL.Host]++
+		code := http.StatusOK
+		if !healthy[r.URL.Host] {
+			code = http.StatusServiceUnavailable
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	handle := func() string {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		return proxy.Handle(getCtx(stdr))
+	}
+
+	// 9095 is ejected after 2 failures, and then all requests are routed
+	// to 9096.
+	for i := 0; i < 10; i++ {
+		handle()
+	}
+	assert.Equal(2, sent["127.0.0.1:9095"])
+	assert.Equal(8, sent["127.0.0.1:9096"])
+
+	status := proxy.mainPool.status().PassiveHealth
+	assert.Equal(int64(1), status.NumOfEjected)
+	assert.Equal(int64(3), status.NumOfRerouted)
+	assert.Equal([]string{"http://127.0.0.1:9095"}, status.EjectedServers)
+
+	// the last healthy server is never ejected from routing, requests are
+	// still sent to the servers when all of them are ejected.
+	healthy["127.0.0.1:9096"] = false
+	sent = map[string]int{}
+	for i := 0; i < 4; i++ {
+		assert.Equal(resultFailureCode, handle())
+	}
+	assert.Equal(1, sent["127.0.0.1:9095"])
+	assert.Equal(3, sent["127.0.0.1:9096"])
+	status = proxy.mainPool.status().PassiveHealth
+	assert.Equal(int64(2), status.NumOfEjected)
+	assert.Equal(int64(2), status.NumOfPanicRoute)
+
+	// the servers are reinstated after the ejection time.
+	time.Sleep(60 * time.Millisecond)
+	healthy["127.0.0.1:9095"] = true
+	assert.Empty(proxy.mainPool.status().PassiveHealth.EjectedServers)
+	sent = map[string]int{}
+	handle()
+	handle()
+	assert.Equal(1, sent["127.0.0.1:9095"])
+	assert.Equal(1, sent["127.0.0.1:9096"])
+}
+
+func TestPassiveHealthCheckSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &PassiveHealthCheckSpec{}
+	assert.NoError(spec.Validate())
+
+	spec.Window = "-1s"
+	assert.Error(spec.Validate())
+
+	spec.Window = "10s"
+	spec.EjectionTime = "abc"
+	assert.Error(spec.Validate())
+
+	spec.EjectionTime = "1m"
+	assert.NoError(spec.Validate())
+
+	ph := newPassiveHealth(&PassiveHealthCheckSpec{})
+	assert.Equal(defaultPassiveHealthFailures, ph.failures)
+	assert.Equal(defaultPassiveHealthWindow, ph.window)
+	assert.Equal(defaultPassiveHealthEjectionTime, ph.ejectionTime)
+}
@@ -19,6 +19,7 @@ package proxy
 
 import (
 	stdcontext "context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -144,6 +145,12 @@ func (spCtx *serverPoolContext) prepareRequest(svr *Server, ctx stdcontext.Conte
 	stdr.Header = req.HTTPHeader().Clone()
 	removeHopByHopHeaders(stdr.Header)
 
+	// the body is already read, waiting for "100 Continue" from the
+	// backend only adds latency.
+	if !req.IsStream() {
+		stdr.Header.Del("Expect")
+	}
+
 	// only set host when server address is not host name OR
 	// server is explicitly told to keep the host of the request.
 	if !svr.addrIsHostName || svr.KeepHost {
@@ -164,27 +171,38 @@ type ServerPool struct {
 
 	proxy        *Proxy
 	spec         *ServerPoolSpec
+	backend      string
 	failureCodes map[int]struct{}
 
-	timeout               time.Duration
+	timeouts              *timeouts
 	retryWrapper          resilience.Wrapper
 	circuitBreakerWrapper resilience.Wrapper
 
 	httpStat    *httpstat.HTTPStat
 	memoryCache *MemoryCache
+	shaper      *shaper
+	breaker     *serverBreaker
+	passive     *passiveHealth
 	metrics     *metrics
+	rangeStat   RangeStatus
 }
 
 // ServerPoolSpec is the spec for a server pool.
 type ServerPoolSpec struct {
 	BaseServerPoolSpec `json:",inline"`
 
-	SpanName             string           `json:"spanName" jsonschema:"omitempty"`
-	ServerMaxBodySize    int64            `json:"serverMaxBodySize" jsonschema:"omitempty"`
-	Timeout              string           `json:"timeout" jsonschema:"omitempty,format=duration"`
-	RetryPolicy          string           `json:"retryPolicy" jsonschema:"omitempty"`
-	CircuitBreakerPolicy string           `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
-	MemoryCache          *MemoryCacheSpec `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	SpanName             string             `json:"spanName" jsonschema:"omitempty"`
+	ServerMaxBodySize    int64              `json:"serverMaxBodySize" jsonschema:"omitempty"`
+	Timeout              string             `json:"timeout" jsonschema:"omitempty,format=duration"`
+	Timeouts             []*TimeoutRuleSpec `json:"timeouts,omitempty" jsonschema:"omitempty"`
+	RetryPolicy          string             `json:"retryPolicy" jsonschema:"omitempty"`
+	CircuitBreakerPolicy string             `json:"circuitBreakerPolicy" jsonschema:"omitempty"`
+	MemoryCache          *MemoryCacheSpec   `json:"memoryCache,omitempty" jsonschema:"omitempty"`
+	Range                *RangeSpec         `json:"range,omitempty" jsonschema:"omitempty"`
+	Shaping              *ShapingSpec       `json:"shaping,omitempty" jsonschema:"omitempty"`
+
+	ServerCircuitBreaker *ServerCircuitBreakerSpec `json:"serverCircuitBreaker,omitempty" jsonschema:"omitempty"`
+	PassiveHealthCheck   *PassiveHealthCheckSpec   `json:"passiveHealthCheck,omitempty" jsonschema:"omitempty"`
 
 	// FailureCodes would be 5xx if it isn't assigned any value.
 	FailureCodes []int `json:"failureCodes" jsonschema:"omitempty,uniqueItems=true"`
@@ -192,7 +210,20 @@ type ServerPoolSpec struct {
 
 // ServerPoolStatus is the status of Pool.
 type ServerPoolStatus struct {
-	Stat *httpstat.Status `json:"stat"`
+	Stat           *httpstat.Status            `json:"stat"`
+	Range          *RangeStatus                `json:"range,omitempty"`
+	BoundedLoad    *BoundedLoadStatus          `json:"boundedLoad,omitempty"`
+	LeastRequest   *LeastRequestStatus         `json:"leastRequest,omitempty"`
+	Shaping        *ShapingStatus              `json:"shaping,omitempty"`
+	ServerBreaker  *ServerCircuitBreakerStatus `json:"serverCircuitBreaker,omitempty"`
+	PassiveHealth  *PassiveHealthCheckStatus   `json:"passiveHealthCheck,omitempty"`
+	MemoryCache    *MemoryCacheStatus          `json:"memoryCache,omitempty"`
+	RegionFailover *RegionFailoverStatus       `json:"regionFailover,omitempty"`
+	AffinityHint   *AffinityHintStatus         `json:"affinityHint,omitempty"`
+	ForceUpstream  *ForceUpstreamStatus        `json:"forceUpstream,omitempty"`
+	HealthCheck    *HealthCheckStatus          `json:"healthCheck,omitempty"`
+	Timeout        *TimeoutStatus              `json:"timeout,omitempty"`
+	Cohort         *CohortStatus               `json:"cohort,omitempty"`
 }
 
 // NewServerPool creates a new server pool according to spec.
@@ -204,14 +235,30 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 	}
 	sp.BaseServerPool.Init(proxy.super, name, &spec.BaseServerPoolSpec)
 
+	// the cohort is rolled back according to the stat of the pool.
+	if m, ok := sp.filter.(*cohortMatcher); ok {
+		m.stat = sp.httpStat
+	}
+
 	if spec.MemoryCache != nil {
 		sp.memoryCache = NewMemoryCache(spec.MemoryCache)
 	}
 
-	if spec.Timeout != "" {
-		sp.timeout, _ = time.ParseDuration(spec.Timeout)
+	if spec.Shaping != nil {
+		sp.shaper = newShaper(spec.Shaping)
+	}
+
+	if spec.ServerCircuitBreaker != nil {
+		sp.breaker = newServerBreaker(spec.ServerCircuitBreaker)
+	}
+
+	if spec.PassiveHealthCheck != nil {
+		sp.passive = newPassiveHealth(spec.PassiveHealthCheck)
 	}
 
+	timeout, _ := time.ParseDuration(spec.Timeout)
+	sp.timeouts = newTimeouts(timeout, spec.Timeouts)
+
 	sp.failureCodes = map[int]struct{}{}
 	for _, code := range spec.FailureCodes {
 		sp.failureCodes[code] = struct{}{}
@@ -222,7 +269,48 @@ func NewServerPool(proxy *Proxy, spec *ServerPoolSpec, name string) *ServerPool
 }
 
 func (sp *ServerPool) status() *ServerPoolStatus {
-	s := &ServerPoolStatus{Stat: sp.httpStat.Status()}
+	s := &ServerPoolStatus{
+		Stat:  sp.httpStat.Status(),
+		Range: sp.rangeStatus(),
+	}
+	lb := sp.LoadBalancer()
+	if fulb, ok := lb.(*forceUpstreamLoadBalancer); ok {
+		s.ForceUpstream = fulb.status()
+		lb = fulb.LoadBalancer
+	}
+	if ahlb, ok := lb.(*affinityHintLoadBalancer); ok {
+		s.AffinityHint = ahlb.status()
+		lb = ahlb.LoadBalancer
+	}
+	if hc, ok := lb.(interface{ healthCheckStatus() *HealthCheckStatus }); ok {
+		s.HealthCheck = hc.healthCheckStatus()
+	}
+	switch lb := lb.(type) {
+	case *boundedLoadHashLoadBalancer:
+		s.BoundedLoad = lb.status()
+	case *leastRequestLoadBalancer:
+		s.LeastRequest = lb.status()
+	case *regionFailoverLoadBalancer:
+		s.RegionFailover = lb.status()
+	}
+	if sp.shaper != nil {
+		s.Shaping = sp.shaper.status()
+	}
+	if sp.breaker != nil {
+		s.ServerBreaker = sp.breaker.status()
+	}
+	if sp.passive != nil {
+		s.PassiveHealth = sp.passive.status()
+	}
+	if sp.memoryCache != nil {
+		s.MemoryCache = sp.memoryCache.status()
+	}
+	if sp.timeouts.timeout > 0 || len(sp.timeouts.rules) > 0 {
+		s.Timeout = sp.timeouts.status()
+	}
+	if m, ok := sp.filter.(*cohortMatcher); ok {
+		s.Cohort = m.status()
+	}
 	return s
 }
 
@@ -297,10 +385,14 @@ func (sp *ServerPool) collectMetrics(spCtx *serverPoolContext) {
 }
 
 func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(spCtx.req)
 	if svr == nil {
 		return
 	}
+	if lt, ok := lb.(serverLoadTracker); ok {
+		defer lt.releaseServer(svr)
+	}
 
 	err := spCtx.prepareRequest(svr, spCtx.req.Context(), true)
 	if err != nil {
@@ -308,7 +400,7 @@ func (sp *ServerPool) handleMirror(spCtx *serverPoolContext) {
 		return
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	resp, err := sp.proxy.send(spCtx.stdReq)
 	if err != nil {
 		return
 	}
@@ -328,9 +420,21 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 		return ""
 	}
 
+	if err := checkBackendGuard(ctx, sp.backend); err != nil {
+		logger.Errorf("%s: rejected by backend guard: %v", sp.name, err)
+		spCtx.AddTag("rejected by backend guard: " + err.Error())
+		sp.buildFailureResponse(spCtx, http.StatusInternalServerError)
+		return resultInternalError
+	}
+
 	spCtx.startTime = fasttime.Now()
 	defer sp.collectMetrics(spCtx)
 
+	if sp.memoryCache != nil && sp.memoryCache.IsPurgeRequest(spCtx.req) {
+		sp.handlePurge(spCtx)
+		return ""
+	}
+
 	if sp.buildResponseFromCache(spCtx) {
 		if sp.inFailureCodes(spCtx.resp.StatusCode()) {
 			return resultFailureCode
@@ -338,12 +442,19 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 		return ""
 	}
 
+	timeout, timeoutRule := sp.timeouts.choose(spCtx.req)
+	if timeout > 0 {
+		spCtx.LazyAddTag(func() string {
+			return sp.name + "#timeout: " + timeout.String()
+		})
+	}
+
 	// wrap the handler function to meet the requirement of resilience
 	// wrappers.
 	handler := func(stdctx stdcontext.Context) error {
-		if sp.timeout > 0 {
+		if timeout > 0 {
 			var cancel stdcontext.CancelFunc
-			stdctx, cancel = stdcontext.WithTimeout(stdctx, sp.timeout)
+			stdctx, cancel = stdcontext.WithTimeout(stdctx, timeout)
 			defer cancel()
 		}
 
@@ -392,6 +503,14 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	// response in most cases, but for failure status codes, the
 	// response is already there.
 	if spe, ok := err.(serverPoolError); ok {
+		if spe.result == resultTimeout {
+			sp.timeouts.timedOut(timeoutRule)
+			// requests timed out by a timeout rule are responded with
+			// 504, the timeout of the pool keeps 408 for compatibility.
+			if timeoutRule != nil {
+				spe.code = http.StatusGatewayTimeout
+			}
+		}
 		if spCtx.resp == nil {
 			sp.buildFailureResponse(spCtx, spe.code)
 		}
@@ -401,8 +520,19 @@ func (sp *ServerPool) handle(ctx *context.Context, mirror bool) string {
 	panic(fmt.Errorf("should not reach here"))
 }
 
-func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) error {
-	svr := sp.LoadBalancer().ChooseServer(spCtx.req)
+func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolContext) (err error) {
+	// smooth the requests to the servers, the request fails fast if it
+	// can't be sent in time.
+	if sp.shaper != nil {
+		if err := sp.shaper.wait(stdctx); err != nil {
+			logger.Errorf("%s: rejected by outbound shaping: %v", sp.name, err)
+			spCtx.AddTag("rejected by outbound shaping")
+			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
+		}
+	}
+
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(spCtx.req)
 
 	// if there's no available server.
 	if svr == nil {
@@ -410,6 +540,32 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusServiceUnavailable, resultInternalError}
 	}
 
+	if lt, ok := lb.(serverLoadTracker); ok {
+		defer lt.releaseServer(svr)
+	}
+
+	// skip the servers which are ejected by the passive health check or
+	// whose circuit is open, the load is still released on the server
+	// chosen by the load balancer.
+	if sp.passive != nil {
+		svr = sp.passive.choose(lb, svr)
+		defer func() {
+			sp.passive.record(svr, err)
+		}()
+	}
+	if sp.breaker != nil {
+		s := sp.breaker.choose(lb, svr)
+		if s == nil {
+			logger.Errorf("%s: circuits of all servers are open", sp.name)
+			spCtx.AddTag("short circuited by server circuit breaker")
+			return serverPoolError{http.StatusServiceUnavailable, resultShortCircuited}
+		}
+		svr = s
+		defer func() {
+			sp.breaker.record(svr, err)
+		}()
+	}
+
 	// prepare the request to send.
 	statResult := &gohttpstat.Result{}
 	stdctx = gohttpstat.WithHTTPStat(stdctx, statResult)
@@ -418,7 +574,7 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
-	resp, err := fnSendRequest(spCtx.stdReq, sp.proxy.client)
+	resp, err := sp.proxy.send(spCtx.stdReq)
 	if err != nil {
 		logger.Errorf("%s: failed to send request: %v", sp.name, err)
 
@@ -427,6 +583,10 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 			return fmt.Sprintf("trace %v", statResult)
 		})
 
+		if errors.Is(err, errSPKIPinMismatch) {
+			return serverPoolError{http.StatusBadGateway, resultServerError}
+		}
+
 		if err := spCtx.stdReq.Context().Err(); err == nil {
 			return serverPoolError{http.StatusServiceUnavailable, resultServerError}
 		} else if err == stdcontext.DeadlineExceeded {
@@ -443,7 +603,14 @@ func (sp *ServerPool) doHandle(stdctx stdcontext.Context, spCtx *serverPoolConte
 		return serverPoolError{http.StatusInternalServerError, resultInternalError}
 	}
 
-	sp.LoadBalancer().ReturnServer(svr, spCtx.req, spCtx.resp)
+	if err = sp.handleRangeRequest(spCtx); err != nil {
+		logger.Errorf("%s: failed to handle range request: %v", sp.name, err)
+		// the response is broken, build a failure response instead.
+		spCtx.resp = nil
+		return serverPoolError{http.StatusServiceUnavailable, resultServerError}
+	}
+
+	lb.ReturnServer(svr, spCtx.req, spCtx.resp)
 
 	spCtx.LazyAddTag(func() string {
 		return fmt.Sprintf("status code: %d", resp.StatusCode)
@@ -566,14 +733,42 @@ func (sp *ServerPool) buildResponseFromCache(spCtx *serverPoolContext) bool {
 		}
 	}
 
-	resp.SetStatusCode(ce.StatusCode)
-	resp.SetPayload(ce.Body)
+	if sp.memoryCache.NotModified(spCtx.req, ce) {
+		header.Del("Content-Length")
+		resp.SetStatusCode(http.StatusNotModified)
+		resp.SetPayload(nil)
+	} else {
+		resp.SetStatusCode(ce.StatusCode)
+		resp.SetPayload(ce.Body)
+	}
 
 	spCtx.resp = resp
 	spCtx.SetOutputResponse(resp)
 	return true
 }
 
+// handlePurge purges the cache entries matching the request, and builds a
+// response with the number of purged entries.
+func (sp *ServerPool) handlePurge(spCtx *serverPoolContext) {
+	n := sp.memoryCache.Purge(spCtx.req)
+	spCtx.LazyAddTag(func() string {
+		return fmt.Sprintf("purged %d cache entries", n)
+	})
+
+	resp, _ := spCtx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+
+	body := []byte(fmt.Sprintf(`{"purged":%d}`, n))
+	resp.SetStatusCode(http.StatusOK)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+
+	spCtx.resp = resp
+	spCtx.SetOutputResponse(resp)
+}
+
 func (sp *ServerPool) buildFailureResponse(spCtx *serverPoolContext, statusCode int) {
 	resp, _ := spCtx.GetOutputResponse().(*httpprot.Response)
 	if resp == nil {
@@ -163,6 +163,16 @@ servers:
 	resp.HTTPHeader().Set("Access-Control-Allow-Origin", "*")
 	sp.memoryCache.Store(req, resp)
 	assert.True(sp.buildResponseFromCache(spCtx))
+
+	// conditional request
+	req.HTTPHeader().Del("Origin")
+	resp.HTTPHeader().Set("ETag", `"v1"`)
+	sp.memoryCache.Store(req, resp)
+	req.HTTPHeader().Set("If-None-Match", `"v1"`)
+	assert.True(sp.buildResponseFromCache(spCtx))
+	assert.Equal(http.StatusNotModified, spCtx.resp.StatusCode())
+	assert.Equal(int64(0), spCtx.resp.PayloadSize())
+	assert.Equal(`"v1"`, spCtx.resp.HTTPHeader().Get("ETag"))
 }
 
 func TestCopyCORSHeaders(t *testing.T) {
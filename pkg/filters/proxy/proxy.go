@@ -24,6 +24,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
@@ -60,6 +62,7 @@ var kind = &filters.Kind{
 		resultTimeout,
 		resultShortCircuited,
 	},
+	Effects: []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{
 			MaxIdleConns:        10240,
@@ -85,6 +88,14 @@ var fnSendRequest = func(r *http.Request, client *http.Client) (*http.Response,
 	return client.Do(r)
 }
 
+// send sends the request to the server.
+func (p *Proxy) send(r *http.Request) (*http.Response, error) {
+	if p.sendRequest != nil {
+		return p.sendRequest(r, p.client)
+	}
+	return fnSendRequest(r, p.client)
+}
+
 type (
 	// Proxy is the filter Proxy.
 	Proxy struct {
@@ -96,8 +107,16 @@ type (
 		mirrorPool     *ServerPool
 
 		client *http.Client
+		// sendRequest overrides fnSendRequest for this proxy if it is not
+		// nil, tests use it to fake the servers without touching the
+		// global function, which is read by the goroutines of mirrors.
+		sendRequest func(r *http.Request, client *http.Client) (*http.Response, error)
 
-		compression *compression
+		compression    *compression
+		errorReplayer  *errorReplayer
+		serverNameStat *serverNameStat
+
+		numOfPinFailures int64
 	}
 
 	// Spec describes the Proxy.
@@ -108,6 +127,9 @@ type (
 		MirrorPool          *ServerPoolSpec   `json:"mirrorPool,omitempty" jsonschema:"omitempty"`
 		Compression         *CompressionSpec  `json:"compression,omitempty" jsonschema:"omitempty"`
 		MTLS                *MTLS             `json:"mtls,omitempty" jsonschema:"omitempty"`
+		SPKIPins            []string          `json:"spkiPins" jsonschema:"omitempty,uniqueItems=true"`
+		ErrorReplay         *ErrorReplaySpec  `json:"errorReplay,omitempty" jsonschema:"omitempty"`
+		DefaultServerName   string            `json:"defaultServerName" jsonschema:"omitempty"`
 		MaxIdleConns        int               `json:"maxIdleConns" jsonschema:"omitempty"`
 		MaxIdleConnsPerHost int               `json:"maxIdleConnsPerHost" jsonschema:"omitempty"`
 		ServerMaxBodySize   int64             `json:"serverMaxBodySize" jsonschema:"omitempty"`
@@ -118,6 +140,10 @@ type (
 		MainPool       *ServerPoolStatus   `json:"mainPool"`
 		CandidatePools []*ServerPoolStatus `json:"candidatePools,omitempty"`
 		MirrorPool     *ServerPoolStatus   `json:"mirrorPool,omitempty"`
+		ErrorReplay    *ErrorReplayStatus  `json:"errorReplay,omitempty"`
+		ServerNames    map[string]int64    `json:"serverNames,omitempty"`
+
+		NumOfPinFailures int64 `json:"numOfPinFailures,omitempty"`
 	}
 
 	// MTLS is the configuration for client side mTLS.
@@ -138,6 +164,26 @@ func (s *Spec) Validate() error {
 		if err := pool.Validate(); err != nil {
 			return fmt.Errorf("pool %d: %v", i, err)
 		}
+		if pool.Shaping != nil {
+			if err := pool.Shaping.Validate(); err != nil {
+				return fmt.Errorf("pool %d: shaping: %v", i, err)
+			}
+		}
+		if pool.ServerCircuitBreaker != nil {
+			if err := pool.ServerCircuitBreaker.Validate(); err != nil {
+				return fmt.Errorf("pool %d: serverCircuitBreaker: %v", i, err)
+			}
+		}
+		if pool.PassiveHealthCheck != nil {
+			if err := pool.PassiveHealthCheck.Validate(); err != nil {
+				return fmt.Errorf("pool %d: passiveHealthCheck: %v", i, err)
+			}
+		}
+		for j, rule := range pool.Timeouts {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("pool %d: timeouts %d: %v", i, j, err)
+			}
+		}
 	}
 
 	if numMainPool != 1 {
@@ -153,6 +199,16 @@ func (s *Spec) Validate() error {
 		}
 	}
 
+	if err := validateSPKIPins(s.SPKIPins); err != nil {
+		return err
+	}
+
+	if s.ErrorReplay != nil {
+		if err := s.ErrorReplay.Validate(); err != nil {
+			return fmt.Errorf("errorReplay: %v", err)
+		}
+	}
+
 	return nil
 }
 
@@ -179,6 +235,19 @@ func (p *Proxy) Init() {
 // Inherit inherits previous generation of Proxy.
 func (p *Proxy) Inherit(previousGeneration filters.Filter) {
 	p.reload()
+
+	// the counters of canary cohorts are kept.
+	prev := previousGeneration.(*Proxy)
+	for i, pool := range p.candidatePools {
+		if i >= len(prev.candidatePools) {
+			break
+		}
+		m, ok1 := pool.filter.(*cohortMatcher)
+		pm, ok2 := prev.candidatePools[i].filter.(*cohortMatcher)
+		if ok1 && ok2 {
+			m.inherit(pm)
+		}
+	}
 }
 
 func (p *Proxy) tlsConfig() (*tls.Config, error) {
@@ -207,7 +276,7 @@ func (p *Proxy) tlsConfig() (*tls.Config, error) {
 }
 
 func (p *Proxy) reload() {
-	for _, spec := range p.spec.Pools {
+	for i, spec := range p.spec.Pools {
 		name := ""
 		if spec.Filter == nil {
 			name = fmt.Sprintf("proxy#%s#main", p.Name())
@@ -217,6 +286,7 @@ func (p *Proxy) reload() {
 		}
 
 		pool := NewServerPool(p, spec, name)
+		pool.backend = fmt.Sprintf("%s/%d", p.Name(), i)
 
 		if spec.Filter == nil {
 			p.mainPool = pool
@@ -228,6 +298,26 @@ func (p *Proxy) reload() {
 	if p.spec.MirrorPool != nil {
 		name := fmt.Sprintf("proxy#%s#mirror", p.Name())
 		p.mirrorPool = NewServerPool(p, p.spec.MirrorPool, name)
+		p.mirrorPool.backend = p.Name() + "/mirror"
+	}
+
+	// requests are counted by server name if any pool is selected by it.
+	pools := append([]*ServerPool{p.mirrorPool}, p.candidatePools...)
+	for _, pool := range pools {
+		if pool == nil {
+			continue
+		}
+		if m, ok := pool.filter.(*serverNameMatcher); ok {
+			m.defaultName = strings.ToLower(p.spec.DefaultServerName)
+			if p.serverNameStat == nil {
+				p.serverNameStat = newServerNameStat()
+			}
+		}
+	}
+
+	if p.spec.ErrorReplay != nil {
+		name := fmt.Sprintf("proxy#%s#errorReplay", p.Name())
+		p.errorReplayer = newErrorReplayer(name, p.spec.ErrorReplay)
 	}
 
 	if p.spec.Compression != nil {
@@ -235,6 +325,9 @@ func (p *Proxy) reload() {
 	}
 
 	tlsCfg, _ := p.tlsConfig()
+	if len(p.spec.SPKIPins) > 0 {
+		tlsCfg.VerifyConnection = p.verifySPKIPins(p.spec.SPKIPins)
+	}
 	p.client = &http.Client{
 		// NOTE: Timeout could be no limit, real client or server could cancel it.
 		Timeout: 0,
@@ -264,7 +357,8 @@ func (p *Proxy) reload() {
 // Status returns Proxy status.
 func (p *Proxy) Status() interface{} {
 	s := &Status{
-		MainPool: p.mainPool.status(),
+		MainPool:         p.mainPool.status(),
+		NumOfPinFailures: atomic.LoadInt64(&p.numOfPinFailures),
 	}
 
 	for _, pool := range p.candidatePools {
@@ -275,6 +369,14 @@ func (p *Proxy) Status() interface{} {
 		s.MirrorPool = p.mirrorPool.status()
 	}
 
+	if p.errorReplayer != nil {
+		s.ErrorReplay = p.errorReplayer.status()
+	}
+
+	if p.serverNameStat != nil {
+		s.ServerNames = p.serverNameStat.status()
+	}
+
 	return s
 }
 
@@ -289,13 +391,27 @@ func (p *Proxy) Close() {
 	if p.mirrorPool != nil {
 		p.mirrorPool.close()
 	}
+
+	if p.errorReplayer != nil {
+		p.errorReplayer.close()
+	}
 }
 
 // Handle handles HTTPContext.
 func (p *Proxy) Handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
 
-	if p.mirrorPool != nil && p.mirrorPool.filter.Match(req) {
+	if p.serverNameStat != nil {
+		name := serverName(req)
+		if name == "" {
+			name = strings.ToLower(p.spec.DefaultServerName)
+		}
+		p.serverNameStat.count(name)
+	}
+
+	// the backend guard is checked here for the mirror pool, as the
+	// context must not be accessed concurrently.
+	if p.mirrorPool != nil && p.mirrorPool.filter.Match(req) && checkBackendGuard(ctx, p.mirrorPool.backend) == nil {
 		go p.mirrorPool.handle(ctx, true)
 	}
 
@@ -307,7 +423,11 @@ func (p *Proxy) Handle(ctx *context.Context) (result string) {
 		}
 	}
 
-	return sp.handle(ctx, false)
+	result = sp.handle(ctx, false)
+	if p.errorReplayer != nil && isErrorResult(ctx, result) {
+		p.errorReplayer.capture(req)
+	}
+	return result
 }
 
 // InjectResiliencePolicy injects resilience policies to the proxy.
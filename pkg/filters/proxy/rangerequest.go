@@ -0,0 +1,292 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// rangeModePassThrough relays the full response to the client if
+	// the server does not support range requests.
+	rangeModePassThrough = "passThrough"
+	// rangeModeSynthesize builds a partial response from the full
+	// response if the server does not support range requests.
+	rangeModeSynthesize = "synthesize"
+)
+
+var (
+	errRangeUnsupported    = fmt.Errorf("range unsupported")
+	errRangeNotSatisfiable = fmt.Errorf("range not satisfiable")
+)
+
+type (
+	// RangeSpec describes how to handle range requests if the server
+	// responds them with the full content.
+	RangeSpec struct {
+		Mode       string `json:"mode" jsonschema:"omitempty,enum=,enum=passThrough,enum=synthesize"`
+		BufferSize int64  `json:"bufferSize" jsonschema:"omitempty"`
+	}
+
+	// RangeStatus is the status of range requests.
+	RangeStatus struct {
+		NumOfRequests    int64 `json:"numOfRequests"`
+		NumOfPartial     int64 `json:"numOfPartial"`
+		NumOfSynthesized int64 `json:"numOfSynthesized"`
+		NumOfPassThrough int64 `json:"numOfPassThrough"`
+	}
+
+	// byteRange is a resolved byte range, both start and end are
+	// inclusive.
+	byteRange struct {
+		start int64
+		end   int64
+	}
+)
+
+func (br byteRange) length() int64 {
+	return br.end - br.start + 1
+}
+
+func (br byteRange) contentRange(size int64) string {
+	if size < 0 {
+		return fmt.Sprintf("bytes %d-%d/*", br.start, br.end)
+	}
+	return fmt.Sprintf("bytes %d-%d/%d", br.start, br.end, size)
+}
+
+// parseRange parses the value of a Range header against a representation
+// of size bytes, size is negative if it is unknown. Only a single byte range
+// is supported, errRangeUnsupported is returned for other cases, and the
+// header should be ignored according to RFC 7233.
+func parseRange(s string, size int64) (byteRange, error) {
+	br := byteRange{}
+
+	if !strings.HasPrefix(s, "bytes=") {
+		return br, errRangeUnsupported
+	}
+	s = strings.TrimSpace(s[len("bytes="):])
+	if strings.Contains(s, ",") {
+		return br, errRangeUnsupported
+	}
+
+	idx := strings.IndexByte(s, '-')
+	if idx < 0 {
+		return br, errRangeUnsupported
+	}
+	first, last := strings.TrimSpace(s[:idx]), strings.TrimSpace(s[idx+1:])
+
+	// suffix range, that's the last N bytes.
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 || size < 0 {
+			return br, errRangeUnsupported
+		}
+		if n == 0 || size == 0 {
+			return br, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		br.start, br.end = size-n, size-1
+		return br, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return br, errRangeUnsupported
+	}
+	br.start = start
+
+	if last == "" {
+		if size < 0 {
+			return br, errRangeUnsupported
+		}
+		br.end = size - 1
+	} else {
+		end, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return br, errRangeUnsupported
+		}
+		br.end = end
+	}
+
+	if size >= 0 {
+		if start >= size {
+			return br, errRangeNotSatisfiable
+		}
+		if br.end >= size {
+			br.end = size - 1
+		}
+	}
+
+	return br, nil
+}
+
+func (sp *ServerPool) rangeStatus() *RangeStatus {
+	return &RangeStatus{
+		NumOfRequests:    atomic.LoadInt64(&sp.rangeStat.NumOfRequests),
+		NumOfPartial:     atomic.LoadInt64(&sp.rangeStat.NumOfPartial),
+		NumOfSynthesized: atomic.LoadInt64(&sp.rangeStat.NumOfSynthesized),
+		NumOfPassThrough: atomic.LoadInt64(&sp.rangeStat.NumOfPassThrough),
+	}
+}
+
+// handleRangeRequest checks the response of a range request, and builds
+// a partial response from the full one if required.
+//
+// The Range header and the partial response of the server are forwarded
+// as is, so nothing need to be done if the server supports range requests.
+func (sp *ServerPool) handleRangeRequest(spCtx *serverPoolContext) error {
+	value := spCtx.req.HTTPHeader().Get("Range")
+	if value == "" {
+		return nil
+	}
+	atomic.AddInt64(&sp.rangeStat.NumOfRequests, 1)
+
+	resp := spCtx.resp
+	switch resp.StatusCode() {
+	case http.StatusPartialContent:
+		atomic.AddInt64(&sp.rangeStat.NumOfPartial, 1)
+		return nil
+	case http.StatusOK:
+	default:
+		return nil
+	}
+
+	// ranges of encoded content and conditional range requests are left
+	// to the client.
+	if sp.spec.Range == nil || sp.spec.Range.Mode != rangeModeSynthesize ||
+		spCtx.req.Method() != http.MethodGet ||
+		spCtx.req.HTTPHeader().Get("If-Range") != "" ||
+		resp.HTTPHeader().Get("Content-Encoding") != "" {
+		atomic.AddInt64(&sp.rangeStat.NumOfPassThrough, 1)
+		return nil
+	}
+
+	ok, err := sp.synthesizeRange(spCtx, value)
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		atomic.AddInt64(&sp.rangeStat.NumOfSynthesized, 1)
+		spCtx.AddTag("range synthesized")
+	} else {
+		atomic.AddInt64(&sp.rangeStat.NumOfPassThrough, 1)
+	}
+	return nil
+}
+
+// synthesizeRange builds a partial response from the full response. For
+// a stream response, the bytes before the range are discarded, and the
+// range is read into a buffer, whose size is limited by the spec.
+func (sp *ServerPool) synthesizeRange(spCtx *serverPoolContext, value string) (bool, error) {
+	resp := spCtx.resp
+
+	size := resp.Std().ContentLength
+	if !resp.IsStream() {
+		size = int64(len(resp.RawPayload()))
+	}
+
+	br, err := parseRange(value, size)
+	if err == errRangeUnsupported {
+		return false, nil
+	}
+
+	if err == errRangeNotSatisfiable {
+		sp.setPartialResponse(spCtx, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", size), nil)
+		return true, nil
+	}
+
+	if !resp.IsStream() {
+		payload := resp.RawPayload()[br.start : br.end+1]
+		sp.setPartialResponse(spCtx, http.StatusPartialContent, br.contentRange(size), payload)
+		return true, nil
+	}
+
+	bufferSize := sp.spec.Range.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = httpprot.DefaultMaxPayloadSize
+	}
+	if br.length() > bufferSize {
+		return false, nil
+	}
+
+	body := resp.GetPayload()
+	n, err := io.CopyN(io.Discard, body, br.start)
+	if err == io.EOF && size < 0 {
+		sp.setPartialResponse(spCtx, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", n), nil)
+		return true, nil
+	}
+
+	if err == nil {
+		payload := make([]byte, br.length())
+		var n int
+		n, err = io.ReadFull(body, payload)
+		payload = payload[:n]
+
+		// the content could be shorter than the range if its size is
+		// unknown, and we know its size now.
+		if (err == io.EOF || err == io.ErrUnexpectedEOF) && size < 0 {
+			size = br.start + int64(n)
+			if n == 0 {
+				sp.setPartialResponse(spCtx, http.StatusRequestedRangeNotSatisfiable, fmt.Sprintf("bytes */%d", size), nil)
+				return true, nil
+			}
+			br.end = size - 1
+			err = nil
+		}
+
+		if err == nil {
+			sp.setPartialResponse(spCtx, http.StatusPartialContent, br.contentRange(size), payload)
+			return true, nil
+		}
+	}
+
+	// part of the body has been consumed, the response is broken.
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	spCtx.respCallbackBody.Close()
+	resp.SetPayload(nil)
+	resp.HTTPHeader().Del("Content-Length")
+	return false, err
+}
+
+func (sp *ServerPool) setPartialResponse(spCtx *serverPoolContext, code int, contentRange string, payload []byte) {
+	resp := spCtx.resp
+	if resp.IsStream() {
+		spCtx.respCallbackBody.Close()
+	}
+
+	resp.SetStatusCode(code)
+	resp.SetPayload(payload)
+	resp.Std().ContentLength = int64(len(payload))
+
+	h := resp.HTTPHeader()
+	h.Set("Content-Range", contentRange)
+	h.Set("Content-Length", strconv.Itoa(len(payload)))
+}
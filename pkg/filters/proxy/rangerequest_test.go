@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/tracing"
+	"github.com/megaease/easegress/pkg/util/readers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRange(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		value string
+		size  int64
+		br    byteRange
+		err   error
+	}{
+		{"bytes=0-9", 100, byteRange{0, 9}, nil},
+		{"bytes=90-", 100, byteRange{90, 99}, nil},
+		{"bytes=90-200", 100, byteRange{90, 99}, nil},
+		{"bytes=-10", 100, byteRange{90, 99}, nil},
+		{"bytes=-200", 100, byteRange{0, 99}, nil},
+		{"bytes=10-19", -1, byteRange{10, 19}, nil},
+		{"bytes=100-", 100, byteRange{}, errRangeNotSatisfiable},
+		{"bytes=-0", 100, byteRange{}, errRangeNotSatisfiable},
+		{"bytes=10-", -1, byteRange{}, errRangeUnsupported},
+		{"bytes=-10", -1, byteRange{}, errRangeUnsupported},
+		{"bytes=0-9,20-29", 100, byteRange{}, errRangeUnsupported},
+		{"bytes=9-0", 100, byteRange{}, errRangeUnsupported},
+		{"items=0-9", 100, byteRange{}, errRangeUnsupported},
+		{"bytes=abc", 100, byteRange{}, errRangeUnsupported},
+	}
+
+	for _, c := range cases {
+		br, err := parseRange(c.value, c.size)
+		assert.Equal(c.err, err, c.value)
+		if err == nil {
+			assert.Equal(c.br, br, c.value)
+		}
+	}
+}
+
+func TestRangeRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	const content = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+	sp := &ServerPool{spec: &ServerPoolSpec{}}
+
+	handle := func(rng string, code int, stream bool) *httpprot.Response {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		stdr.Header.Set("Range", rng)
+		req, _ := httpprot.NewRequest(stdr)
+
+		rw := httptest.NewRecorder()
+		rw.WriteHeader(code)
+		rw.WriteString(content)
+		stdResp := rw.Result()
+		stdResp.ContentLength = int64(len(content))
+
+		body := readers.NewCallbackReader(stdResp.Body)
+		stdResp.Body = body
+		resp, _ := httpprot.NewResponse(stdResp)
+		if stream {
+			resp.FetchPayload(-1)
+		} else {
+			resp.FetchPayload(0)
+		}
+
+		spCtx := &serverPoolContext{
+			Context:          context.New(tracing.NoopSpan),
+			req:              req,
+			resp:             resp,
+			stdResp:          stdResp,
+			respCallbackBody: body,
+		}
+		assert.NoError(sp.handleRangeRequest(spCtx))
+		return spCtx.resp
+	}
+
+	readBody := func(resp *httpprot.Response) string {
+		data, _ := io.ReadAll(resp.GetPayload())
+		return string(data)
+	}
+
+	// the server supports range requests.
+	resp := handle("bytes=10-15", http.StatusPartialContent, false)
+	assert.Equal(http.StatusPartialContent, resp.StatusCode())
+	assert.Equal(content, readBody(resp))
+
+	// the full response is passed through by default.
+	resp = handle("bytes=10-15", http.StatusOK, false)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal(content, readBody(resp))
+
+	sp.spec.Range = &RangeSpec{Mode: rangeModeSynthesize, BufferSize: 8}
+
+	// synthesized from the full response.
+	resp = handle("bytes=10-15", http.StatusOK, false)
+	assert.Equal(http.StatusPartialContent, resp.StatusCode())
+	assert.Equal("bytes 10-15/36", resp.HTTPHeader().Get("Content-Range"))
+	assert.Equal("6", resp.HTTPHeader().Get("Content-Length"))
+	assert.Equal("abcdef", readBody(resp))
+
+	resp = handle("bytes=100-", http.StatusOK, false)
+	assert.Equal(http.StatusRequestedRangeNotSatisfiable, resp.StatusCode())
+	assert.Equal("bytes */36", resp.HTTPHeader().Get("Content-Range"))
+
+	// multiple ranges are not synthesized.
+	resp = handle("bytes=0-1,5-6", http.StatusOK, false)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.Equal(content, readBody(resp))
+
+	// synthesized from a stream.
+	resp = handle("bytes=-6", http.StatusOK, true)
+	assert.Equal(http.StatusPartialContent, resp.StatusCode())
+	assert.False(resp.IsStream())
+	assert.Equal("bytes 30-35/36", resp.HTTPHeader().Get("Content-Range"))
+	assert.Equal("uvwxyz", readBody(resp))
+
+	// the range is larger than the buffer.
+	resp = handle("bytes=0-19", http.StatusOK, true)
+	assert.Equal(http.StatusOK, resp.StatusCode())
+	assert.True(resp.IsStream())
+	assert.Equal(content, readBody(resp))
+
+	rs := sp.rangeStatus()
+	assert.Equal(int64(7), rs.NumOfRequests)
+	assert.Equal(int64(1), rs.NumOfPartial)
+	assert.Equal(int64(3), rs.NumOfSynthesized)
+	assert.Equal(int64(3), rs.NumOfPassThrough)
+}
@@ -0,0 +1,338 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// DefaultFailoverThreshold is the default healthy ratio of a region
+	// below which traffic fails over to the next region.
+	DefaultFailoverThreshold = 0.5
+	// DefaultFailbackThreshold is the default healthy ratio of a region
+	// at or above which traffic fails back to the region.
+	DefaultFailbackThreshold = 1.0
+	// DefaultFailbackDelay is the default duration a region must stay
+	// recovered before traffic fails back to it.
+	DefaultFailbackDelay = 30 * time.Second
+
+	regionEvalInterval = time.Second
+	maxFailoverEvents  = 16
+)
+
+type (
+	// RegionFailoverSpec is the spec of the region failover load balancer.
+	RegionFailoverSpec struct {
+		Regions           []*RegionSpec `json:"regions" jsonschema:"required,minItems=1"`
+		FailoverThreshold float64       `json:"failoverThreshold" jsonschema:"omitempty,minimum=0,maximum=1"`
+		FailbackThreshold float64       `json:"failbackThreshold" jsonschema:"omitempty,minimum=0,maximum=1"`
+		FailbackDelay     string        `json:"failbackDelay" jsonschema:"omitempty,format=duration"`
+	}
+
+	// RegionSpec is the spec of a region, servers with a tag equal to the
+	// name of the region belong to the region.
+	RegionSpec struct {
+		Name     string `json:"name" jsonschema:"required"`
+		Priority int    `json:"priority" jsonschema:"omitempty"`
+	}
+
+	// RegionFailoverStatus is the status of the region failover load
+	// balancer.
+	RegionFailoverStatus struct {
+		ActiveRegion string           `json:"activeRegion"`
+		Events       []*FailoverEvent `json:"events"`
+	}
+
+	// FailoverEvent records a switch of the active region.
+	FailoverEvent struct {
+		Time   time.Time `json:"time"`
+		From   string    `json:"from"`
+		To     string    `json:"to"`
+		Reason string    `json:"reason"`
+	}
+
+	region struct {
+		name    string
+		servers []*Server
+		// recoveredAt is the time the region becomes recovered, that is,
+		// its healthy ratio reaches the failback threshold, it is zero if
+		// the region is not recovered.
+		recoveredAt time.Time
+	}
+
+	// activeRegion is the active region and its healthy servers.
+	activeRegion struct {
+		region      *region
+		servers     []*Server
+		totalWeight int
+	}
+
+	// regionFailoverLoadBalancer sends traffic to the servers of the
+	// region with the highest priority while it is healthy, fails over
+	// to the next region when the healthy ratio of the active region
+	// drops below the failover threshold, and fails back when a region
+	// with higher priority has recovered for the failback delay.
+	regionFailoverLoadBalancer struct {
+		BaseLoadBalancer
+		failoverThreshold float64
+		failbackThreshold float64
+		failbackDelay     time.Duration
+
+		// regions are sorted by priority.
+		regions  []*region
+		active   atomic.Value
+		counter  uint64
+		nextEval int64
+
+		lock   sync.Mutex
+		events []*FailoverEvent
+	}
+)
+
+// Validate validates RegionFailoverSpec.
+func (s *RegionFailoverSpec) Validate() error {
+	if len(s.Regions) == 0 {
+		return fmt.Errorf("regions must not be empty")
+	}
+	names := map[string]struct{}{}
+	for _, r := range s.Regions {
+		if r.Name == "" {
+			return fmt.Errorf("region name must not be empty")
+		}
+		if _, ok := names[r.Name]; ok {
+			return fmt.Errorf("duplicated region %s", r.Name)
+		}
+		names[r.Name] = struct{}{}
+	}
+
+	if s.FailoverThreshold < 0 || s.FailoverThreshold > 1 {
+		return fmt.Errorf("failoverThreshold must be in [0, 1]")
+	}
+	if s.FailbackThreshold < 0 || s.FailbackThreshold > 1 {
+		return fmt.Errorf("failbackThreshold must be in [0, 1]")
+	}
+	failover, failback := s.FailoverThreshold, s.FailbackThreshold
+	if failover == 0 {
+		failover = DefaultFailoverThreshold
+	}
+	if failback == 0 {
+		failback = DefaultFailbackThreshold
+	}
+	if failback < failover {
+		return fmt.Errorf("failbackThreshold must not be less than failoverThreshold")
+	}
+
+	if s.FailbackDelay != "" {
+		if d, err := time.ParseDuration(s.FailbackDelay); err != nil || d < 0 {
+			return fmt.Errorf("invalid failbackDelay %q", s.FailbackDelay)
+		}
+	}
+	return nil
+}
+
+func newRegionFailoverLoadBalancer(spec *LoadBalanceSpec, servers []*Server) *regionFailoverLoadBalancer {
+	lb := &regionFailoverLoadBalancer{}
+	lb.init(spec, servers)
+
+	rfs := spec.RegionFailover
+	if rfs == nil {
+		rfs = &RegionFailoverSpec{}
+	}
+	lb.failoverThreshold = rfs.FailoverThreshold
+	if lb.failoverThreshold == 0 {
+		lb.failoverThreshold = DefaultFailoverThreshold
+	}
+	lb.failbackThreshold = rfs.FailbackThreshold
+	if lb.failbackThreshold == 0 {
+		lb.failbackThreshold = DefaultFailbackThreshold
+	}
+	lb.failbackDelay = DefaultFailbackDelay
+	if rfs.FailbackDelay != "" {
+		lb.failbackDelay, _ = time.ParseDuration(rfs.FailbackDelay)
+	}
+
+	specs := make([]*RegionSpec, len(rfs.Regions))
+	copy(specs, rfs.Regions)
+	sort.SliceStable(specs, func(i, j int) bool {
+		return specs[i].Priority < specs[j].Priority
+	})
+	for _, rs := range specs {
+		r := &region{name: rs.Name}
+		for _, s := range servers {
+			if stringtool.StrInSlice(rs.Name, s.Tags) {
+				r.servers = append(r.servers, s)
+			}
+		}
+		lb.regions = append(lb.regions, r)
+	}
+
+	if len(lb.regions) > 0 {
+		lb.setActive(lb.regions[0])
+	}
+	return lb
+}
+
+// regionHealthyServers returns the healthy servers of the region.
+func (lb *regionFailoverLoadBalancer) regionHealthyServers(r *region) []*Server {
+	healthy := make([]*Server, 0, len(r.servers))
+	for _, s := range lb.HealthyServers() {
+		if stringtool.StrInSlice(r.name, s.Tags) {
+			healthy = append(healthy, s)
+		}
+	}
+	return healthy
+}
+
+func (lb *regionFailoverLoadBalancer) healthyRatio(r *region) float64 {
+	if len(r.servers) == 0 {
+		return 0
+	}
+	return float64(len(lb.regionHealthyServers(r))) / float64(len(r.servers))
+}
+
+func (lb *regionFailoverLoadBalancer) getActive() *activeRegion {
+	if v := lb.active.Load(); v != nil {
+		return v.(*activeRegion)
+	}
+	return nil
+}
+
+func (lb *regionFailoverLoadBalancer) setActive(r *region) {
+	ar := &activeRegion{region: r, servers: lb.regionHealthyServers(r)}
+	for _, s := range ar.servers {
+		ar.totalWeight += s.Weight
+	}
+	lb.active.Store(ar)
+}
+
+// evaluate re-evaluates the active region, it is called at most once per
+// regionEvalInterval.
+func (lb *regionFailoverLoadBalancer) evaluate(now time.Time) {
+	next := atomic.LoadInt64(&lb.nextEval)
+	if now.UnixNano() < next || !atomic.CompareAndSwapInt64(&lb.nextEval, next, now.Add(regionEvalInterval).UnixNano()) {
+		return
+	}
+
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	current := lb.getActive().region
+	for _, r := range lb.regions {
+		if lb.healthyRatio(r) >= lb.failbackThreshold {
+			if r.recoveredAt.IsZero() {
+				r.recoveredAt = now
+			}
+		} else {
+			r.recoveredAt = time.Time{}
+		}
+	}
+
+	// fail back to a region with higher priority which has recovered for
+	// the failback delay.
+	for _, r := range lb.regions {
+		if r == current {
+			break
+		}
+		if !r.recoveredAt.IsZero() && now.Sub(r.recoveredAt) >= lb.failbackDelay {
+			lb.switchTo(current, r, "failback", now)
+			return
+		}
+	}
+
+	if lb.healthyRatio(current) >= lb.failoverThreshold {
+		// refresh the healthy servers of the active region.
+		lb.setActive(current)
+		return
+	}
+
+	// fail over to the region with the highest priority whose healthy
+	// ratio is not below the failover threshold.
+	for _, r := range lb.regions {
+		if r != current && lb.healthyRatio(r) >= lb.failoverThreshold {
+			lb.switchTo(current, r, "failover", now)
+			return
+		}
+	}
+
+	// no region is healthy enough, stay in the current region.
+	lb.setActive(current)
+}
+
+// switchTo switches the active region, the caller must hold the lock.
+func (lb *regionFailoverLoadBalancer) switchTo(from, to *region, reason string, now time.Time) {
+	logger.Warnf("region %s: %s from region %s", to.name, reason, from.name)
+	lb.setActive(to)
+
+	lb.events = append(lb.events, &FailoverEvent{
+		Time:   now,
+		From:   from.name,
+		To:     to.name,
+		Reason: reason,
+	})
+	if len(lb.events) > maxFailoverEvents {
+		lb.events = lb.events[len(lb.events)-maxFailoverEvents:]
+	}
+}
+
+// ChooseServer implements the LoadBalancer interface.
+func (lb *regionFailoverLoadBalancer) ChooseServer(req *httpprot.Request) *Server {
+	if len(lb.regions) == 0 {
+		return nil
+	}
+
+	lb.evaluate(fasttime.Now())
+	ar := lb.getActive()
+	if len(ar.servers) == 0 {
+		return nil
+	}
+
+	if ar.totalWeight > 0 {
+		w := rand.Intn(ar.totalWeight)
+		for _, s := range ar.servers {
+			if w -= s.Weight; w < 0 {
+				return s
+			}
+		}
+	}
+
+	counter := atomic.AddUint64(&lb.counter, 1) - 1
+	return ar.servers[int(counter%uint64(len(ar.servers)))]
+}
+
+func (lb *regionFailoverLoadBalancer) status() *RegionFailoverStatus {
+	lb.lock.Lock()
+	defer lb.lock.Unlock()
+
+	s := &RegionFailoverStatus{Events: make([]*FailoverEvent, len(lb.events))}
+	copy(s.Events, lb.events)
+	if ar := lb.getActive(); ar != nil {
+		s.ActiveRegion = ar.region.name
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegionFailoverLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+
+	var servers []*Server
+	for i := 0; i < 4; i++ {
+		servers = append(servers, &Server{URL: fmt.Sprintf("http://primary-%d", i), Tags: []string{"primary"}})
+	}
+	for i := 0; i < 2; i++ {
+		servers = append(servers, &Server{URL: fmt.Sprintf("http://secondary-%d", i), Tags: []string{"secondary"}})
+	}
+
+	spec := &LoadBalanceSpec{
+		Policy: LoadBalancePolicyRegionFailover,
+		RegionFailover: &RegionFailoverSpec{
+			Regions: []*RegionSpec{
+				{Name: "secondary", Priority: 2},
+				{Name: "primary", Priority: 1},
+			},
+			FailbackDelay: "1m",
+		},
+	}
+	lb := NewLoadBalancer(spec, servers).(*regionFailoverLoadBalancer)
+	defer lb.Close()
+
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	for i := 0; i < 10; i++ {
+		assert.Contains(lb.ChooseServer(req).Tags, "primary")
+	}
+
+	now := time.Now().Add(time.Minute)
+	step := func(d time.Duration) {
+		now = now.Add(d)
+		lb.evaluate(now)
+	}
+
+	// half of the primary servers are healthy, which is not below the
+	// failover threshold.
+	lb.healthyServers.Store(servers[2:])
+	step(2 * time.Second)
+	assert.Equal("primary", lb.status().ActiveRegion)
+	for i := 0; i < 10; i++ {
+		svr := lb.ChooseServer(req)
+		assert.True(svr == servers[2] || svr == servers[3])
+	}
+
+	// fail over to the secondary region
+	lb.healthyServers.Store(servers[3:])
+	step(2 * time.Second)
+	assert.Equal("secondary", lb.status().ActiveRegion)
+	for i := 0; i < 10; i++ {
+		assert.Contains(lb.ChooseServer(req).Tags, "secondary")
+	}
+
+	// the primary region recovers partially, no failback
+	lb.healthyServers.Store(servers[1:])
+	step(2 * time.Minute)
+	assert.Equal("secondary", lb.status().ActiveRegion)
+
+	// the primary region recovers, but fails back after the delay only
+	lb.healthyServers.Store(servers)
+	step(2 * time.Second)
+	assert.Equal("secondary", lb.status().ActiveRegion)
+	step(30 * time.Second)
+	assert.Equal("secondary", lb.status().ActiveRegion)
+	step(31 * time.Second)
+	assert.Equal("primary", lb.status().ActiveRegion)
+
+	// evaluation is throttled
+	lb.healthyServers.Store(servers[4:])
+	lb.evaluate(now.Add(time.Millisecond))
+	assert.Equal("primary", lb.status().ActiveRegion)
+
+	events := lb.status().Events
+	assert.Len(events, 2)
+	assert.Equal("failover", events[0].Reason)
+	assert.Equal("primary", events[0].From)
+	assert.Equal("secondary", events[0].To)
+	assert.Equal("failback", events[1].Reason)
+
+	// no region is healthy enough, stay in the current region
+	lb.healthyServers.Store([]*Server{})
+	step(2 * time.Second)
+	assert.Equal("primary", lb.status().ActiveRegion)
+	assert.Nil(lb.ChooseServer(req))
+}
+
+func TestRegionFailoverSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &RegionFailoverSpec{}
+	assert.Error(spec.Validate())
+
+	spec.Regions = []*RegionSpec{{Name: "a"}, {Name: "a"}}
+	assert.Error(spec.Validate())
+
+	spec.Regions = []*RegionSpec{{Name: "a"}, {Name: "b"}}
+	assert.NoError(spec.Validate())
+
+	spec.FailoverThreshold = 0.8
+	spec.FailbackThreshold = 0.6
+	assert.Error(spec.Validate())
+
+	spec.FailbackThreshold = 0.9
+	spec.FailbackDelay = "abc"
+	assert.Error(spec.Validate())
+
+	sps := &BaseServerPoolSpec{
+		Servers:     []*Server{{URL: "http://127.0.0.1"}},
+		LoadBalance: &LoadBalanceSpec{Policy: LoadBalancePolicyRegionFailover},
+	}
+	assert.Error(sps.Validate())
+}
@@ -36,12 +36,14 @@ type RequestMatcher interface {
 
 // RequestMatcherSpec describe RequestMatcher
 type RequestMatcherSpec struct {
-	Policy          string                    `json:"policy" jsonschema:"omitempty,enum=,enum=general,enum=ipHash,enum=headerHash,enum=random"`
+	Policy          string                    `json:"policy" jsonschema:"omitempty,enum=,enum=general,enum=ipHash,enum=headerHash,enum=random,enum=serverName"`
 	MatchAllHeaders bool                      `json:"matchAllHeaders" jsonschema:"omitempty"`
 	Headers         map[string]*StringMatcher `json:"headers" jsonschema:"omitempty"`
 	URLs            []*MethodAndURLMatcher    `json:"urls" jsonschema:"omitempty"`
 	Permil          uint32                    `json:"permil" jsonschema:"omitempty,minimum=0,maximum=1000"`
 	HeaderHashKey   string                    `json:"headerHashKey" jsonschema:"omitempty"`
+	ServerNames     []string                  `json:"serverNames" jsonschema:"omitempty,uniqueItems=true"`
+	Expansion       *CohortExpansionSpec      `json:"expansion,omitempty" jsonschema:"omitempty"`
 }
 
 // Validate validtes the RequestMatcherSpec.
@@ -50,10 +52,23 @@ func (s *RequestMatcherSpec) Validate() error {
 		if len(s.Headers) == 0 {
 			return fmt.Errorf("headers is not specified")
 		}
-	} else if s.Permil == 0 {
+	} else if s.Policy == "serverName" {
+		if err := validateServerNames(s.ServerNames); err != nil {
+			return err
+		}
+	} else if s.Permil == 0 && s.Expansion == nil {
 		return fmt.Errorf("permil is not specified")
 	}
 
+	if s.Expansion != nil {
+		if s.Policy != "ipHash" && s.Policy != "headerHash" {
+			return fmt.Errorf("expansion is only supported by policy ipHash and headerHash")
+		}
+		if err := s.Expansion.Validate(s.Permil); err != nil {
+			return fmt.Errorf("expansion: %v", err)
+		}
+	}
+
 	for _, v := range s.Headers {
 		if err := v.Validate(); err != nil {
 			return err
@@ -85,14 +100,26 @@ func NewRequestMatcher(spec *RequestMatcherSpec) RequestMatcher {
 		matcher.init()
 		return matcher
 	case "ipHash":
+		if spec.Expansion != nil {
+			return newCohortMatcher(spec, func(req *httpprot.Request) string {
+				return req.RealIP()
+			})
+		}
 		return &ipHashMatcher{permill: spec.Permil}
 	case "headerHash":
+		if spec.Expansion != nil {
+			return newCohortMatcher(spec, func(req *httpprot.Request) string {
+				return req.HTTPHeader().Get(spec.HeaderHashKey)
+			})
+		}
 		return &headerHashMatcher{
 			permill:       spec.Permil,
 			headerHashKey: spec.HeaderHashKey,
 		}
 	case "random":
 		return &randomMatcher{permill: spec.Permil}
+	case "serverName":
+		return newServerNameMatcher(spec.ServerNames)
 	}
 
 	logger.Errorf("BUG: unsupported probability policy: %s", spec.Policy)
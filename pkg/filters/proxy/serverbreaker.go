@@ -0,0 +1,255 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	defaultServerBreakerFailures = 5
+	defaultServerBreakerCooldown = 30 * time.Second
+
+	serverBreakerClosed   = "closed"
+	serverBreakerOpen     = "open"
+	serverBreakerHalfOpen = "halfOpen"
+)
+
+type (
+	// ServerCircuitBreakerSpec is the spec of the circuit breakers of the
+	// servers of a pool. Unlike the circuitBreakerPolicy, which breaks the
+	// whole pool, the state is kept for each server, so that requests are
+	// routed to other servers when the circuit of a server is open.
+	ServerCircuitBreakerSpec struct {
+		// ConsecutiveFailures is the number of consecutive failures to
+		// open the circuit of a server.
+		ConsecutiveFailures int `json:"consecutiveFailures" jsonschema:"omitempty,minimum=1"`
+		// Cooldown is the duration the circuit keeps open before a probe
+		// request is allowed.
+		Cooldown string `json:"cooldown" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ServerCircuitBreakerStatus is the status of the circuit breakers of
+	// the servers of a pool.
+	ServerCircuitBreakerStatus struct {
+		Servers             []*ServerCircuitStatus `json:"servers,omitempty"`
+		NumOfOpened         int64                  `json:"numOfOpened"`
+		NumOfRerouted       int64                  `json:"numOfRerouted"`
+		NumOfShortCircuited int64                  `json:"numOfShortCircuited"`
+	}
+
+	// ServerCircuitStatus is the circuit status of a server, only servers
+	// whose circuit is not closed are reported.
+	ServerCircuitStatus struct {
+		URL      string `json:"url"`
+		State    string `json:"state"`
+		OpenedAt string `json:"openedAt"`
+	}
+
+	// serverBreaker keeps the circuits of servers by server ID, so that
+	// the state survives the update of servers from service registries.
+	serverBreaker struct {
+		failures int
+		cooldown time.Duration
+
+		lock     sync.Mutex
+		circuits map[string]*serverCircuit
+
+		numOfOpened         int64
+		numOfRerouted       int64
+		numOfShortCircuited int64
+	}
+
+	serverCircuit struct {
+		url      string
+		failures int
+		openedAt time.Time
+		probing  bool
+	}
+)
+
+// Validate validates the ServerCircuitBreakerSpec.
+func (s *ServerCircuitBreakerSpec) Validate() error {
+	if s.Cooldown != "" {
+		if d, err := time.ParseDuration(s.Cooldown); err != nil || d <= 0 {
+			return fmt.Errorf("invalid cooldown %q", s.Cooldown)
+		}
+	}
+	return nil
+}
+
+func newServerBreaker(spec *ServerCircuitBreakerSpec) *serverBreaker {
+	sb := &serverBreaker{
+		failures: spec.ConsecutiveFailures,
+		circuits: map[string]*serverCircuit{},
+	}
+	if sb.failures <= 0 {
+		sb.failures = defaultServerBreakerFailures
+	}
+	sb.cooldown, _ = time.ParseDuration(spec.Cooldown)
+	if sb.cooldown <= 0 {
+		sb.cooldown = defaultServerBreakerCooldown
+	}
+	return sb
+}
+
+// state returns the state of the circuit at now, the caller must hold
+// the lock.
+func (c *serverCircuit) state(now time.Time, cooldown time.Duration) string {
+	switch {
+	case c.openedAt.IsZero():
+		return serverBreakerClosed
+	case now.Sub(c.openedAt) < cooldown:
+		return serverBreakerOpen
+	default:
+		return serverBreakerHalfOpen
+	}
+}
+
+// allow reports whether a request could be sent to the server. Only one
+// probe request is allowed at a time when the circuit is half open.
+func (sb *serverBreaker) allow(svr *Server, now time.Time) bool {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	c := sb.circuits[svr.ID()]
+	if c == nil {
+		return true
+	}
+	switch c.state(now, sb.cooldown) {
+	case serverBreakerClosed:
+		return true
+	case serverBreakerHalfOpen:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+		return true
+	}
+	return false
+}
+
+// choose returns svr if its circuit allows the request, or another
+// healthy server whose circuit allows it. It returns nil if the circuits
+// of all the servers are open.
+func (sb *serverBreaker) choose(lb LoadBalancer, svr *Server) *Server {
+	now := fasttime.Now()
+	if sb.allow(svr, now) {
+		return svr
+	}
+
+	servers := lb.HealthyServers()
+	if n := len(servers); n > 0 {
+		offset := rand.Intn(n)
+		for i := 0; i < n; i++ {
+			s := servers[(offset+i)%n]
+			if s != svr && sb.allow(s, now) {
+				atomic.AddInt64(&sb.numOfRerouted, 1)
+				return s
+			}
+		}
+	}
+
+	atomic.AddInt64(&sb.numOfShortCircuited, 1)
+	return nil
+}
+
+// isNeutralError reports whether err is caused by the client or Easegress
+// itself, which says nothing about the health of the server.
+func isNeutralError(err error) bool {
+	if spe, ok := err.(serverPoolError); ok {
+		switch spe.result {
+		case resultClientError, resultInternalError, resultShortCircuited:
+			return true
+		}
+	}
+	return false
+}
+
+// record records the result of a request sent to the server. Errors
+// caused by the client or Easegress itself are neutral, they only finish
+// the probe.
+func (sb *serverBreaker) record(svr *Server, err error) {
+	success, neutral := err == nil, isNeutralError(err)
+
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	id := svr.ID()
+	c := sb.circuits[id]
+	if c == nil {
+		if success || neutral {
+			return
+		}
+		c = &serverCircuit{url: svr.URL}
+		sb.circuits[id] = c
+	}
+
+	wasProbing := c.probing
+	c.probing = false
+	switch {
+	case neutral:
+	case success:
+		// the circuit is closed, remove it to keep the map small.
+		delete(sb.circuits, id)
+	case wasProbing:
+		// the probe failed, open the circuit again.
+		c.openedAt = fasttime.Now()
+		atomic.AddInt64(&sb.numOfOpened, 1)
+	case c.openedAt.IsZero():
+		if c.failures++; c.failures >= sb.failures {
+			c.openedAt = fasttime.Now()
+			atomic.AddInt64(&sb.numOfOpened, 1)
+		}
+	}
+}
+
+func (sb *serverBreaker) status() *ServerCircuitBreakerStatus {
+	s := &ServerCircuitBreakerStatus{
+		NumOfOpened:         atomic.LoadInt64(&sb.numOfOpened),
+		NumOfRerouted:       atomic.LoadInt64(&sb.numOfRerouted),
+		NumOfShortCircuited: atomic.LoadInt64(&sb.numOfShortCircuited),
+	}
+
+	now := fasttime.Now()
+	sb.lock.Lock()
+	for _, c := range sb.circuits {
+		state := c.state(now, sb.cooldown)
+		if state == serverBreakerClosed {
+			continue
+		}
+		s.Servers = append(s.Servers, &ServerCircuitStatus{
+			URL:      c.url,
+			State:    state,
+			OpenedAt: c.openedAt.Format(time.RFC3339),
+		})
+	}
+	sb.lock.Unlock()
+
+	sort.Slice(s.Servers, func(i, j int) bool {
+		return s.Servers[i].URL < s.Servers[j].URL
+	})
+	return s
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  - url: http://127.0.0.1:9096
+  loadBalance:
+    policy: roundRobin
+  serverCircuitBreaker:
+    consecutiveFailures: 2
+    cooldown: 50ms
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+	defer proxy.Close()
+
+	healthy := map[string]bool{"127.0.0.1:9095": false, "127.0.0.1:9096": true}
+	sent := map[string]int{}
+
+	proxy.sendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		sent[r.URL.Host]++
+		code := http.StatusOK
+		if !healthy[r.URL.Host] {
+			code = http.StatusServiceUnavailable
+		}
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	handle := func() (string, int) {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://www.megaease.com/", nil)
+		ctx := getCtx(stdr)
+		result := proxy.Handle(ctx)
+		return result, ctx.GetOutputResponse().(*httpprot.Response).StatusCode()
+	}
+
+	// the circuit of 9095 opens after 2 consecutive failures, and then
+	// all requests are routed to 9096.
+	for i := 0; i < 10; i++ {
+		handle()
+	}
+	assert.Equal(2, sent["127.0.0.1:9095"])
+	assert.Equal(8, sent["127.0.0.1:9096"])
+
+	status := proxy.mainPool.status().ServerBreaker
+	assert.Equal(int64(1), status.NumOfOpened)
+	assert.Equal(int64(3), status.NumOfRerouted)
+	assert.Len(status.Servers, 1)
+	assert.Equal("http://127.0.0.1:9095", status.Servers[0].URL)
+	assert.Equal(serverBreakerOpen, status.Servers[0].State)
+
+	// all requests are short circuited when all circuits are open.
+	healthy["127.0.0.1:9096"] = false
+	handle()
+	handle()
+	result, code := handle()
+	assert.Equal(resultShortCircuited, result)
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(int64(1), proxy.mainPool.status().ServerBreaker.NumOfShortCircuited)
+
+	// a probe is allowed after the cooldown, the circuit is closed if
+	// the probe succeeds, and is opened again if it fails.
+	time.Sleep(60 * time.Millisecond)
+	healthy["127.0.0.1:9095"] = true
+	sent = map[string]int{}
+	failures := 0
+	for i := 0; i < 4; i++ {
+		if result, _ = handle(); result != "" {
+			failures++
+		}
+	}
+	assert.Equal(1, failures)
+	assert.Equal(3, sent["127.0.0.1:9095"])
+	assert.Equal(1, sent["127.0.0.1:9096"])
+
+	status = proxy.mainPool.status().ServerBreaker
+	assert.Len(status.Servers, 1)
+	assert.Equal("http://127.0.0.1:9096", status.Servers[0].URL)
+	assert.Equal(serverBreakerOpen, status.Servers[0].State)
+}
+
+func TestServerCircuitBreakerSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &ServerCircuitBreakerSpec{}
+	assert.NoError(spec.Validate())
+
+	spec.Cooldown = "0s"
+	assert.Error(spec.Validate())
+
+	spec.Cooldown = "10s"
+	assert.NoError(spec.Validate())
+
+	sb := newServerBreaker(&ServerCircuitBreakerSpec{})
+	assert.Equal(defaultServerBreakerFailures, sb.failures)
+	assert.Equal(defaultServerBreakerCooldown, sb.cooldown)
+}
@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// maxServerNameStats is the max number of server names counted in
+	// the status, to bound the memory usage.
+	maxServerNameStats = 1024
+
+	serverNameNone  = "none"
+	serverNameOther = "other"
+)
+
+// serverName returns the server name sent by the client in the TLS
+// handshake (SNI), it is empty if the request is not from a TLS
+// connection, or the client doesn't send SNI.
+func serverName(req *httpprot.Request) string {
+	if cs := req.Std().TLS; cs != nil {
+		return strings.ToLower(cs.ServerName)
+	}
+	return ""
+}
+
+func validateServerNames(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("serverNames is not specified")
+	}
+	for _, name := range names {
+		if name == "" || strings.Contains(name[1:], "*") || (name[0] == '*' && !strings.HasPrefix(name, "*.")) {
+			return fmt.Errorf("invalid server name %q", name)
+		}
+	}
+	return nil
+}
+
+// serverNameMatcher matches requests by the SNI, both exact names and
+// wildcard names like *.example.com are supported, a wildcard matches
+// exactly one label.
+type serverNameMatcher struct {
+	exact       map[string]struct{}
+	wildcards   map[string]struct{}
+	defaultName string
+}
+
+func newServerNameMatcher(names []string) *serverNameMatcher {
+	m := &serverNameMatcher{
+		exact:     map[string]struct{}{},
+		wildcards: map[string]struct{}{},
+	}
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "*.") {
+			m.wildcards[name[1:]] = struct{}{}
+		} else {
+			m.exact[name] = struct{}{}
+		}
+	}
+	return m
+}
+
+// Match implements RequestMatcher.
+func (m *serverNameMatcher) Match(req *httpprot.Request) bool {
+	name := serverName(req)
+	if name == "" {
+		name = m.defaultName
+	}
+	if name == "" {
+		return false
+	}
+
+	if _, ok := m.exact[name]; ok {
+		return true
+	}
+
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		_, ok := m.wildcards[name[i:]]
+		return ok
+	}
+	return false
+}
+
+// serverNameStat counts requests by server name.
+type serverNameStat struct {
+	lock   sync.Mutex
+	counts map[string]int64
+}
+
+func newServerNameStat() *serverNameStat {
+	return &serverNameStat{counts: map[string]int64{}}
+}
+
+func (s *serverNameStat) count(name string) {
+	if name == "" {
+		name = serverNameNone
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.counts[name]; !ok && len(s.counts) >= maxServerNameStats {
+		name = serverNameOther
+	}
+	s.counts[name]++
+}
+
+func (s *serverNameStat) status() map[string]int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	counts := make(map[string]int64, len(s.counts))
+	for k, v := range s.counts {
+		counts[k] = v
+	}
+	return counts
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSNIRequest(name string, isTLS bool) *httpprot.Request {
+	stdr, _ := http.NewRequest(http.MethodGet, "https://127.0.0.1/", nil)
+	if isTLS {
+		stdr.TLS = &tls.ConnectionState{ServerName: name}
+	}
+	req, _ := httpprot.NewRequest(stdr)
+	return req
+}
+
+func TestServerNameMatcher(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &RequestMatcherSpec{
+		Policy:      "serverName",
+		ServerNames: []string{"api.example.com", "*.tenant.example.com"},
+	}
+	assert.NoError(spec.Validate())
+
+	m := NewRequestMatcher(spec).(*serverNameMatcher)
+	assert.True(m.Match(newSNIRequest("api.example.com", true)))
+	assert.True(m.Match(newSNIRequest("API.Example.com", true)))
+	assert.True(m.Match(newSNIRequest("a.tenant.example.com", true)))
+	assert.False(m.Match(newSNIRequest("a.b.tenant.example.com", true)))
+	assert.False(m.Match(newSNIRequest("tenant.example.com", true)))
+	assert.False(m.Match(newSNIRequest("www.example.com", true)))
+	assert.False(m.Match(newSNIRequest("", true)))
+	assert.False(m.Match(newSNIRequest("", false)))
+
+	m.defaultName = "api.example.com"
+	assert.True(m.Match(newSNIRequest("", true)))
+	assert.True(m.Match(newSNIRequest("", false)))
+
+	for _, names := range [][]string{nil, {""}, {"a.*.com"}, {"*example.com"}, {"**.example.com"}} {
+		spec.ServerNames = names
+		assert.Error(spec.Validate(), names)
+	}
+}
+
+func TestServerNameStat(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newServerNameStat()
+	s.count("a.example.com")
+	s.count("a.example.com")
+	s.count("")
+	for i := 0; i < maxServerNameStats; i++ {
+		s.count(fmt.Sprintf("%d.example.com", i))
+	}
+
+	counts := s.status()
+	assert.Equal(maxServerNameStats+1, len(counts))
+	assert.Equal(int64(2), counts["a.example.com"])
+	assert.Equal(int64(1), counts[serverNameNone])
+	assert.Equal(int64(2), counts[serverNameOther])
+}
+
+func TestProxyServerName(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+defaultServerName: API.example.com
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+- filter:
+    policy: serverName
+    serverNames: ["api.example.com"]
+  servers:
+  - url: http://127.0.0.1:9096
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	defer proxy.Close()
+
+	m := proxy.candidatePools[0].filter.(*serverNameMatcher)
+	assert.Equal("api.example.com", m.defaultName)
+	assert.True(m.Match(newSNIRequest("", false)))
+	assert.NotNil(proxy.serverNameStat)
+	assert.NotNil(proxy.Status().(*Status).ServerNames)
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+var errShaperQueueFull = fmt.Errorf("shaper queue full")
+
+type (
+	// ShapingSpec describes the outbound rate shaping of a server pool,
+	// which smooths requests to the servers with a leaky bucket.
+	ShapingSpec struct {
+		Rate     float64 `json:"rate" jsonschema:"required"`
+		MaxQueue int     `json:"maxQueue" jsonschema:"omitempty"`
+		MaxWait  string  `json:"maxWait" jsonschema:"omitempty,format=duration"`
+	}
+
+	// ShapingStatus is the status of the outbound rate shaping.
+	ShapingStatus struct {
+		Rate          int64 `json:"rate"`
+		QueueDepth    int   `json:"queueDepth"`
+		NumOfSent     int64 `json:"numOfSent"`
+		NumOfQueued   int64 `json:"numOfQueued"`
+		NumOfRejected int64 `json:"numOfRejected"`
+	}
+
+	// shaper is a leaky bucket, requests leak out at a constant interval,
+	// and wait in a bounded queue if they arrive too fast.
+	shaper struct {
+		interval time.Duration
+		maxQueue int
+		maxWait  time.Duration
+
+		lock       sync.Mutex
+		next       time.Time
+		queueDepth int
+
+		// counters of the current and the last second to calculate
+		// the outbound rate.
+		second        int64
+		curCount      int64
+		lastCount     int64
+		numOfSent     int64
+		numOfQueued   int64
+		numOfRejected int64
+	}
+)
+
+// Validate validates ShapingSpec.
+func (s *ShapingSpec) Validate() error {
+	if s.Rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	if s.MaxQueue < 0 {
+		return fmt.Errorf("maxQueue must not be negative")
+	}
+	if s.MaxWait != "" {
+		if d, err := time.ParseDuration(s.MaxWait); err != nil || d <= 0 {
+			return fmt.Errorf("invalid maxWait %q", s.MaxWait)
+		}
+	}
+	return nil
+}
+
+func newShaper(spec *ShapingSpec) *shaper {
+	s := &shaper{
+		interval: time.Duration(float64(time.Second) / spec.Rate),
+		maxQueue: spec.MaxQueue,
+	}
+	s.maxWait, _ = time.ParseDuration(spec.MaxWait)
+	return s
+}
+
+// count counts a sent request, the caller must hold the lock.
+func (s *shaper) count(now time.Time) {
+	sec := now.Unix()
+	switch sec - s.second {
+	case 0:
+	case 1:
+		s.lastCount, s.curCount = s.curCount, 0
+	default:
+		s.lastCount, s.curCount = 0, 0
+	}
+	s.second = sec
+	s.curCount++
+	s.numOfSent++
+}
+
+// wait waits until the request could be sent to the servers. It fails
+// fast if the queue is full, or the request could not leave the queue
+// before the deadline of stdctx or maxWait.
+func (s *shaper) wait(stdctx stdcontext.Context) error {
+	s.lock.Lock()
+
+	now := fasttime.Now()
+	if s.next.Before(now) {
+		s.next = now
+	}
+	delay := s.next.Sub(now)
+
+	if delay > 0 {
+		reject := s.queueDepth >= s.maxQueue
+		if s.maxWait > 0 && delay > s.maxWait {
+			reject = true
+		}
+		if deadline, ok := stdctx.Deadline(); ok && now.Add(delay).After(deadline) {
+			reject = true
+		}
+		if reject {
+			s.numOfRejected++
+			s.lock.Unlock()
+			return errShaperQueueFull
+		}
+	}
+
+	s.next = s.next.Add(s.interval)
+	if delay == 0 {
+		s.count(now)
+		s.lock.Unlock()
+		return nil
+	}
+
+	s.queueDepth++
+	s.numOfQueued++
+	s.lock.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-timer.C:
+	case <-stdctx.Done():
+		err = stdctx.Err()
+	}
+
+	s.lock.Lock()
+	s.queueDepth--
+	if err == nil {
+		s.count(fasttime.Now())
+	} else {
+		// give back the slot reserved by the request, so that later
+		// requests are not delayed for it.
+		s.next = s.next.Add(-s.interval)
+	}
+	s.lock.Unlock()
+	return err
+}
+
+func (s *shaper) status() *ShapingStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// the count of the last full second is the current rate.
+	rate := int64(0)
+	switch fasttime.Now().Unix() - s.second {
+	case 0:
+		rate = s.lastCount
+	case 1:
+		rate = s.curCount
+	}
+
+	return &ShapingStatus{
+		Rate:          rate,
+		QueueDepth:    s.queueDepth,
+		NumOfSent:     s.numOfSent,
+		NumOfQueued:   s.numOfQueued,
+		NumOfRejected: s.numOfRejected,
+	}
+}
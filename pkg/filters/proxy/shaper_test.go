@@ -0,0 +1,106 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	stdcontext "context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShaper(t *testing.T) {
+	assert := assert.New(t)
+
+	s := newShaper(&ShapingSpec{Rate: 20, MaxQueue: 2})
+	assert.Equal(50*time.Millisecond, s.interval)
+
+	// the first request is sent at once, the next two are queued, and
+	// the last one is rejected as the queue is full.
+	start := time.Now()
+	assert.NoError(s.wait(stdcontext.Background()))
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(s.wait(stdcontext.Background()))
+		}()
+	}
+
+	assert.Eventually(func() bool {
+		return s.status().QueueDepth == 2
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(s.wait(stdcontext.Background()), errShaperQueueFull)
+
+	wg.Wait()
+	assert.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+
+	status := s.status()
+	assert.Equal(0, status.QueueDepth)
+	assert.Equal(int64(3), status.NumOfSent)
+	assert.Equal(int64(2), status.NumOfQueued)
+	assert.Equal(int64(1), status.NumOfRejected)
+
+	// the request is rejected if it can't be sent before the deadline.
+	s = newShaper(&ShapingSpec{Rate: 1, MaxQueue: 10})
+	assert.NoError(s.wait(stdcontext.Background()))
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(s.wait(ctx), errShaperQueueFull)
+
+	// and also if it would wait longer than maxWait.
+	s = newShaper(&ShapingSpec{Rate: 1, MaxQueue: 10, MaxWait: "100ms"})
+	assert.NoError(s.wait(stdcontext.Background()))
+	assert.ErrorIs(s.wait(stdcontext.Background()), errShaperQueueFull)
+
+	// the slot of a cancelled request is given back.
+	s = newShaper(&ShapingSpec{Rate: 10, MaxQueue: 10})
+	assert.NoError(s.wait(stdcontext.Background()))
+	s.lock.Lock()
+	next := s.next
+	s.lock.Unlock()
+
+	ctx, cancel = stdcontext.WithCancel(stdcontext.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.wait(ctx)
+	}()
+	assert.Eventually(func() bool {
+		return s.status().QueueDepth == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(<-done, stdcontext.Canceled)
+
+	s.lock.Lock()
+	assert.Equal(next, s.next)
+	s.lock.Unlock()
+	assert.Equal(int64(1), s.status().NumOfSent)
+}
+
+func TestShapingSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&ShapingSpec{}).Validate())
+	assert.Error((&ShapingSpec{Rate: 1, MaxQueue: -1}).Validate())
+	assert.Error((&ShapingSpec{Rate: 1, MaxWait: "abc"}).Validate())
+	assert.NoError((&ShapingSpec{Rate: 0.5, MaxQueue: 10, MaxWait: "1s"}).Validate())
+}
@@ -0,0 +1,87 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/logger"
+)
+
+// errSPKIPinMismatch is the error returned when none of the certificates
+// presented by the server matches the pinned SPKI hashes.
+var errSPKIPinMismatch = fmt.Errorf("SPKI pin mismatch")
+
+// spkiHash returns the base64 encoded SHA-256 hash of the subject public
+// key info of the certificate.
+func spkiHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func validateSPKIPins(pins []string) error {
+	for _, pin := range pins {
+		b, err := base64.StdEncoding.DecodeString(pin)
+		if err != nil || len(b) != sha256.Size {
+			return fmt.Errorf("invalid SPKI pin %q, must be a base64 encoded SHA-256 hash", pin)
+		}
+	}
+	return nil
+}
+
+// verifySPKIPins returns a function to be used as tls.Config.VerifyConnection,
+// it accepts a connection only if one of the certificates in the chain matches
+// one of the pins.
+//
+// As the chain may not be verified by the TLS stack (InsecureSkipVerify),
+// a certificate other than the leaf matches only if every certificate before
+// it is signed by the next one, so a server cannot pass the check by simply
+// appending a pinned certificate to the chain.
+func (p *Proxy) verifySPKIPins(pins []string) func(tls.ConnectionState) error {
+	expected := map[string]struct{}{}
+	for _, pin := range pins {
+		expected[pin] = struct{}{}
+	}
+
+	return func(cs tls.ConnectionState) error {
+		certs := cs.PeerCertificates
+		observed := make([]string, 0, len(certs))
+
+		for i, cert := range certs {
+			if i > 0 && certs[i-1].CheckSignatureFrom(cert) != nil {
+				break
+			}
+			hash := spkiHash(cert)
+			if _, ok := expected[hash]; ok {
+				return nil
+			}
+			observed = append(observed, hash)
+		}
+
+		atomic.AddInt64(&p.numOfPinFailures, 1)
+		logger.Errorf("%s: SPKI pin mismatch for %s, observed: [%s], expected: [%s]",
+			p.Name(), cs.ServerName, strings.Join(observed, ", "), strings.Join(pins, ", "))
+		return errSPKIPinMismatch
+	}
+}
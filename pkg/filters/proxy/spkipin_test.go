@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSPKIPins(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(validateSPKIPins(nil))
+	assert.NoError(validateSPKIPins([]string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}))
+	assert.Error(validateSPKIPins([]string{"not base64"}))
+	assert.Error(validateSPKIPins([]string{"YWJj"}))
+}
+
+func TestSPKIPins(t *testing.T) {
+	assert := assert.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pin := spkiHash(server.Certificate())
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: %s
+spkiPins: [%s]
+`
+	newProxy := func(pin string) *Proxy {
+		return newTestProxy(fmt.Sprintf(yamlConfig, server.URL, pin), assert)
+	}
+
+	p := newProxy(pin)
+	resp, err := p.client.Get(server.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(int64(0), p.Status().(*Status).NumOfPinFailures)
+	p.Close()
+
+	p = newProxy("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	_, err = p.client.Get(server.URL)
+	assert.True(errors.Is(err, errSPKIPinMismatch))
+	assert.Equal(int64(1), p.Status().(*Status).NumOfPinFailures)
+	p.Close()
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+type (
+	// TimeoutRuleSpec overrides the timeout of the pool for the requests
+	// matching the methods and the URL.
+	TimeoutRuleSpec struct {
+		MethodAndURLMatcher `json:",inline"`
+		Timeout             string `json:"timeout" jsonschema:"required,format=duration"`
+	}
+
+	// TimeoutStatus is the status of the timeouts of a pool.
+	TimeoutStatus struct {
+		Default       string               `json:"default"`
+		NumOfTimeouts int64                `json:"numOfTimeouts"`
+		Rules         []*TimeoutRuleStatus `json:"rules"`
+	}
+
+	// TimeoutRuleStatus is the status of a timeout rule.
+	TimeoutRuleStatus struct {
+		Methods       []string `json:"methods,omitempty"`
+		URL           string   `json:"url"`
+		Timeout       string   `json:"timeout"`
+		NumOfMatched  int64    `json:"numOfMatched"`
+		NumOfTimeouts int64    `json:"numOfTimeouts"`
+	}
+
+	timeoutRule struct {
+		spec          *TimeoutRuleSpec
+		timeout       time.Duration
+		numOfMatched  int64
+		numOfTimeouts int64
+	}
+
+	// timeouts chooses the timeout of the requests of a pool, the first
+	// matching rule wins, and the timeout of the pool is used if none of
+	// the rules matches.
+	timeouts struct {
+		timeout       time.Duration
+		rules         []*timeoutRule
+		numOfTimeouts int64
+	}
+)
+
+// Validate validates the TimeoutRuleSpec.
+func (s *TimeoutRuleSpec) Validate() error {
+	if s.URL == nil {
+		return fmt.Errorf("url is required")
+	}
+	if err := s.MethodAndURLMatcher.Validate(); err != nil {
+		return err
+	}
+	if d, err := time.ParseDuration(s.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("invalid timeout %q", s.Timeout)
+	}
+	return nil
+}
+
+func newTimeouts(timeout time.Duration, rules []*TimeoutRuleSpec) *timeouts {
+	t := &timeouts{timeout: timeout}
+	for _, spec := range rules {
+		spec.init()
+		d, _ := time.ParseDuration(spec.Timeout)
+		t.rules = append(t.rules, &timeoutRule{spec: spec, timeout: d})
+	}
+	return t
+}
+
+// choose returns the timeout of the request, and the rule matches the
+// request, which is nil if the default timeout is used.
+func (t *timeouts) choose(req *httpprot.Request) (time.Duration, *timeoutRule) {
+	for _, r := range t.rules {
+		if r.spec.Match(req) {
+			atomic.AddInt64(&r.numOfMatched, 1)
+			return r.timeout, r
+		}
+	}
+	return t.timeout, nil
+}
+
+func (t *timeouts) timedOut(r *timeoutRule) {
+	if r == nil {
+		atomic.AddInt64(&t.numOfTimeouts, 1)
+	} else {
+		atomic.AddInt64(&r.numOfTimeouts, 1)
+	}
+}
+
+func (t *timeouts) status() *TimeoutStatus {
+	s := &TimeoutStatus{NumOfTimeouts: atomic.LoadInt64(&t.numOfTimeouts)}
+	if t.timeout > 0 {
+		s.Default = t.timeout.String()
+	}
+	for _, r := range t.rules {
+		url := r.spec.URL.Exact
+		if url == "" {
+			url = r.spec.URL.Prefix
+		}
+		if url == "" {
+			url = r.spec.URL.RegEx
+		}
+		s.Rules = append(s.Rules, &TimeoutRuleStatus{
+			Methods:       r.spec.Methods,
+			URL:           url,
+			Timeout:       r.timeout.String(),
+			NumOfMatched:  atomic.LoadInt64(&r.numOfMatched),
+			NumOfTimeouts: atomic.LoadInt64(&r.numOfTimeouts),
+		})
+	}
+	return s
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/resilience"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeouts(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: proxy
+kind: Proxy
+pools:
+- servers:
+  - url: http://127.0.0.1:9095
+  timeout: 20ms
+  timeouts:
+  - url:
+      prefix: /batch/
+    timeout: 200ms
+  - methods: [POST]
+    url:
+      regex: ^/orders
+    timeout: 5ms
+`
+	proxy := newTestProxy(yamlConfig, assert)
+	proxy.InjectResiliencePolicy(make(map[string]resilience.Policy))
+	defer proxy.Close()
+
+	proxy.sendRequest = func(r *http.Request, client *http.Client) (*http.Response, error) {
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("this is the body")),
+		}, nil
+	}
+
+	handle := func(method, path string) (string, int, string) {
+		stdr, _ := http.NewRequest(method, "http://www.megaease.com"+path, nil)
+		ctx := getCtx(stdr)
+		result := proxy.Handle(ctx)
+		return result, ctx.GetOutputResponse().(*httpprot.Response).StatusCode(), ctx.Tags()
+	}
+
+	// the slow endpoint is allowed more time.
+	result, code, tags := handle(http.MethodGet, "/batch/jobs")
+	assert.Equal("", result)
+	assert.Equal(http.StatusOK, code)
+	assert.Contains(tags, "#timeout: 200ms")
+
+	// the default timeout of the pool.
+	result, code, tags = handle(http.MethodGet, "/orders")
+	assert.Equal(resultTimeout, result)
+	assert.Equal(http.StatusRequestTimeout, code)
+	assert.Contains(tags, "#timeout: 20ms")
+
+	result, code, tags = handle(http.MethodPost, "/orders")
+	assert.Equal(resultTimeout, result)
+	assert.Equal(http.StatusGatewayTimeout, code)
+	assert.Contains(tags, "#timeout: 5ms")
+
+	status := proxy.mainPool.status().Timeout
+	assert.Equal("20ms", status.Default)
+	assert.Equal(int64(1), status.NumOfTimeouts)
+	assert.Len(status.Rules, 2)
+	assert.Equal("/batch/", status.Rules[0].URL)
+	assert.Equal(int64(1), status.Rules[0].NumOfMatched)
+	assert.Equal(int64(0), status.Rules[0].NumOfTimeouts)
+	assert.Equal("^/orders", status.Rules[1].URL)
+	assert.Equal(int64(1), status.Rules[1].NumOfMatched)
+	assert.Equal(int64(1), status.Rules[1].NumOfTimeouts)
+}
+
+func TestTimeoutRuleSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &TimeoutRuleSpec{Timeout: "1s"}
+	assert.Error(spec.Validate())
+
+	spec.URL = &StringMatcher{}
+	assert.Error(spec.Validate())
+
+	spec.URL.Prefix = "/batch"
+	assert.NoError(spec.Validate())
+
+	spec.Timeout = "0s"
+	assert.Error(spec.Validate())
+}
@@ -137,7 +137,8 @@ func (sp *WebSocketServerPool) dialServer(svr *Server, req *httpprot.Request) (*
 
 func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 	req := ctx.GetInputRequest().(*httpprot.Request)
-	svr := sp.LoadBalancer().ChooseServer(req)
+	lb := sp.LoadBalancer()
+	svr := lb.ChooseServer(req)
 
 	metric := &httpstat.Metric{}
 	startTime := fasttime.Now()
@@ -154,6 +155,12 @@ func (sp *WebSocketServerPool) handle(ctx *context.Context) (result string) {
 		return resultInternalError
 	}
 
+	// a WebSocket connection is counted as a load of the server until it
+	// is closed.
+	if lt, ok := lb.(serverLoadTracker); ok {
+		defer lt.releaseServer(svr)
+	}
+
 	stdw, _ := ctx.GetData("HTTP_RESPONSE_WRITER").(http.ResponseWriter)
 	if stdw == nil {
 		logger.Errorf("%s: cannot get response writer from context", sp.name)
@@ -36,6 +36,7 @@ var kindWebSocketProxy = &filters.Kind{
 		resultInternalError,
 		resultClientError,
 	},
+	Effects: []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &WebSocketProxySpec{}
 	},
@@ -0,0 +1,323 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quarantine
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/fingerprint"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of Quarantine.
+	Kind = "Quarantine"
+
+	defaultWindow     = time.Minute
+	defaultCooldown   = 5 * time.Minute
+	defaultMaxEntries = 10000
+
+	resultQuarantined = "quarantined"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Quarantine fast-fails requests whose fingerprint failed repeatedly.",
+	Results:     []string{resultQuarantined},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			DataKey:    fingerprint.DefaultDataKey,
+			Window:     defaultWindow.String(),
+			Cooldown:   defaultCooldown.String(),
+			StatusCode: http.StatusServiceUnavailable,
+			MaxEntries: defaultMaxEntries,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Quarantine{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// Quarantine is filter Quarantine.
+	Quarantine struct {
+		spec         *Spec
+		window       time.Duration
+		cooldown     time.Duration
+		failureCodes map[int]struct{}
+
+		lock    sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+
+		numOfFastFailed int64
+	}
+
+	// Spec describes the Quarantine.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		DataKey      string `json:"dataKey" jsonschema:"omitempty"`
+		FailureCodes []int  `json:"failureCodes" jsonschema:"omitempty,uniqueItems=true"`
+		Threshold    int    `json:"threshold" jsonschema:"required,minimum=1"`
+		Window       string `json:"window" jsonschema:"omitempty,format=duration"`
+		Cooldown     string `json:"cooldown" jsonschema:"omitempty,format=duration"`
+		StatusCode   int    `json:"statusCode" jsonschema:"omitempty"`
+		MaxEntries   int    `json:"maxEntries" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Quarantine.
+	Status struct {
+		NumOfTracked     int   `json:"numOfTracked"`
+		NumOfQuarantined int   `json:"numOfQuarantined"`
+		NumOfFastFailed  int64 `json:"numOfFastFailed"`
+	}
+
+	// entry records the failures of a fingerprint.
+	entry struct {
+		fingerprint string
+		failures    int
+		windowStart time.Time
+		releaseAt   time.Time
+	}
+)
+
+var _ filters.Filter = (*Quarantine)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for name, v := range map[string]string{"window": spec.Window, "cooldown": spec.Cooldown} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+	}
+	if spec.StatusCode != 0 && (spec.StatusCode < 100 || spec.StatusCode > 599) {
+		return fmt.Errorf("invalid statusCode %d", spec.StatusCode)
+	}
+	if spec.MaxEntries < 0 {
+		return fmt.Errorf("maxEntries must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name of the Quarantine filter instance.
+func (q *Quarantine) Name() string {
+	return q.spec.Name()
+}
+
+// Kind returns the kind of Quarantine.
+func (q *Quarantine) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Quarantine
+func (q *Quarantine) Spec() filters.Spec {
+	return q.spec
+}
+
+// Init initializes Quarantine.
+func (q *Quarantine) Init() {
+	q.reload()
+}
+
+// Inherit inherits previous generation of Quarantine.
+func (q *Quarantine) Inherit(previousGeneration filters.Filter) {
+	q.reload()
+}
+
+func (q *Quarantine) reload() {
+	q.window, _ = time.ParseDuration(q.spec.Window)
+	if q.window <= 0 {
+		q.window = defaultWindow
+	}
+	q.cooldown, _ = time.ParseDuration(q.spec.Cooldown)
+	if q.cooldown <= 0 {
+		q.cooldown = defaultCooldown
+	}
+
+	q.failureCodes = make(map[int]struct{}, len(q.spec.FailureCodes))
+	for _, code := range q.spec.FailureCodes {
+		q.failureCodes[code] = struct{}{}
+	}
+
+	q.entries = make(map[string]*list.Element)
+	q.lru = list.New()
+}
+
+func (q *Quarantine) isFailure(code int) bool {
+	if len(q.failureCodes) == 0 {
+		return code >= 500
+	}
+	_, ok := q.failureCodes[code]
+	return ok
+}
+
+func (q *Quarantine) maxEntries() int {
+	if q.spec.MaxEntries == 0 {
+		return defaultMaxEntries
+	}
+	return q.spec.MaxEntries
+}
+
+// expired reports whether the entry could be removed, that is, it is
+// neither in quarantine nor has failures in the current window.
+func (q *Quarantine) expired(e *entry, now time.Time) bool {
+	return !now.Before(e.releaseAt) && now.Sub(e.windowStart) >= q.window
+}
+
+// isQuarantined reports whether the fingerprint is in quarantine.
+func (q *Quarantine) isQuarantined(fp string, now time.Time) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	elem := q.entries[fp]
+	if elem == nil {
+		return false
+	}
+	return now.Before(elem.Value.(*entry).releaseAt)
+}
+
+// recordFailure records a failure of the fingerprint, and puts it into
+// quarantine if the failures reach the threshold in the window.
+func (q *Quarantine) recordFailure(fp string, now time.Time) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var e *entry
+	if elem := q.entries[fp]; elem != nil {
+		e = elem.Value.(*entry)
+		q.lru.MoveToBack(elem)
+	} else {
+		q.evict(now)
+		e = &entry{fingerprint: fp, windowStart: now}
+		q.entries[fp] = q.lru.PushBack(e)
+	}
+
+	if now.Sub(e.windowStart) >= q.window {
+		e.windowStart = now
+		e.failures = 0
+	}
+	e.failures++
+
+	if e.failures >= q.spec.Threshold {
+		e.releaseAt = now.Add(q.cooldown)
+		e.failures = 0
+		e.windowStart = now
+	}
+}
+
+// evict makes room for a new entry, expired entries are removed first,
+// and then the least recently updated ones if the set is still full. The
+// caller must hold the lock.
+func (q *Quarantine) evict(now time.Time) {
+	if q.lru.Len() < q.maxEntries() {
+		return
+	}
+
+	for elem := q.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if e := elem.Value.(*entry); q.expired(e, now) {
+			q.lru.Remove(elem)
+			delete(q.entries, e.fingerprint)
+		}
+		elem = next
+	}
+
+	for q.lru.Len() >= q.maxEntries() {
+		elem := q.lru.Front()
+		q.lru.Remove(elem)
+		delete(q.entries, elem.Value.(*entry).fingerprint)
+	}
+}
+
+// Handle fast-fails the request if its fingerprint is in quarantine, and
+// records the failure of the request after it is finished.
+func (q *Quarantine) Handle(ctx *context.Context) string {
+	dataKey := q.spec.DataKey
+	if dataKey == "" {
+		dataKey = fingerprint.DefaultDataKey
+	}
+	fp, _ := ctx.GetData(dataKey).(string)
+	if fp == "" {
+		return ""
+	}
+
+	now := fasttime.Now()
+	if q.isQuarantined(fp, now) {
+		atomic.AddInt64(&q.numOfFastFailed, 1)
+
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		statusCode := q.spec.StatusCode
+		if statusCode == 0 {
+			statusCode = http.StatusServiceUnavailable
+		}
+		resp.SetStatusCode(statusCode)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("quarantine: fingerprint " + fp + " is in quarantine")
+		return resultQuarantined
+	}
+
+	ctx.OnFinish(func() {
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp != nil && q.isFailure(resp.StatusCode()) {
+			q.recordFailure(fp, fasttime.Now())
+		}
+	})
+
+	return ""
+}
+
+// Status returns status.
+func (q *Quarantine) Status() interface{} {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	now := fasttime.Now()
+	s := &Status{
+		NumOfTracked:    q.lru.Len(),
+		NumOfFastFailed: atomic.LoadInt64(&q.numOfFastFailed),
+	}
+	for elem := q.lru.Front(); elem != nil; elem = elem.Next() {
+		if now.Before(elem.Value.(*entry).releaseAt) {
+			s.NumOfQuarantined++
+		}
+	}
+	return s
+}
+
+// Close closes Quarantine.
+func (q *Quarantine) Close() {}
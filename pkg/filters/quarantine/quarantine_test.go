@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quarantine
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/fingerprint"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createQuarantine(t *testing.T, yamlConfig string) *Quarantine {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	q := kind.CreateInstance(spec).(*Quarantine)
+	q.Init()
+	return q
+}
+
+// handle handles a request with the fingerprint, and finishes it with the
+// status code if it is not fast-failed.
+func handle(t *testing.T, q *Quarantine, fp string, code int) string {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	ctx.SetData(fingerprint.DefaultDataKey, fp)
+
+	result := q.Handle(ctx)
+	if result == "" {
+		resp, _ := httpprot.NewResponse(nil)
+		resp.SetStatusCode(code)
+		ctx.SetOutputResponse(resp)
+	}
+	ctx.Finish()
+	return result
+}
+
+func TestQuarantine(t *testing.T) {
+	assert := assert.New(t)
+
+	q := createQuarantine(t, `
+name: quarantine
+kind: Quarantine
+threshold: 3
+window: 1m
+cooldown: 1m
+statusCode: 429
+`)
+
+	assert.Equal("", handle(t, q, "a", http.StatusInternalServerError))
+	assert.Equal("", handle(t, q, "a", http.StatusOK))
+	assert.Equal("", handle(t, q, "a", http.StatusBadGateway))
+	assert.Equal("", handle(t, q, "b", http.StatusBadGateway))
+	assert.Equal("", handle(t, q, "a", http.StatusServiceUnavailable))
+
+	// a is quarantined, b is not
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req, _ := httpprot.NewRequest(stdr)
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	ctx.SetData(fingerprint.DefaultDataKey, "a")
+	assert.Equal(resultQuarantined, q.Handle(ctx))
+	assert.Equal(http.StatusTooManyRequests, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	assert.Equal("", handle(t, q, "b", http.StatusOK))
+
+	// requests without fingerprint are not affected
+	assert.Equal("", handle(t, q, "", http.StatusInternalServerError))
+
+	status := q.Status().(*Status)
+	assert.Equal(2, status.NumOfTracked)
+	assert.Equal(1, status.NumOfQuarantined)
+	assert.Equal(int64(1), status.NumOfFastFailed)
+
+	// the quarantine expires after the cooldown
+	assert.False(q.isQuarantined("a", time.Now().Add(2*time.Minute)))
+}
+
+func TestFailureCodes(t *testing.T) {
+	assert := assert.New(t)
+
+	q := createQuarantine(t, `
+name: quarantine
+kind: Quarantine
+threshold: 1
+failureCodes: [401]
+`)
+
+	assert.Equal("", handle(t, q, "a", http.StatusInternalServerError))
+	assert.Equal("", handle(t, q, "a", http.StatusOK))
+	assert.Equal("", handle(t, q, "a", http.StatusUnauthorized))
+	assert.Equal(resultQuarantined, handle(t, q, "a", http.StatusOK))
+}
+
+func TestBounded(t *testing.T) {
+	assert := assert.New(t)
+
+	q := createQuarantine(t, `
+name: quarantine
+kind: Quarantine
+threshold: 2
+window: 1s
+maxEntries: 2
+`)
+
+	now := time.Now()
+	q.recordFailure("a", now)
+	q.recordFailure("b", now)
+	q.recordFailure("a", now)
+	assert.True(q.isQuarantined("a", now))
+
+	// b is the least recently updated one, so it is evicted
+	q.recordFailure("c", now)
+	assert.Equal(2, q.lru.Len())
+	assert.Nil(q.entries["b"])
+	assert.NotNil(q.entries["a"])
+
+	// c is expired after the window, so it is evicted before a
+	q.recordFailure("d", now.Add(2*time.Second))
+	assert.Nil(q.entries["c"])
+	assert.NotNil(q.entries["a"])
+	assert.NotNil(q.entries["d"])
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Threshold: 1, Window: "abc"}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Threshold: 1, StatusCode: 1000}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Threshold: 1, MaxEntries: -1}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Threshold: 1, Window: "10s", StatusCode: 503}
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,259 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package querynormalizer
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of QueryNormalizer.
+	Kind = "QueryNormalizer"
+
+	// DefaultDataKey is the default key to save the original query.
+	DefaultDataKey = "ORIGINAL_QUERY"
+
+	resultInvalid = "invalid"
+
+	unknownParamsStrip  = "strip"
+	unknownParamsReject = "reject"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "QueryNormalizer sorts query parameters, drops tracking ones and enforces an allow list.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			UnknownParams: unknownParamsStrip,
+			DataKey:       DefaultDataKey,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &QueryNormalizer{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// QueryNormalizer is filter QueryNormalizer.
+	QueryNormalizer struct {
+		spec *Spec
+
+		drop    *paramSet
+		allowed *paramSet
+
+		numOfNormalized int64
+		numOfRejected   int64
+	}
+
+	// Spec describes the QueryNormalizer.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		DropParams    []string `json:"dropParams" jsonschema:"omitempty,uniqueItems=true"`
+		AllowedParams []string `json:"allowedParams" jsonschema:"omitempty,uniqueItems=true"`
+		UnknownParams string   `json:"unknownParams" jsonschema:"omitempty,enum=,enum=strip,enum=reject"`
+		DataKey       string   `json:"dataKey" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of QueryNormalizer.
+	Status struct {
+		NumOfNormalized int64 `json:"numOfNormalized"`
+		NumOfRejected   int64 `json:"numOfRejected"`
+	}
+
+	// paramSet matches parameter names exactly, or by prefix if the
+	// name in the spec ends with '*'.
+	paramSet struct {
+		names    map[string]struct{}
+		prefixes []string
+	}
+)
+
+var _ filters.Filter = (*QueryNormalizer)(nil)
+
+func newParamSet(names []string) *paramSet {
+	if len(names) == 0 {
+		return nil
+	}
+
+	ps := &paramSet{names: map[string]struct{}{}}
+	for _, name := range names {
+		if strings.HasSuffix(name, "*") {
+			ps.prefixes = append(ps.prefixes, strings.TrimSuffix(name, "*"))
+		} else {
+			ps.names[name] = struct{}{}
+		}
+	}
+	return ps
+}
+
+func (ps *paramSet) match(name string) bool {
+	if _, ok := ps.names[name]; ok {
+		return true
+	}
+	for _, prefix := range ps.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateParamNames(field string, names []string) error {
+	for _, name := range names {
+		if name == "" || name == "*" {
+			return fmt.Errorf("%s: invalid parameter name %q", field, name)
+		}
+		if strings.Contains(strings.TrimSuffix(name, "*"), "*") {
+			return fmt.Errorf("%s: '*' is only allowed at the end of parameter name %q", field, name)
+		}
+	}
+	return nil
+}
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if err := validateParamNames("dropParams", spec.DropParams); err != nil {
+		return err
+	}
+	if err := validateParamNames("allowedParams", spec.AllowedParams); err != nil {
+		return err
+	}
+
+	drop := newParamSet(spec.DropParams)
+	if drop == nil {
+		return nil
+	}
+	for _, name := range spec.AllowedParams {
+		if drop.match(strings.TrimSuffix(name, "*")) {
+			return fmt.Errorf("allowed parameter %q is also dropped", name)
+		}
+	}
+
+	return nil
+}
+
+// Name returns the name of the QueryNormalizer filter instance.
+func (qn *QueryNormalizer) Name() string {
+	return qn.spec.Name()
+}
+
+// Kind returns the kind of QueryNormalizer.
+func (qn *QueryNormalizer) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the QueryNormalizer
+func (qn *QueryNormalizer) Spec() filters.Spec {
+	return qn.spec
+}
+
+// Init initializes QueryNormalizer.
+func (qn *QueryNormalizer) Init() {
+	qn.reload()
+}
+
+// Inherit inherits previous generation of QueryNormalizer.
+func (qn *QueryNormalizer) Inherit(previousGeneration filters.Filter) {
+	qn.reload()
+}
+
+func (qn *QueryNormalizer) reload() {
+	qn.drop = newParamSet(qn.spec.DropParams)
+	qn.allowed = newParamSet(qn.spec.AllowedParams)
+}
+
+func (qn *QueryNormalizer) reject(ctx *context.Context, reason string) string {
+	atomic.AddInt64(&qn.numOfRejected, 1)
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusBadRequest)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag(stringtool.Cat("queryNormalizer: ", reason))
+	return resultInvalid
+}
+
+// Handle normalizes the query of the request.
+func (qn *QueryNormalizer) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	u := req.URL()
+
+	original := u.RawQuery
+	if original == "" {
+		return ""
+	}
+
+	query, err := url.ParseQuery(original)
+	if err != nil {
+		return qn.reject(ctx, "malformed query: "+err.Error())
+	}
+
+	for name := range query {
+		if qn.drop != nil && qn.drop.match(name) {
+			query.Del(name)
+			continue
+		}
+		if qn.allowed == nil || qn.allowed.match(name) {
+			continue
+		}
+		if qn.spec.UnknownParams == unknownParamsReject {
+			return qn.reject(ctx, "unknown parameter "+name)
+		}
+		query.Del(name)
+	}
+
+	dataKey := qn.spec.DataKey
+	if dataKey == "" {
+		dataKey = DefaultDataKey
+	}
+	ctx.SetData(dataKey, original)
+
+	// Encode sorts the parameters by name.
+	u.RawQuery = query.Encode()
+	atomic.AddInt64(&qn.numOfNormalized, 1)
+
+	return ""
+}
+
+// Status returns status.
+func (qn *QueryNormalizer) Status() interface{} {
+	return &Status{
+		NumOfNormalized: atomic.LoadInt64(&qn.numOfNormalized),
+		NumOfRejected:   atomic.LoadInt64(&qn.numOfRejected),
+	}
+}
+
+// Close closes QueryNormalizer.
+func (qn *QueryNormalizer) Close() {}
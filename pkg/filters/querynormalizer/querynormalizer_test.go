@@ -0,0 +1,139 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package querynormalizer
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createNormalizer(t *testing.T, yamlConfig string) *QueryNormalizer {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	qn := kind.CreateInstance(spec).(*QueryNormalizer)
+	qn.Init()
+	return qn
+}
+
+func newContext(t *testing.T, rawURL string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, rawURL, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	rawSpec := map[string]interface{}{
+		"name":          "qn",
+		"kind":          Kind,
+		"allowedParams": []string{"id", ""},
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	rawSpec["allowedParams"] = []string{"i*d"}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	rawSpec["allowedParams"] = []string{"id", "utm_source"}
+	rawSpec["dropParams"] = []string{"utm_*"}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(err)
+
+	rawSpec["allowedParams"] = []string{"id", "page"}
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(err)
+}
+
+func TestStrip(t *testing.T) {
+	assert := assert.New(t)
+
+	qn := createNormalizer(t, `
+name: qn
+kind: QueryNormalizer
+dropParams: ["utm_*", "fbclid"]
+allowedParams: ["id", "page"]
+`)
+
+	ctx := newContext(t, "http://example.com/list?page=2&utm_source=x&fbclid=y&debug=1&id=b&id=a")
+	assert.Equal("", qn.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("id=b&id=a&page=2", req.URL().RawQuery)
+	assert.Equal("page=2&utm_source=x&fbclid=y&debug=1&id=b&id=a", ctx.GetData(DefaultDataKey))
+
+	ctx = newContext(t, "http://example.com/list?page=%zz")
+	assert.Equal(resultInvalid, qn.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	status := qn.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfNormalized)
+	assert.Equal(int64(1), status.NumOfRejected)
+}
+
+func TestReject(t *testing.T) {
+	assert := assert.New(t)
+
+	qn := createNormalizer(t, `
+name: qn
+kind: QueryNormalizer
+dropParams: ["utm_*"]
+allowedParams: ["id"]
+unknownParams: reject
+dataKey: originalQuery
+`)
+
+	ctx := newContext(t, "http://example.com/?utm_medium=email&id=1")
+	assert.Equal("", qn.Handle(ctx))
+	assert.Equal("id=1", ctx.GetInputRequest().(*httpprot.Request).URL().RawQuery)
+	assert.Equal("utm_medium=email&id=1", ctx.GetData("originalQuery"))
+
+	ctx = newContext(t, "http://example.com/?id=1&debug=1")
+	assert.Equal(resultInvalid, qn.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// without allow list, parameters are only sorted.
+	qn = createNormalizer(t, `
+name: qn
+kind: QueryNormalizer
+`)
+	ctx = newContext(t, "http://example.com/?b=2&a=1")
+	assert.Equal("", qn.Handle(ctx))
+	assert.Equal("a=1&b=2", ctx.GetInputRequest().(*httpprot.Request).URL().RawQuery)
+}
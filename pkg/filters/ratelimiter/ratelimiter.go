@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
@@ -35,12 +37,18 @@ const (
 	// Kind is the kind of RateLimiter.
 	Kind              = "RateLimiter"
 	resultRateLimited = "rateLimited"
+
+	// MatchModeFirst uses the first matched URL rule.
+	MatchModeFirst = "first"
+	// MatchModeMostSpecific uses the most specific matched URL rule.
+	MatchModeMostSpecific = "mostSpecific"
 )
 
 var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "RateLimiter implements a rate limiter for http request.",
 	Results:     []string{resultRateLimited},
+	Effects:     []string{filters.EffectState},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -67,6 +75,9 @@ type (
 		urlrule.URLRule `json:",inline"`
 		policy          *Policy
 		rl              *librl.RateLimiter
+
+		numOfAllowed  int64
+		numOfRejected int64
 	}
 
 	// Spec is the configuration of a rate limiter
@@ -77,38 +88,93 @@ type (
 
 	// Rule is the detailed config of RateLimiter.
 	Rule struct {
-		Policies         []*Policy  `json:"policies" jsonschema:"required"`
-		DefaultPolicyRef string     `json:"defaultPolicyRef" jsonschema:"omitempty"`
-		URLs             []*URLRule `json:"urls" jsonschema:"required"`
+		Policies           []*Policy  `json:"policies" jsonschema:"required"`
+		DefaultPolicyRef   string     `json:"defaultPolicyRef" jsonschema:"omitempty"`
+		URLs               []*URLRule `json:"urls" jsonschema:"required"`
+		MatchMode          string     `json:"matchMode,omitempty" jsonschema:"omitempty,enum=,enum=first,enum=mostSpecific"`
+		UnmatchedPolicyRef string     `json:"unmatchedPolicyRef,omitempty" jsonschema:"omitempty"`
 	}
 
 	// RateLimiter defines the rate limiter
 	RateLimiter struct {
-		spec *Spec
+		spec      *Spec
+		unmatched *URLRule
+	}
+
+	// Status is the status of RateLimiter.
+	Status struct {
+		URLs      []*URLStatus `json:"urls"`
+		Unmatched *URLStatus   `json:"unmatched,omitempty"`
+	}
+
+	// URLStatus is the status of the rate limiter of a URL rule.
+	URLStatus struct {
+		ID            string   `json:"id"`
+		Methods       []string `json:"methods,omitempty"`
+		NumOfAllowed  int64    `json:"numOfAllowed"`
+		NumOfRejected int64    `json:"numOfRejected"`
 	}
 )
 
+func (spec *Spec) hasPolicy(name string) bool {
+	for _, p := range spec.Policies {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Validate implements custom validation for Spec
 func (spec Spec) Validate() error {
-URLLoop:
 	for _, u := range spec.URLs {
+		if err := u.URL.Validate(); err != nil {
+			return fmt.Errorf("url %v: %v", u.URL, err)
+		}
+
 		name := u.PolicyRef
 		if name == "" {
 			name = spec.DefaultPolicyRef
 		}
-
-		for _, p := range spec.Policies {
-			if p.Name == name {
-				continue URLLoop
-			}
+		if !spec.hasPolicy(name) {
+			return fmt.Errorf("policy '%s' is not defined", name)
 		}
+	}
 
+	if name := spec.UnmatchedPolicyRef; name != "" && !spec.hasPolicy(name) {
 		return fmt.Errorf("policy '%s' is not defined", name)
 	}
 
 	return nil
 }
 
+// specificity returns how specific the rule matches the path, the larger
+// the more specific. An exact match is more specific than a prefix match,
+// which is more specific than a regular expression match, and for the same
+// kind of matches, the longer pattern is more specific.
+func (url *URLRule) specificity(path string) (int, int) {
+	sm := &url.URL
+	switch {
+	case sm.Empty && path == "":
+		return 3, 0
+	case sm.Exact != "" && path == sm.Exact:
+		return 3, len(sm.Exact)
+	case sm.Prefix != "" && strings.HasPrefix(path, sm.Prefix):
+		return 2, len(sm.Prefix)
+	default:
+		return 1, len(sm.RegEx)
+	}
+}
+
+func (url *URLRule) status() *URLStatus {
+	return &URLStatus{
+		ID:            url.ID(),
+		Methods:       url.Methods,
+		NumOfAllowed:  atomic.LoadInt64(&url.numOfAllowed),
+		NumOfRejected: atomic.LoadInt64(&url.numOfRejected),
+	}
+}
+
 func (url *URLRule) createRateLimiter() {
 	policy := librl.Policy{
 		LimitForPeriod: url.policy.LimitForPeriod,
@@ -207,6 +273,13 @@ func isSamePolicy(spec1, spec2 *Spec, policyName string) bool {
 }
 
 func (rl *RateLimiter) reload(previousGeneration *RateLimiter) {
+	if name := rl.spec.UnmatchedPolicyRef; name != "" {
+		rl.unmatched = &URLRule{}
+		rl.unmatched.PolicyRef = name
+		rl.unmatched.URL.Prefix = "/"
+		rl.createRateLimiterForURL(rl.unmatched)
+	}
+
 	if previousGeneration == nil {
 		for _, u := range rl.spec.URLs {
 			rl.createRateLimiterForURL(u)
@@ -245,50 +318,84 @@ func (rl *RateLimiter) Inherit(previousGeneration filters.Filter) {
 	rl.reload(previousGeneration.(*RateLimiter))
 }
 
-// Handle handles HTTP request
-func (rl *RateLimiter) Handle(ctx *context.Context) string {
+// match returns the URL rule matches the request, or the rule for
+// unmatched requests if none of the rules matches.
+func (rl *RateLimiter) match(req *httpprot.Request) *URLRule {
+	var matched *URLRule
+	var kind, length int
+
 	for _, u := range rl.spec.URLs {
-		req := ctx.GetInputRequest().(*httpprot.Request)
 		if !u.Match(req.Std()) {
 			continue
 		}
+		if rl.spec.MatchMode != MatchModeMostSpecific {
+			return u
+		}
 
-		permitted, d := u.rl.AcquirePermission()
-		if !permitted {
-			ctx.AddTag("rateLimiter: too many requests")
+		k, l := u.specificity(req.Path())
+		if matched == nil || k > kind || (k == kind && l > length) {
+			matched, kind, length = u, k, l
+		}
+	}
 
-			resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
-			if resp == nil {
-				resp, _ = httpprot.NewResponse(nil)
-			}
+	if matched == nil {
+		return rl.unmatched
+	}
+	return matched
+}
 
-			resp.SetStatusCode(http.StatusTooManyRequests)
-			resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+// Handle handles HTTP request
+func (rl *RateLimiter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
 
-			ctx.SetOutputResponse(resp)
-			return resultRateLimited
-		}
+	u := rl.match(req)
+	if u == nil {
+		return ""
+	}
 
-		if d <= 0 {
-			break
-		}
+	permitted, d := u.rl.AcquirePermission()
+	if !permitted {
+		atomic.AddInt64(&u.numOfRejected, 1)
+		ctx.AddTag("rateLimiter: too many requests")
 
-		timer := time.NewTimer(d)
-		select {
-		case <-req.Context().Done():
-			timer.Stop()
-			return ""
-		case <-timer.C:
-			ctx.AddTag(fmt.Sprintf("rateLimiter: waiting duration: %s", d.String()))
-			return ""
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
 		}
+
+		resp.SetStatusCode(http.StatusTooManyRequests)
+		resp.HTTPHeader().Set("X-EG-Rate-Limiter", "too-many-requests")
+
+		ctx.SetOutputResponse(resp)
+		return resultRateLimited
+	}
+
+	atomic.AddInt64(&u.numOfAllowed, 1)
+	if d <= 0 {
+		return ""
+	}
+
+	timer := time.NewTimer(d)
+	select {
+	case <-req.Context().Done():
+		timer.Stop()
+		return ""
+	case <-timer.C:
+		ctx.AddTag(fmt.Sprintf("rateLimiter: waiting duration: %s", d.String()))
+		return ""
 	}
-	return ""
 }
 
 // Status returns Status generated by Runtime.
 func (rl *RateLimiter) Status() interface{} {
-	return nil
+	s := &Status{}
+	for _, u := range rl.spec.URLs {
+		s.URLs = append(s.URLs, u.status())
+	}
+	if rl.unmatched != nil {
+		s.Unmatched = rl.unmatched.status()
+	}
+	return s
 }
 
 // Close closes RateLimiter.
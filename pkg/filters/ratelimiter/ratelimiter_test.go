@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package ratelimiter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createRateLimiter(t *testing.T, yamlConfig string) *RateLimiter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	rl := kind.CreateInstance(spec).(*RateLimiter)
+	rl.Init()
+	return rl
+}
+
+func newContext(t *testing.T, path string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com"+path, nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+const yamlConfig = `
+name: rl
+kind: RateLimiter
+policies:
+- name: strict
+  timeoutDuration: 1ms
+  limitRefreshPeriod: 1h
+  limitForPeriod: 1
+- name: loose
+  timeoutDuration: 1ms
+  limitRefreshPeriod: 1h
+  limitForPeriod: 3
+defaultPolicyRef: loose
+urls:
+- url:
+    prefix: /
+- url:
+    prefix: /search
+  policyRef: strict
+`
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	rawSpec["unmatchedPolicyRef"] = "unknown"
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["unmatchedPolicyRef"] = "strict"
+	rawSpec["matchMode"] = "mostSpecific"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+}
+
+func TestFirstMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := createRateLimiter(t, yamlConfig)
+	for i := 0; i < 3; i++ {
+		assert.Equal("", rl.Handle(newContext(t, "/search")))
+	}
+	assert.Equal(resultRateLimited, rl.Handle(newContext(t, "/static")))
+
+	status := rl.Status().(*Status)
+	assert.Equal(int64(3), status.URLs[0].NumOfAllowed)
+	assert.Equal(int64(1), status.URLs[0].NumOfRejected)
+	assert.Equal(int64(0), status.URLs[1].NumOfAllowed)
+	assert.Nil(status.Unmatched)
+}
+
+func TestMostSpecificMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	rl := createRateLimiter(t, yamlConfig+`
+matchMode: mostSpecific
+unmatchedPolicyRef: strict
+`)
+
+	assert.Equal("", rl.Handle(newContext(t, "/search")))
+	ctx := newContext(t, "/search/books")
+	assert.Equal(resultRateLimited, rl.Handle(ctx))
+	assert.Equal(http.StatusTooManyRequests, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the search limit doesn't affect other paths.
+	assert.Equal("", rl.Handle(newContext(t, "/static")))
+
+	// unmatched requests use their own bucket.
+	assert.Equal("", rl.Handle(newContext(t, "")))
+	assert.Equal(resultRateLimited, rl.Handle(newContext(t, "")))
+
+	status := rl.Status().(*Status)
+	assert.Equal("/", status.URLs[0].ID)
+	assert.Equal(int64(1), status.URLs[0].NumOfAllowed)
+	assert.Equal("/search", status.URLs[1].ID)
+	assert.Equal(int64(1), status.URLs[1].NumOfAllowed)
+	assert.Equal(int64(1), status.URLs[1].NumOfRejected)
+	assert.Equal(int64(1), status.Unmatched.NumOfAllowed)
+	assert.Equal(int64(1), status.Unmatched.NumOfRejected)
+}
@@ -0,0 +1,436 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package redactor implements a filter to mask sensitive data in logs and
+// responses.
+package redactor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of Redactor.
+	Kind = "Redactor"
+
+	defaultMask        = "[REDACTED]"
+	defaultMaxBodySize = 1024 * 1024
+
+	builtinSSN        = "ssn"
+	builtinCreditCard = "creditCard"
+	builtinEmail      = "email"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "Redactor masks sensitive data in logs and optionally in responses.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Mask:        defaultMask,
+			MaxBodySize: defaultMaxBodySize,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &Redactor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+// builtins are the predefined patterns, the check function, if not nil,
+// is used to filter out false positives of a match.
+var builtins = map[string]struct {
+	re    *regexp.Regexp
+	check func(s string) bool
+}{
+	builtinSSN:        {re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	builtinCreditCard: {re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), check: luhn},
+	builtinEmail:      {re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+}
+
+type (
+	// Redactor is filter Redactor.
+	Redactor struct {
+		spec *Spec
+
+		fields   [][]string
+		headers  map[string]bool
+		patterns []*pattern
+
+		numOfLogRedactions      int64
+		numOfResponseRedactions int64
+		numOfRedactedResponses  int64
+		numOfOversized          int64
+	}
+
+	// Spec describes the Redactor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Fields      []string `json:"fields" jsonschema:"omitempty"`
+		Headers     []string `json:"headers" jsonschema:"omitempty"`
+		Builtins    []string `json:"builtins" jsonschema:"omitempty,uniqueItems=true"`
+		Patterns    []string `json:"patterns" jsonschema:"omitempty"`
+		Mask        string   `json:"mask" jsonschema:"omitempty"`
+		Response    bool     `json:"response" jsonschema:"omitempty"`
+		MaxBodySize int64    `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Status is the status of Redactor.
+	Status struct {
+		NumOfLogRedactions      int64 `json:"numOfLogRedactions"`
+		NumOfResponseRedactions int64 `json:"numOfResponseRedactions"`
+		NumOfRedactedResponses  int64 `json:"numOfRedactedResponses"`
+		NumOfOversized          int64 `json:"numOfOversized"`
+	}
+
+	pattern struct {
+		re    *regexp.Regexp
+		check func(s string) bool
+	}
+)
+
+var (
+	_ filters.Filter       = (*Redactor)(nil)
+	_ httpprot.LogRedactor = (*Redactor)(nil)
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if len(spec.Fields) == 0 && len(spec.Headers) == 0 && len(spec.Builtins) == 0 && len(spec.Patterns) == 0 {
+		return fmt.Errorf("at least one of fields, headers, builtins and patterns must be specified")
+	}
+	for _, f := range spec.Fields {
+		for _, k := range strings.Split(f, ".") {
+			if k == "" {
+				return fmt.Errorf("invalid field path %q", f)
+			}
+		}
+	}
+	for _, b := range spec.Builtins {
+		if _, ok := builtins[b]; !ok {
+			return fmt.Errorf("unknown builtin pattern %q", b)
+		}
+	}
+	for _, p := range spec.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return fmt.Errorf("invalid pattern %q: %v", p, err)
+		}
+	}
+	return nil
+}
+
+// Name returns the name of the Redactor filter instance.
+func (r *Redactor) Name() string {
+	return r.spec.Name()
+}
+
+// Kind returns the kind of Redactor.
+func (r *Redactor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the Redactor
+func (r *Redactor) Spec() filters.Spec {
+	return r.spec
+}
+
+// Init initializes Redactor.
+func (r *Redactor) Init() {
+	r.reload()
+}
+
+// Inherit inherits previous generation of Redactor.
+func (r *Redactor) Inherit(previousGeneration filters.Filter) {
+	r.reload()
+}
+
+func (r *Redactor) reload() {
+	for _, f := range r.spec.Fields {
+		r.fields = append(r.fields, strings.Split(f, "."))
+	}
+
+	r.headers = make(map[string]bool, len(r.spec.Headers))
+	for _, h := range r.spec.Headers {
+		r.headers[http.CanonicalHeaderKey(h)] = true
+	}
+
+	for _, b := range r.spec.Builtins {
+		r.patterns = append(r.patterns, &pattern{re: builtins[b].re, check: builtins[b].check})
+	}
+	for _, p := range r.spec.Patterns {
+		// the pattern is checked by Validate.
+		r.patterns = append(r.patterns, &pattern{re: regexp.MustCompile(p)})
+	}
+}
+
+func (r *Redactor) mask() string {
+	if r.spec.Mask == "" {
+		return defaultMask
+	}
+	return r.spec.Mask
+}
+
+func (r *Redactor) maxBodySize() int64 {
+	if r.spec.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return r.spec.MaxBodySize
+}
+
+// luhn reports whether the digits in s pass the Luhn checksum, which is
+// used to avoid masking numbers which are not card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+// redactString masks the matches of the patterns in s, it returns the
+// result and the number of masked values.
+func (r *Redactor) redactString(s string) (string, int) {
+	count := 0
+	for _, p := range r.patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			if p.check != nil && !p.check(m) {
+				return m
+			}
+			count++
+			return r.mask()
+		})
+	}
+	return s, count
+}
+
+// redactField masks the field at path in v, arrays are traversed
+// transparently.
+func (r *Redactor) redactField(v interface{}, path []string) int {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		child, ok := x[path[0]]
+		if !ok {
+			return 0
+		}
+		if len(path) == 1 {
+			x[path[0]] = r.mask()
+			return 1
+		}
+		return r.redactField(child, path[1:])
+	case []interface{}:
+		count := 0
+		for _, val := range x {
+			count += r.redactField(val, path)
+		}
+		return count
+	}
+	return 0
+}
+
+// redactValue masks the matches of the patterns in the string values of v.
+func (r *Redactor) redactValue(v interface{}) (interface{}, int) {
+	count := 0
+	switch x := v.(type) {
+	case string:
+		return r.redactString(x)
+	case map[string]interface{}:
+		for k, val := range x {
+			var n int
+			x[k], n = r.redactValue(val)
+			count += n
+		}
+	case []interface{}:
+		for i, val := range x {
+			var n int
+			x[i], n = r.redactValue(val)
+			count += n
+		}
+	}
+	return v, count
+}
+
+// redactBody masks the sensitive data in body. JSON bodies are masked by
+// both fields and patterns, other text bodies are masked by patterns, and
+// binary bodies are kept. It returns the result and the number of masked
+// values.
+func (r *Redactor) redactBody(body []byte) ([]byte, int) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if decoder.Decode(&v) == nil {
+			count := 0
+			for _, path := range r.fields {
+				count += r.redactField(v, path)
+			}
+			v, n := r.redactValue(v)
+			if count += n; count == 0 {
+				return body, 0
+			}
+			data, _ := json.Marshal(v)
+			return data, count
+		}
+	}
+
+	if len(r.patterns) == 0 || !utf8.Valid(body) {
+		return body, 0
+	}
+	s, count := r.redactString(string(body))
+	if count == 0 {
+		return body, 0
+	}
+	return []byte(s), count
+}
+
+// RedactString implements httpprot.LogRedactor.
+func (r *Redactor) RedactString(s string) string {
+	s, n := r.redactString(s)
+	atomic.AddInt64(&r.numOfLogRedactions, int64(n))
+	return s
+}
+
+// RedactHeader implements httpprot.LogRedactor.
+func (r *Redactor) RedactHeader(h http.Header) http.Header {
+	result := make(http.Header, len(h))
+	count := 0
+	for k, v := range h {
+		if r.headers[http.CanonicalHeaderKey(k)] {
+			result[k] = []string{r.mask()}
+			count++
+			continue
+		}
+		values := make([]string, len(v))
+		for i, s := range v {
+			var n int
+			values[i], n = r.redactString(s)
+			count += n
+		}
+		result[k] = values
+	}
+	atomic.AddInt64(&r.numOfLogRedactions, int64(count))
+	return result
+}
+
+// RedactBody implements httpprot.LogRedactor.
+func (r *Redactor) RedactBody(body []byte) []byte {
+	body, n := r.redactBody(body)
+	atomic.AddInt64(&r.numOfLogRedactions, int64(n))
+	return body
+}
+
+// readBody reads the body of the response, it returns false if the body
+// is larger than maxBodySize, and the response is left unchanged.
+func (r *Redactor) readBody(resp *httpprot.Response) ([]byte, bool) {
+	if !resp.IsStream() {
+		body := resp.RawPayload()
+		return body, int64(len(body)) <= r.maxBodySize()
+	}
+
+	stream := resp.GetPayload()
+	body, err := io.ReadAll(io.LimitReader(stream, r.maxBodySize()+1))
+	if err == nil && int64(len(body)) <= r.maxBodySize() {
+		return body, true
+	}
+
+	// put back the bytes read, so that the response is not changed.
+	resp.SetPayload(io.MultiReader(bytes.NewReader(body), stream))
+	return nil, false
+}
+
+// Handle registers the Redactor as the log redactor of the request, and
+// masks the response body if the response is enabled and the filter is
+// called after the backend.
+func (r *Redactor) Handle(ctx *context.Context) string {
+	ctx.SetData(httpprot.LogRedactorDataKey, r)
+
+	if !r.spec.Response {
+		return ""
+	}
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return ""
+	}
+
+	h := resp.HTTPHeader()
+	if h.Get("Content-Encoding") != "" {
+		return ""
+	}
+
+	body, ok := r.readBody(resp)
+	if !ok {
+		atomic.AddInt64(&r.numOfOversized, 1)
+		ctx.AddTag("redactor: response body too large to redact")
+		return ""
+	}
+
+	data, n := r.redactBody(body)
+	if n == 0 {
+		if resp.IsStream() {
+			resp.SetPayload(body)
+		}
+		return ""
+	}
+
+	resp.SetPayload(data)
+	resp.ContentLength = int64(len(data))
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	atomic.AddInt64(&r.numOfRedactedResponses, 1)
+	atomic.AddInt64(&r.numOfResponseRedactions, int64(n))
+	return ""
+}
+
+// Status returns status.
+func (r *Redactor) Status() interface{} {
+	return &Status{
+		NumOfLogRedactions:      atomic.LoadInt64(&r.numOfLogRedactions),
+		NumOfResponseRedactions: atomic.LoadInt64(&r.numOfResponseRedactions),
+		NumOfRedactedResponses:  atomic.LoadInt64(&r.numOfRedactedResponses),
+		NumOfOversized:          atomic.LoadInt64(&r.numOfOversized),
+	}
+}
+
+// Close closes Redactor.
+func (r *Redactor) Close() {}
@@ -0,0 +1,180 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package redactor
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createRedactor(t *testing.T, yamlConfig string) *Redactor {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	r := kind.CreateInstance(spec).(*Redactor)
+	r.Init()
+	return r
+}
+
+func newContext(t *testing.T, body interface{}) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://megaease.com/users", nil)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.HTTPHeader().Set("Content-Type", "application/json")
+	resp.SetPayload(body)
+	ctx.SetOutputResponse(resp)
+	return ctx
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, yamlConfig := range []string{`
+kind: Redactor
+name: redactor
+`, `
+kind: Redactor
+name: redactor
+builtins: [phone]
+`, `
+kind: Redactor
+name: redactor
+patterns: ["a("]
+`, `
+kind: Redactor
+name: redactor
+fields: ["user..ssn"]
+`} {
+		rawSpec := make(map[string]interface{})
+		codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+		_, err := filters.NewSpec(nil, "", rawSpec)
+		assert.Error(err, yamlConfig)
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	assert := assert.New(t)
+
+	r := createRedactor(t, `
+kind: Redactor
+name: redactor
+fields: [users.password]
+builtins: [ssn, creditCard, email]
+patterns: ["token-[0-9a-f]+"]
+mask: "***"
+`)
+
+	body := `{"users":[{"name":"bob","password":"secret","ssn":"123-45-6789"},` +
+		`{"name":"alice","note":"card 4111 1111 1111 1111, order 1234567890123"}],"total":2}`
+	data, n := r.redactBody([]byte(body))
+	assert.Equal(3, n)
+	assert.JSONEq(`{"users":[{"name":"bob","password":"***","ssn":"***"},`+
+		`{"name":"alice","note":"card ***, order 1234567890123"}],"total":2}`, string(data))
+
+	data, n = r.redactBody([]byte("mail bob@megaease.com with token-3fa9"))
+	assert.Equal(2, n)
+	assert.Equal("mail *** with ***", string(data))
+
+	binary := []byte{0xff, 0xfe, '1', '2', '3', '-', '4', '5', '-', '6', '7', '8', '9'}
+	data, n = r.redactBody(binary)
+	assert.Equal(0, n)
+	assert.Equal(binary, data)
+
+	var lr httpprot.LogRedactor = r
+	assert.Equal("/users?email=***", lr.RedactString("/users?email=bob@megaease.com"))
+	h := http.Header{"Authorization": {"Bearer abc"}}
+	assert.Equal(http.Header{"Authorization": {"Bearer abc"}}, lr.RedactHeader(h))
+	assert.Equal(int64(1), r.Status().(*Status).NumOfLogRedactions)
+}
+
+func TestHandle(t *testing.T) {
+	assert := assert.New(t)
+
+	r := createRedactor(t, `
+kind: Redactor
+name: redactor
+headers: [Authorization]
+builtins: [ssn]
+response: true
+maxBodySize: 64
+`)
+
+	ctx := newContext(t, []byte(`{"ssn":"123-45-6789"}`))
+	assert.Equal("", r.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.JSONEq(`{"ssn":"[REDACTED]"}`, string(resp.RawPayload()))
+	assert.Equal(int64(len(resp.RawPayload())), resp.ContentLength)
+
+	// the redactor is registered as the log redactor
+	lr := ctx.GetData(httpprot.LogRedactorDataKey).(httpprot.LogRedactor)
+	h := lr.RedactHeader(http.Header{"Authorization": {"Bearer abc"}, "X-Id": {"1"}})
+	assert.Equal(http.Header{"Authorization": {"[REDACTED]"}, "X-Id": {"1"}}, h)
+
+	// stream bodies within the cap are redacted
+	ctx = newContext(t, strings.NewReader(`{"ssn":"123-45-6789"}`))
+	r.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.JSONEq(`{"ssn":"[REDACTED]"}`, string(resp.RawPayload()))
+
+	// oversized stream bodies are kept unchanged
+	body := `{"ssn":"123-45-6789","padding":"` + strings.Repeat("x", 64) + `"}`
+	ctx = newContext(t, strings.NewReader(body))
+	r.Handle(ctx)
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	data, _ := io.ReadAll(resp.GetPayload())
+	assert.Equal(body, string(data))
+
+	// compressed bodies are skipped
+	ctx = newContext(t, []byte(`{"ssn":"123-45-6789"}`))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	resp.HTTPHeader().Set("Content-Encoding", "gzip")
+	r.Handle(ctx)
+	assert.Equal(`{"ssn":"123-45-6789"}`, string(resp.RawPayload()))
+
+	status := r.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfRedactedResponses)
+	assert.Equal(int64(2), status.NumOfResponseRedactions)
+	assert.Equal(int64(1), status.NumOfOversized)
+	assert.Equal(int64(1), status.NumOfLogRedactions)
+
+	r.Inherit(r)
+	r.Close()
+}
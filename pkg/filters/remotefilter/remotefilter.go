@@ -52,6 +52,7 @@ var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "RemoteFilter invokes remote apis.",
 	Results:     []string{resultFailed, resultResponseAlready},
+	Effects:     []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
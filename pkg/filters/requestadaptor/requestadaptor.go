@@ -18,16 +18,22 @@
 package requestadaptor
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"net/http"
 	"strconv"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/builder"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
+	"github.com/megaease/easegress/pkg/util/codectool"
 	"github.com/megaease/easegress/pkg/util/pathadaptor"
 	"github.com/megaease/easegress/pkg/util/readers"
 	"github.com/megaease/easegress/pkg/util/signer"
@@ -41,6 +47,8 @@ const (
 	resultDecompressFailed = "decompressFailed"
 	resultCompressFailed   = "compressFailed"
 	resultSignFailed       = "signFailed"
+	resultInvalidBody      = "invalidBody"
+	resultBuildBodyFailed  = "buildBodyFailed"
 
 	keyContentLength   = "Content-Length"
 	keyContentEncoding = "Content-Encoding"
@@ -52,6 +60,9 @@ var kind = &filters.Kind{
 	Results: []string{
 		resultDecompressFailed,
 		resultCompressFailed,
+		resultSignFailed,
+		resultInvalidBody,
+		resultBuildBodyFailed,
 	},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
@@ -133,22 +144,27 @@ type (
 	RequestAdaptor struct {
 		spec *Spec
 
-		pa     *pathadaptor.PathAdaptor
-		signer *signer.Signer
+		pa           *pathadaptor.PathAdaptor
+		signer       *signer.Signer
+		bodyTemplate *template.Template
+
+		numOfInvalidBody     int64
+		numOfBuildBodyFailed int64
 	}
 
 	// Spec is HTTPAdaptor Spec.
 	Spec struct {
 		filters.BaseSpec `json:",inline"`
 
-		Host       string                `json:"host" jsonschema:"omitempty"`
-		Method     string                `json:"method" jsonschema:"omitempty,format=httpmethod"`
-		Path       *pathadaptor.Spec     `json:"path,omitempty" jsonschema:"omitempty"`
-		Header     *httpheader.AdaptSpec `json:"header,omitempty" jsonschema:"omitempty"`
-		Body       string                `json:"body" jsonschema:"omitempty"`
-		Compress   string                `json:"compress" jsonschema:"omitempty"`
-		Decompress string                `json:"decompress" jsonschema:"omitempty"`
-		Sign       *SignerSpec           `json:"sign,omitempty" jsonschema:"omitempty"`
+		Host         string                `json:"host" jsonschema:"omitempty"`
+		Method       string                `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		Path         *pathadaptor.Spec     `json:"path,omitempty" jsonschema:"omitempty"`
+		Header       *httpheader.AdaptSpec `json:"header,omitempty" jsonschema:"omitempty"`
+		Body         string                `json:"body" jsonschema:"omitempty"`
+		BodyTemplate *builder.Spec         `json:"bodyTemplate,omitempty" jsonschema:"omitempty"`
+		Compress     string                `json:"compress" jsonschema:"omitempty"`
+		Decompress   string                `json:"decompress" jsonschema:"omitempty"`
+		Sign         *SignerSpec           `json:"sign,omitempty" jsonschema:"omitempty"`
 	}
 
 	// SignerSpec is the spec of the request signer.
@@ -158,6 +174,12 @@ type (
 		Scopes      []string `json:"scopes" jsonschema:"omitempty"`
 	}
 
+	// Status is the status of RequestAdaptor.
+	Status struct {
+		NumOfInvalidBody     int64 `json:"numOfInvalidBody"`
+		NumOfBuildBodyFailed int64 `json:"numOfBuildBodyFailed"`
+	}
+
 	signerConfig struct {
 		literal        *signer.Literal
 		headerHoisting *signer.HeaderHoisting
@@ -178,6 +200,17 @@ func (spec *Spec) Validate() error {
 	if spec.Body != "" && spec.Decompress != "" {
 		return fmt.Errorf("No need to decompress when body is specified in RequestAdaptor spec")
 	}
+	if spec.BodyTemplate != nil {
+		if spec.Body != "" {
+			return fmt.Errorf("body and bodyTemplate cannot be specified at the same time")
+		}
+		if spec.Decompress != "" {
+			return fmt.Errorf("decompress cannot be specified when bodyTemplate is specified")
+		}
+		if err := spec.BodyTemplate.Validate(); err != nil {
+			return fmt.Errorf("invalid bodyTemplate: %v", err)
+		}
+	}
 	if spec.Sign == nil {
 		return nil
 	}
@@ -220,6 +253,9 @@ func (ra *RequestAdaptor) reload() {
 	if ra.spec.Path != nil {
 		ra.pa = pathadaptor.New(ra.spec.Path)
 	}
+	if ra.spec.BodyTemplate != nil {
+		ra.bodyTemplate = template.Must(builder.NewTemplate(ra.spec.BodyTemplate))
+	}
 	if s := ra.spec.Sign; s != nil {
 		sc, ok := signerConfigs[s.APIProvider]
 		if ok {
@@ -270,6 +306,13 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 		req.Std().Header.Del("Content-Encoding")
 	}
 
+	if ra.bodyTemplate != nil {
+		res := ra.processBodyTemplate(ctx, req)
+		if res != "" {
+			return res
+		}
+	}
+
 	if len(ra.spec.Host) != 0 {
 		req.SetHost(ra.spec.Host)
 	}
@@ -298,6 +341,49 @@ func (ra *RequestAdaptor) Handle(ctx *context.Context) string {
 	return ""
 }
 
+// processBodyTemplate builds the body with the template, besides the data
+// available to builder filters, the JSON body of the request is available
+// to the template as '.body'.
+func (ra *RequestAdaptor) processBodyTemplate(ctx *context.Context, req *httpprot.Request) string {
+	if req.IsStream() {
+		atomic.AddInt64(&ra.numOfBuildBodyFailed, 1)
+		ctx.AddTag("requestAdaptor: cannot build body from a stream")
+		return resultBuildBodyFailed
+	}
+
+	var body interface{}
+	if raw := req.RawPayload(); len(raw) > 0 {
+		if err := codectool.UnmarshalJSON(raw, &body); err != nil {
+			atomic.AddInt64(&ra.numOfInvalidBody, 1)
+			resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+			if resp == nil {
+				resp, _ = httpprot.NewResponse(nil)
+			}
+			resp.SetStatusCode(http.StatusBadRequest)
+			ctx.SetOutputResponse(resp)
+			ctx.AddTag(stringtool.Cat("requestAdaptor: invalid JSON body: ", err.Error()))
+			return resultInvalidBody
+		}
+	}
+
+	data, err := builder.PrepareBuilderData(ctx)
+	if err == nil {
+		data["body"] = body
+		var buf bytes.Buffer
+		if err = ra.bodyTemplate.Execute(&buf, data); err == nil {
+			req.SetPayload(buf.Bytes())
+			req.ContentLength = int64(buf.Len())
+			req.HTTPHeader().Set(keyContentLength, strconv.Itoa(buf.Len()))
+			req.HTTPHeader().Del(keyContentEncoding)
+			return ""
+		}
+	}
+
+	atomic.AddInt64(&ra.numOfBuildBodyFailed, 1)
+	logger.Errorf("%s: failed to build body: %v", ra.Name(), err)
+	return resultBuildBodyFailed
+}
+
 func (ra *RequestAdaptor) processCompress(req *httpprot.Request) string {
 	encoding := req.HTTPHeader().Get(keyContentEncoding)
 	if encoding != "" {
@@ -371,7 +457,10 @@ func (ra *RequestAdaptor) signRequest(req *httpprot.Request) string {
 
 // Status returns status.
 func (ra *RequestAdaptor) Status() interface{} {
-	return nil
+	return &Status{
+		NumOfInvalidBody:     atomic.LoadInt64(&ra.numOfInvalidBody),
+		NumOfBuildBodyFailed: atomic.LoadInt64(&ra.numOfBuildBodyFailed),
+	}
 }
 
 // Close closes RequestAdaptor.
@@ -22,14 +22,17 @@ import (
 	"compress/gzip"
 	"io"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/builder"
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpheader"
 	"github.com/megaease/easegress/pkg/util/pathadaptor"
+	"github.com/megaease/easegress/pkg/util/signer"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -69,7 +72,7 @@ func TestRequestAdaptor(t *testing.T) {
 		ra := kind.CreateInstance(spec)
 		ra.Init()
 		assert.Equal(Kind, ra.Kind().Name)
-		assert.Nil(ra.Status())
+		assert.Equal(&Status{}, ra.Status())
 		assert.Equal(spec.Name(), ra.Name())
 		assert.Equal(spec, ra.Spec())
 
@@ -108,6 +111,23 @@ func TestRequestAdaptor(t *testing.T) {
 		assert.Nil(spec)
 	}
 
+	{
+		// set body and bodyTemplate
+		spec := defaultFilterSpec(&Spec{
+			Body:         "body",
+			BodyTemplate: &builder.Spec{Template: "{}"},
+		})
+		assert.Nil(spec)
+	}
+
+	{
+		// invalid bodyTemplate
+		spec := defaultFilterSpec(&Spec{
+			BodyTemplate: &builder.Spec{Template: "{{.body"},
+		})
+		assert.Nil(spec)
+	}
+
 	{
 		// unknown API provider
 		spec := defaultFilterSpec(&Spec{
@@ -311,3 +331,48 @@ func TestHandle(t *testing.T) {
 
 	assert.Contains(req.Header.Get("Authorization"), " SignedHeaders=host;x-add;x-amz-date;x-set,")
 }
+
+func TestBodyTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := defaultFilterSpec(&Spec{
+		BodyTemplate: &builder.Spec{
+			Template: `{"tenant": "{{.data.tenant}}", "order": {{toRawJson .body}}}`,
+		},
+		Sign: &SignerSpec{
+			Spec: signer.Spec{
+				AccessKeyID:     "AKID",
+				AccessKeySecret: "SECRET",
+				AccessKeys:      map[string]string{"AKID": "SECRET"},
+			},
+		},
+	})
+	ra := kind.CreateInstance(spec).(*RequestAdaptor)
+	ra.Init()
+
+	ctx := context.New(nil)
+	ctx.SetData("tenant", "megaease")
+	stdReq, _ := http.NewRequest(http.MethodPost, "http://127.0.0.1/orders", strings.NewReader(`{"id":1}`))
+	setRequest(t, ctx, stdReq)
+
+	assert.Equal("", ra.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.JSONEq(`{"tenant":"megaease","order":{"id":1}}`, string(req.RawPayload()))
+	assert.Equal(int64(len(req.RawPayload())), req.ContentLength)
+
+	// the built body is signed.
+	v := signer.CreateFromSpec(&spec.(*Spec).Sign.Spec)
+	err := v.NewVerificationContext().Verify(req.Std(), req.GetPayload)
+	assert.NoError(err)
+
+	// malformed JSON body
+	ctx = context.New(nil)
+	stdReq, _ = http.NewRequest(http.MethodPost, "http://127.0.0.1/orders", strings.NewReader(`{"id":`))
+	setRequest(t, ctx, stdReq)
+	assert.Equal(resultInvalidBody, ra.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	status := ra.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfInvalidBody)
+	assert.Equal(int64(0), status.NumOfBuildBodyFailed)
+}
@@ -0,0 +1,324 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package scriptrouter implements the ScriptRouter filter, which routes
+// requests by the decision of a sandboxed Rego script.
+package scriptrouter
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/open-policy-agent/opa/rego"
+)
+
+const (
+	// Kind is the kind of ScriptRouter.
+	Kind = "ScriptRouter"
+
+	maxResults = 10
+
+	resultResponded   = "responded"
+	resultScriptError = "scriptErr"
+	resultUnknown     = "unknown"
+
+	defaultTimeout = 100 * time.Millisecond
+
+	// query is the query of the routing decision, scripts must define
+	// the rule decision in package router.
+	query = "decision = data.router.decision"
+)
+
+// unsafeBuiltins are the built-in functions not allowed in scripts, as
+// they access the network or the environment.
+var unsafeBuiltins = map[string]struct{}{
+	"http.send":          {},
+	"net.lookup_ip_addr": {},
+	"opa.runtime":        {},
+}
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "ScriptRouter routes requests by the decision of a sandboxed Rego script.",
+	Results:     []string{},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &ScriptRouter{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	results := []string{}
+	for i := 0; i < maxResults; i++ {
+		results = append(results, fmt.Sprintf("result%d", i))
+	}
+	results = append(results, resultResponded, resultScriptError, resultUnknown)
+	kind.Results = results
+
+	filters.Register(kind)
+}
+
+type (
+	// ScriptRouter is filter ScriptRouter.
+	ScriptRouter struct {
+		spec    *Spec
+		query   rego.PreparedEvalQuery
+		timeout time.Duration
+
+		numOfEvaluated int64
+		numOfResponded int64
+		numOfErrors    int64
+		numOfTimeouts  int64
+	}
+
+	// Spec describes the ScriptRouter.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Script   string `json:"script" jsonschema:"required"`
+		Timeout  string `json:"timeout" jsonschema:"omitempty,format=duration"`
+		ReadBody bool   `json:"readBody" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of ScriptRouter.
+	Status struct {
+		NumOfEvaluated int64 `json:"numOfEvaluated"`
+		NumOfResponded int64 `json:"numOfResponded"`
+		NumOfErrors    int64 `json:"numOfErrors"`
+		NumOfTimeouts  int64 `json:"numOfTimeouts"`
+	}
+
+	// decision is the routing decision made by the script.
+	decision struct {
+		Result        string            `json:"result"`
+		SetHeaders    map[string]string `json:"setHeaders"`
+		DeleteHeaders []string          `json:"deleteHeaders"`
+		Response      *response         `json:"response"`
+	}
+
+	// response is the response to short-circuit the request.
+	response struct {
+		StatusCode int               `json:"statusCode"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body"`
+	}
+)
+
+// prepare compiles the script.
+func (spec *Spec) prepare() (rego.PreparedEvalQuery, error) {
+	ctx, cancel := stdcontext.WithTimeout(stdcontext.Background(), 5*time.Second)
+	defer cancel()
+
+	return rego.New(
+		rego.Query(query),
+		rego.Module(spec.Name()+".rego", spec.Script),
+		rego.UnsafeBuiltins(unsafeBuiltins),
+		rego.StrictBuiltinErrors(true),
+	).PrepareForEval(ctx)
+}
+
+// Validate validates the spec, the script is compiled to find out errors.
+func (spec *Spec) Validate() error {
+	if spec.Timeout != "" {
+		if d, err := time.ParseDuration(spec.Timeout); err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", spec.Timeout)
+		}
+	}
+	if _, err := spec.prepare(); err != nil {
+		return fmt.Errorf("invalid script: %v", err)
+	}
+	return nil
+}
+
+var _ filters.Filter = (*ScriptRouter)(nil)
+
+// Name returns the name of the ScriptRouter filter instance.
+func (sr *ScriptRouter) Name() string {
+	return sr.spec.Name()
+}
+
+// Kind returns the kind of ScriptRouter.
+func (sr *ScriptRouter) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the ScriptRouter
+func (sr *ScriptRouter) Spec() filters.Spec {
+	return sr.spec
+}
+
+// Init initializes ScriptRouter.
+func (sr *ScriptRouter) Init() {
+	sr.reload()
+}
+
+// Inherit inherits previous generation of ScriptRouter.
+func (sr *ScriptRouter) Inherit(previousGeneration filters.Filter) {
+	sr.reload()
+}
+
+func (sr *ScriptRouter) reload() {
+	query, err := sr.spec.prepare()
+	if err != nil {
+		// the script has been validated, so this should never happen.
+		panic(fmt.Errorf("failed to compile script: %v", err))
+	}
+	sr.query = query
+
+	sr.timeout, _ = time.ParseDuration(sr.spec.Timeout)
+	if sr.timeout <= 0 {
+		sr.timeout = defaultTimeout
+	}
+}
+
+func (sr *ScriptRouter) buildInput(req *httpprot.Request) map[string]interface{} {
+	headers := map[string]string{}
+	for k, v := range req.HTTPHeader() {
+		headers[k] = strings.Join(v, ", ")
+	}
+
+	body := ""
+	if sr.spec.ReadBody && !req.IsStream() {
+		body = string(req.RawPayload())
+	}
+
+	return map[string]interface{}{
+		"request": map[string]interface{}{
+			"method":     req.Method(),
+			"host":       req.Host(),
+			"path":       req.Path(),
+			"path_parts": strings.Split(strings.Trim(req.Path(), "/"), "/"),
+			"raw_query":  req.URL().RawQuery,
+			"query":      map[string][]string(req.URL().Query()),
+			"headers":    headers,
+			"scheme":     req.Scheme(),
+			"realIP":     req.RealIP(),
+			"body":       body,
+		},
+	}
+}
+
+// evaluate evaluates the script, a nil decision is returned if the script
+// makes no decision for the request.
+func (sr *ScriptRouter) evaluate(req *httpprot.Request) (*decision, error) {
+	ctx, cancel := stdcontext.WithTimeout(req.Context(), sr.timeout)
+	defer cancel()
+
+	rs, err := sr.query.Eval(ctx, rego.EvalInput(sr.buildInput(req)))
+	if err != nil {
+		if ctx.Err() == stdcontext.DeadlineExceeded {
+			atomic.AddInt64(&sr.numOfTimeouts, 1)
+			return nil, fmt.Errorf("timeout")
+		}
+		atomic.AddInt64(&sr.numOfErrors, 1)
+		return nil, err
+	}
+	if len(rs) == 0 {
+		return nil, nil
+	}
+
+	// the decision is converted by JSON to check its fields.
+	data, err := json.Marshal(rs[0].Bindings["decision"])
+	if err == nil {
+		d := &decision{}
+		if err = json.Unmarshal(data, d); err == nil {
+			return d, nil
+		}
+	}
+	atomic.AddInt64(&sr.numOfErrors, 1)
+	return nil, fmt.Errorf("invalid decision: %v", err)
+}
+
+func (sr *ScriptRouter) buildResponse(ctx *context.Context, code int, headers map[string]string, body string) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	for k, v := range headers {
+		resp.HTTPHeader().Set(k, v)
+	}
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+}
+
+// Handle evaluates the script and applies its decision.
+func (sr *ScriptRouter) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	atomic.AddInt64(&sr.numOfEvaluated, 1)
+
+	d, err := sr.evaluate(req)
+	if err != nil {
+		ctx.AddTag("scriptRouter: " + err.Error())
+		sr.buildResponse(ctx, http.StatusInternalServerError, nil, "")
+		return resultScriptError
+	}
+	if d == nil {
+		return ""
+	}
+
+	h := req.HTTPHeader()
+	for _, k := range d.DeleteHeaders {
+		h.Del(k)
+	}
+	for k, v := range d.SetHeaders {
+		h.Set(k, v)
+	}
+
+	if d.Response != nil {
+		code := d.Response.StatusCode
+		if code == 0 {
+			code = http.StatusOK
+		}
+		atomic.AddInt64(&sr.numOfResponded, 1)
+		sr.buildResponse(ctx, code, d.Response.Headers, d.Response.Body)
+		return resultResponded
+	}
+
+	if d.Result == "" {
+		return ""
+	}
+	for i := 0; i < maxResults; i++ {
+		if d.Result == kind.Results[i] {
+			return d.Result
+		}
+	}
+	return resultUnknown
+}
+
+// Status returns status.
+func (sr *ScriptRouter) Status() interface{} {
+	return &Status{
+		NumOfEvaluated: atomic.LoadInt64(&sr.numOfEvaluated),
+		NumOfResponded: atomic.LoadInt64(&sr.numOfResponded),
+		NumOfErrors:    atomic.LoadInt64(&sr.numOfErrors),
+		NumOfTimeouts:  atomic.LoadInt64(&sr.numOfTimeouts),
+	}
+}
+
+// Close closes ScriptRouter.
+func (sr *ScriptRouter) Close() {}
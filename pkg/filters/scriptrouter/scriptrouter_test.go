@@ -0,0 +1,169 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package scriptrouter
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createScriptRouter(t *testing.T, yamlConfig string) *ScriptRouter {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sr := kind.CreateInstance(spec).(*ScriptRouter)
+	sr.Init()
+	return sr
+}
+
+func newContext(t *testing.T, method, url string, header http.Header) *context.Context {
+	stdr, _ := http.NewRequest(method, url, nil)
+	for k, v := range header {
+		stdr.Header[k] = v
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestScriptRouter(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: ScriptRouter
+name: router
+script: |
+  package router
+
+  default tier := "free"
+  tier := "premium" { startswith(input.request.headers["X-Api-Key"], "pk-") }
+
+  decision := {"response": {"statusCode": 403, "body": "forbidden", "headers": {"X-Reason": "blocked"}}} {
+    input.request.path_parts[0] == "admin"
+  } else := {"result": "result1", "setHeaders": {"X-Tier": tier}, "deleteHeaders": ["X-Api-Key"]} {
+    input.request.method == "POST"
+  } else := {"result": "result9x"} {
+    input.request.path == "/unknown"
+  } else := {"result": 1} {
+    input.request.path == "/invalid"
+  } else := {"setHeaders": {"X-Tier": tier}} {
+    input.request.query.debug[0] == "true"
+  }
+`
+	sr := createScriptRouter(t, yamlConfig)
+
+	// short-circuit
+	ctx := newContext(t, http.MethodGet, "http://example.com/admin/users", nil)
+	assert.Equal(resultResponded, sr.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusForbidden, resp.StatusCode())
+	assert.Equal("blocked", resp.HTTPHeader().Get("X-Reason"))
+	assert.Equal("forbidden", string(resp.RawPayload()))
+
+	// route with header rewrites
+	ctx = newContext(t, http.MethodPost, "http://example.com/orders", http.Header{"X-Api-Key": {"pk-123"}})
+	assert.Equal("result1", sr.Handle(ctx))
+	h := ctx.GetInputRequest().(*httpprot.Request).HTTPHeader()
+	assert.Equal("premium", h.Get("X-Tier"))
+	assert.Equal("", h.Get("X-Api-Key"))
+
+	// header rewrites only
+	ctx = newContext(t, http.MethodGet, "http://example.com/orders?debug=true", nil)
+	assert.Equal("", sr.Handle(ctx))
+	assert.Equal("free", ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Get("X-Tier"))
+
+	// no decision
+	ctx = newContext(t, http.MethodGet, "http://example.com/orders", nil)
+	assert.Equal("", sr.Handle(ctx))
+
+	// unknown result
+	ctx = newContext(t, http.MethodGet, "http://example.com/unknown", nil)
+	assert.Equal(resultUnknown, sr.Handle(ctx))
+
+	// invalid decision
+	ctx = newContext(t, http.MethodGet, "http://example.com/invalid", nil)
+	assert.Equal(resultScriptError, sr.Handle(ctx))
+	assert.Equal(http.StatusInternalServerError, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	status := sr.Status().(*Status)
+	assert.Equal(int64(6), status.NumOfEvaluated)
+	assert.Equal(int64(1), status.NumOfResponded)
+	assert.Equal(int64(1), status.NumOfErrors)
+	assert.Equal(int64(0), status.NumOfTimeouts)
+}
+
+func TestScriptRouterTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: ScriptRouter
+name: router
+timeout: 10ms
+script: |
+  package router
+
+  decision := {"result": "result0"} {
+    count([x | x := numbers.range(1, 100000000)[_]; x % 7 == 0]) > 0
+  }
+`
+	sr := createScriptRouter(t, yamlConfig)
+
+	ctx := newContext(t, http.MethodGet, "http://example.com/", nil)
+	assert.Equal(resultScriptError, sr.Handle(ctx))
+	assert.Equal(int64(1), sr.Status().(*Status).NumOfTimeouts)
+}
+
+func TestSpecValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Script: "package router\n\ndecision := {}"}
+	assert.NoError(spec.Validate())
+
+	spec.Timeout = "-1s"
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Script: "package router\n\ndecision := {"}
+	assert.Error(spec.Validate())
+
+	// network access is not allowed
+	spec = &Spec{Script: `package router
+
+decision := {"result": "result0"} {
+  http.send({"method": "get", "url": "http://127.0.0.1"}).status_code == 200
+}`}
+	assert.Error(spec.Validate())
+}
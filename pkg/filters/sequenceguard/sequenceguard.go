@@ -0,0 +1,332 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sequenceguard
+
+import (
+	"container/list"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+const (
+	// Kind is the kind of SequenceGuard.
+	Kind = "SequenceGuard"
+
+	defaultSessionTTL  = 10 * time.Minute
+	defaultMaxSessions = 10000
+
+	resultOutOfOrder = "outOfOrder"
+	resultInvalid    = "invalid"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SequenceGuard rejects requests whose sequence token is not greater than the last one of the session.",
+	Results:     []string{resultOutOfOrder, resultInvalid},
+	Effects:     []string{filters.EffectState},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			SessionTTL:  defaultSessionTTL.String(),
+			MaxSessions: defaultMaxSessions,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SequenceGuard{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SequenceGuard is filter SequenceGuard.
+	SequenceGuard struct {
+		spec       *Spec
+		maxWait    time.Duration
+		sessionTTL time.Duration
+
+		state *state
+
+		// the counters are protected by the lock of the state.
+		numOfAccepted   int64
+		numOfOutOfOrder int64
+		numOfBuffered   int64
+		numOfInvalid    int64
+	}
+
+	// Spec describes the SequenceGuard.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		SessionKey  string `json:"sessionKey" jsonschema:"required"`
+		SequenceKey string `json:"sequenceKey" jsonschema:"required"`
+		MaxWait     string `json:"maxWait" jsonschema:"omitempty,format=duration"`
+		SessionTTL  string `json:"sessionTTL" jsonschema:"omitempty,format=duration"`
+		MaxSessions int    `json:"maxSessions" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of SequenceGuard.
+	Status struct {
+		NumOfSessions   int   `json:"numOfSessions"`
+		NumOfAccepted   int64 `json:"numOfAccepted"`
+		NumOfOutOfOrder int64 `json:"numOfOutOfOrder"`
+		NumOfBuffered   int64 `json:"numOfBuffered"`
+		NumOfInvalid    int64 `json:"numOfInvalid"`
+	}
+
+	// state is the sessions of the filter, it is shared between
+	// generations of the filter, so that the sessions are kept when the
+	// spec is updated, the lock also protects requests still in flight
+	// on the previous generation.
+	state struct {
+		lock     sync.Mutex
+		sessions map[string]*list.Element
+		lru      *list.List
+	}
+
+	// session records the last accepted sequence of a session, changed is
+	// closed and replaced when the sequence is updated, to wake up the
+	// requests buffered for the session.
+	session struct {
+		key      string
+		last     uint64
+		lastSeen time.Time
+		changed  chan struct{}
+	}
+)
+
+var _ filters.Filter = (*SequenceGuard)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for name, v := range map[string]string{"maxWait": spec.MaxWait, "sessionTTL": spec.SessionTTL} {
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d < 0 {
+			return fmt.Errorf("invalid %s %q", name, v)
+		}
+	}
+	if spec.MaxSessions < 0 {
+		return fmt.Errorf("maxSessions must not be negative")
+	}
+	return nil
+}
+
+// Name returns the name of the SequenceGuard filter instance.
+func (sg *SequenceGuard) Name() string {
+	return sg.spec.Name()
+}
+
+// Kind returns the kind of SequenceGuard.
+func (sg *SequenceGuard) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SequenceGuard
+func (sg *SequenceGuard) Spec() filters.Spec {
+	return sg.spec
+}
+
+// Init initializes SequenceGuard.
+func (sg *SequenceGuard) Init() {
+	sg.reload(nil)
+}
+
+// Inherit inherits previous generation of SequenceGuard.
+//
+// The sessions are inherited, otherwise, requests replayed right after
+// the update would be accepted.
+func (sg *SequenceGuard) Inherit(previousGeneration filters.Filter) {
+	sg.reload(previousGeneration.(*SequenceGuard))
+}
+
+func (sg *SequenceGuard) reload(prev *SequenceGuard) {
+	sg.maxWait, _ = time.ParseDuration(sg.spec.MaxWait)
+	sg.sessionTTL, _ = time.ParseDuration(sg.spec.SessionTTL)
+	if sg.sessionTTL <= 0 {
+		sg.sessionTTL = defaultSessionTTL
+	}
+
+	if prev == nil {
+		sg.state = &state{
+			sessions: make(map[string]*list.Element),
+			lru:      list.New(),
+		}
+		return
+	}
+	sg.state = prev.state
+}
+
+func (sg *SequenceGuard) maxSessions() int {
+	if sg.spec.MaxSessions == 0 {
+		return defaultMaxSessions
+	}
+	return sg.spec.MaxSessions
+}
+
+// getSession returns the session of the key, a new session is created if
+// it does not exist or is expired. The caller must hold the lock.
+func (sg *SequenceGuard) getSession(key string, now time.Time) *session {
+	if elem := sg.state.sessions[key]; elem != nil {
+		s := elem.Value.(*session)
+		if now.Sub(s.lastSeen) < sg.sessionTTL {
+			sg.state.lru.MoveToBack(elem)
+			return s
+		}
+		sg.state.lru.Remove(elem)
+		delete(sg.state.sessions, key)
+	}
+
+	sg.evict(now)
+	s := &session{key: key, lastSeen: now, changed: make(chan struct{})}
+	sg.state.sessions[key] = sg.state.lru.PushBack(s)
+	return s
+}
+
+// evict makes room for a new session, expired sessions are removed first,
+// and then the least recently used ones if there are still too many
+// sessions. The caller must hold the lock.
+func (sg *SequenceGuard) evict(now time.Time) {
+	for elem := sg.state.lru.Front(); elem != nil; {
+		s := elem.Value.(*session)
+		if now.Sub(s.lastSeen) < sg.sessionTTL {
+			// sessions are ordered by the last seen time.
+			break
+		}
+		next := elem.Next()
+		sg.state.lru.Remove(elem)
+		delete(sg.state.sessions, s.key)
+		elem = next
+	}
+
+	for sg.state.lru.Len() >= sg.maxSessions() {
+		elem := sg.state.lru.Front()
+		sg.state.lru.Remove(elem)
+		delete(sg.state.sessions, elem.Value.(*session).key)
+	}
+}
+
+// accept checks the sequence against the last accepted one of the
+// session, and records it as the last one if it is greater. If maxWait is
+// configured and there is a gap between the sequence and the last one,
+// the request is buffered until the gap is filled or maxWait elapses.
+func (sg *SequenceGuard) accept(key string, seq uint64) bool {
+	sg.state.lock.Lock()
+	defer sg.state.lock.Unlock()
+
+	var timer *time.Timer
+	timedOut := false
+
+	for {
+		now := fasttime.Now()
+		s := sg.getSession(key, now)
+		s.lastSeen = now
+
+		if s.last != 0 && seq <= s.last {
+			sg.numOfOutOfOrder++
+			return false
+		}
+
+		// the first request of a session is always accepted, as there's no
+		// way to know whether it is the first one the client sends.
+		if s.last == 0 || seq == s.last+1 || sg.maxWait <= 0 || timedOut {
+			s.last = seq
+			close(s.changed)
+			s.changed = make(chan struct{})
+			sg.numOfAccepted++
+			return true
+		}
+
+		if timer == nil {
+			sg.numOfBuffered++
+			timer = time.NewTimer(sg.maxWait)
+			defer timer.Stop()
+		}
+
+		changed := s.changed
+		sg.state.lock.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			timedOut = true
+		}
+		sg.state.lock.Lock()
+	}
+}
+
+func (sg *SequenceGuard) reject(ctx *context.Context, code int, result, reason string) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(code)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("sequenceGuard: " + reason)
+	return result
+}
+
+// Handle rejects the request if its sequence is not greater than the last
+// accepted one of the session.
+func (sg *SequenceGuard) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	key := req.HTTPHeader().Get(sg.spec.SessionKey)
+	if key == "" {
+		return ""
+	}
+
+	v := req.HTTPHeader().Get(sg.spec.SequenceKey)
+	seq, err := strconv.ParseUint(v, 10, 64)
+	if err != nil || seq == 0 {
+		sg.state.lock.Lock()
+		sg.numOfInvalid++
+		sg.state.lock.Unlock()
+		return sg.reject(ctx, http.StatusBadRequest, resultInvalid, fmt.Sprintf("invalid sequence %q", v))
+	}
+
+	if !sg.accept(key, seq) {
+		return sg.reject(ctx, http.StatusConflict, resultOutOfOrder, fmt.Sprintf("sequence %d of session %s is out of order", seq, key))
+	}
+	return ""
+}
+
+// Status returns status.
+func (sg *SequenceGuard) Status() interface{} {
+	sg.state.lock.Lock()
+	defer sg.state.lock.Unlock()
+
+	return &Status{
+		NumOfSessions:   sg.state.lru.Len(),
+		NumOfAccepted:   sg.numOfAccepted,
+		NumOfOutOfOrder: sg.numOfOutOfOrder,
+		NumOfBuffered:   sg.numOfBuffered,
+		NumOfInvalid:    sg.numOfInvalid,
+	}
+}
+
+// Close closes SequenceGuard.
+func (sg *SequenceGuard) Close() {}
@@ -0,0 +1,226 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package sequenceguard
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createGuard(t *testing.T, yamlConfig string) *SequenceGuard {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sg := kind.CreateInstance(spec).(*SequenceGuard)
+	sg.Init()
+	return sg
+}
+
+func handle(t *testing.T, sg *SequenceGuard, session string, seq string) (string, *context.Context) {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/", nil)
+	stdr.Header.Set("X-Session", session)
+	stdr.Header.Set("X-Seq", seq)
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return sg.Handle(ctx), ctx
+}
+
+func TestSequenceGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	sg := createGuard(t, `
+name: guard
+kind: SequenceGuard
+sessionKey: X-Session
+sequenceKey: X-Seq
+`)
+
+	result, _ := handle(t, sg, "a", "1")
+	assert.Equal("", result)
+	result, _ = handle(t, sg, "a", "3")
+	assert.Equal("", result)
+
+	// replayed or late requests are rejected
+	for _, seq := range []string{"3", "2"} {
+		result, ctx := handle(t, sg, "a", seq)
+		assert.Equal(resultOutOfOrder, result)
+		assert.Equal(http.StatusConflict, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+	}
+
+	// sessions are independent
+	result, _ = handle(t, sg, "b", "2")
+	assert.Equal("", result)
+
+	result, ctx := handle(t, sg, "a", "abc")
+	assert.Equal(resultInvalid, result)
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// requests without session are not checked
+	result, _ = handle(t, sg, "", "")
+	assert.Equal("", result)
+
+	status := sg.Status().(*Status)
+	assert.Equal(2, status.NumOfSessions)
+	assert.Equal(int64(3), status.NumOfAccepted)
+	assert.Equal(int64(2), status.NumOfOutOfOrder)
+	assert.Equal(int64(1), status.NumOfInvalid)
+}
+
+func TestBuffering(t *testing.T) {
+	assert := assert.New(t)
+
+	sg := createGuard(t, `
+name: guard
+kind: SequenceGuard
+sessionKey: X-Session
+sequenceKey: X-Seq
+maxWait: 1s
+`)
+
+	result, _ := handle(t, sg, "a", "1")
+	assert.Equal("", result)
+
+	// 3 arrives before 2, it is buffered until 2 is accepted
+	done := make(chan string)
+	go func() {
+		result, _ := handle(t, sg, "a", "3")
+		done <- result
+	}()
+	assert.Eventually(func() bool {
+		return sg.Status().(*Status).NumOfBuffered == 1
+	}, time.Second, time.Millisecond)
+
+	result, _ = handle(t, sg, "a", "2")
+	assert.Equal("", result)
+	assert.Equal("", <-done)
+
+	// the gap is never filled, the request is accepted after maxWait
+	sg.maxWait = 10 * time.Millisecond
+	start := time.Now()
+	result, _ = handle(t, sg, "a", "5")
+	assert.Equal("", result)
+	assert.GreaterOrEqual(time.Since(start), 10*time.Millisecond)
+
+	result, _ = handle(t, sg, "a", "4")
+	assert.Equal(resultOutOfOrder, result)
+}
+
+func TestBounded(t *testing.T) {
+	assert := assert.New(t)
+
+	sg := createGuard(t, `
+name: guard
+kind: SequenceGuard
+sessionKey: X-Session
+sequenceKey: X-Seq
+maxSessions: 2
+sessionTTL: 1m
+`)
+
+	for i := 0; i < 5; i++ {
+		handle(t, sg, fmt.Sprintf("s%d", i), strconv.Itoa(i+1))
+	}
+	assert.Equal(2, sg.Status().(*Status).NumOfSessions)
+	assert.Nil(sg.state.sessions["s0"])
+	assert.NotNil(sg.state.sessions["s4"])
+
+	// expired sessions start over
+	now := time.Now().Add(2 * time.Minute)
+	s := sg.getSession("s4", now)
+	assert.Equal(uint64(0), s.last)
+	assert.Equal(1, sg.state.lru.Len())
+
+	// sessions are inherited
+	sg2 := createGuard(t, `
+name: guard
+kind: SequenceGuard
+sessionKey: X-Session
+sequenceKey: X-Seq
+`)
+	sg2.Inherit(sg)
+	assert.Equal(1, sg2.Status().(*Status).NumOfSessions)
+}
+
+func TestInheritConcurrently(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+name: guard
+kind: SequenceGuard
+sessionKey: X-Session
+sequenceKey: X-Seq
+maxWait: 20ms
+maxSessions: 5
+`
+	sg := createGuard(t, yamlConfig)
+	sg2 := createGuard(t, yamlConfig)
+
+	// requests in flight on the previous generation, including buffered
+	// ones, run concurrently with requests on the new generation.
+	var wg sync.WaitGroup
+	run := func(guard *SequenceGuard, offset int) {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 1; j <= 20; j++ {
+					handle(t, guard, fmt.Sprintf("s%d", j%7), strconv.Itoa(j*2+offset))
+				}
+			}()
+		}
+	}
+	run(sg, 0)
+	sg2.Inherit(sg)
+	run(sg2, 1)
+	wg.Wait()
+
+	assert.Same(sg.state, sg2.state)
+	assert.LessOrEqual(sg2.Status().(*Status).NumOfSessions, 5)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Error((&Spec{MaxWait: "abc"}).Validate())
+	assert.Error((&Spec{SessionTTL: "-1s"}).Validate())
+	assert.Error((&Spec{MaxSessions: -1}).Validate())
+	assert.NoError((&Spec{MaxWait: "100ms"}).Validate())
+}
@@ -0,0 +1,237 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package smugglingguard implements the SmugglingGuard filter, which
+// rejects requests with ambiguous message framing.
+package smugglingguard
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of SmugglingGuard.
+	Kind = "SmugglingGuard"
+
+	resultBlocked = "blocked"
+
+	reasonConflictingContentLength = "conflictingContentLength"
+	reasonInvalidContentLength     = "invalidContentLength"
+	reasonTransferEncoding         = "transferEncoding"
+	reasonLengthMismatch           = "lengthMismatch"
+	reasonConnectionHeader         = "connectionHeader"
+	reasonEmbeddedRequest          = "embeddedRequest"
+)
+
+var reasons = []string{
+	reasonConflictingContentLength,
+	reasonInvalidContentLength,
+	reasonTransferEncoding,
+	reasonLengthMismatch,
+	reasonConnectionHeader,
+	reasonEmbeddedRequest,
+}
+
+// reEmbeddedRequest matches an HTTP/1.x request line at the beginning of
+// a line, which is the sign of a request smuggled in the body.
+var reEmbeddedRequest = regexp.MustCompile(`(?m)^(?:GET|HEAD|POST|PUT|DELETE|CONNECT|OPTIONS|TRACE|PATCH) \S+ HTTP/1\.[01]\r?$`)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SmugglingGuard rejects requests with ambiguous message framing to prevent request smuggling.",
+	Results:     []string{resultBlocked},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SmugglingGuard{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SmugglingGuard is filter SmugglingGuard.
+	SmugglingGuard struct {
+		spec *Spec
+
+		// counters of the reasons, the map is read only after
+		// initialization.
+		blocked map[string]*int64
+	}
+
+	// Spec describes the SmugglingGuard.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		InspectBody bool `json:"inspectBody" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of SmugglingGuard.
+	Status struct {
+		NumOfBlocked int64            `json:"numOfBlocked"`
+		Reasons      map[string]int64 `json:"reasons"`
+	}
+)
+
+var _ filters.Filter = (*SmugglingGuard)(nil)
+
+// Name returns the name of the SmugglingGuard filter instance.
+func (sg *SmugglingGuard) Name() string {
+	return sg.spec.Name()
+}
+
+// Kind returns the kind of SmugglingGuard.
+func (sg *SmugglingGuard) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SmugglingGuard
+func (sg *SmugglingGuard) Spec() filters.Spec {
+	return sg.spec
+}
+
+// Init initializes SmugglingGuard.
+func (sg *SmugglingGuard) Init() {
+	sg.blocked = make(map[string]*int64, len(reasons))
+	for _, r := range reasons {
+		sg.blocked[r] = new(int64)
+	}
+}
+
+// Inherit inherits previous generation of SmugglingGuard.
+func (sg *SmugglingGuard) Inherit(previousGeneration filters.Filter) {
+	sg.Init()
+}
+
+// Handle rejects the request if its framing is ambiguous.
+func (sg *SmugglingGuard) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	reason := sg.check(req)
+	if reason == "" {
+		return ""
+	}
+
+	atomic.AddInt64(sg.blocked[reason], 1)
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusBadRequest)
+	// the connection could be out of sync with the client, so it must not
+	// be reused.
+	resp.HTTPHeader().Set("Connection", "close")
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("smugglingGuard: " + reason)
+	return resultBlocked
+}
+
+// check returns the reason why the framing of the request is ambiguous,
+// or an empty string if it is not.
+func (sg *SmugglingGuard) check(req *httpprot.Request) string {
+	stdr := req.Std()
+	h := stdr.Header
+
+	// the framing headers could be removed by a proxy if they are listed
+	// in the Connection header.
+	for _, v := range h.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			switch strings.ToLower(strings.TrimSpace(token)) {
+			case "content-length", "transfer-encoding":
+				return reasonConnectionHeader
+			}
+		}
+	}
+
+	// the HTTP/1 server of Go deduplicates Content-Length and rejects
+	// conflicting ones, but other protocols may not.
+	cls := h.Values("Content-Length")
+	if len(cls) > 1 {
+		return reasonConflictingContentLength
+	}
+	contentLength := int64(-1)
+	if len(cls) == 1 {
+		if !isDigits(cls[0]) {
+			return reasonInvalidContentLength
+		}
+		n, err := strconv.ParseInt(cls[0], 10, 64)
+		if err != nil {
+			return reasonInvalidContentLength
+		}
+		contentLength = n
+	}
+
+	// the Transfer-Encoding header is consumed by the HTTP/1 server of Go,
+	// so it is suspicious if it is still there.
+	if len(h.Values("Transfer-Encoding")) > 0 {
+		return reasonTransferEncoding
+	}
+	if len(stdr.TransferEncoding) > 0 && (len(cls) > 0 || stdr.ProtoMajor != 1) {
+		return reasonTransferEncoding
+	}
+
+	if req.IsStream() {
+		return ""
+	}
+
+	body := req.RawPayload()
+	if contentLength >= 0 && int64(len(body)) != contentLength {
+		return reasonLengthMismatch
+	}
+	if sg.spec.InspectBody && reEmbeddedRequest.Match(body) {
+		return reasonEmbeddedRequest
+	}
+
+	return ""
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Status returns status.
+func (sg *SmugglingGuard) Status() interface{} {
+	s := &Status{Reasons: make(map[string]int64, len(sg.blocked))}
+	for r, n := range sg.blocked {
+		v := atomic.LoadInt64(n)
+		s.Reasons[r] = v
+		s.NumOfBlocked += v
+	}
+	return s
+}
+
+// Close closes SmugglingGuard.
+func (sg *SmugglingGuard) Close() {}
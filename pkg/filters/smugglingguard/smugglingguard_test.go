@@ -0,0 +1,137 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package smugglingguard
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createSmugglingGuard(t *testing.T, yamlConfig string) *SmugglingGuard {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sg := kind.CreateInstance(spec).(*SmugglingGuard)
+	sg.Init()
+	return sg
+}
+
+func newContext(t *testing.T, stdr *http.Request) *context.Context {
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func readRequest(t *testing.T, raw string) *http.Request {
+	stdr, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	assert.NoError(t, err)
+	return stdr
+}
+
+func TestSmugglingGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: SmugglingGuard
+name: guard
+inspectBody: true
+`
+	sg := createSmugglingGuard(t, yamlConfig)
+
+	check := func(stdr *http.Request, reason string) {
+		ctx := newContext(t, stdr)
+		if reason == "" {
+			assert.Equal("", sg.Handle(ctx))
+			return
+		}
+		assert.Equal(resultBlocked, sg.Handle(ctx))
+		resp := ctx.GetOutputResponse().(*httpprot.Response)
+		assert.Equal(http.StatusBadRequest, resp.StatusCode())
+		assert.Equal("close", resp.HTTPHeader().Get("Connection"))
+		assert.Contains(ctx.Tags(), reason)
+	}
+
+	// normal requests
+	check(readRequest(t, "POST /orders HTTP/1.1\r\nHost: a\r\nContent-Length: 5\r\n\r\nhello"), "")
+	check(readRequest(t, "POST /orders HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"), "")
+	check(readRequest(t, "GET /orders HTTP/1.1\r\nHost: a\r\nConnection: keep-alive\r\n\r\n"), "")
+
+	// the Content-Length is removed by the parser if the request is chunked
+	check(readRequest(t, "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n"), "")
+
+	// the framing headers are hop-by-hop
+	check(readRequest(t, "POST / HTTP/1.1\r\nHost: a\r\nConnection: keep-alive, Content-Length\r\nContent-Length: 5\r\n\r\nhello"), reasonConnectionHeader)
+
+	// smuggled request in the body
+	check(readRequest(t, "POST / HTTP/1.1\r\nHost: a\r\nTransfer-Encoding: chunked\r\n\r\n"+
+		"20\r\nx=1\r\nGET /admin HTTP/1.1\r\nFoo: x\r\n0\r\n\r\n"), reasonEmbeddedRequest)
+
+	// requests from other protocols
+	stdr, _ := http.NewRequest(http.MethodPost, "http://a/", strings.NewReader("hello"))
+	stdr.Header["Content-Length"] = []string{"5", "5"}
+	check(stdr, reasonConflictingContentLength)
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://a/", strings.NewReader("hello"))
+	stdr.Header.Set("Content-Length", "+5")
+	check(stdr, reasonInvalidContentLength)
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://a/", strings.NewReader("hello"))
+	stdr.Header.Set("Content-Length", "5")
+	stdr.Header.Set("Transfer-Encoding", "chunked")
+	check(stdr, reasonTransferEncoding)
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://a/", strings.NewReader("hello"))
+	stdr.ProtoMajor = 2
+	stdr.TransferEncoding = []string{"chunked"}
+	check(stdr, reasonTransferEncoding)
+
+	stdr, _ = http.NewRequest(http.MethodPost, "http://a/", strings.NewReader("hello"))
+	stdr.Header.Set("Content-Length", "3")
+	check(stdr, reasonLengthMismatch)
+
+	status := sg.Status().(*Status)
+	assert.Equal(int64(7), status.NumOfBlocked)
+	assert.Equal(int64(2), status.Reasons[reasonTransferEncoding])
+	assert.Equal(int64(1), status.Reasons[reasonEmbeddedRequest])
+
+	// body is not inspected by default
+	sg = createSmugglingGuard(t, "kind: SmugglingGuard\nname: guard")
+	check(readRequest(t, "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: 25\r\n\r\nGET /admin HTTP/1.1\r\nFoo: "), "")
+}
@@ -0,0 +1,311 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of SOAPAdaptor.
+	Kind = "SOAPAdaptor"
+
+	version11 = "1.1"
+	version12 = "1.2"
+
+	keyContentLength = "Content-Length"
+	keyContentType   = "Content-Type"
+
+	resultInvalidRequest  = "invalidRequest"
+	resultInvalidResponse = "invalidResponse"
+	resultFault           = "fault"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "SOAPAdaptor translates JSON requests to SOAP requests, and SOAP responses back to JSON responses.",
+	Results:     []string{resultInvalidRequest, resultInvalidResponse, resultFault},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			Version: version11,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &SOAPAdaptor{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// SOAPAdaptor is filter SOAPAdaptor.
+	SOAPAdaptor struct {
+		spec       *Spec
+		operations map[string]*OperationSpec
+
+		numOfTranslated     int64
+		numOfFaults         int64
+		numOfRequestErrors  int64
+		numOfResponseErrors int64
+	}
+
+	// Spec describes the SOAPAdaptor.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Version    string           `json:"version" jsonschema:"omitempty,enum=,enum=1.1,enum=1.2"`
+		Operations []*OperationSpec `json:"operations" jsonschema:"required"`
+	}
+
+	// OperationSpec maps a REST endpoint to a SOAP operation.
+	OperationSpec struct {
+		Method     string `json:"method" jsonschema:"omitempty,format=httpmethod"`
+		Path       string `json:"path" jsonschema:"required"`
+		Name       string `json:"name" jsonschema:"required"`
+		Namespace  string `json:"namespace" jsonschema:"omitempty"`
+		SOAPAction string `json:"soapAction" jsonschema:"omitempty"`
+		Endpoint   string `json:"endpoint" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of SOAPAdaptor.
+	Status struct {
+		NumOfTranslated     int64 `json:"numOfTranslated"`
+		NumOfFaults         int64 `json:"numOfFaults"`
+		NumOfRequestErrors  int64 `json:"numOfRequestErrors"`
+		NumOfResponseErrors int64 `json:"numOfResponseErrors"`
+	}
+)
+
+var _ filters.Filter = (*SOAPAdaptor)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	keys := map[string]struct{}{}
+	for i, op := range spec.Operations {
+		if !isValidName(op.Name) {
+			return fmt.Errorf("operation %d: invalid name %q", i, op.Name)
+		}
+		key := op.Method + " " + op.Path
+		if _, ok := keys[key]; ok {
+			return fmt.Errorf("operation %d: duplicated method and path", i)
+		}
+		keys[key] = struct{}{}
+	}
+	return nil
+}
+
+// Name returns the name of the SOAPAdaptor filter instance.
+func (sa *SOAPAdaptor) Name() string {
+	return sa.spec.Name()
+}
+
+// Kind returns the kind of SOAPAdaptor.
+func (sa *SOAPAdaptor) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the SOAPAdaptor
+func (sa *SOAPAdaptor) Spec() filters.Spec {
+	return sa.spec
+}
+
+// Init initializes SOAPAdaptor.
+func (sa *SOAPAdaptor) Init() {
+	sa.reload()
+}
+
+// Inherit inherits previous generation of SOAPAdaptor.
+func (sa *SOAPAdaptor) Inherit(previousGeneration filters.Filter) {
+	sa.reload()
+}
+
+func (sa *SOAPAdaptor) reload() {
+	sa.operations = make(map[string]*OperationSpec, len(sa.spec.Operations))
+	for _, op := range sa.spec.Operations {
+		sa.operations[op.Method+" "+op.Path] = op
+	}
+}
+
+// dataKey is the key of the context data to record the operation of the
+// request, so that the filter knows the response should be translated
+// when it is called again.
+func (sa *SOAPAdaptor) dataKey() string {
+	return "SOAP_ADAPTOR/" + sa.Name()
+}
+
+func (sa *SOAPAdaptor) match(req *httpprot.Request) *OperationSpec {
+	if op := sa.operations[req.Method()+" "+req.Path()]; op != nil {
+		return op
+	}
+	return sa.operations[" "+req.Path()]
+}
+
+func setRequestBody(req *httpprot.Request, data []byte) {
+	req.SetPayload(data)
+	req.ContentLength = int64(len(data))
+	req.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+}
+
+func setResponseBody(resp *httpprot.Response, data []byte) {
+	resp.SetPayload(data)
+	resp.ContentLength = int64(len(data))
+	resp.HTTPHeader().Set(keyContentLength, strconv.Itoa(len(data)))
+}
+
+func buildErrorResponse(ctx *context.Context, code int, err error) {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"message": err.Error()},
+	})
+	resp.SetStatusCode(code)
+	resp.HTTPHeader().Set(keyContentType, "application/json")
+	setResponseBody(resp, data)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag("soapAdaptor: " + err.Error())
+}
+
+// Handle translates the request to a SOAP request when it is called the
+// first time in a pipeline, and translates the response back to JSON when
+// it is called again after the backend.
+func (sa *SOAPAdaptor) Handle(ctx *context.Context) string {
+	if op, ok := ctx.GetData(sa.dataKey()).(*OperationSpec); ok {
+		return sa.handleResponse(ctx, op)
+	}
+	return sa.handleRequest(ctx)
+}
+
+func (sa *SOAPAdaptor) handleRequest(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	op := sa.match(req)
+	if op == nil {
+		return ""
+	}
+
+	if req.IsStream() {
+		atomic.AddInt64(&sa.numOfRequestErrors, 1)
+		buildErrorResponse(ctx, http.StatusBadRequest, fmt.Errorf("stream request is not supported"))
+		return resultInvalidRequest
+	}
+
+	args := map[string]interface{}{}
+	if raw := bytes.TrimSpace(req.RawPayload()); len(raw) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(raw))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			atomic.AddInt64(&sa.numOfRequestErrors, 1)
+			buildErrorResponse(ctx, http.StatusBadRequest, fmt.Errorf("invalid JSON body: %v", err))
+			return resultInvalidRequest
+		}
+	}
+
+	data, err := buildEnvelope(sa.spec.Version, op.Name, op.Namespace, args)
+	if err != nil {
+		atomic.AddInt64(&sa.numOfRequestErrors, 1)
+		buildErrorResponse(ctx, http.StatusBadRequest, err)
+		return resultInvalidRequest
+	}
+
+	h := req.HTTPHeader()
+	if sa.spec.Version == version12 {
+		ct := "application/soap+xml; charset=utf-8"
+		if op.SOAPAction != "" {
+			ct += "; action=" + strconv.Quote(op.SOAPAction)
+		}
+		h.Set(keyContentType, ct)
+	} else {
+		h.Set(keyContentType, "text/xml; charset=utf-8")
+		h.Set("SOAPAction", strconv.Quote(op.SOAPAction))
+	}
+	h.Set("Accept", "text/xml, application/soap+xml")
+	h.Del("Content-Encoding")
+
+	req.SetMethod(http.MethodPost)
+	if op.Endpoint != "" {
+		req.SetPath(op.Endpoint)
+	}
+	setRequestBody(req, data)
+
+	ctx.SetData(sa.dataKey(), op)
+	return ""
+}
+
+func (sa *SOAPAdaptor) handleResponse(ctx *context.Context, op *OperationSpec) string {
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		return ""
+	}
+
+	if resp.IsStream() {
+		atomic.AddInt64(&sa.numOfResponseErrors, 1)
+		buildErrorResponse(ctx, http.StatusBadGateway, fmt.Errorf("stream response is not supported"))
+		return resultInvalidResponse
+	}
+
+	elem, fault, err := parseEnvelope(bytes.NewReader(resp.RawPayload()))
+	if err != nil {
+		logger.Errorf("%s: failed to parse SOAP response of %s: %v", sa.Name(), op.Name, err)
+		atomic.AddInt64(&sa.numOfResponseErrors, 1)
+		buildErrorResponse(ctx, http.StatusBadGateway, fmt.Errorf("invalid SOAP response: %v", err))
+		return resultInvalidResponse
+	}
+
+	resp.HTTPHeader().Set(keyContentType, "application/json")
+	resp.HTTPHeader().Del("Content-Encoding")
+
+	if fault != nil {
+		atomic.AddInt64(&sa.numOfFaults, 1)
+		resp.SetStatusCode(fault.statusCode())
+		setResponseBody(resp, fault.marshal())
+		ctx.AddTag("soapAdaptor: fault " + fault.code)
+		return resultFault
+	}
+
+	data, _ := json.Marshal(elem.childrenToJSON())
+	resp.SetStatusCode(http.StatusOK)
+	setResponseBody(resp, data)
+	atomic.AddInt64(&sa.numOfTranslated, 1)
+	return ""
+}
+
+// Status returns status.
+func (sa *SOAPAdaptor) Status() interface{} {
+	return &Status{
+		NumOfTranslated:     atomic.LoadInt64(&sa.numOfTranslated),
+		NumOfFaults:         atomic.LoadInt64(&sa.numOfFaults),
+		NumOfRequestErrors:  atomic.LoadInt64(&sa.numOfRequestErrors),
+		NumOfResponseErrors: atomic.LoadInt64(&sa.numOfResponseErrors),
+	}
+}
+
+// Close closes SOAPAdaptor.
+func (sa *SOAPAdaptor) Close() {}
@@ -0,0 +1,197 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createAdaptor(t *testing.T, yamlConfig string) *SOAPAdaptor {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	sa := kind.CreateInstance(spec).(*SOAPAdaptor)
+	sa.Init()
+	return sa
+}
+
+func newContext(t *testing.T, method, path, body string) *context.Context {
+	stdr, _ := http.NewRequest(method, "http://example.com"+path, strings.NewReader(body))
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	assert.NoError(t, req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func setBackendResponse(ctx *context.Context, code int, body string) {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(code)
+	resp.HTTPHeader().Set("Content-Type", "text/xml")
+	resp.SetPayload([]byte(body))
+	ctx.SetOutputResponse(resp)
+}
+
+const yamlConfig = `
+name: soap
+kind: SOAPAdaptor
+operations:
+- method: POST
+  path: /users
+  name: GetUser
+  namespace: http://example.com/users
+  soapAction: http://example.com/users/GetUser
+  endpoint: /soap/users
+`
+
+func TestSOAPAdaptor(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := createAdaptor(t, yamlConfig)
+
+	// unmatched requests are not touched
+	ctx := newContext(t, http.MethodGet, "/users", "")
+	assert.Equal("", sa.Handle(ctx))
+	assert.Equal(http.MethodGet, ctx.GetInputRequest().(*httpprot.Request).Method())
+
+	ctx = newContext(t, http.MethodPost, "/users", `{"id": 1, "tags": ["a", "b<"], "name": {"first": "x"}}`)
+	assert.Equal("", sa.Handle(ctx))
+
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal("/soap/users", req.Path())
+	assert.Equal(`"http://example.com/users/GetUser"`, req.HTTPHeader().Get("SOAPAction"))
+	assert.Equal("text/xml; charset=utf-8", req.HTTPHeader().Get("Content-Type"))
+	assert.Contains(string(req.RawPayload()),
+		`<soap:Body><GetUser xmlns="http://example.com/users"><id>1</id><name><first>x</first></name><tags>a</tags><tags>b&lt;</tags></GetUser></soap:Body>`)
+
+	setBackendResponse(ctx, http.StatusOK, `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <GetUserResponse xmlns="http://example.com/users">
+      <name>Alice</name>
+      <roles>admin</roles>
+      <roles>dev</roles>
+    </GetUserResponse>
+  </soap:Body>
+</soap:Envelope>`)
+	assert.Equal("", sa.Handle(ctx))
+
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal("application/json", resp.HTTPHeader().Get("Content-Type"))
+	body := map[string]interface{}{}
+	assert.NoError(json.Unmarshal(resp.RawPayload(), &body))
+	assert.Equal("Alice", body["name"])
+	assert.Equal([]interface{}{"admin", "dev"}, body["roles"])
+
+	// fault
+	ctx = newContext(t, http.MethodPost, "/users", `{"id": 2}`)
+	assert.Equal("", sa.Handle(ctx))
+	setBackendResponse(ctx, http.StatusInternalServerError, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <soap:Fault>
+      <faultcode>soap:Client</faultcode>
+      <faultstring>user not found</faultstring>
+      <detail><id>2</id></detail>
+    </soap:Fault>
+  </soap:Body>
+</soap:Envelope>`)
+	assert.Equal(resultFault, sa.Handle(ctx))
+	resp = ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusBadRequest, resp.StatusCode())
+	assert.JSONEq(`{"error": {"code": "soap:Client", "message": "user not found", "detail": {"id": "2"}}}`, string(resp.RawPayload()))
+
+	// invalid response
+	ctx = newContext(t, http.MethodPost, "/users", ``)
+	assert.Equal("", sa.Handle(ctx))
+	setBackendResponse(ctx, http.StatusBadGateway, `bad gateway`)
+	assert.Equal(resultInvalidResponse, sa.Handle(ctx))
+	assert.Equal(http.StatusBadGateway, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// invalid request
+	ctx = newContext(t, http.MethodPost, "/users", `{"id":`)
+	assert.Equal(resultInvalidRequest, sa.Handle(ctx))
+	assert.Equal(http.StatusBadRequest, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	ctx = newContext(t, http.MethodPost, "/users", `{"1id": 1}`)
+	assert.Equal(resultInvalidRequest, sa.Handle(ctx))
+
+	status := sa.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfTranslated)
+	assert.Equal(int64(1), status.NumOfFaults)
+	assert.Equal(int64(2), status.NumOfRequestErrors)
+	assert.Equal(int64(1), status.NumOfResponseErrors)
+}
+
+func TestSOAP12(t *testing.T) {
+	assert := assert.New(t)
+
+	sa := createAdaptor(t, yamlConfig+"version: \"1.2\"\n")
+
+	ctx := newContext(t, http.MethodPost, "/users", `{}`)
+	assert.Equal("", sa.Handle(ctx))
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	assert.Equal(`application/soap+xml; charset=utf-8; action="http://example.com/users/GetUser"`, req.HTTPHeader().Get("Content-Type"))
+	assert.Contains(string(req.RawPayload()), namespaceSOAP12)
+
+	setBackendResponse(ctx, http.StatusInternalServerError, `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Body>
+    <env:Fault>
+      <env:Code><env:Value>env:Receiver</env:Value></env:Code>
+      <env:Reason><env:Text xml:lang="en">database down</env:Text></env:Reason>
+    </env:Fault>
+  </env:Body>
+</env:Envelope>`)
+	assert.Equal(resultFault, sa.Handle(ctx))
+	resp := ctx.GetOutputResponse().(*httpprot.Response)
+	assert.Equal(http.StatusBadGateway, resp.StatusCode())
+	assert.JSONEq(`{"error": {"code": "env:Receiver", "message": "database down"}}`, string(resp.RawPayload()))
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{Operations: []*OperationSpec{{Path: "/a", Name: "1a"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Operations: []*OperationSpec{{Path: "/a", Name: "A"}, {Path: "/a", Name: "B"}}}
+	assert.Error(spec.Validate())
+
+	spec = &Spec{Operations: []*OperationSpec{{Path: "/a", Name: "A"}, {Method: "GET", Path: "/a", Name: "B"}}}
+	assert.NoError(spec.Validate())
+}
@@ -0,0 +1,308 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package soapadaptor
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	json "github.com/goccy/go-json"
+)
+
+const (
+	namespaceSOAP11 = "http://schemas.xmlsoap.org/soap/envelope/"
+	namespaceSOAP12 = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+type (
+	// xmlNode is a generic XML element.
+	xmlNode struct {
+		name     xml.Name
+		children []*xmlNode
+		text     strings.Builder
+	}
+
+	// soapFault is a SOAP fault, of either SOAP 1.1 or 1.2.
+	soapFault struct {
+		code    string
+		message string
+		detail  interface{}
+	}
+)
+
+// isValidName reports whether s could be used as an XML element name.
+func isValidName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if unicode.IsLetter(r) || r == '_' {
+			continue
+		}
+		if i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.') {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// writeElement writes v as element name, objects are written as child
+// elements in the order of their keys, and arrays as repeated elements.
+func writeElement(buf *bytes.Buffer, name string, v interface{}) error {
+	if !isValidName(name) {
+		return fmt.Errorf("invalid element name %q", name)
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			if err := writeElement(buf, name, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case nil:
+		buf.WriteString("<" + name + "/>")
+		return nil
+	}
+
+	buf.WriteString("<" + name + ">")
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if err := writeChildren(buf, v); err != nil {
+			return err
+		}
+	case string:
+		xml.EscapeText(buf, []byte(v))
+	default:
+		// json.Number and bool
+		fmt.Fprint(buf, v)
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+func writeChildren(buf *bytes.Buffer, m map[string]interface{}) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := writeElement(buf, k, m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildEnvelope builds a SOAP envelope whose body is the operation
+// element, with the fields of args as its children.
+func buildEnvelope(version, operation, namespace string, args map[string]interface{}) ([]byte, error) {
+	ns := namespaceSOAP11
+	if version == version12 {
+		ns = namespaceSOAP12
+	}
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + ns + `"><soap:Body>`)
+
+	if namespace == "" {
+		buf.WriteString("<" + operation + ">")
+	} else {
+		buf.WriteString("<" + operation + ` xmlns="`)
+		xml.EscapeText(buf, []byte(namespace))
+		buf.WriteString(`">`)
+	}
+	if err := writeChildren(buf, args); err != nil {
+		return nil, err
+	}
+	buf.WriteString("</" + operation + "></soap:Body></soap:Envelope>")
+
+	return buf.Bytes(), nil
+}
+
+// parseXML parses the XML document into a tree of xmlNode.
+func parseXML(r io.Reader) (*xmlNode, error) {
+	decoder := xml.NewDecoder(r)
+
+	var root *xmlNode
+	var stack []*xmlNode
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: t.Name}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			} else {
+				return nil, fmt.Errorf("multiple root elements")
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text.Write(t)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("empty document")
+	}
+	return root, nil
+}
+
+func (n *xmlNode) child(local string) *xmlNode {
+	for _, c := range n.children {
+		if c.name.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// toJSON converts the element to a JSON value, elements with children are
+// converted to objects, repeated children to arrays, and others to strings.
+func (n *xmlNode) toJSON() interface{} {
+	if len(n.children) == 0 {
+		return strings.TrimSpace(n.text.String())
+	}
+	return n.childrenToJSON()
+}
+
+func (n *xmlNode) childrenToJSON() map[string]interface{} {
+	m := make(map[string]interface{}, len(n.children))
+	for _, c := range n.children {
+		v := c.toJSON()
+		switch old := m[c.name.Local].(type) {
+		case nil:
+			m[c.name.Local] = v
+		case []interface{}:
+			m[c.name.Local] = append(old, v)
+		default:
+			m[c.name.Local] = []interface{}{old, v}
+		}
+	}
+	return m
+}
+
+// parseEnvelope parses a SOAP envelope, and returns the first element of
+// the body, or the fault if the body is a fault.
+func parseEnvelope(r io.Reader) (*xmlNode, *soapFault, error) {
+	root, err := parseXML(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.name.Local != "Envelope" {
+		return nil, nil, fmt.Errorf("root element is %s, not Envelope", root.name.Local)
+	}
+
+	body := root.child("Body")
+	if body == nil {
+		return nil, nil, fmt.Errorf("no Body in the envelope")
+	}
+	if len(body.children) == 0 {
+		return &xmlNode{}, nil, nil
+	}
+
+	elem := body.children[0]
+	if elem.name.Local != "Fault" {
+		return elem, nil, nil
+	}
+
+	fault := &soapFault{}
+	if elem.name.Space == namespaceSOAP12 {
+		if c := elem.child("Code"); c != nil {
+			if v := c.child("Value"); v != nil {
+				fault.code = strings.TrimSpace(v.text.String())
+			}
+		}
+		if c := elem.child("Reason"); c != nil {
+			if t := c.child("Text"); t != nil {
+				fault.message = strings.TrimSpace(t.text.String())
+			}
+		}
+		if c := elem.child("Detail"); c != nil {
+			fault.detail = c.toJSON()
+		}
+	} else {
+		if c := elem.child("faultcode"); c != nil {
+			fault.code = strings.TrimSpace(c.text.String())
+		}
+		if c := elem.child("faultstring"); c != nil {
+			fault.message = strings.TrimSpace(c.text.String())
+		}
+		if c := elem.child("detail"); c != nil {
+			fault.detail = c.toJSON()
+		}
+	}
+	return nil, fault, nil
+}
+
+// statusCode returns the HTTP status code of the fault, faults caused by
+// the client are mapped to 400, and others to 502.
+func (f *soapFault) statusCode() int {
+	code := f.code
+	if i := strings.LastIndexByte(code, ':'); i >= 0 {
+		code = code[i+1:]
+	}
+	// SOAP 1.1 fault codes could be extended with dots, e.g. Client.Auth.
+	if i := strings.IndexByte(code, '.'); i >= 0 {
+		code = code[:i]
+	}
+
+	switch code {
+	case "Client", "Sender":
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func (f *soapFault) marshal() []byte {
+	body := map[string]interface{}{
+		"code":    f.code,
+		"message": f.message,
+	}
+	if f.detail != nil && f.detail != "" {
+		body["detail"] = f.detail
+	}
+	data, _ := json.Marshal(map[string]interface{}{"error": body})
+	return data
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tenantguard implements the TenantGuard filter, which makes sure
+// requests of a tenant are only sent to the backends of the tenant.
+package tenantguard
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of TenantGuard.
+	Kind = "TenantGuard"
+
+	defaultTenantHeader = "X-Tenant-Id"
+
+	resultUnknownTenant = "unknownTenant"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "TenantGuard makes sure requests of a tenant are only sent to the backends of the tenant.",
+	Results:     []string{resultUnknownTenant},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{TenantHeader: defaultTenantHeader}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &TenantGuard{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// TenantGuard is filter TenantGuard.
+	TenantGuard struct {
+		spec    *Spec
+		tenants map[string]*tenant
+
+		numOfUnknownTenant int64
+	}
+
+	// Spec describes the TenantGuard.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		TenantHeader string        `json:"tenantHeader" jsonschema:"omitempty"`
+		Tenants      []*TenantSpec `json:"tenants" jsonschema:"required,minItems=1"`
+	}
+
+	// TenantSpec defines the backends allowed for a tenant.
+	TenantSpec struct {
+		ID       string   `json:"id" jsonschema:"required"`
+		Backends []string `json:"backends" jsonschema:"required,minItems=1,uniqueItems=true"`
+	}
+
+	// Status is the status of TenantGuard.
+	Status struct {
+		NumOfCrossTenantBlocked int64            `json:"numOfCrossTenantBlocked"`
+		NumOfUnknownTenant      int64            `json:"numOfUnknownTenant"`
+		CrossTenantBlocked      map[string]int64 `json:"crossTenantBlocked"`
+	}
+
+	tenant struct {
+		id       string
+		backends []string
+		guard    proxy.BackendGuard
+
+		numOfBlocked int64
+	}
+)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	ids := map[string]bool{}
+	for _, t := range spec.Tenants {
+		if ids[t.ID] {
+			return fmt.Errorf("duplicated tenant %q", t.ID)
+		}
+		ids[t.ID] = true
+		for _, b := range t.Backends {
+			if b == "" || strings.Count(b, "/") > 1 {
+				return fmt.Errorf("tenant %q: invalid backend %q", t.ID, b)
+			}
+		}
+	}
+	return nil
+}
+
+func newTenant(spec *TenantSpec) *tenant {
+	t := &tenant{id: spec.ID, backends: spec.Backends}
+	t.guard = t.check
+	return t
+}
+
+// allows reports whether the backend, in the form of "{proxy}/{pool}", is
+// one of the backends of the tenant, a backend of the tenant matches all
+// the pools of a proxy if the pool is omitted.
+func (t *tenant) allows(backend string) bool {
+	name, _, _ := strings.Cut(backend, "/")
+	for _, b := range t.backends {
+		if b == backend || b == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tenant) check(backend string) error {
+	if t.allows(backend) {
+		return nil
+	}
+	atomic.AddInt64(&t.numOfBlocked, 1)
+	logger.Errorf("cross tenant request is blocked: tenant %s, backend %s", t.id, backend)
+	return fmt.Errorf("backend %s is not allowed for tenant %s", backend, t.id)
+}
+
+var _ filters.Filter = (*TenantGuard)(nil)
+
+// Name returns the name of the TenantGuard filter instance.
+func (tg *TenantGuard) Name() string {
+	return tg.spec.Name()
+}
+
+// Kind returns the kind of TenantGuard.
+func (tg *TenantGuard) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the TenantGuard
+func (tg *TenantGuard) Spec() filters.Spec {
+	return tg.spec
+}
+
+// Init initializes TenantGuard.
+func (tg *TenantGuard) Init() {
+	tg.reload()
+}
+
+// Inherit inherits previous generation of TenantGuard.
+func (tg *TenantGuard) Inherit(previousGeneration filters.Filter) {
+	tg.reload()
+
+	// keep the counters, so that blocked requests are not hidden by
+	// reloading the mapping.
+	prev := previousGeneration.(*TenantGuard)
+	atomic.StoreInt64(&tg.numOfUnknownTenant, atomic.LoadInt64(&prev.numOfUnknownTenant))
+	for id, t := range tg.tenants {
+		if pt := prev.tenants[id]; pt != nil {
+			atomic.StoreInt64(&t.numOfBlocked, atomic.LoadInt64(&pt.numOfBlocked))
+		}
+	}
+}
+
+func (tg *TenantGuard) reload() {
+	tg.tenants = make(map[string]*tenant, len(tg.spec.Tenants))
+	for _, spec := range tg.spec.Tenants {
+		tg.tenants[spec.ID] = newTenant(spec)
+	}
+}
+
+func (tg *TenantGuard) tenantHeader() string {
+	if tg.spec.TenantHeader == "" {
+		return defaultTenantHeader
+	}
+	return tg.spec.TenantHeader
+}
+
+// Handle sets the backend guard of the tenant of the request.
+func (tg *TenantGuard) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	id := req.HTTPHeader().Get(tg.tenantHeader())
+	t := tg.tenants[id]
+	if t == nil {
+		atomic.AddInt64(&tg.numOfUnknownTenant, 1)
+		resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+		if resp == nil {
+			resp, _ = httpprot.NewResponse(nil)
+		}
+		resp.SetStatusCode(http.StatusForbidden)
+		ctx.SetOutputResponse(resp)
+		ctx.AddTag("tenantGuard: unknown tenant " + id)
+		return resultUnknownTenant
+	}
+
+	ctx.SetData(proxy.BackendGuardDataKey, t.guard)
+	return ""
+}
+
+// Status returns status.
+func (tg *TenantGuard) Status() interface{} {
+	s := &Status{
+		NumOfUnknownTenant: atomic.LoadInt64(&tg.numOfUnknownTenant),
+		CrossTenantBlocked: map[string]int64{},
+	}
+	for id, t := range tg.tenants {
+		n := atomic.LoadInt64(&t.numOfBlocked)
+		if n > 0 {
+			s.CrossTenantBlocked[id] = n
+			s.NumOfCrossTenantBlocked += n
+		}
+	}
+	return s
+}
+
+// Close closes TenantGuard.
+func (tg *TenantGuard) Close() {}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tenantguard
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/filters/proxy"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createTenantGuard(t *testing.T, yamlConfig string, prev *TenantGuard) *TenantGuard {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	tg := kind.CreateInstance(spec).(*TenantGuard)
+	if prev == nil {
+		tg.Init()
+	} else {
+		tg.Inherit(prev)
+	}
+	return tg
+}
+
+func newContext(t *testing.T, tenant string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if tenant != "" {
+		stdr.Header.Set("X-Tenant-Id", tenant)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func TestTenantGuard(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: TenantGuard
+name: guard
+tenants:
+- id: a
+  backends: ["proxy-a"]
+- id: b
+  backends: ["proxy-shared/1", "proxy-b"]
+`
+	tg := createTenantGuard(t, yamlConfig, nil)
+
+	guard := func(tenant string) proxy.BackendGuard {
+		ctx := newContext(t, tenant)
+		assert.Equal("", tg.Handle(ctx))
+		return ctx.GetData(proxy.BackendGuardDataKey).(proxy.BackendGuard)
+	}
+
+	g := guard("a")
+	assert.NoError(g("proxy-a/0"))
+	assert.NoError(g("proxy-a/mirror"))
+	assert.Error(g("proxy-b/0"))
+	assert.Error(g("proxy-shared/1"))
+
+	g = guard("b")
+	assert.NoError(g("proxy-shared/1"))
+	assert.NoError(g("proxy-b/0"))
+	assert.Error(g("proxy-shared/0"))
+	assert.Error(g("proxy-a/0"))
+
+	// unknown tenant
+	for _, tenant := range []string{"", "c"} {
+		ctx := newContext(t, tenant)
+		assert.Equal(resultUnknownTenant, tg.Handle(ctx))
+		assert.Equal(http.StatusForbidden, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+		assert.Nil(ctx.GetData(proxy.BackendGuardDataKey))
+	}
+
+	status := tg.Status().(*Status)
+	assert.Equal(int64(4), status.NumOfCrossTenantBlocked)
+	assert.Equal(int64(2), status.NumOfUnknownTenant)
+	assert.Equal(map[string]int64{"a": 2, "b": 2}, status.CrossTenantBlocked)
+
+	// reload the mapping, the counters are kept
+	tg = createTenantGuard(t, `
+kind: TenantGuard
+name: guard
+tenants:
+- id: a
+  backends: ["proxy-a", "proxy-b"]
+`, tg)
+	g = guard("a")
+	assert.NoError(g("proxy-b/0"))
+	status = tg.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfCrossTenantBlocked)
+	assert.Equal(int64(2), status.NumOfUnknownTenant)
+
+	spec := &Spec{Tenants: []*TenantSpec{{ID: "a", Backends: []string{"p"}}, {ID: "a", Backends: []string{"p"}}}}
+	assert.Error(spec.Validate())
+	spec = &Spec{Tenants: []*TenantSpec{{ID: "a", Backends: []string{"p/0/1"}}}}
+	assert.Error(spec.Validate())
+}
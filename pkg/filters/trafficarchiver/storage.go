@@ -0,0 +1,152 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficarchiver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/signer"
+)
+
+const (
+	defaultStorageTimeout = 10 * time.Second
+	defaultStorageRegion  = "us-east-1"
+)
+
+// aws4Literal is the literal of AWS Signature Version 4.
+var aws4Literal = &signer.Literal{
+	ScopeSuffix:      "aws4_request",
+	AlgorithmName:    "X-Amz-Algorithm",
+	AlgorithmValue:   "AWS4-HMAC-SHA256",
+	SignedHeaders:    "X-Amz-SignedHeaders",
+	Signature:        "X-Amz-Signature",
+	Date:             "X-Amz-Date",
+	Expires:          "X-Amz-Expires",
+	Credential:       "X-Amz-Credential",
+	ContentSHA256:    "X-Amz-Content-Sha256",
+	SigningKeyPrefix: "AWS4",
+}
+
+type (
+	// StorageSpec is the spec of the S3 compatible object storage.
+	StorageSpec struct {
+		Endpoint        string `json:"endpoint" jsonschema:"required,format=uri"`
+		Bucket          string `json:"bucket" jsonschema:"required"`
+		Region          string `json:"region" jsonschema:"omitempty"`
+		AccessKeyID     string `json:"accessKeyId" jsonschema:"omitempty"`
+		AccessKeySecret string `json:"accessKeySecret" jsonschema:"omitempty"`
+		Prefix          string `json:"prefix" jsonschema:"omitempty"`
+		Timeout         string `json:"timeout" jsonschema:"omitempty,format=duration"`
+	}
+
+	// storage uploads objects to the object storage with path style URLs,
+	// i.e. {endpoint}/{bucket}/{key}.
+	storage struct {
+		spec   *StorageSpec
+		base   string
+		region string
+		signer *signer.Signer
+		client *http.Client
+	}
+)
+
+// Validate validates the StorageSpec.
+func (spec *StorageSpec) Validate() error {
+	u, err := url.Parse(spec.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid endpoint: %s", spec.Endpoint)
+	}
+	if strings.Contains(spec.Bucket, "/") {
+		return fmt.Errorf("invalid bucket: %s", spec.Bucket)
+	}
+	if (spec.AccessKeyID == "") != (spec.AccessKeySecret == "") {
+		return fmt.Errorf("accessKeyId and accessKeySecret must be specified together")
+	}
+	return nil
+}
+
+func newStorage(spec *StorageSpec) *storage {
+	timeout, _ := time.ParseDuration(spec.Timeout)
+	if timeout <= 0 {
+		timeout = defaultStorageTimeout
+	}
+
+	s := &storage{
+		spec:   spec,
+		base:   strings.TrimSuffix(spec.Endpoint, "/") + "/" + spec.Bucket + "/",
+		region: spec.Region,
+		client: &http.Client{Timeout: timeout},
+	}
+	if s.region == "" {
+		s.region = defaultStorageRegion
+	}
+	if spec.AccessKeyID != "" {
+		s.signer = signer.New().SetLiteral(aws4Literal).SetCredential(spec.AccessKeyID, spec.AccessKeySecret)
+	}
+	return s
+}
+
+// objectKey returns the key of an object, which is partitioned by the
+// pipeline and the time, e.g. {prefix}/{pipeline}/2006/01/02/15/{id}.json.
+func (s *storage) objectKey(pipeline string, t time.Time, id string) string {
+	t = t.UTC()
+	parts := make([]string, 0, 4)
+	if prefix := strings.Trim(s.spec.Prefix, "/"); prefix != "" {
+		parts = append(parts, prefix)
+	}
+	if pipeline != "" {
+		parts = append(parts, pipeline)
+	}
+	parts = append(parts, t.Format("2006/01/02/15"), t.Format("20060102T150405.000Z")+"-"+id+".json")
+	return strings.Join(parts, "/")
+}
+
+// put uploads an object.
+func (s *storage) put(key string, data []byte) error {
+	req, err := http.NewRequest(http.MethodPut, s.base+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if s.signer != nil {
+		sCtx := s.signer.NewSigningContext(time.Now(), s.region, "s3")
+		getBody := func() io.Reader { return bytes.NewReader(data) }
+		if err = sCtx.Sign(req, getBody); err != nil {
+			return err
+		}
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
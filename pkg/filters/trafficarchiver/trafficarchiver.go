@@ -0,0 +1,393 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficarchiver
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	// Kind is the kind of TrafficArchiver.
+	Kind = "TrafficArchiver"
+
+	defaultMaxBodySize = 64 * 1024
+	defaultQueueSize   = 1000
+	defaultConcurrency = 4
+
+	redacted = "[REDACTED]"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "TrafficArchiver archives sampled requests and responses to object storage.",
+	Results:     []string{},
+	Effects:     []string{filters.EffectWrite},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{
+			MaxBodySize: defaultMaxBodySize,
+			QueueSize:   defaultQueueSize,
+			Concurrency: defaultConcurrency,
+		}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &TrafficArchiver{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// TrafficArchiver is filter TrafficArchiver.
+	TrafficArchiver struct {
+		spec *Spec
+
+		storage       *storage
+		redactHeaders map[string]bool
+		redactFields  map[string]bool
+		queue         chan *Exchange
+		done          chan struct{}
+		wg            sync.WaitGroup
+
+		numOfSampled  int64
+		numOfUploaded int64
+		numOfDropped  int64
+		numOfFailed   int64
+	}
+
+	// Spec describes the TrafficArchiver.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		SampleRate    float64      `json:"sampleRate" jsonschema:"required"`
+		Storage       *StorageSpec `json:"storage" jsonschema:"required"`
+		MaxBodySize   int          `json:"maxBodySize" jsonschema:"omitempty,minimum=0"`
+		RedactHeaders []string     `json:"redactHeaders" jsonschema:"omitempty"`
+		RedactFields  []string     `json:"redactFields" jsonschema:"omitempty"`
+		QueueSize     int          `json:"queueSize" jsonschema:"omitempty,minimum=1"`
+		Concurrency   int          `json:"concurrency" jsonschema:"omitempty,minimum=1"`
+	}
+
+	// Status is the status of TrafficArchiver.
+	Status struct {
+		NumOfSampled  int64 `json:"numOfSampled"`
+		NumOfUploaded int64 `json:"numOfUploaded"`
+		NumOfDropped  int64 `json:"numOfDropped"`
+		NumOfFailed   int64 `json:"numOfFailed"`
+	}
+
+	// Exchange is an archived pair of request and response.
+	Exchange struct {
+		Time     string   `json:"time"`
+		Pipeline string   `json:"pipeline"`
+		Request  *Message `json:"request"`
+		Response *Message `json:"response,omitempty"`
+
+		id   string
+		time time.Time
+	}
+
+	// Message is an archived request or response.
+	Message struct {
+		Method        string              `json:"method,omitempty"`
+		URL           string              `json:"url,omitempty"`
+		StatusCode    int                 `json:"statusCode,omitempty"`
+		Headers       map[string][]string `json:"headers"`
+		Body          string              `json:"body,omitempty"`
+		BodyBase64    bool                `json:"bodyBase64,omitempty"`
+		BodyTruncated bool                `json:"bodyTruncated,omitempty"`
+		BodyStreamed  bool                `json:"bodyStreamed,omitempty"`
+	}
+)
+
+var _ filters.Filter = (*TrafficArchiver)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	if spec.SampleRate <= 0 || spec.SampleRate > 1 {
+		return fmt.Errorf("sampleRate must be in (0, 1]")
+	}
+	if err := spec.Storage.Validate(); err != nil {
+		return fmt.Errorf("storage: %v", err)
+	}
+	return nil
+}
+
+// Name returns the name of the TrafficArchiver filter instance.
+func (ta *TrafficArchiver) Name() string {
+	return ta.spec.Name()
+}
+
+// Kind returns the kind of TrafficArchiver.
+func (ta *TrafficArchiver) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the TrafficArchiver
+func (ta *TrafficArchiver) Spec() filters.Spec {
+	return ta.spec
+}
+
+// Init initializes TrafficArchiver.
+func (ta *TrafficArchiver) Init() {
+	ta.reload()
+}
+
+// Inherit inherits previous generation of TrafficArchiver.
+func (ta *TrafficArchiver) Inherit(previousGeneration filters.Filter) {
+	ta.reload()
+}
+
+func (ta *TrafficArchiver) reload() {
+	ta.storage = newStorage(ta.spec.Storage)
+
+	ta.redactHeaders = make(map[string]bool, len(ta.spec.RedactHeaders))
+	for _, h := range ta.spec.RedactHeaders {
+		ta.redactHeaders[http.CanonicalHeaderKey(h)] = true
+	}
+	ta.redactFields = make(map[string]bool, len(ta.spec.RedactFields))
+	for _, f := range ta.spec.RedactFields {
+		ta.redactFields[f] = true
+	}
+
+	queueSize := ta.spec.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	ta.queue = make(chan *Exchange, queueSize)
+	ta.done = make(chan struct{})
+
+	concurrency := ta.spec.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	for i := 0; i < concurrency; i++ {
+		ta.wg.Add(1)
+		go ta.run()
+	}
+}
+
+func (ta *TrafficArchiver) run() {
+	defer ta.wg.Done()
+
+	for {
+		select {
+		case e := <-ta.queue:
+			ta.upload(e)
+		case <-ta.done:
+			for {
+				select {
+				case e := <-ta.queue:
+					ta.upload(e)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (ta *TrafficArchiver) upload(e *Exchange) {
+	data, err := json.Marshal(e)
+	if err == nil {
+		key := ta.storage.objectKey(e.Pipeline, e.time, e.id)
+		if err = ta.storage.put(key, data); err == nil {
+			atomic.AddInt64(&ta.numOfUploaded, 1)
+			return
+		}
+	}
+	atomic.AddInt64(&ta.numOfFailed, 1)
+	logger.Errorf("%s: failed to upload exchange: %v", ta.Name(), err)
+}
+
+// enqueue adds the exchange to the queue, and drops it if the queue is
+// full, so that request processing is never blocked.
+func (ta *TrafficArchiver) enqueue(e *Exchange) {
+	select {
+	case ta.queue <- e:
+	default:
+		atomic.AddInt64(&ta.numOfDropped, 1)
+	}
+}
+
+func (ta *TrafficArchiver) maxBodySize() int {
+	if ta.spec.MaxBodySize == 0 {
+		return defaultMaxBodySize
+	}
+	return ta.spec.MaxBodySize
+}
+
+func (ta *TrafficArchiver) captureHeaders(h http.Header) map[string][]string {
+	result := make(map[string][]string, len(h))
+	for k, v := range h {
+		if ta.redactHeaders[k] {
+			result[k] = []string{redacted}
+		} else {
+			result[k] = append([]string(nil), v...)
+		}
+	}
+	return result
+}
+
+// captureBody captures the body up to the max body size. Stream bodies
+// are not captured, so that they are not buffered in memory. If fields
+// should be redacted, only JSON bodies which are not truncated are kept.
+func (ta *TrafficArchiver) captureBody(m *Message, isStream bool, getBody func() []byte) {
+	if isStream {
+		m.BodyStreamed = true
+		return
+	}
+
+	body := getBody()
+	if len(body) > ta.maxBodySize() {
+		body = body[:ta.maxBodySize()]
+		m.BodyTruncated = true
+	}
+	if len(body) == 0 {
+		return
+	}
+
+	if len(ta.redactFields) > 0 {
+		var v interface{}
+		if m.BodyTruncated || json.Unmarshal(body, &v) != nil {
+			m.Body = redacted
+			return
+		}
+		body, _ = json.Marshal(ta.redact(v))
+	}
+
+	if utf8.Valid(body) {
+		m.Body = string(body)
+	} else {
+		m.Body = base64.StdEncoding.EncodeToString(body)
+		m.BodyBase64 = true
+	}
+}
+
+// redact redacts the fields in v, at any depth.
+func (ta *TrafficArchiver) redact(v interface{}) interface{} {
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for k, val := range x {
+			if ta.redactFields[k] {
+				x[k] = redacted
+			} else {
+				x[k] = ta.redact(val)
+			}
+		}
+	case []interface{}:
+		for i, val := range x {
+			x[i] = ta.redact(val)
+		}
+	}
+	return v
+}
+
+// redactMessage redacts the message with the log redactor, base64 encoded
+// bodies are binary and are kept.
+func redactMessage(lr httpprot.LogRedactor, m *Message) {
+	if m == nil {
+		return
+	}
+	m.URL = lr.RedactString(m.URL)
+	m.Headers = lr.RedactHeader(m.Headers)
+	if m.Body != "" && !m.BodyBase64 {
+		m.Body = string(lr.RedactBody([]byte(m.Body)))
+	}
+}
+
+func newID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Handle captures the request if it is sampled, and captures the response
+// and queues them for uploading after the request is finished.
+func (ta *TrafficArchiver) Handle(ctx *context.Context) string {
+	if rand.Float64() >= ta.spec.SampleRate {
+		return ""
+	}
+	atomic.AddInt64(&ta.numOfSampled, 1)
+
+	// the request could be modified by the following filters, so capture
+	// it now.
+	req := ctx.GetInputRequest().(*httpprot.Request)
+	now := time.Now()
+	e := &Exchange{
+		Time:     now.UTC().Format(time.RFC3339Nano),
+		Pipeline: ta.spec.Pipeline(),
+		Request: &Message{
+			Method:  req.Method(),
+			URL:     req.URL().String(),
+			Headers: ta.captureHeaders(req.Std().Header),
+		},
+		id:   newID(),
+		time: now,
+	}
+	ta.captureBody(e.Request, req.IsStream(), req.RawPayload)
+
+	ctx.OnFinish(func() {
+		if resp, _ := ctx.GetOutputResponse().(*httpprot.Response); resp != nil {
+			e.Response = &Message{
+				StatusCode: resp.StatusCode(),
+				Headers:    ta.captureHeaders(resp.Std().Header),
+			}
+			ta.captureBody(e.Response, resp.IsStream(), resp.RawPayload)
+		}
+		if lr, ok := ctx.GetData(httpprot.LogRedactorDataKey).(httpprot.LogRedactor); ok {
+			redactMessage(lr, e.Request)
+			redactMessage(lr, e.Response)
+		}
+		ta.enqueue(e)
+	})
+
+	return ""
+}
+
+// Status returns status.
+func (ta *TrafficArchiver) Status() interface{} {
+	return &Status{
+		NumOfSampled:  atomic.LoadInt64(&ta.numOfSampled),
+		NumOfUploaded: atomic.LoadInt64(&ta.numOfUploaded),
+		NumOfDropped:  atomic.LoadInt64(&ta.numOfDropped),
+		NumOfFailed:   atomic.LoadInt64(&ta.numOfFailed),
+	}
+}
+
+// Close closes TrafficArchiver, the exchanges in the queue are uploaded
+// before it returns.
+func (ta *TrafficArchiver) Close() {
+	close(ta.done)
+	ta.wg.Wait()
+}
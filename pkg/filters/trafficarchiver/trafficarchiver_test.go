@@ -0,0 +1,214 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trafficarchiver
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	json "github.com/goccy/go-json"
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/megaease/easegress/pkg/util/signer"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+func createArchiver(t *testing.T, yamlConfig string) *TrafficArchiver {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "pipeline-demo", rawSpec)
+	assert.NoError(t, err)
+
+	ta := kind.CreateInstance(spec).(*TrafficArchiver)
+	ta.Init()
+	return ta
+}
+
+type fakeStorage struct {
+	t       *testing.T
+	lock    sync.Mutex
+	objects map[string][]byte
+	server  *httptest.Server
+}
+
+func newFakeStorage(t *testing.T) *fakeStorage {
+	fs := &fakeStorage{t: t, objects: map[string][]byte{}}
+	verifier := signer.New().SetLiteral(aws4Literal).SetAccessKeyStore(idSecretStore{"AKID": "SECRET"})
+
+	fs.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		getBody := func() io.Reader { return bytes.NewReader(body) }
+		if err := verifier.NewVerificationContext().Verify(r, getBody); err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		assert.Equal(t, http.MethodPut, r.Method)
+
+		fs.lock.Lock()
+		fs.objects[r.URL.Path] = body
+		fs.lock.Unlock()
+	}))
+	return fs
+}
+
+type idSecretStore map[string]string
+
+func (s idSecretStore) GetSecret(id string) (string, bool) {
+	secret, ok := s[id]
+	return secret, ok
+}
+
+func TestTrafficArchiver(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newFakeStorage(t)
+	defer fs.server.Close()
+
+	ta := createArchiver(t, `
+name: archiver
+kind: TrafficArchiver
+sampleRate: 1
+maxBodySize: 64
+redactHeaders: [Authorization]
+redactFields: [password]
+storage:
+  endpoint: `+fs.server.URL+`
+  bucket: traffic
+  prefix: /archive/
+  accessKeyId: AKID
+  accessKeySecret: SECRET
+`)
+
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com/login?x=1", strings.NewReader(`{"user": "alice", "password": "secret"}`))
+	stdr.Header.Set("Authorization", "Bearer token")
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(err)
+	assert.NoError(req.FetchPayload(0))
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	assert.Equal("", ta.Handle(ctx))
+
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusOK)
+	resp.SetPayload(strings.Repeat("x", 100))
+	ctx.SetOutputResponse(resp)
+	ctx.Finish()
+
+	ta.Close()
+	status := ta.Status().(*Status)
+	assert.Equal(int64(1), status.NumOfSampled)
+	assert.Equal(int64(1), status.NumOfUploaded)
+
+	assert.Len(fs.objects, 1)
+	for key, data := range fs.objects {
+		prefix := "/traffic/archive/pipeline-demo/" + time.Now().UTC().Format("2006/01/02/")
+		assert.True(strings.HasPrefix(key, prefix), key)
+
+		e := &Exchange{}
+		assert.NoError(json.Unmarshal(data, e))
+		assert.Equal("pipeline-demo", e.Pipeline)
+		assert.Equal("http://example.com/login?x=1", e.Request.URL)
+		assert.Equal([]string{redacted}, e.Request.Headers["Authorization"])
+		assert.JSONEq(`{"user": "alice", "password": "[REDACTED]"}`, e.Request.Body)
+		assert.Equal(http.StatusOK, e.Response.StatusCode)
+		assert.True(e.Response.BodyTruncated)
+		assert.Equal(redacted, e.Response.Body)
+	}
+}
+
+func TestDropAndFail(t *testing.T) {
+	assert := assert.New(t)
+
+	fs := newFakeStorage(t)
+	defer fs.server.Close()
+
+	ta := createArchiver(t, `
+name: archiver
+kind: TrafficArchiver
+sampleRate: 1
+queueSize: 1
+concurrency: 1
+storage:
+  endpoint: `+fs.server.URL+`
+  bucket: traffic
+  accessKeyId: AKID
+  accessKeySecret: WRONG
+`)
+
+	// stop the uploader so that the queue is not consumed
+	close(ta.done)
+	ta.wg.Wait()
+
+	for i := 0; i < 3; i++ {
+		stdr, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		req, _ := httpprot.NewRequest(stdr)
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+		ta.Handle(ctx)
+		ctx.Finish()
+	}
+
+	ta.upload(<-ta.queue)
+	status := ta.Status().(*Status)
+	assert.Equal(int64(3), status.NumOfSampled)
+	assert.Equal(int64(2), status.NumOfDropped)
+	assert.Equal(int64(1), status.NumOfFailed)
+	assert.Empty(fs.objects)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	spec := &Spec{
+		SampleRate: 0.1,
+		Storage:    &StorageSpec{Endpoint: "http://127.0.0.1:9000", Bucket: "traffic"},
+	}
+	assert.NoError(spec.Validate())
+
+	spec.SampleRate = 0
+	assert.Error(spec.Validate())
+	spec.SampleRate = 0.1
+
+	spec.Storage.Endpoint = "ftp://127.0.0.1"
+	assert.Error(spec.Validate())
+	spec.Storage.Endpoint = "http://127.0.0.1:9000"
+
+	spec.Storage.Bucket = "a/b"
+	assert.Error(spec.Validate())
+	spec.Storage.Bucket = "traffic"
+
+	spec.Storage.AccessKeyID = "AKID"
+	assert.Error(spec.Validate())
+}
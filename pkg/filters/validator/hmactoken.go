@@ -0,0 +1,276 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package validator
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+const (
+	defaultHMACTokenKeyIDHeader     = "X-Auth-Key-Id"
+	defaultHMACTokenTimestampHeader = "X-Auth-Timestamp"
+	defaultHMACTokenSignatureHeader = "X-Auth-Signature"
+	defaultHMACTokenTolerance       = 5 * time.Minute
+
+	// maxHMACTokenSeenSignatures is the max number of signatures remembered
+	// to detect replays.
+	maxHMACTokenSeenSignatures = 100000
+
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+type (
+	// HMACTokenValidatorSpec defines the configuration of HMAC token validator.
+	HMACTokenValidatorSpec struct {
+		// Secrets are the active shared secrets, more than one secrets
+		// could be active during rotation.
+		Secrets []*HMACTokenSecret `json:"secrets" jsonschema:"required,minItems=1"`
+		// KeyIDHeader is the header of the ID of the secret used to sign the
+		// request, all secrets are tried if the header is absent.
+		KeyIDHeader string `json:"keyIdHeader" jsonschema:"omitempty"`
+		// TimestampHeader is the header of the unix timestamp in seconds.
+		TimestampHeader string `json:"timestampHeader" jsonschema:"omitempty"`
+		// SignatureHeader is the header of the hex encoded signature.
+		SignatureHeader string `json:"signatureHeader" jsonschema:"omitempty"`
+		// SignedHeaders are the headers included in the canonical request.
+		SignedHeaders []string `json:"signedHeaders" jsonschema:"omitempty"`
+		// Tolerance is the max difference between the timestamp and now.
+		Tolerance string `json:"tolerance" jsonschema:"omitempty,format=duration"`
+		// RejectReplays rejects requests whose signature has been seen in
+		// the tolerance window.
+		RejectReplays bool `json:"rejectReplays" jsonschema:"omitempty"`
+	}
+
+	// HMACTokenSecret is a shared secret of HMAC token validator.
+	HMACTokenSecret struct {
+		ID     string `json:"id" jsonschema:"required"`
+		Secret string `json:"secret" jsonschema:"required"`
+	}
+
+	// HMACTokenStatus is the status of HMAC token validator.
+	HMACTokenStatus struct {
+		NumOfSucceeded int64 `json:"numOfSucceeded"`
+		NumOfFailed    int64 `json:"numOfFailed"`
+		NumOfReplayed  int64 `json:"numOfReplayed"`
+	}
+
+	// HMACTokenValidator defines the HMAC token validator
+	HMACTokenValidator struct {
+		spec      *HMACTokenValidatorSpec
+		tolerance time.Duration
+
+		lock sync.Mutex
+		seen map[string]time.Time
+
+		numOfSucceeded int64
+		numOfFailed    int64
+		numOfReplayed  int64
+	}
+)
+
+// Validate validates the HMACTokenValidatorSpec.
+func (spec *HMACTokenValidatorSpec) Validate() error {
+	ids := map[string]bool{}
+	for _, s := range spec.Secrets {
+		if ids[s.ID] {
+			return fmt.Errorf("duplicated secret id %q", s.ID)
+		}
+		ids[s.ID] = true
+	}
+	if spec.Tolerance != "" {
+		if d, err := time.ParseDuration(spec.Tolerance); err != nil || d <= 0 {
+			return fmt.Errorf("invalid tolerance %q", spec.Tolerance)
+		}
+	}
+	return nil
+}
+
+// NewHMACTokenValidator creates a new HMAC token validator
+func NewHMACTokenValidator(spec *HMACTokenValidatorSpec) *HMACTokenValidator {
+	v := &HMACTokenValidator{spec: spec, seen: map[string]time.Time{}}
+	v.tolerance, _ = time.ParseDuration(spec.Tolerance)
+	if v.tolerance <= 0 {
+		v.tolerance = defaultHMACTokenTolerance
+	}
+	return v
+}
+
+func (v *HMACTokenValidator) inherit(prev *HMACTokenValidator) {
+	prev.lock.Lock()
+	defer prev.lock.Unlock()
+	for k, expire := range prev.seen {
+		v.seen[k] = expire
+	}
+}
+
+func headerOrDefault(name, defaultName string) string {
+	if name == "" {
+		return defaultName
+	}
+	return name
+}
+
+// CanonicalRequest returns the canonical representation of the request
+// to sign, which consists of the below lines:
+//
+//	HTTP method
+//	path
+//	query string, sorted by keys
+//	timestamp
+//	signed headers, each one in the form of 'name:value', in lower case and sorted by names
+//	hex encoded SHA256 digest of the body, or UNSIGNED-PAYLOAD for stream bodies
+func (v *HMACTokenValidator) CanonicalRequest(req *httpprot.Request, timestamp string) string {
+	var sb strings.Builder
+
+	sb.WriteString(req.Method())
+	sb.WriteByte('\n')
+	sb.WriteString(req.URL().EscapedPath())
+	sb.WriteByte('\n')
+	sb.WriteString(strings.ReplaceAll(req.URL().Query().Encode(), "+", "%20"))
+	sb.WriteByte('\n')
+	sb.WriteString(timestamp)
+	sb.WriteByte('\n')
+
+	headers := make([]string, 0, len(v.spec.SignedHeaders))
+	for _, h := range v.spec.SignedHeaders {
+		values := req.HTTPHeader().Values(h)
+		headers = append(headers, strings.ToLower(h)+":"+strings.TrimSpace(strings.Join(values, ",")))
+	}
+	sort.Strings(headers)
+	for _, h := range headers {
+		sb.WriteString(h)
+		sb.WriteByte('\n')
+	}
+
+	if req.IsStream() {
+		sb.WriteString(unsignedPayload)
+	} else {
+		sum := sha256.New()
+		io.Copy(sum, req.GetPayload())
+		sb.WriteString(hex.EncodeToString(sum.Sum(nil)))
+	}
+	return sb.String()
+}
+
+func signHMACToken(secret, canonical string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return mac.Sum(nil)
+}
+
+// Validate validates the HMAC token of a http request
+func (v *HMACTokenValidator) Validate(req *httpprot.Request) error {
+	err := v.validate(req, time.Now())
+	if err == nil {
+		atomic.AddInt64(&v.numOfSucceeded, 1)
+	} else {
+		atomic.AddInt64(&v.numOfFailed, 1)
+	}
+	return err
+}
+
+func (v *HMACTokenValidator) validate(req *httpprot.Request, now time.Time) error {
+	h := req.HTTPHeader()
+
+	timestamp := h.Get(headerOrDefault(v.spec.TimestampHeader, defaultHMACTokenTimestampHeader))
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %q", timestamp)
+	}
+	if d := now.Sub(time.Unix(ts, 0)); d > v.tolerance || d < -v.tolerance {
+		atomic.AddInt64(&v.numOfReplayed, 1)
+		return fmt.Errorf("timestamp is out of the tolerance window")
+	}
+
+	signature, err := hex.DecodeString(h.Get(headerOrDefault(v.spec.SignatureHeader, defaultHMACTokenSignatureHeader)))
+	if err != nil || len(signature) == 0 {
+		return fmt.Errorf("invalid signature")
+	}
+
+	keyID := h.Get(headerOrDefault(v.spec.KeyIDHeader, defaultHMACTokenKeyIDHeader))
+	canonical := v.CanonicalRequest(req, timestamp)
+	matched := false
+	for _, s := range v.spec.Secrets {
+		if keyID != "" && s.ID != keyID {
+			continue
+		}
+		if hmac.Equal(signHMACToken(s.Secret, canonical), signature) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	if v.spec.RejectReplays && !v.remember(string(signature), now) {
+		atomic.AddInt64(&v.numOfReplayed, 1)
+		return fmt.Errorf("replayed request")
+	}
+	return nil
+}
+
+// remember remembers the signature until it is out of the tolerance
+// window, false is returned if it has been seen.
+func (v *HMACTokenValidator) remember(signature string, now time.Time) bool {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if expire, ok := v.seen[signature]; ok && now.Before(expire) {
+		return false
+	}
+
+	if len(v.seen) >= maxHMACTokenSeenSignatures {
+		for k, expire := range v.seen {
+			if !now.Before(expire) {
+				delete(v.seen, k)
+			}
+		}
+		// all of the signatures are valid, which should not happen in
+		// practice, forget them to bound the memory.
+		if len(v.seen) >= maxHMACTokenSeenSignatures {
+			v.seen = map[string]time.Time{}
+		}
+	}
+
+	// a timestamp is accepted in [now-tolerance, now+tolerance], so the
+	// signature must be remembered for twice the tolerance.
+	v.seen[signature] = now.Add(2 * v.tolerance)
+	return true
+}
+
+// Status returns the status of the HMAC token validator.
+func (v *HMACTokenValidator) Status() *HMACTokenStatus {
+	return &HMACTokenStatus{
+		NumOfSucceeded: atomic.LoadInt64(&v.numOfSucceeded),
+		NumOfFailed:    atomic.LoadInt64(&v.numOfFailed),
+		NumOfReplayed:  atomic.LoadInt64(&v.numOfReplayed),
+	}
+}
@@ -41,6 +41,9 @@ var kind = &filters.Kind{
 	Name:        Kind,
 	Description: "Validator validates HTTP request.",
 	Results:     []string{resultInvalid},
+	// OAuth2 tokens are introspected by the authorization server, and
+	// basic auth could be checked against LDAP.
+	Effects: []string{filters.EffectBackend},
 	DefaultSpec: func() filters.Spec {
 		return &Spec{}
 	},
@@ -63,6 +66,7 @@ type (
 		signer    *signer.Signer
 		oauth2    *OAuth2Validator
 		basicAuth *BasicAuthValidator
+		hmacToken *HMACTokenValidator
 	}
 
 	// Spec describes the Validator.
@@ -74,6 +78,12 @@ type (
 		Signature *signer.Spec              `json:"signature,omitempty" jsonschema:"omitempty"`
 		OAuth2    *OAuth2ValidatorSpec      `json:"oauth2,omitempty" jsonschema:"omitempty"`
 		BasicAuth *BasicAuthValidatorSpec   `json:"basicAuth,omitempty" jsonschema:"omitempty"`
+		HMACToken *HMACTokenValidatorSpec   `json:"hmacToken,omitempty" jsonschema:"omitempty"`
+	}
+
+	// Status is the status of Validator.
+	Status struct {
+		HMACToken *HMACTokenStatus `json:"hmacToken,omitempty"`
 	}
 )
 
@@ -82,6 +92,11 @@ func (spec Spec) Validate() error {
 	if spec == (Spec{}) {
 		return fmt.Errorf("none of the validations are defined")
 	}
+	if spec.HMACToken != nil {
+		if err := spec.HMACToken.Validate(); err != nil {
+			return fmt.Errorf("hmacToken: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -108,6 +123,13 @@ func (v *Validator) Init() {
 // Inherit inherits previous generation of Validator.
 func (v *Validator) Inherit(previousGeneration filters.Filter) {
 	v.reload()
+
+	// keep the remembered signatures, so that secret rotation does not
+	// open a window for replay attacks.
+	prev := previousGeneration.(*Validator)
+	if v.hmacToken != nil && prev.hmacToken != nil {
+		v.hmacToken.inherit(prev.hmacToken)
+	}
 }
 
 func (v *Validator) reload() {
@@ -126,6 +148,9 @@ func (v *Validator) reload() {
 	if v.spec.BasicAuth != nil {
 		v.basicAuth = NewBasicAuthValidator(v.spec.BasicAuth, v.spec.Super())
 	}
+	if v.spec.HMACToken != nil {
+		v.hmacToken = NewHMACTokenValidator(v.spec.HMACToken)
+	}
 }
 
 // Handle validates the request in the context.
@@ -177,12 +202,23 @@ func (v *Validator) Handle(ctx *context.Context) string {
 			return resultInvalid
 		}
 	}
+	if v.hmacToken != nil {
+		if err := v.hmacToken.Validate(req); err != nil {
+			prepareErrorResponse(http.StatusUnauthorized, "hmac token validator: ", err)
+			return resultInvalid
+		}
+	}
 
 	return ""
 }
 
 // Status returns status.
-func (v *Validator) Status() interface{} { return nil }
+func (v *Validator) Status() interface{} {
+	if v.hmacToken == nil {
+		return nil
+	}
+	return &Status{HMACToken: v.hmacToken.Status()}
+}
 
 // Close closes validations.
 func (v *Validator) Close() {
@@ -19,10 +19,12 @@ package validator
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -374,6 +376,99 @@ signature:
 	}
 }
 
+func TestHMACToken(t *testing.T) {
+	assert := assert.New(t)
+
+	const yamlConfig = `
+kind: Validator
+name: validator
+hmacToken:
+  secrets:
+  - id: k1
+    secret: secret1
+  - id: k2
+    secret: secret2
+  signedHeaders: ["X-Tenant"]
+  tolerance: 1m
+  rejectReplays: true
+`
+	v := createValidator(yamlConfig, nil, nil)
+
+	sign := func(method, url, body, keyID, secret string, ts time.Time) *context.Context {
+		stdr, err := http.NewRequest(method, url, strings.NewReader(body))
+		assert.Nil(err)
+		stdr.Header.Set("X-Tenant", "megaease")
+		req, err := httpprot.NewRequest(stdr)
+		assert.Nil(err)
+		assert.Nil(req.FetchPayload(0))
+
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		canonical := v.hmacToken.CanonicalRequest(req, timestamp)
+		signature := hex.EncodeToString(signHMACToken(secret, canonical))
+		req.HTTPHeader().Set("X-Auth-Timestamp", timestamp)
+		req.HTTPHeader().Set("X-Auth-Signature", signature)
+		if keyID != "" {
+			req.HTTPHeader().Set("X-Auth-Key-Id", keyID)
+		}
+
+		ctx := context.New(nil)
+		ctx.SetInputRequest(req)
+		return ctx
+	}
+
+	ctx := sign(http.MethodPost, "http://example.com/orders?b=2&a=1", "{}", "k1", "secret1", time.Now())
+	assert.Equal("", v.Handle(ctx))
+
+	// replayed
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	// the second secret, with or without the key id
+	ctx = sign(http.MethodPost, "http://example.com/orders", "{}", "k2", "secret2", time.Now())
+	assert.Equal("", v.Handle(ctx))
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "", "secret2", time.Now())
+	assert.Equal("", v.Handle(ctx))
+
+	// key id does not match the secret
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "k1", "secret2", time.Now())
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	// unknown secret
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "", "secret3", time.Now())
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	// out of the tolerance window
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "k1", "secret1", time.Now().Add(-2*time.Minute))
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	// tampered signed header
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "k1", "secret1", time.Now())
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Set("X-Tenant", "other")
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	// missing timestamp
+	ctx = sign(http.MethodGet, "http://example.com/orders", "", "k1", "secret1", time.Now())
+	ctx.GetInputRequest().(*httpprot.Request).HTTPHeader().Del("X-Auth-Timestamp")
+	assert.Equal(resultInvalid, v.Handle(ctx))
+
+	status := v.Status().(*Status).HMACToken
+	assert.Equal(int64(3), status.NumOfSucceeded)
+	assert.Equal(int64(6), status.NumOfFailed)
+	assert.Equal(int64(2), status.NumOfReplayed)
+
+	// rotate the secrets, the remembered signatures are kept
+	ctx = sign(http.MethodGet, "http://example.com/items", "", "k2", "secret2", time.Now())
+	assert.Equal("", v.Handle(ctx))
+	v = createValidator(strings.Replace(yamlConfig, "secret1", "secret3", 1), v, nil)
+	assert.Equal(resultInvalid, v.Handle(ctx))
+	ctx = sign(http.MethodGet, "http://example.com/items", "", "k1", "secret3", time.Now())
+	assert.Equal("", v.Handle(ctx))
+
+	spec := &HMACTokenValidatorSpec{Secrets: []*HMACTokenSecret{{ID: "a"}, {ID: "a"}}}
+	assert.Error(spec.Validate())
+	spec = &HMACTokenValidatorSpec{Secrets: []*HMACTokenSecret{{ID: "a"}}, Tolerance: "-1s"}
+	assert.Error(spec.Validate())
+}
+
 func check(e error) {
 	if e != nil {
 		panic(e)
@@ -0,0 +1,312 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookverifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/fasttime"
+	"github.com/megaease/easegress/pkg/util/stringtool"
+)
+
+const (
+	// Kind is the kind of WebhookVerifier.
+	Kind = "WebhookVerifier"
+
+	defaultTolerance = 5 * time.Minute
+
+	resultInvalid = "invalid"
+)
+
+var kind = &filters.Kind{
+	Name:        Kind,
+	Description: "WebhookVerifier verifies the HMAC signature of webhook requests.",
+	Results:     []string{resultInvalid},
+	DefaultSpec: func() filters.Spec {
+		return &Spec{}
+	},
+	CreateInstance: func(spec filters.Spec) filters.Filter {
+		return &WebhookVerifier{spec: spec.(*Spec)}
+	},
+}
+
+func init() {
+	filters.Register(kind)
+}
+
+type (
+	// WebhookVerifier is filter WebhookVerifier.
+	WebhookVerifier struct {
+		spec     *Spec
+		partners []*partner
+
+		numOfVerified int64
+		numOfFailed   int64
+	}
+
+	// Spec describes the WebhookVerifier.
+	Spec struct {
+		filters.BaseSpec `json:",inline"`
+
+		Partners []*PartnerSpec `json:"partners" jsonschema:"required,minItems=1"`
+	}
+
+	// PartnerSpec describes how to verify the webhook requests of a partner.
+	PartnerSpec struct {
+		Name            string `json:"name" jsonschema:"required"`
+		PathPrefix      string `json:"pathPrefix" jsonschema:"omitempty"`
+		HeaderName      string `json:"headerName" jsonschema:"omitempty"`
+		HeaderValue     string `json:"headerValue" jsonschema:"omitempty"`
+		Secret          string `json:"secret" jsonschema:"required"`
+		Algorithm       string `json:"algorithm" jsonschema:"omitempty,enum=,enum=sha1,enum=sha256,enum=sha512"`
+		Encoding        string `json:"encoding" jsonschema:"omitempty,enum=,enum=hex,enum=base64"`
+		SignatureHeader string `json:"signatureHeader" jsonschema:"required"`
+		SignaturePrefix string `json:"signaturePrefix" jsonschema:"omitempty"`
+		TimestampHeader string `json:"timestampHeader" jsonschema:"omitempty"`
+		SignTimestamp   bool   `json:"signTimestamp" jsonschema:"omitempty"`
+		Tolerance       string `json:"tolerance" jsonschema:"omitempty,format=duration"`
+	}
+
+	// Status is the status of WebhookVerifier.
+	Status struct {
+		NumOfVerified int64 `json:"numOfVerified"`
+		NumOfFailed   int64 `json:"numOfFailed"`
+	}
+
+	partner struct {
+		spec      *PartnerSpec
+		hash      func() hash.Hash
+		tolerance time.Duration
+	}
+)
+
+var _ filters.Filter = (*WebhookVerifier)(nil)
+
+// Validate validates the spec.
+func (spec *Spec) Validate() error {
+	for _, p := range spec.Partners {
+		if p.PathPrefix == "" && p.HeaderName == "" {
+			return fmt.Errorf("partner %s: one of pathPrefix and headerName is required", p.Name)
+		}
+		if p.SignTimestamp && p.TimestampHeader == "" {
+			return fmt.Errorf("partner %s: timestampHeader is required to sign timestamp", p.Name)
+		}
+		// an unsigned timestamp could be replaced by attackers, so
+		// checking it gives no replay protection.
+		if p.TimestampHeader != "" && !p.SignTimestamp {
+			return fmt.Errorf("partner %s: signTimestamp is required to check timestamp", p.Name)
+		}
+		if p.Tolerance != "" {
+			if d, err := time.ParseDuration(p.Tolerance); err != nil || d <= 0 {
+				return fmt.Errorf("partner %s: invalid tolerance %q", p.Name, p.Tolerance)
+			}
+		}
+	}
+	return nil
+}
+
+func newPartner(spec *PartnerSpec) *partner {
+	p := &partner{spec: spec}
+
+	switch spec.Algorithm {
+	case "sha1":
+		p.hash = sha1.New
+	case "sha512":
+		p.hash = sha512.New
+	default:
+		p.hash = sha256.New
+	}
+
+	p.tolerance, _ = time.ParseDuration(spec.Tolerance)
+	if p.tolerance <= 0 {
+		p.tolerance = defaultTolerance
+	}
+
+	return p
+}
+
+func (p *partner) match(req *httpprot.Request) bool {
+	if p.spec.PathPrefix != "" && !strings.HasPrefix(req.Path(), p.spec.PathPrefix) {
+		return false
+	}
+	if p.spec.HeaderName == "" {
+		return true
+	}
+
+	values := req.HTTPHeader().Values(p.spec.HeaderName)
+	if len(values) == 0 {
+		return false
+	}
+	if p.spec.HeaderValue == "" {
+		return true
+	}
+	for _, v := range values {
+		if v == p.spec.HeaderValue {
+			return true
+		}
+	}
+	return false
+}
+
+// sign returns the encoded signature of the payload.
+func (p *partner) sign(timestamp string, body []byte) string {
+	mac := hmac.New(p.hash, []byte(p.spec.Secret))
+	if p.spec.SignTimestamp {
+		mac.Write([]byte(timestamp))
+		mac.Write([]byte("."))
+	}
+	mac.Write(body)
+
+	if p.spec.Encoding == "base64" {
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *partner) verify(req *httpprot.Request) error {
+	signature := req.HTTPHeader().Get(p.spec.SignatureHeader)
+	if signature == "" {
+		return fmt.Errorf("missing signature")
+	}
+	if !strings.HasPrefix(signature, p.spec.SignaturePrefix) {
+		return fmt.Errorf("malformed signature")
+	}
+	signature = signature[len(p.spec.SignaturePrefix):]
+
+	timestamp := ""
+	if p.spec.TimestampHeader != "" {
+		timestamp = req.HTTPHeader().Get(p.spec.TimestampHeader)
+		sec, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp")
+		}
+		d := fasttime.Now().Sub(time.Unix(sec, 0))
+		if d > p.tolerance || d < -p.tolerance {
+			return fmt.Errorf("timestamp out of tolerance")
+		}
+	}
+
+	// the signature is calculated over the raw body, the body of a stream
+	// request can't be read without consuming it.
+	if req.IsStream() {
+		return fmt.Errorf("stream body is not supported")
+	}
+
+	expected := p.sign(timestamp, req.RawPayload())
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
+
+// Name returns the name of the WebhookVerifier filter instance.
+func (wv *WebhookVerifier) Name() string {
+	return wv.spec.Name()
+}
+
+// Kind returns the kind of WebhookVerifier.
+func (wv *WebhookVerifier) Kind() *filters.Kind {
+	return kind
+}
+
+// Spec returns the spec used by the WebhookVerifier
+func (wv *WebhookVerifier) Spec() filters.Spec {
+	return wv.spec
+}
+
+// Init initializes WebhookVerifier.
+func (wv *WebhookVerifier) Init() {
+	wv.reload()
+}
+
+// Inherit inherits previous generation of WebhookVerifier.
+func (wv *WebhookVerifier) Inherit(previousGeneration filters.Filter) {
+	wv.reload()
+}
+
+func (wv *WebhookVerifier) reload() {
+	for _, spec := range wv.spec.Partners {
+		wv.partners = append(wv.partners, newPartner(spec))
+	}
+}
+
+// Handle verifies the signature of the request with the secret of the
+// first matched partner.
+func (wv *WebhookVerifier) Handle(ctx *context.Context) string {
+	req := ctx.GetInputRequest().(*httpprot.Request)
+
+	var err error
+	p := wv.choosePartner(req)
+	if p == nil {
+		err = fmt.Errorf("no matched partner")
+	} else {
+		err = p.verify(req)
+	}
+
+	if err == nil {
+		atomic.AddInt64(&wv.numOfVerified, 1)
+		return ""
+	}
+
+	atomic.AddInt64(&wv.numOfFailed, 1)
+
+	resp, _ := ctx.GetOutputResponse().(*httpprot.Response)
+	if resp == nil {
+		resp, _ = httpprot.NewResponse(nil)
+	}
+	resp.SetStatusCode(http.StatusUnauthorized)
+	ctx.SetOutputResponse(resp)
+	ctx.AddTag(stringtool.Cat("webhookVerifier: ", err.Error()))
+	return resultInvalid
+}
+
+func (wv *WebhookVerifier) choosePartner(req *httpprot.Request) *partner {
+	for _, p := range wv.partners {
+		if p.match(req) {
+			return p
+		}
+	}
+	return nil
+}
+
+// Status returns status.
+func (wv *WebhookVerifier) Status() interface{} {
+	return &Status{
+		NumOfVerified: atomic.LoadInt64(&wv.numOfVerified),
+		NumOfFailed:   atomic.LoadInt64(&wv.numOfFailed),
+	}
+}
+
+// Close closes WebhookVerifier.
+func (wv *WebhookVerifier) Close() {}
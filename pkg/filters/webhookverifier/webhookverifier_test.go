@@ -0,0 +1,162 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package webhookverifier
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/filters"
+	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+	"github.com/megaease/easegress/pkg/util/codectool"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	logger.InitNop()
+	code := m.Run()
+	os.Exit(code)
+}
+
+const yamlConfig = `
+name: webhook
+kind: WebhookVerifier
+partners:
+- name: github
+  pathPrefix: /webhooks/github
+  secret: github-secret
+  signatureHeader: X-Hub-Signature-256
+  signaturePrefix: sha256=
+- name: partner
+  headerName: X-Partner
+  headerValue: acme
+  secret: acme-secret
+  encoding: base64
+  signatureHeader: X-Signature
+  timestampHeader: X-Timestamp
+  signTimestamp: true
+  tolerance: 1m
+`
+
+func createVerifier(t *testing.T, yamlConfig string) *WebhookVerifier {
+	rawSpec := make(map[string]interface{})
+	codectool.MustUnmarshal([]byte(yamlConfig), &rawSpec)
+	spec, err := filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	wv := kind.CreateInstance(spec).(*WebhookVerifier)
+	wv.Init()
+	return wv
+}
+
+func newContext(t *testing.T, path string, header map[string]string, body string) *context.Context {
+	stdr, _ := http.NewRequest(http.MethodPost, "http://example.com"+path, strings.NewReader(body))
+	for k, v := range header {
+		stdr.Header.Set(k, v)
+	}
+	req, err := httpprot.NewRequest(stdr)
+	assert.NoError(t, err)
+	req.FetchPayload(0)
+
+	ctx := context.New(nil)
+	ctx.SetInputRequest(req)
+	return ctx
+}
+
+func hmacSHA256(secret, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+func TestSpecValidate(t *testing.T) {
+	rawSpec := map[string]interface{}{
+		"name": "webhook",
+		"kind": Kind,
+		"partners": []map[string]interface{}{{
+			"name":            "p",
+			"secret":          "s",
+			"signatureHeader": "X-Signature",
+		}},
+	}
+	_, err := filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["partners"].([]map[string]interface{})[0]["pathPrefix"] = "/"
+	rawSpec["partners"].([]map[string]interface{})[0]["signTimestamp"] = true
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+
+	rawSpec["partners"].([]map[string]interface{})[0]["timestampHeader"] = "X-Timestamp"
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.NoError(t, err)
+
+	// the timestamp must be signed to be checked.
+	rawSpec["partners"].([]map[string]interface{})[0]["signTimestamp"] = false
+	_, err = filters.NewSpec(nil, "", rawSpec)
+	assert.Error(t, err)
+}
+
+func TestWebhookVerifier(t *testing.T) {
+	assert := assert.New(t)
+
+	wv := createVerifier(t, yamlConfig)
+	body := `{"action":"opened"}`
+
+	// github style signature
+	sig := "sha256=" + hex.EncodeToString(hmacSHA256("github-secret", body))
+	ctx := newContext(t, "/webhooks/github", map[string]string{"X-Hub-Signature-256": sig}, body)
+	assert.Equal("", wv.Handle(ctx))
+
+	ctx = newContext(t, "/webhooks/github", map[string]string{"X-Hub-Signature-256": sig}, body+" ")
+	assert.Equal(resultInvalid, wv.Handle(ctx))
+	assert.Equal(http.StatusUnauthorized, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// signature with timestamp
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	sig = base64.StdEncoding.EncodeToString(hmacSHA256("acme-secret", ts+"."+body))
+	header := map[string]string{"X-Partner": "acme", "X-Signature": sig, "X-Timestamp": ts}
+	ctx = newContext(t, "/hooks", header, body)
+	assert.Equal("", wv.Handle(ctx))
+
+	// replayed request
+	ts = strconv.FormatInt(time.Now().Add(-2*time.Minute).Unix(), 10)
+	header["X-Signature"] = base64.StdEncoding.EncodeToString(hmacSHA256("acme-secret", ts+"."+body))
+	header["X-Timestamp"] = ts
+	ctx = newContext(t, "/hooks", header, body)
+	assert.Equal(resultInvalid, wv.Handle(ctx))
+
+	// no matched partner
+	header["X-Partner"] = "other"
+	ctx = newContext(t, "/hooks", header, body)
+	assert.Equal(resultInvalid, wv.Handle(ctx))
+
+	status := wv.Status().(*Status)
+	assert.Equal(int64(2), status.NumOfVerified)
+	assert.Equal(int64(3), status.NumOfFailed)
+}
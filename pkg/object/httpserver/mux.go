@@ -58,6 +58,24 @@ type (
 		topN     *httpstat.TopN
 
 		inst atomic.Value // *muxInstance
+
+		// number of requests being served.
+		inflight int64
+
+		expectContinue *expectContinueStat
+	}
+
+	// expectContinueStat counts the requests with "Expect: 100-continue".
+	expectContinueStat struct {
+		numOfGateway int64
+		numOfBackend int64
+	}
+
+	// ExpectContinueStatus is the status of the requests with
+	// "Expect: 100-continue".
+	ExpectContinueStatus struct {
+		NumOfGateway int64 `json:"numOfGateway"`
+		NumOfBackend int64 `json:"numOfBackend"`
 	}
 
 	muxInstance struct {
@@ -67,6 +85,7 @@ type (
 		topN               *httpstat.TopN
 		metrics            *metrics
 		accessLogFormatter *accessLogFormatter
+		expectContinue     *expectContinueStat
 
 		muxMapper context.MuxMapper
 
@@ -131,8 +150,9 @@ func (mi *muxInstance) putRouteToCache(req *httpprot.Request, rc *cachedRoute) {
 func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN,
 	metrics *metrics, mapper context.MuxMapper) *mux {
 	m := &mux{
-		httpStat: httpStat,
-		topN:     topN,
+		httpStat:       httpStat,
+		topN:           topN,
+		expectContinue: &expectContinueStat{},
 	}
 
 	m.inst.Store(&muxInstance{
@@ -142,6 +162,8 @@ func newMux(httpStat *httpstat.HTTPStat, topN *httpstat.TopN,
 		httpStat:  httpStat,
 		topN:      topN,
 		metrics:   metrics,
+
+		expectContinue: m.expectContinue,
 	})
 
 	return m
@@ -184,6 +206,7 @@ func (m *mux) reload(superSpec *supervisor.Spec, muxMapper context.MuxMapper) {
 		ipFilter:           ipfilter.New(spec.IPFilterSpec),
 		tracer:             tracer,
 		accessLogFormatter: newAccessLogFormatter(spec.AccessLogFormat),
+		expectContinue:     m.expectContinue,
 	}
 	spec.Rules.Init()
 	inst.router = routers.Create(routerKind, spec.Rules)
@@ -208,10 +231,24 @@ func (m *mux) ServeHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 		return
 	}
 
+	atomic.AddInt64(&m.inflight, 1)
+	defer atomic.AddInt64(&m.inflight, -1)
+
 	// Forward to the current muxInstance to handle the request.
 	m.inst.Load().(*muxInstance).serveHTTP(stdw, stdr)
 }
 
+func (m *mux) inflightRequests() int64 {
+	return atomic.LoadInt64(&m.inflight)
+}
+
+func (s *expectContinueStat) status() *ExpectContinueStatus {
+	return &ExpectContinueStatus{
+		NumOfGateway: atomic.LoadInt64(&s.numOfGateway),
+		NumOfBackend: atomic.LoadInt64(&s.numOfBackend),
+	}
+}
+
 func buildFailureResponse(ctx *context.Context, statusCode int) *httpprot.Response {
 	resp, _ := httpprot.NewResponse(nil)
 	resp.SetStatusCode(statusCode)
@@ -269,6 +306,17 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	route := mi.search(routeCtx)
 	var respHeader http.Header
 
+	// The Go HTTP server sends "100 Continue" on the first read of the
+	// body of a request with "Expect: 100-continue", expectContinue is
+	// true if the expectation is handled by the backend.
+	hasExpect := strings.EqualFold(stdr.Header.Get("Expect"), "100-continue")
+	expectContinue := hasExpect && mi.spec.ExpectContinue == expectContinueBackend
+	if hasExpect && !expectContinue {
+		// the body is read by the gateway, so the expectation must not
+		// be sent to the backend.
+		stdr.Header.Del("Expect")
+	}
+
 	defer func() {
 		metric, _ := ctx.GetData("HTTP_METRIC").(*httpstat.Metric)
 
@@ -277,8 +325,13 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 			ctx.Finish()
 
 			// Drain off the body if it has not been, so that we can get the
-			// correct body size.
-			io.Copy(io.Discard, body)
+			// correct body size. But if the client is still waiting for
+			// "100 Continue", e.g. the backend rejected the expectation,
+			// reading the body sends it, the body must be left unread, and
+			// the connection is closed by the Go HTTP server.
+			if !expectContinue || body.BytesRead() > 0 {
+				io.Copy(io.Discard, body)
+			}
 
 			metric = &httpstat.Metric{
 				StatusCode: statusCode,
@@ -316,6 +369,12 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 				ReqHeaders:  printHeader(stdr.Header),
 				RespHeaders: printHeader(respHeader),
 			}
+			if lr, ok := ctx.GetData(httpprot.LogRedactorDataKey).(httpprot.LogRedactor); ok {
+				log.URI = lr.RedactString(log.URI)
+				log.Tags = lr.RedactString(log.Tags)
+				log.ReqHeaders = printHeader(lr.RedactHeader(stdr.Header))
+				log.RespHeaders = printHeader(lr.RedactHeader(respHeader))
+			}
 			return mi.accessLogFormatter.format(log)
 		})
 	}()
@@ -344,6 +403,15 @@ func (mi *muxInstance) serveHTTP(stdw http.ResponseWriter, stdr *http.Request) {
 	if maxBodySize == 0 {
 		maxBodySize = mi.spec.ClientMaxBodySize
 	}
+	if expectContinue {
+		// the body is sent as a stream to the backend after it accepts
+		// the expectation, as the Go HTTP client relays the expectation
+		// and waits for the response of the backend before sending it.
+		atomic.AddInt64(&mi.expectContinue.numOfBackend, 1)
+		maxBodySize = -1
+	} else if hasExpect {
+		atomic.AddInt64(&mi.expectContinue.numOfGateway, 1)
+	}
 	err := req.FetchPayload(maxBodySize)
 	if err == httpprot.ErrRequestEntityTooLarge {
 		logger.Errorf("%s: %s, you may need to increase 'clientMaxBodySize' or set it to -1", mi.superSpec.Name(), err.Error())
@@ -19,6 +19,7 @@ package httpserver
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -214,6 +215,68 @@ rules:
 	assert.Equal(http.StatusBadRequest, stdw.Code)
 }
 
+func TestServeHTTPExpectContinue(t *testing.T) {
+	assert := assert.New(t)
+
+	mm := &contexttest.MockedMuxMapper{}
+	m := newMux(httpstat.New(), httpstat.NewTopN(10), newMockMetrics(), mm)
+
+	var req *httpprot.Request
+	mm.MockedGetHandler = func(name string) (context.Handler, bool) {
+		return &contexttest.MockedHandler{
+			MockedHandle: func(ctx *context.Context) string {
+				req = ctx.GetInputRequest().(*httpprot.Request)
+				return ""
+			},
+		}, true
+	}
+
+	yamlConfig := `
+kind: HTTPServer
+name: test
+port: 8080
+keepAlive: true
+https: false
+rules:
+- paths:
+  - pathPrefix: /
+    backend: pipeline
+`
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	newRequest := func() *http.Request {
+		stdr, _ := http.NewRequest(http.MethodPost, "http://www.megaease.com/abc", strings.NewReader("hello"))
+		stdr.Header.Set("Expect", "100-continue")
+		return stdr
+	}
+
+	// the gateway reads the body, and removes the expectation.
+	m.ServeHTTP(httptest.NewRecorder(), newRequest())
+	assert.False(req.IsStream())
+	assert.Equal("hello", string(req.RawPayload()))
+	assert.Equal("", req.HTTPHeader().Get("Expect"))
+
+	// the backend handles the expectation.
+	superSpec, err = supervisor.NewSpec(yamlConfig + "expectContinue: backend\n")
+	assert.NoError(err)
+	m.reload(superSpec, mm)
+
+	stdr := newRequest()
+	m.ServeHTTP(httptest.NewRecorder(), stdr)
+	assert.True(req.IsStream())
+	assert.Equal("100-continue", req.HTTPHeader().Get("Expect"))
+
+	// the body is left unread
+	body, _ := io.ReadAll(stdr.Body)
+	assert.Equal("hello", string(body))
+
+	status := m.expectContinue.status()
+	assert.Equal(int64(1), status.NumOfGateway)
+	assert.Equal(int64(1), status.NumOfBackend)
+}
+
 func TestMuxInstanceSearch(t *testing.T) {
 	assert := assert.New(t)
 
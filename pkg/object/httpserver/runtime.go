@@ -22,6 +22,7 @@ import (
 	stdcontext "context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"reflect"
@@ -34,6 +35,7 @@ import (
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/graceupdate"
 	"github.com/megaease/easegress/pkg/logger"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/protocols/httpprot/httpstat"
 	"github.com/megaease/easegress/pkg/supervisor"
 	"github.com/megaease/easegress/pkg/util/easemonitor"
@@ -50,6 +52,10 @@ const (
 
 	topNum = 10
 
+	acceptOverflowReset = "reset"
+
+	expectContinueBackend = "backend"
+
 	stateNil     stateType = "nil"
 	stateFailed  stateType = "failed"
 	stateRunning stateType = "running"
@@ -91,7 +97,8 @@ type (
 		httpStat      *httpstat.HTTPStat
 		topN          *httpstat.TopN
 		metrics       *metrics
-		limitListener *limitlistener.LimitListener
+		limitListener atomic.Value // *limitlistener.LimitListener
+		maxInflight   int64
 	}
 
 	// Status contains all status generated by runtime, for displaying to users.
@@ -103,7 +110,10 @@ type (
 		Error string    `json:"error,omitempty"`
 
 		*httpstat.Status
-		TopN []*httpstat.Item `json:"topN"`
+		TopN     []*httpstat.Item      `json:"topN"`
+		Listener *limitlistener.Status `json:"listener,omitempty"`
+
+		ExpectContinue *ExpectContinueStatus `json:"expectContinue"`
 	}
 )
 
@@ -137,14 +147,22 @@ func (r *runtime) Close() {
 func (r *runtime) Status() *Status {
 	health := r.getError().Error()
 
-	return &Status{
+	s := &Status{
 		Name:   r.superSpec.Name(),
 		Health: health,
 		State:  r.getState(),
 		Error:  r.getError().Error(),
 		Status: r.httpStat.Status(),
 		TopN:   r.topN.Status(),
+
+		ExpectContinue: r.mux.expectContinue.status(),
 	}
+
+	if ll := r.getLimitListener(); ll != nil {
+		s.Listener = ll.Status()
+	}
+
+	return s
 }
 
 // FSM is the finite-state-machine for the runtime.
@@ -175,9 +193,14 @@ func (r *runtime) reload(nextSuperSpec *supervisor.Spec, muxMapper context.MuxMa
 
 	nextSpec := nextSuperSpec.ObjectSpec().(*Spec)
 
-	// r.limitListener is not created just after the process started and the config load for the first time.
-	if nextSpec != nil && r.limitListener != nil {
-		r.limitListener.SetMaxConnection(nextSpec.MaxConnections)
+	if nextSpec != nil {
+		atomic.StoreInt64(&r.maxInflight, int64(nextSpec.MaxInflight))
+	}
+
+	// limitListener is not created just after the process started and the config load for the first time.
+	if ll := r.getLimitListener(); nextSpec != nil && ll != nil {
+		ll.SetMaxConnection(nextSpec.MaxConnections)
+		ll.SetResetOnOverflow(nextSpec.AcceptOverflow == acceptOverflowReset)
 	}
 
 	// NOTE: Due to the mechanism of supervisor,
@@ -230,12 +253,30 @@ func (r *runtime) getError() error {
 	return err.(error)
 }
 
+func (r *runtime) setLimitListener(ll *limitlistener.LimitListener) {
+	r.limitListener.Store(ll)
+}
+
+func (r *runtime) getLimitListener() *limitlistener.LimitListener {
+	ll, _ := r.limitListener.Load().(*limitlistener.LimitListener)
+	return ll
+}
+
+// isOverloaded returns whether the number of in-flight requests reaches
+// the limit.
+func (r *runtime) isOverloaded() bool {
+	max := atomic.LoadInt64(&r.maxInflight)
+	return max > 0 && r.mux.inflightRequests() >= max
+}
+
 func (r *runtime) needRestartServer(nextSpec *Spec) bool {
 	x := *r.spec
 	y := *nextSpec
 
 	// The change of options below need not restart the HTTP server.
 	x.MaxConnections, y.MaxConnections = 0, 0
+	x.MaxInflight, y.MaxInflight = 0, 0
+	x.AcceptOverflow, y.AcceptOverflow = "", ""
 	x.CacheSize, y.CacheSize = 0, 0
 	x.XForwardedFor, y.XForwardedFor = false, false
 	x.Tracing, y.Tracing = nil, nil
@@ -306,6 +347,9 @@ func (r *runtime) startHTTP1And2Server() {
 		Handler:     r.mux,
 		IdleTimeout: keepAliveTimeout,
 		ErrorLog:    log.New(fw, "", log.LstdFlags),
+		ConnContext: func(ctx stdcontext.Context, c net.Conn) stdcontext.Context {
+			return httpprot.WithClientHelloHolder(ctx)
+		},
 	}
 	r.server.SetKeepAlivesEnabled(r.spec.KeepAlive)
 
@@ -316,7 +360,9 @@ func (r *runtime) startHTTP1And2Server() {
 		return
 	}
 	limitListener := limitlistener.NewLimitListener(listener, r.spec.MaxConnections)
-	r.limitListener = limitListener
+	limitListener.SetResetOnOverflow(r.spec.AcceptOverflow == acceptOverflowReset)
+	limitListener.SetOverloadChecker(r.isOverloaded)
+	r.setLimitListener(limitListener)
 
 	// to avoid data race
 	spec := r.spec
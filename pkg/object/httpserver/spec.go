@@ -25,6 +25,7 @@ import (
 
 	"github.com/megaease/easegress/pkg/object/autocertmanager"
 	"github.com/megaease/easegress/pkg/object/httpserver/routers"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
 	"github.com/megaease/easegress/pkg/tracing"
 	"github.com/megaease/easegress/pkg/util/ipfilter"
 )
@@ -41,6 +42,9 @@ type (
 		ClientMaxBodySize int64         `json:"clientMaxBodySize" jsonschema:"omitempty"`
 		KeepAliveTimeout  string        `json:"keepAliveTimeout" jsonschema:"omitempty,format=duration"`
 		MaxConnections    uint32        `json:"maxConnections" jsonschema:"omitempty,minimum=1"`
+		MaxInflight       uint32        `json:"maxInflight" jsonschema:"omitempty"`
+		AcceptOverflow    string        `json:"acceptOverflow" jsonschema:"omitempty,enum=,enum=wait,enum=reset"`
+		ExpectContinue    string        `json:"expectContinue" jsonschema:"omitempty,enum=,enum=gateway,enum=backend"`
 		CacheSize         uint32        `json:"cacheSize" jsonschema:"omitempty"`
 		Tracing           *tracing.Spec `json:"tracing,omitempty" jsonschema:"omitempty"`
 		CaCertBase64      string        `json:"caCertBase64" jsonschema:"omitempty,format=base64"`
@@ -136,6 +140,9 @@ func (spec *Spec) tlsConfig() (*tls.Config, error) {
 		NextProtos:   []string{"acme-tls/1"},
 	}
 	tlsConf.GetCertificate = func(chi *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		// keep the ClientHello for filters, e.g. to calculate the JA3
+		// fingerprint of the client.
+		httpprot.StoreClientHello(chi)
 		return autocertmanager.GetCertificate(chi, !spec.AutoCert /* tokenOnly */)
 	}
 
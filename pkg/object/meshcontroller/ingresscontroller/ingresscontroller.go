@@ -70,7 +70,7 @@ func New(superSpec *supervisor.Spec) *IngressController {
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 
-	store := storage.New(superSpec.Name(), superSpec.Super().Cluster())
+	store := storage.New(superSpec.Name(), superSpec.ObjectSpec().(*spec.Admin).RegistryPrefix, superSpec.Super().Cluster())
 
 	instanceID := os.Getenv(spec.PodEnvHostname)
 	applicationIP := os.Getenv(spec.PodEnvApplicationIP)
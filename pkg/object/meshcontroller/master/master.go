@@ -19,6 +19,7 @@ package master
 
 import (
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
 	"github.com/megaease/easegress/pkg/api"
@@ -49,16 +50,20 @@ type (
 		store          storage.Storage
 		service        *service.Service
 
-		done chan struct{}
+		// ready is set to 1 once the service registry is loaded.
+		ready int32
+		done  chan struct{}
 	}
 
 	// Status is the status of mesh master.
-	Status struct{}
+	Status struct {
+		Ready bool `json:"ready"`
+	}
 )
 
 // New creates a mesh master.
 func New(superSpec *supervisor.Spec) *Master {
-	store := storage.New(superSpec.Name(), superSpec.Super().Cluster())
+	store := storage.New(superSpec.Name(), superSpec.ObjectSpec().(*spec.Admin).RegistryPrefix, superSpec.Super().Cluster())
 	adminSpec := superSpec.ObjectSpec().(*spec.Admin)
 
 	m := &Master{
@@ -118,6 +123,10 @@ func (m *Master) run() {
 		case <-ticker.C:
 			if m.needHandle() {
 				m.checkServiceInstances()
+			} else {
+				// only the leader handles the registry, others are
+				// ready once they are running.
+				atomic.StoreInt32(&m.ready, 1)
 			}
 		}
 	}
@@ -138,6 +147,7 @@ func (m *Master) checkServiceInstances() {
 
 	statuses := m.service.ListAllServiceInstanceStatuses()
 	specs := m.service.ListAllServiceInstanceSpecs()
+	atomic.StoreInt32(&m.ready, 1)
 
 	for _, _spec := range specs {
 		if !m.isMeshRegistryName(_spec.RegistryName) {
@@ -246,9 +256,14 @@ func (m *Master) Close() {
 	close(m.done)
 }
 
+// Ready returns whether the master has loaded the service registry.
+func (m *Master) Ready() bool {
+	return atomic.LoadInt32(&m.ready) == 1
+}
+
 // Status returns the status of master.
 func (m *Master) Status() *supervisor.Status {
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: &Status{Ready: m.Ready()},
 	}
 }
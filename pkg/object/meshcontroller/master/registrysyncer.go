@@ -60,7 +60,7 @@ func newRegistrySyncer(superSpec *supervisor.Spec) *registrySyncer {
 		done: make(chan struct{}),
 	}
 
-	store := storage.New(superSpec.Name(), superSpec.Super().Cluster())
+	store := storage.New(superSpec.Name(), spec.RegistryPrefix, superSpec.Super().Cluster())
 	rs.service = service.New(superSpec)
 
 	if spec.CleanExternalRegistry {
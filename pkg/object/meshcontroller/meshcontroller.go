@@ -18,6 +18,8 @@
 package meshcontroller
 
 import (
+	"sync/atomic"
+
 	"github.com/megaease/easegress/pkg/logger"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/api"
 	"github.com/megaease/easegress/pkg/object/meshcontroller/ingresscontroller"
@@ -48,6 +50,10 @@ type (
 		master            *master.Master
 		worker            *worker.Worker
 		ingressController *ingresscontroller.IngressController
+
+		// ready holds the readiness check of the role, which is stored
+		// at the end of reload, so Ready is safe to call at any time.
+		ready atomic.Value
 	}
 )
 
@@ -128,6 +134,24 @@ func (mc *MeshController) reload() {
 		mc.role = label.ValueRoleIngressController
 		mc.ingressController = ingresscontroller.New(mc.superSpec)
 	}
+
+	switch {
+	case mc.master != nil:
+		mc.ready.Store(mc.master.Ready)
+	case mc.worker != nil:
+		mc.ready.Store(mc.worker.Ready)
+	default:
+		// the ingress controller is synced when it is created.
+		mc.ready.Store(func() bool { return true })
+	}
+}
+
+// Ready returns whether the MeshController has finished its initial sync
+// and is ready to serve: the master has loaded the service registry, or
+// the worker has registered its service instance.
+func (mc *MeshController) Ready() bool {
+	ready, _ := mc.ready.Load().(func() bool)
+	return ready != nil && ready()
 }
 
 // Status returns the status of MeshController.
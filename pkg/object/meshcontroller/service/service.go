@@ -48,13 +48,18 @@ type (
 
 // New creates a service with spec
 func New(superSpec *supervisor.Spec) *Service {
-	kindPrefix := layout.CustomResourceKindPrefix()
-	dataPrefix := layout.AllCustomResourcePrefix()
+	adminSpec := superSpec.ObjectSpec().(*spec.Admin)
+	cls := superSpec.Super().Cluster()
+
+	// custom data is accessed by its own store, so the registry prefix
+	// is added to its prefixes too.
+	kindPrefix := storage.Key(adminSpec.RegistryPrefix, layout.CustomResourceKindPrefix())
+	dataPrefix := storage.Key(adminSpec.RegistryPrefix, layout.AllCustomResourcePrefix())
 	s := &Service{
 		superSpec: superSpec,
-		spec:      superSpec.ObjectSpec().(*spec.Admin),
-		store:     storage.New(superSpec.Name(), superSpec.Super().Cluster()),
-		cds:       customdata.NewStore(superSpec.Super().Cluster(), kindPrefix, dataPrefix),
+		spec:      adminSpec,
+		store:     storage.New(superSpec.Name(), adminSpec.RegistryPrefix, cls),
+		cds:       customdata.NewStore(cls, kindPrefix, dataPrefix),
 	}
 
 	return s
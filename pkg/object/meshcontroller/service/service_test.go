@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package service_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/megaease/easegress/pkg/cluster"
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/option"
+	"github.com/megaease/easegress/pkg/supervisor"
+	"github.com/stretchr/testify/assert"
+
+	_ "github.com/megaease/easegress/pkg/object/meshcontroller"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/service"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/spec"
+)
+
+func newService(t *testing.T, cls cluster.Cluster, prefix string) *service.Service {
+	super := supervisor.NewMock(option.New(), cls, sync.Map{}, sync.Map{}, nil, nil, false, nil, nil)
+	superSpec, err := super.NewSpec(`
+name: mesh-controller
+kind: MeshController
+heartbeatInterval: 5s
+registryType: consul
+apiPort: 13009
+ingressPort: 13010
+registryPrefix: ` + prefix)
+	assert.NoError(t, err)
+	return service.New(superSpec)
+}
+
+func TestRegistryPrefixIsolation(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, data := clustertest.NewMemoryCluster()
+	svcA := newService(t, cls, "team-a")
+	svcB := newService(t, cls, "team-b")
+	svcDefault := newService(t, cls, `""`)
+
+	svcA.PutServiceSpec(&spec.Service{Name: "order"})
+	svcB.PutServiceSpec(&spec.Service{Name: "payment"})
+
+	kind := &spec.CustomResourceKind{Name: "circuitbreaker"}
+	svcA.PutCustomResourceKind(kind, false)
+	svcA.PutCustomResource(spec.CustomResource{"kind": "circuitbreaker", "name": "cb-a"}, false)
+
+	// the controllers only see their own services and custom resources.
+	services := svcA.ListServiceSpecs()
+	assert.Len(services, 1)
+	assert.Equal("order", services[0].Name)
+
+	services = svcB.ListServiceSpecs()
+	assert.Len(services, 1)
+	assert.Equal("payment", services[0].Name)
+	assert.Empty(svcDefault.ListServiceSpecs())
+
+	assert.Len(svcA.ListCustomResourceKinds(), 1)
+	assert.Len(svcA.ListCustomResources("circuitbreaker"), 1)
+	assert.Empty(svcB.ListCustomResourceKinds())
+	assert.Nil(svcB.GetCustomResourceKind("circuitbreaker"))
+	assert.Empty(svcDefault.ListCustomResourceKinds())
+
+	// the same kind is created in another mesh independently.
+	svcB.PutCustomResourceKind(kind, false)
+	assert.Empty(svcB.ListCustomResources("circuitbreaker"))
+
+	// keys of meshes with a prefix are out of the keys of the default mesh.
+	for key := range data {
+		assert.True(strings.HasPrefix(key, "/mesh-registries/team-"), key)
+	}
+}
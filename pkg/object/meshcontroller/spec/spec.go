@@ -19,6 +19,7 @@ package spec
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/megaease/easegress/pkg/cluster/customdata"
@@ -88,6 +89,10 @@ const (
 )
 
 var (
+	// registryPrefixRegexp matches the characters safe in a key, a prefix
+	// must not contain '/', so that it is a single segment of the keys.
+	registryPrefixRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
 	// ErrParamNotMatch means RESTful request URL's object name or other fields are not matched in this request's body
 	ErrParamNotMatch = fmt.Errorf("param in url and body's spec not matched")
 	// ErrAlreadyRegistered indicates this instance has already been registered
@@ -115,6 +120,10 @@ type (
 		// IngressPort is the port for http server in mesh ingress
 		IngressPort int `json:"ingressPort" jsonschema:"required"`
 
+		// RegistryPrefix isolates the data of meshes sharing a cluster,
+		// keys of the mesh are stored under it.
+		RegistryPrefix string `json:"registryPrefix" jsonschema:"omitempty"`
+
 		ExternalServiceRegistry string `json:"externalServiceRegistry" jsonschema:"omitempty"`
 
 		CleanExternalRegistry bool `json:"cleanExternalRegistry"`
@@ -493,12 +502,26 @@ func (tr *TrafficRules) Clone() *TrafficRules {
 
 // Validate validates Spec.
 func (a Admin) Validate() error {
+	// the master and workers start tickers with the interval, an invalid
+	// or non-positive one must be rejected before they are created.
+	heartbeat, err := time.ParseDuration(a.HeartbeatInterval)
+	if err != nil {
+		return fmt.Errorf("parse heartbeatInterval: %s failed: %v", a.HeartbeatInterval, err)
+	}
+	if heartbeat <= 0 {
+		return fmt.Errorf("heartbeatInterval: %s must be positive", a.HeartbeatInterval)
+	}
+
 	switch a.RegistryType {
 	case RegistryTypeConsul, RegistryTypeEureka, RegistryTypeNacos:
 	default:
 		return fmt.Errorf("unsupported registry center type: %s", a.RegistryType)
 	}
 
+	if a.RegistryPrefix != "" && !registryPrefixRegexp.MatchString(a.RegistryPrefix) {
+		return fmt.Errorf("invalid registryPrefix: %s", a.RegistryPrefix)
+	}
+
 	if a.Security != nil {
 		switch a.Security.CertProvider {
 		case CertProviderSelfSign:
@@ -179,6 +179,41 @@ func TestAdminInValidatmTLS5(t *testing.T) {
 	}
 }
 
+func TestAdminInValidatHeartbeat(t *testing.T) {
+	for _, interval := range []string{"", "10", "0s", "-5s"} {
+		a := Admin{
+			RegistryType:      RegistryTypeEureka,
+			HeartbeatInterval: interval,
+		}
+
+		err := a.Validate()
+		if err == nil {
+			t.Errorf("heartbeat interval %q is invalid, should failed", interval)
+		}
+	}
+}
+
+func TestAdminRegistryPrefix(t *testing.T) {
+	for prefix, valid := range map[string]bool{
+		"":        true,
+		"team-a":  true,
+		"mesh_v2": true,
+		"a/b":     false,
+		"-a":      false,
+		"a b":     false,
+	} {
+		a := Admin{
+			RegistryType:      RegistryTypeEureka,
+			HeartbeatInterval: "10s",
+			RegistryPrefix:    prefix,
+		}
+
+		if err := a.Validate(); (err == nil) != valid {
+			t.Errorf("registry prefix %q: expected valid=%v, got err: %v", prefix, valid, err)
+		}
+	}
+}
+
 func TestAdminValidat(t *testing.T) {
 	a := Admin{
 		RegistryType:      "eureka",
@@ -18,7 +18,10 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"go.etcd.io/etcd/api/v3/mvccpb"
@@ -50,17 +53,25 @@ type (
 	}
 
 	clusterStorage struct {
-		name  string
-		cls   cluster.Cluster
-		mutex cluster.Mutex
+		name   string
+		prefix string
+		cls    cluster.Cluster
+		mutex  cluster.Mutex
 	}
 )
 
-// New creates a storage.
-func New(name string, cls cluster.Cluster) Storage {
+// registryPrefixRoot is the root of the keys of meshes with a registry
+// prefix, it is out of the keys of meshes without one.
+const registryPrefixRoot = "/mesh-registries/"
+
+// New creates a storage. If prefix is not empty, keys are stored under
+// it in the cluster, so that meshes sharing a cluster don't see each
+// other's data, and the prefix is invisible to the users of the storage.
+func New(name, prefix string, cls cluster.Cluster) Storage {
 	cs := &clusterStorage{
-		name: name,
-		cls:  cls,
+		name:   name,
+		prefix: Key(prefix, ""),
+		cls:    cls,
 	}
 
 	err := cs.mutexGoReady()
@@ -71,6 +82,15 @@ func New(name string, cls cluster.Cluster) Storage {
 	return cs
 }
 
+// Key returns the key in the cluster of the key of the mesh with the
+// registry prefix, it is for data not accessed through the storage.
+func Key(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return registryPrefixRoot + prefix + key
+}
+
 func (cs *clusterStorage) mutexGoReady() error {
 	if cs.mutex != nil {
 		return nil
@@ -105,45 +125,191 @@ func (cs *clusterStorage) Unlock() error {
 }
 
 func (cs *clusterStorage) Get(key string) (*string, error) {
-	return cs.cls.Get(key)
+	return cs.cls.Get(cs.prefix + key)
 }
 
 func (cs *clusterStorage) GetPrefix(prefix string) (map[string]string, error) {
-	return cs.cls.GetPrefix(prefix)
+	kvs, err := cs.cls.GetPrefix(cs.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	return trimPrefix(kvs, cs.prefix), nil
 }
 
 func (cs *clusterStorage) Put(key, value string) error {
-	return cs.cls.Put(key, value)
+	return cs.cls.Put(cs.prefix+key, value)
 }
 
 func (cs *clusterStorage) PutUnderLease(key, value string) error {
-	return cs.cls.PutUnderLease(key, value)
+	return cs.cls.PutUnderLease(cs.prefix+key, value)
 }
 
 func (cs *clusterStorage) PutAndDelete(kvs map[string]*string) error {
-	return cs.cls.PutAndDelete(kvs)
+	return cs.cls.PutAndDelete(cs.addPrefix(kvs))
 }
 
 func (cs *clusterStorage) PutAndDeleteUnderLease(kvs map[string]*string) error {
-	return cs.cls.PutAndDeleteUnderLease(kvs)
+	return cs.cls.PutAndDeleteUnderLease(cs.addPrefix(kvs))
 }
 
 func (cs *clusterStorage) Delete(key string) error {
-	return cs.cls.Delete(key)
+	return cs.cls.Delete(cs.prefix + key)
 }
 
 func (cs *clusterStorage) DeletePrefix(prefix string) error {
-	return cs.cls.DeletePrefix(prefix)
+	return cs.cls.DeletePrefix(cs.prefix + prefix)
 }
 
 func (cs *clusterStorage) GetRaw(key string) (*mvccpb.KeyValue, error) {
-	return cs.cls.GetRaw(key)
+	kv, err := cs.cls.GetRaw(cs.prefix + key)
+	if err != nil {
+		return nil, err
+	}
+	return trimRawPrefix(kv, cs.prefix), nil
 }
 
 func (cs *clusterStorage) GetRawPrefix(prefix string) (map[string]*mvccpb.KeyValue, error) {
-	return cs.cls.GetRawPrefix(prefix)
+	kvs, err := cs.cls.GetRawPrefix(cs.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	return trimRawPrefixes(kvs, cs.prefix), nil
 }
 
 func (cs *clusterStorage) Syncer() (cluster.Syncer, error) {
-	return cs.cls.Syncer(time.Minute)
+	syncer, err := cs.cls.Syncer(time.Minute)
+	if err != nil || cs.prefix == "" {
+		return syncer, err
+	}
+	return &prefixedSyncer{Syncer: syncer, prefix: cs.prefix, done: make(chan struct{})}, nil
+}
+
+func (cs *clusterStorage) addPrefix(kvs map[string]*string) map[string]*string {
+	if cs.prefix == "" {
+		return kvs
+	}
+	result := make(map[string]*string, len(kvs))
+	for k, v := range kvs {
+		result[cs.prefix+k] = v
+	}
+	return result
+}
+
+func trimPrefix(kvs map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return kvs
+	}
+	result := make(map[string]string, len(kvs))
+	for k, v := range kvs {
+		result[strings.TrimPrefix(k, prefix)] = v
+	}
+	return result
+}
+
+func trimRawPrefix(kv *mvccpb.KeyValue, prefix string) *mvccpb.KeyValue {
+	if prefix == "" || kv == nil {
+		return kv
+	}
+	copied := *kv
+	copied.Key = bytes.TrimPrefix(kv.Key, []byte(prefix))
+	return &copied
+}
+
+func trimRawPrefixes(kvs map[string]*mvccpb.KeyValue, prefix string) map[string]*mvccpb.KeyValue {
+	if prefix == "" {
+		return kvs
+	}
+	result := make(map[string]*mvccpb.KeyValue, len(kvs))
+	for k, v := range kvs {
+		result[strings.TrimPrefix(k, prefix)] = trimRawPrefix(v, prefix)
+	}
+	return result
+}
+
+// syncerChanSize is the buffer size of the channels returned by
+// prefixedSyncer, the same as the ones returned by the cluster syncer.
+const syncerChanSize = 10
+
+// prefixedSyncer syncs the keys under the prefix of the storage, and
+// trims the prefix from the synced keys.
+type prefixedSyncer struct {
+	cluster.Syncer
+	prefix string
+
+	// done is closed when the syncer is closed, to stop the forwarding
+	// goroutines even if nobody reads their channels any more.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *prefixedSyncer) Sync(key string) (<-chan *string, error) {
+	return s.Syncer.Sync(s.prefix + key)
+}
+
+func (s *prefixedSyncer) SyncRaw(key string) (<-chan *mvccpb.KeyValue, error) {
+	in, err := s.Syncer.SyncRaw(s.prefix + key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan *mvccpb.KeyValue, syncerChanSize)
+	go func() {
+		defer close(out)
+		for kv := range in {
+			select {
+			case out <- trimRawPrefix(kv, s.prefix):
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *prefixedSyncer) SyncPrefix(prefix string) (<-chan map[string]string, error) {
+	in, err := s.Syncer.SyncPrefix(s.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan map[string]string, syncerChanSize)
+	go func() {
+		defer close(out)
+		for kvs := range in {
+			select {
+			case out <- trimPrefix(kvs, s.prefix):
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (s *prefixedSyncer) SyncRawPrefix(prefix string) (<-chan map[string]*mvccpb.KeyValue, error) {
+	in, err := s.Syncer.SyncRawPrefix(s.prefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan map[string]*mvccpb.KeyValue, syncerChanSize)
+	go func() {
+		defer close(out)
+		for kvs := range in {
+			select {
+			case out <- trimRawPrefixes(kvs, s.prefix):
+			case <-s.done:
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Close closes the syncer and stops the forwarding goroutines.
+func (s *prefixedSyncer) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.Syncer.Close()
+	})
 }
@@ -0,0 +1,102 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/megaease/easegress/pkg/cluster/clustertest"
+	"github.com/megaease/easegress/pkg/object/meshcontroller/layout"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	cls, data := clustertest.NewMemoryCluster()
+	storeA := New("mesh", "team-a", cls)
+	storeB := New("mesh", "team-b", cls)
+	storeC := New("mesh", "", cls)
+
+	assert.NoError(storeA.Put(layout.ServiceSpecKey("order"), "a"))
+	assert.NoError(storeB.Put(layout.ServiceSpecKey("order"), "b"))
+	assert.NoError(storeB.Put(layout.ServiceSpecKey("payment"), "b"))
+	assert.Equal("a", data["/mesh-registries/team-a/mesh/service-spec/order"])
+	assert.Equal("b", data["/mesh-registries/team-b/mesh/service-spec/order"])
+
+	// the storages don't see each other's data, and the prefix is
+	// invisible to the users.
+	v, err := storeA.Get(layout.ServiceSpecKey("order"))
+	assert.NoError(err)
+	assert.Equal("a", *v)
+
+	kvs, err := storeA.GetPrefix(layout.ServiceSpecPrefix())
+	assert.NoError(err)
+	assert.Equal(map[string]string{layout.ServiceSpecKey("order"): "a"}, kvs)
+
+	raw, err := storeB.GetRawPrefix(layout.ServiceSpecPrefix())
+	assert.NoError(err)
+	assert.Len(raw, 2)
+	assert.Equal(layout.ServiceSpecKey("payment"), string(raw[layout.ServiceSpecKey("payment")].Key))
+
+	kvs, err = storeC.GetPrefix(layout.ServiceSpecPrefix())
+	assert.NoError(err)
+	assert.Empty(kvs)
+
+	syncer, err := storeB.Syncer()
+	assert.NoError(err)
+	ch, err := syncer.SyncPrefix(layout.ServiceSpecPrefix())
+	assert.NoError(err)
+	kvs = <-ch
+	assert.Len(kvs, 2)
+	assert.Equal("b", kvs[layout.ServiceSpecKey("order")])
+	syncer.Close()
+}
+
+func TestPrefixedSyncerClose(t *testing.T) {
+	assert := assert.New(t)
+
+	in := make(chan map[string]string)
+	inner := clustertest.NewMockedSyncer()
+	inner.MockedSyncPrefix = func(prefix string) (<-chan map[string]string, error) {
+		return in, nil
+	}
+	syncer := &prefixedSyncer{Syncer: inner, prefix: "/a", done: make(chan struct{})}
+
+	out, err := syncer.SyncPrefix("/b")
+	assert.NoError(err)
+
+	// the channel is buffered like the one of the cluster syncer, and the
+	// forwarding goroutine exits on close even if nobody reads it.
+	for i := 0; i < syncerChanSize+1; i++ {
+		in <- map[string]string{"/a/b/c": "d"}
+	}
+	assert.Len(out, syncerChanSize)
+	syncer.Close()
+	syncer.Close()
+
+	assert.Eventually(func() bool {
+		select {
+		case _, ok := <-out:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+}
@@ -79,7 +79,7 @@ func NewEgressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 
-	inf := informer.NewInformer(storage.New(superSpec.Name(), super.Cluster()), serviceName)
+	inf := informer.NewInformer(storage.New(superSpec.Name(), superSpec.ObjectSpec().(*spec.Admin).RegistryPrefix, super.Cluster()), serviceName)
 
 	return &EgressServer{
 		super:     super,
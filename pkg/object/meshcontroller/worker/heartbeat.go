@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// maxHeartbeatBackoff caps the heartbeat interval after consecutive failures.
+const maxHeartbeatBackoff = 5 * time.Minute
+
+type (
+	// heartbeatBackoff computes the heartbeat interval, it stays at the base
+	// interval while heartbeats succeed, and backs off exponentially with
+	// jitter on consecutive failures, so that the recovering registry is not
+	// hit by all the workers at the same moment.
+	heartbeatBackoff struct {
+		base time.Duration
+		max  time.Duration
+
+		mu       sync.Mutex
+		failures int
+		interval time.Duration
+	}
+
+	// HeartbeatStatus is the status of the heartbeat of the worker.
+	HeartbeatStatus struct {
+		ConsecutiveFailures int    `json:"consecutiveFailures"`
+		Interval            string `json:"interval"`
+	}
+)
+
+func newHeartbeatBackoff() *heartbeatBackoff {
+	return &heartbeatBackoff{}
+}
+
+// reset sets the base interval and clears the failures.
+func (b *heartbeatBackoff) reset(base time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.base = base
+	b.max = maxHeartbeatBackoff
+	if b.max < base {
+		b.max = base
+	}
+	b.failures = 0
+	b.interval = base
+}
+
+// next records the result of a heartbeat and returns the interval to wait
+// before the next one.
+func (b *heartbeatBackoff) next(err error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.failures = 0
+		b.interval = b.base
+		return b.interval
+	}
+
+	b.failures++
+	d := b.base
+	for i := 0; i < b.failures && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+
+	// equal jitter: wait at least half of the backoff, but never less than
+	// the base interval.
+	half := d / 2
+	b.interval = half + time.Duration(rand.Int63n(int64(d-half)+1))
+	if b.interval < b.base {
+		b.interval = b.base
+	}
+	return b.interval
+}
+
+func (b *heartbeatBackoff) status() *HeartbeatStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &HeartbeatStatus{
+		ConsecutiveFailures: b.failures,
+		Interval:            b.interval.String(),
+	}
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package worker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	base := 5 * time.Second
+	b := newHeartbeatBackoff()
+	b.reset(base)
+
+	assert.Equal(base, b.next(nil))
+	assert.Equal(base, b.next(nil))
+
+	failed := fmt.Errorf("registry unreachable")
+	prev := base
+	for i := 1; i <= 10; i++ {
+		d := b.next(failed)
+		upper := base << i
+		if upper > maxHeartbeatBackoff {
+			upper = maxHeartbeatBackoff
+		}
+		assert.GreaterOrEqual(d, upper/2)
+		assert.LessOrEqual(d, upper)
+		assert.GreaterOrEqual(d, base)
+		prev = d
+	}
+	assert.LessOrEqual(prev, maxHeartbeatBackoff)
+
+	status := b.status()
+	assert.Equal(10, status.ConsecutiveFailures)
+	assert.Equal(prev.String(), status.Interval)
+
+	assert.Equal(base, b.next(nil))
+	status = b.status()
+	assert.Equal(0, status.ConsecutiveFailures)
+	assert.Equal(base.String(), status.Interval)
+}
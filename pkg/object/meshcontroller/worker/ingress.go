@@ -68,7 +68,7 @@ func NewIngressServer(superSpec *supervisor.Spec, super *supervisor.Supervisor,
 		panic(fmt.Errorf("BUG: want *TrafficController, got %T", entity.Instance()))
 	}
 
-	inf := informer.NewInformer(storage.New(superSpec.Name(), super.Cluster()), serviceName)
+	inf := informer.NewInformer(storage.New(superSpec.Name(), superSpec.ObjectSpec().(*spec.Admin).RegistryPrefix, super.Cluster()), serviceName)
 
 	return &IngressServer{
 		super:     super,
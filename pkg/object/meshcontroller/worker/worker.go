@@ -54,6 +54,7 @@ type (
 		superSpec         *supervisor.Spec
 		spec              *spec.Admin
 		heartbeatInterval time.Duration
+		heartbeatBackoff  *heartbeatBackoff
 
 		// mesh service fields
 		serviceName     string
@@ -76,6 +77,12 @@ type (
 
 		done chan struct{}
 	}
+
+	// Status is the status of mesh worker.
+	Status struct {
+		Ready     bool             `json:"ready"`
+		Heartbeat *HeartbeatStatus `json:"heartbeat"`
+	}
 )
 
 func decodeLabels(labelStr string) map[string]string {
@@ -112,7 +119,7 @@ func New(superSpec *supervisor.Spec) *Worker {
 
 	instanceID := os.Getenv(spec.PodEnvHostname)
 	applicationIP := os.Getenv(spec.PodEnvApplicationIP)
-	store := storage.New(superSpec.Name(), super.Cluster())
+	store := storage.New(superSpec.Name(), _spec.RegistryPrefix, super.Cluster())
 	_service := service.New(superSpec)
 
 	_informer := informer.NewInformer(store, serviceName)
@@ -157,6 +164,8 @@ func New(superSpec *supervisor.Spec) *Worker {
 		observabilityManager: observabilityManager,
 		apiServer:            apiServer,
 
+		heartbeatBackoff: newHeartbeatBackoff(),
+
 		done: make(chan struct{}),
 	}
 
@@ -247,11 +256,13 @@ func (worker *Worker) run() {
 func (worker *Worker) heartbeat() {
 	trafficGateReady := false
 
-	routine := func() {
+	routine := func() (err error) {
 		defer func() {
-			if err := recover(); err != nil {
+			if r := recover(); r != nil {
 				logger.Errorf("%s: recover from: %v, stack trace:\n%s\n",
-					worker.superSpec.Name(), err, debug.Stack())
+					worker.superSpec.Name(), r, debug.Stack())
+				// a panic counts as a failure of the heartbeat.
+				err = fmt.Errorf("heartbeat panicked: %v", r)
 			}
 		}()
 
@@ -265,19 +276,22 @@ func (worker *Worker) heartbeat() {
 		}
 
 		if worker.registryServer.Registered() {
-			err := worker.updateHeartbeat()
+			err = worker.updateHeartbeat()
 			if err != nil {
 				logger.Errorf("update heartbeat failed: %v", err)
 			}
 		}
+		return err
 	}
 
+	worker.heartbeatBackoff.reset(worker.heartbeatInterval)
+	interval := worker.heartbeatInterval
 	for {
 		select {
 		case <-worker.done:
 			return
-		case <-time.After(worker.heartbeatInterval):
-			routine()
+		case <-time.After(interval):
+			interval = worker.heartbeatBackoff.next(routine())
 		}
 	}
 }
@@ -418,10 +432,19 @@ func (worker *Worker) updateHeartbeat() error {
 	return worker.store.Put(layout.ServiceInstanceStatusKey(worker.serviceName, worker.instanceID), string(buff))
 }
 
+// Ready returns whether the worker has registered the service instance,
+// which happens after its traffic gates are created from the service spec.
+func (worker *Worker) Ready() bool {
+	return worker.registryServer.Registered()
+}
+
 // Status returns the status of worker.
 func (worker *Worker) Status() *supervisor.Status {
 	return &supervisor.Status{
-		ObjectStatus: nil,
+		ObjectStatus: &Status{
+			Ready:     worker.Ready(),
+			Heartbeat: worker.heartbeatBackoff.status(),
+		},
 	}
 }
 
@@ -0,0 +1,105 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/megaease/easegress/pkg/util/fasttime"
+)
+
+// outcomes are counted in one-second buckets, so the max window of the
+// success rate is outcomeBuckets seconds.
+const outcomeBuckets = 600
+
+type (
+	// outcomeTracker counts the outcomes of the requests handled by the
+	// pipeline in a ring of one-second buckets, it is safe to record and
+	// query concurrently.
+	outcomeTracker struct {
+		buckets [outcomeBuckets]outcomeBucket
+	}
+
+	outcomeBucket struct {
+		second     int64
+		total      int64
+		successful int64
+	}
+)
+
+// record records the outcome of a request, a request is successful if the
+// result of the pipeline is empty.
+func (t *outcomeTracker) record(now time.Time, successful bool) {
+	sec := now.Unix()
+	b := &t.buckets[sec%outcomeBuckets]
+
+	// the bucket is reused for the current second, the counts of the old
+	// second are reset by the first request of the second. Requests
+	// racing with the reset may be lost, which is acceptable for a
+	// health signal.
+	if old := atomic.LoadInt64(&b.second); old != sec {
+		if atomic.CompareAndSwapInt64(&b.second, old, sec) {
+			atomic.StoreInt64(&b.total, 0)
+			atomic.StoreInt64(&b.successful, 0)
+		}
+	}
+
+	atomic.AddInt64(&b.total, 1)
+	if successful {
+		atomic.AddInt64(&b.successful, 1)
+	}
+}
+
+// successRate returns the fraction of successful requests in the window
+// before now, and the number of requests. The window is rounded up to
+// whole seconds, and is at most outcomeBuckets seconds.
+func (t *outcomeTracker) successRate(now time.Time, window time.Duration) (float64, int64) {
+	seconds := int64((window + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	} else if seconds > outcomeBuckets {
+		seconds = outcomeBuckets
+	}
+
+	var total, successful int64
+	sec := now.Unix()
+	for i := int64(0); i < seconds; i++ {
+		b := &t.buckets[(sec-i)%outcomeBuckets]
+		if atomic.LoadInt64(&b.second) != sec-i {
+			continue
+		}
+		total += atomic.LoadInt64(&b.total)
+		successful += atomic.LoadInt64(&b.successful)
+	}
+
+	if total == 0 {
+		return 1, 0
+	}
+	return float64(successful) / float64(total), total
+}
+
+// Healthy reports whether the success rate of the requests handled by the
+// pipeline in the recent window is not below threshold. A request is
+// successful if the result of the pipeline is empty, and the pipeline is
+// healthy if it handled no requests in the window. The window is at most
+// 10 minutes.
+func (p *Pipeline) Healthy(threshold float64, window time.Duration) bool {
+	rate, _ := p.outcomes.successRate(fasttime.Now(), window)
+	return rate >= threshold
+}
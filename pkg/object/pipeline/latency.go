@@ -0,0 +1,134 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// latencies are recorded in microseconds, values below
+	// 2*latencySubBuckets are exact, and each larger power of two range is
+	// split into latencySubBuckets buckets, so the relative error is at most
+	// 1/latencySubBuckets, like an HDR histogram.
+	latencySubBuckets = 16
+	latencyMaxShift   = 31
+	latencyBuckets    = 2*latencySubBuckets + latencyMaxShift*latencySubBuckets
+)
+
+type (
+	// FilterLatencyStatus is the latency percentiles of a filter.
+	FilterLatencyStatus struct {
+		Count uint64 `json:"count"`
+		P50   string `json:"p50"`
+		P90   string `json:"p90"`
+		P99   string `json:"p99"`
+		P999  string `json:"p999"`
+	}
+
+	// latencyHistogram is a histogram of filter latencies with fixed
+	// buckets, it is safe to record and query concurrently.
+	latencyHistogram struct {
+		buckets [latencyBuckets]uint64
+	}
+)
+
+func latencyBucket(us uint64) int {
+	if us < 2*latencySubBuckets {
+		return int(us)
+	}
+	shift := bits.Len64(us) - 5
+	if shift > latencyMaxShift {
+		return latencyBuckets - 1
+	}
+	return 2*latencySubBuckets + (shift-1)*latencySubBuckets + int(us>>shift) - latencySubBuckets
+}
+
+// latencyBucketMax returns the max latency, in microseconds, of bucket i.
+func latencyBucketMax(i int) uint64 {
+	if i < 2*latencySubBuckets {
+		return uint64(i)
+	}
+	i -= 2 * latencySubBuckets
+	shift := i/latencySubBuckets + 1
+	lower := uint64(i%latencySubBuckets+latencySubBuckets) << shift
+	return lower + 1<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	atomic.AddUint64(&h.buckets[latencyBucket(uint64(d/time.Microsecond))], 1)
+}
+
+// snapshot returns a copy of the buckets and the total count.
+func (h *latencyHistogram) snapshot() (*[latencyBuckets]uint64, uint64) {
+	var buckets [latencyBuckets]uint64
+	total := uint64(0)
+	for i := range h.buckets {
+		buckets[i] = atomic.LoadUint64(&h.buckets[i])
+		total += buckets[i]
+	}
+	return &buckets, total
+}
+
+func percentileOf(buckets *[latencyBuckets]uint64, total uint64, p float64) time.Duration {
+	rank := uint64(math.Ceil(p * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	count := uint64(0)
+	for i, n := range buckets {
+		if count += n; count >= rank {
+			return time.Duration(latencyBucketMax(i)) * time.Microsecond
+		}
+	}
+	return time.Duration(latencyBucketMax(latencyBuckets-1)) * time.Microsecond
+}
+
+// percentile returns the p-th percentile of the latencies, p is in (0, 1].
+// The result is the max latency of the bucket, which is at most 1/16
+// larger than the real value.
+func (h *latencyHistogram) percentile(p float64) (time.Duration, error) {
+	if p <= 0 || p > 1 {
+		return 0, fmt.Errorf("percentile must be in (0, 1]")
+	}
+	buckets, total := h.snapshot()
+	if total == 0 {
+		return 0, fmt.Errorf("no latency recorded")
+	}
+	return percentileOf(buckets, total, p), nil
+}
+
+func (h *latencyHistogram) status() *FilterLatencyStatus {
+	buckets, total := h.snapshot()
+	s := &FilterLatencyStatus{Count: total}
+	if total == 0 {
+		return s
+	}
+	s.P50 = percentileOf(buckets, total, 0.5).String()
+	s.P90 = percentileOf(buckets, total, 0.9).String()
+	s.P99 = percentileOf(buckets, total, 0.99).String()
+	s.P999 = percentileOf(buckets, total, 0.999).String()
+	return s
+}
@@ -59,6 +59,8 @@ type (
 		filters    map[string]filters.Filter
 		flow       []FlowNode
 		resilience map[string]resilience.Policy
+		timeline   *timelineRecorder
+		outcomes   *outcomeTracker
 	}
 
 	// Spec describes the Pipeline.
@@ -67,6 +69,9 @@ type (
 		Filters    []map[string]interface{} `json:"filters" jsonschema:"required"`
 		Resilience []map[string]interface{} `json:"resilience" jsonschema:"omitempty"`
 		Data       map[string]interface{}   `json:"data" jsonschema:"omitempty"`
+		Timeline   *TimelineSpec            `json:"timeline,omitempty" jsonschema:"omitempty"`
+
+		FilterLatency bool `json:"filterLatency" jsonschema:"omitempty"`
 	}
 
 	// FlowNode describes one node of the pipeline flow.
@@ -75,7 +80,11 @@ type (
 		FilterAlias string            `json:"alias" jsonschema:"omitempty"`
 		Namespace   string            `json:"namespace" jsonschema:"omitempty"`
 		JumpIf      map[string]string `json:"jumpIf" jsonschema:"omitempty"`
+		StatusCodes map[string]int    `json:"statusCodes" jsonschema:"omitempty"`
+		Rollout     *RolloutSpec      `json:"rollout,omitempty" jsonschema:"omitempty"`
 		filter      filters.Filter
+		rollout     *rollout
+		latency     *latencyHistogram
 	}
 
 	// FilterStat records the statistics of a filter.
@@ -83,13 +92,18 @@ type (
 		Name     string
 		Kind     string
 		Result   string
+		Start    time.Time
 		Duration time.Duration
 	}
 
 	// Status is the status of Pipeline.
 	Status struct {
-		Health  string                 `json:"health"`
-		Filters map[string]interface{} `json:"filters"`
+		Health    string                    `json:"health"`
+		Filters   map[string]interface{}    `json:"filters"`
+		Timelines []*Timeline               `json:"timelines,omitempty"`
+		Rollouts  map[string]*RolloutStatus `json:"rollouts,omitempty"`
+
+		FilterLatencies map[string]*FilterLatencyStatus `json:"filterLatencies,omitempty"`
 	}
 )
 
@@ -125,7 +139,23 @@ func (s *Spec) ValidateJumpIf(specs map[string]filters.Spec) {
 				panic(fmt.Errorf("duplicated filter name/alias: %s", target))
 			}
 		}
+		for result, code := range node.StatusCodes {
+			if !stringtool.StrInSlice(result, results) {
+				msgFmt := "filter %s: result %s is not in %v"
+				panic(fmt.Errorf(msgFmt, node.FilterName, result, results))
+			}
+			if code < 100 || code > 599 {
+				msgFmt := "filter %s: invalid status code %d of result %s"
+				panic(fmt.Errorf(msgFmt, node.FilterName, code, result))
+			}
+		}
 		validTargets[node.filterAlias()]++
+
+		if node.Rollout != nil {
+			if err := node.Rollout.Validate(); err != nil {
+				panic(fmt.Errorf("filter %s: rollout: %v", node.filterAlias(), err))
+			}
+		}
 	}
 }
 
@@ -171,6 +201,14 @@ func (s *Spec) Validate() (err error) {
 		}
 	}
 
+	// 4: validate timeline
+	if s.Timeline != nil {
+		errPrefix = "timeline"
+		if err := s.Timeline.Validate(); err != nil {
+			panic(err)
+		}
+	}
+
 	return nil
 }
 
@@ -289,12 +327,41 @@ func (p *Pipeline) reload(previousGeneration *Pipeline) {
 
 	p.flow = flow
 
+	// keep the outcomes recorded by the previous generation.
+	if previousGeneration != nil {
+		p.outcomes = previousGeneration.outcomes
+	}
+	if p.outcomes == nil {
+		p.outcomes = &outcomeTracker{}
+	}
+
+	p.timeline = nil
+	if p.spec.Timeline != nil {
+		p.timeline = newTimelineRecorder(p.spec.Timeline)
+	}
+
 	// bind filter instance to flow node.
 	for i := range flow {
 		node := &flow[i]
 		if node.FilterName != BuiltInFilterEnd {
 			node.filter = p.filters[node.FilterName]
 		}
+		if node.Rollout != nil {
+			var prev *rollout
+			if previousGeneration != nil {
+				prev = previousGeneration.getRollout(node.filterAlias())
+			}
+			node.rollout = newRollout(node.Rollout, prev)
+		}
+		if p.spec.FilterLatency && node.filter != nil {
+			// keep the latencies recorded by the previous generation.
+			if previousGeneration != nil {
+				node.latency = previousGeneration.getLatency(node.filterAlias())
+			}
+			if node.latency == nil {
+				node.latency = &latencyHistogram{}
+			}
+		}
 	}
 }
 
@@ -302,6 +369,38 @@ func (p *Pipeline) getFilter(name string) filters.Filter {
 	return p.filters[name]
 }
 
+func (p *Pipeline) getLatency(alias string) *latencyHistogram {
+	for i := range p.flow {
+		if node := &p.flow[i]; node.latency != nil && node.filterAlias() == alias {
+			return node.latency
+		}
+	}
+	return nil
+}
+
+// FilterLatencyPercentile returns the p-th percentile of the latencies of
+// the filter, p is in (0, 1]. The filter is referenced by its alias in the
+// flow, and the filterLatency of the pipeline must be enabled.
+func (p *Pipeline) FilterLatencyPercentile(alias string, percentile float64) (time.Duration, error) {
+	if !p.spec.FilterLatency {
+		return 0, fmt.Errorf("filter latency is not enabled")
+	}
+	latency := p.getLatency(alias)
+	if latency == nil {
+		return 0, fmt.Errorf("filter %s not found", alias)
+	}
+	return latency.percentile(percentile)
+}
+
+func (p *Pipeline) getRollout(alias string) *rollout {
+	for i := range p.flow {
+		if node := &p.flow[i]; node.rollout != nil && node.filterAlias() == alias {
+			return node.rollout
+		}
+	}
+	return nil
+}
+
 // HandleWithBeforeAfter handles the request, with additional flow defined by
 // the before/after pipeline.
 func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pipeline) string {
@@ -334,6 +433,10 @@ func (p *Pipeline) HandleWithBeforeAfter(ctx *context.Context, before, after *Pi
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
 	})
+	if p.timeline != nil {
+		p.timeline.record(ctx, stats)
+	}
+	p.outcomes.record(fasttime.Now(), result == "")
 	return result
 }
 
@@ -349,6 +452,10 @@ func (p *Pipeline) Handle(ctx *context.Context) string {
 	ctx.LazyAddTag(func() string {
 		return p.serializeStats(stats)
 	})
+	if p.timeline != nil {
+		p.timeline.record(ctx, stats)
+	}
+	p.outcomes.record(fasttime.Now(), result == "")
 	return result
 }
 
@@ -368,16 +475,29 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 			break
 		}
 
+		if node.rollout != nil && !node.rollout.enabled(ctx) {
+			next = ""
+			continue
+		}
+
 		start := fasttime.Now()
 		ctx.UseNamespace(node.Namespace)
 
 		result = node.filter.Handle(ctx)
+		duration := fasttime.Since(start)
 		stats = append(stats, FilterStat{
 			Name:     alias,
 			Kind:     node.filter.Kind().Name,
-			Duration: fasttime.Since(start),
+			Start:    start,
+			Duration: duration,
 			Result:   result,
 		})
+		if node.latency != nil {
+			node.latency.record(duration)
+		}
+		if code, ok := node.StatusCodes[result]; ok {
+			setStatusCode(ctx, code)
+		}
 
 		var ok bool
 		if next, ok = node.JumpIf[result]; result != "" && !ok {
@@ -393,6 +513,15 @@ func (p *Pipeline) doHandle(ctx *context.Context, flow []FlowNode, stats []Filte
 	return result, stats, sawEnd
 }
 
+// setStatusCode overrides the status code of the response of the current
+// namespace, it does nothing if the response does not have a status code.
+func setStatusCode(ctx *context.Context, code int) {
+	resp, ok := ctx.GetOutputResponse().(interface{ SetStatusCode(int) })
+	if ok {
+		resp.SetStatusCode(code)
+	}
+}
+
 // Status returns Status generated by Runtime.
 func (p *Pipeline) Status() *supervisor.Status {
 	s := &Status{
@@ -402,6 +531,29 @@ func (p *Pipeline) Status() *supervisor.Status {
 	for name, filter := range p.filters {
 		s.Filters[name] = filter.Status()
 	}
+	if p.timeline != nil {
+		s.Timelines = p.timeline.recent()
+	}
+	for i := range p.flow {
+		node := &p.flow[i]
+		if node.rollout == nil {
+			continue
+		}
+		if s.Rollouts == nil {
+			s.Rollouts = make(map[string]*RolloutStatus)
+		}
+		s.Rollouts[node.filterAlias()] = node.rollout.status()
+	}
+	for i := range p.flow {
+		node := &p.flow[i]
+		if node.latency == nil {
+			continue
+		}
+		if s.FilterLatencies == nil {
+			s.FilterLatencies = make(map[string]*FilterLatencyStatus)
+		}
+		s.FilterLatencies[node.filterAlias()] = node.latency.status()
+	}
 
 	return &supervisor.Status{
 		ObjectStatus: s,
@@ -21,7 +21,9 @@ import (
 	"fmt"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/megaease/easegress/pkg/context"
 	"github.com/megaease/easegress/pkg/filters"
@@ -282,7 +284,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil, nil, nil}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -330,7 +332,7 @@ filters:
 	if err != nil {
 		t.Errorf("failed to create spec %s", err)
 	}
-	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil}
+	pipeline := Pipeline{nil, nil, map[string]filters.Filter{}, nil, nil, nil, nil}
 	pipeline.Init(superSpec, nil)
 	pipeline.Inherit(superSpec, &pipeline, nil)
 
@@ -498,3 +500,401 @@ filters:
 	assert.NotContains(tags, "filter2")
 	assert.NotContains(tags, "filter3")
 }
+
+func TestPreview(t *testing.T) {
+	assert := assert.New(t)
+
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+  - filter: backend
+  - filter: filter1
+    alias: filter1-again
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: backend
+    kind: Backend
+`
+	filters.Register(MockFilterKind("Filter1", nil))
+	backendKind := MockFilterKind("Backend", nil)
+	backendKind.Effects = []string{filters.EffectBackend}
+	filters.Register(backendKind)
+	defer cleanup()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	stdReq, err := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+	assert.Nil(err)
+	req, err := httpprot.NewRequest(stdReq)
+	assert.Nil(err)
+
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	finished := false
+	ctx.OnFinish(func() { finished = true })
+
+	pr := pipeline.Preview(ctx)
+	assert.Equal("", pr.Result)
+	assert.Equal(3, len(pr.Steps))
+
+	// the finish callbacks are called.
+	assert.True(finished)
+
+	assert.Equal("filter1", pr.Steps[0].Name)
+	assert.False(pr.Steps[0].Stubbed)
+
+	assert.Equal("backend", pr.Steps[1].Name)
+	assert.Equal("Backend", pr.Steps[1].Kind)
+	assert.True(pr.Steps[1].Stubbed)
+	assert.Equal([]string{filters.EffectBackend}, pr.Steps[1].Effects)
+
+	assert.Equal("filter1-again", pr.Steps[2].Name)
+	assert.False(pr.Steps[2].Stubbed)
+
+	// the stubbed filter is not called.
+	assert.Equal(2, MockGetFilter(pipeline, "filter1").(*MockedFilter).count)
+	assert.Equal(0, MockGetFilter(pipeline, "backend").(*MockedFilter).count)
+}
+
+func TestTimeline(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+  - filter: filter2
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter2
+timeline:
+  sampleRate: 1
+  maxTimelines: 2
+`
+	filters.Register(MockFilterKind("Filter1", nil))
+	filters.Register(MockFilterKind("Filter2", nil))
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		pipeline.Handle(ctx)
+		assert.Contains(ctx.Tags(), "timeline: filter1@0s(")
+	}
+
+	status := pipeline.Status().ObjectStatus.(*Status)
+	assert.Len(status.Timelines, 2)
+	tl := status.Timelines[0]
+	assert.Len(tl.Spans, 2)
+	assert.Equal("filter2", tl.Spans[1].Name)
+	assert.Equal("Filter2", tl.Spans[1].Kind)
+	assert.True(status.Timelines[0].Time.After(status.Timelines[1].Time) ||
+		status.Timelines[0].Time.Equal(status.Timelines[1].Time))
+
+	// timelines are not recorded if the sample rate is 0
+	tr := newTimelineRecorder(&TimelineSpec{})
+	tr.record(context.New(tracing.NoopSpan), []FilterStat{{Name: "filter1"}})
+	assert.Empty(tr.recent())
+
+	assert.Error((&TimelineSpec{SampleRate: 2}).Validate())
+	assert.Error((&TimelineSpec{MaxTimelines: -1}).Validate())
+}
+
+func TestRollout(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+    rollout:
+      percentage: 0
+  - filter: filter2
+    rollout:
+      percentage: 50
+      hashKey: X-User
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter2
+`
+	filters.Register(MockFilterKind("Filter1", nil))
+	filters.Register(MockFilterKind("Filter2", nil))
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer cleanup()
+
+	handle := func(p *Pipeline, user string) string {
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+		stdReq.Header.Set("X-User", user)
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		p.Handle(ctx)
+		return ctx.Tags()
+	}
+
+	// the same user always gets the same decision
+	first := strings.Contains(handle(pipeline, "user1"), "filter2")
+	for i := 0; i < 10; i++ {
+		tags := handle(pipeline, "user1")
+		assert.NotContains(tags, "filter1")
+		assert.Equal(first, strings.Contains(tags, "filter2"))
+	}
+
+	enabled := 0
+	for i := 0; i < 1000; i++ {
+		if strings.Contains(handle(pipeline, fmt.Sprintf("user-%d", i)), "filter2") {
+			enabled++
+		}
+	}
+	assert.InDelta(500, enabled, 100)
+
+	status := pipeline.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(1011), status.Rollouts["filter1"].NumOfSkipped)
+	assert.Equal(int64(0), status.Rollouts["filter1"].NumOfEnabled)
+	r := status.Rollouts["filter2"]
+	assert.Equal(int64(1011), r.NumOfEnabled+r.NumOfSkipped)
+
+	// the percentage is hot-updatable, and the statistics are kept
+	superSpec, err = supervisor.NewSpec(strings.Replace(yamlConfig, "percentage: 0", "percentage: 100", 1))
+	assert.Nil(err)
+	pipeline2 := &Pipeline{}
+	pipeline2.Inherit(superSpec, pipeline, nil)
+	defer pipeline2.Close()
+
+	assert.Contains(handle(pipeline2, "user1"), "filter1")
+	status = pipeline2.Status().ObjectStatus.(*Status)
+	assert.Equal(int64(1), status.Rollouts["filter1"].NumOfEnabled)
+	assert.Equal(int64(1011), status.Rollouts["filter1"].NumOfSkipped)
+	assert.Equal(float64(100), status.Rollouts["filter1"].Percentage)
+
+	assert.Error((&RolloutSpec{Percentage: 101}).Validate())
+}
+
+func TestFilterLatency(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+  - filter: filter2
+  - filter: filter1
+    alias: filter1-again
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter2
+filterLatency: true
+`
+	filters.Register(MockFilterKind("Filter1", nil))
+	filters.Register(MockFilterKind("Filter2", nil))
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer cleanup()
+
+	_, err = pipeline.FilterLatencyPercentile("filter1", 0.5)
+	assert.Error(err)
+
+	for i := 0; i < 10; i++ {
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		pipeline.Handle(ctx)
+	}
+
+	status := pipeline.Status().ObjectStatus.(*Status)
+	assert.Len(status.FilterLatencies, 3)
+	assert.Equal(uint64(10), status.FilterLatencies["filter1-again"].Count)
+	_, err = pipeline.FilterLatencyPercentile("filter2", 0.99)
+	assert.NoError(err)
+	_, err = pipeline.FilterLatencyPercentile("filter3", 0.99)
+	assert.Error(err)
+	_, err = pipeline.FilterLatencyPercentile("filter2", 1.5)
+	assert.Error(err)
+
+	// the latencies are kept by the next generation
+	pipeline2 := &Pipeline{}
+	pipeline2.Inherit(superSpec, pipeline, nil)
+	defer pipeline2.Close()
+	status = pipeline2.Status().ObjectStatus.(*Status)
+	assert.Equal(uint64(10), status.FilterLatencies["filter1"].Count)
+
+	// percentiles are accurate within the resolution of the buckets
+	h := &latencyHistogram{}
+	for i := 1; i <= 1000; i++ {
+		h.record(time.Duration(i) * time.Millisecond)
+	}
+	for _, p := range []float64{0.5, 0.9, 0.99} {
+		d, err := h.percentile(p)
+		assert.NoError(err)
+		expected := time.Duration(p*1000) * time.Millisecond
+		assert.True(d >= expected && d <= expected+expected/16, "p%v: %v", p, d)
+	}
+	h.record(-time.Second)
+	h.record(time.Hour * 1000)
+	d, _ := h.percentile(1)
+	assert.Equal(time.Duration(latencyBucketMax(latencyBuckets-1))*time.Microsecond, d)
+	for i := 1; i < latencyBuckets; i++ {
+		assert.Equal(i, latencyBucket(latencyBucketMax(i)))
+		assert.Equal(i, latencyBucket(latencyBucketMax(i-1)+1))
+	}
+}
+
+type failingFilter struct {
+	MockedFilter
+}
+
+func (f *failingFilter) Handle(ctx *context.Context) string {
+	resp, _ := httpprot.NewResponse(nil)
+	resp.SetStatusCode(http.StatusServiceUnavailable)
+	ctx.SetOutputResponse(resp)
+	return "failed"
+}
+
+func TestStatusCodes(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+    statusCodes:
+      failed: 429
+filters:
+  - name: filter1
+    kind: Filter1
+`
+	k := MockFilterKind("Filter1", []string{"failed"})
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		return &failingFilter{MockedFilter{kind: k, spec: spec.(*MockedSpec)}}
+	}
+	filters.Register(k)
+	defer cleanup()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+	defer pipeline.Close()
+
+	stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+	req, _ := httpprot.NewRequest(stdReq)
+	ctx := context.New(tracing.NoopSpan)
+	ctx.SetRequest(context.DefaultNamespace, req)
+	assert.Equal("failed", pipeline.Handle(ctx))
+	assert.Equal(http.StatusTooManyRequests, ctx.GetOutputResponse().(*httpprot.Response).StatusCode())
+
+	// the result must be one of the results of the filter.
+	_, err = supervisor.NewSpec(strings.Replace(yamlConfig, "failed: 429", "unknown: 429", 1))
+	assert.Error(err)
+
+	_, err = supervisor.NewSpec(strings.Replace(yamlConfig, "failed: 429", "failed: 1000", 1))
+	assert.Error(err)
+}
+
+func TestHealthy(t *testing.T) {
+	assert := assert.New(t)
+	yamlConfig := `
+name: http-pipeline-test
+kind: Pipeline
+flow:
+  - filter: filter1
+    jumpIf:
+      failed: END
+  - filter: filter2
+filters:
+  - name: filter1
+    kind: Filter1
+  - name: filter2
+    kind: Filter2
+`
+	fail := true
+	k := MockFilterKind("Filter1", []string{"failed"})
+	k.CreateInstance = func(spec filters.Spec) filters.Filter {
+		if fail {
+			return &failingFilter{MockedFilter{kind: k, spec: spec.(*MockedSpec)}}
+		}
+		return &MockedFilter{kind: k, spec: spec.(*MockedSpec)}
+	}
+	filters.Register(k)
+	filters.Register(MockFilterKind("Filter2", nil))
+	defer cleanup()
+
+	superSpec, err := supervisor.NewSpec(yamlConfig)
+	assert.Nil(err)
+	pipeline := &Pipeline{}
+	pipeline.Init(superSpec, nil)
+
+	handle := func(p *Pipeline) {
+		stdReq, _ := http.NewRequest(http.MethodGet, "http://localhost:9095", nil)
+		req, _ := httpprot.NewRequest(stdReq)
+		ctx := context.New(tracing.NoopSpan)
+		ctx.SetRequest(context.DefaultNamespace, req)
+		p.Handle(ctx)
+	}
+
+	// a pipeline without requests is healthy.
+	assert.True(pipeline.Healthy(0.9, time.Minute))
+
+	handle(pipeline)
+	assert.False(pipeline.Healthy(0.9, time.Minute))
+
+	// the outcomes are kept by the next generation.
+	fail = false
+	pipeline2 := &Pipeline{}
+	pipeline2.Inherit(superSpec, pipeline, nil)
+	defer pipeline2.Close()
+	for i := 0; i < 3; i++ {
+		handle(pipeline2)
+	}
+	assert.True(pipeline2.Healthy(0.75, time.Minute))
+	assert.False(pipeline2.Healthy(0.8, time.Minute))
+
+	// outcomes out of the window are not counted.
+	tracker := &outcomeTracker{}
+	now := time.Now()
+	tracker.record(now.Add(-time.Minute), false)
+	tracker.record(now.Add(-time.Second), true)
+	tracker.record(now, true)
+	rate, total := tracker.successRate(now, 10*time.Second)
+	assert.Equal(1.0, rate)
+	assert.Equal(int64(2), total)
+	rate, total = tracker.successRate(now, time.Minute+time.Second)
+	assert.InDelta(2.0/3, rate, 1e-9)
+	assert.Equal(int64(3), total)
+
+	// buckets of old seconds are reused.
+	tracker.record(now.Add(outcomeBuckets*time.Second), true)
+	rate, total = tracker.successRate(now.Add(outcomeBuckets*time.Second), time.Second)
+	assert.Equal(1.0, rate)
+	assert.Equal(int64(1), total)
+}
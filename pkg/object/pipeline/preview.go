@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+type (
+	// PreviewStep is a step of the preview, which is a filter in the flow.
+	PreviewStep struct {
+		Name    string   `json:"name"`
+		Kind    string   `json:"kind"`
+		Effects []string `json:"effects,omitempty"`
+		Stubbed bool     `json:"stubbed"`
+		Result  string   `json:"result"`
+		Error   string   `json:"error,omitempty"`
+	}
+
+	// PreviewResult is the result of previewing a pipeline.
+	PreviewResult struct {
+		Steps  []*PreviewStep `json:"steps"`
+		Result string         `json:"result"`
+	}
+)
+
+// Preview runs the request through the flow in dry-run mode, filters with
+// side effects declared by their kinds are stubbed, that is, they are not
+// called and return the normal result. Side effects are sending requests
+// to backends or other external services, writing to external systems,
+// and changing the runtime state shared by requests, e.g. consuming rate
+// limit budget. It returns which filters would run, in what order, and
+// their results. Preview is only available to Go callers for now.
+//
+// Filters without side effects are called as normal, so they may update
+// their runtime status. A filter which panics, e.g. because a stubbed
+// filter doesn't build a response, stops the preview, and the panic is
+// reported in the error of the step.
+//
+// The context is finished when Preview returns, so that the resources
+// acquired by the filters, e.g. concurrency slots released in OnFinish,
+// are released. The caller must not use it after that.
+func (p *Pipeline) Preview(ctx *context.Context) *PreviewResult {
+	defer ctx.Finish()
+
+	if len(p.spec.Data) > 0 {
+		ctx.SetData("PIPELINE", p.spec.Data)
+	}
+
+	pr := &PreviewResult{Steps: make([]*PreviewStep, 0, len(p.flow))}
+	next := ""
+
+	for i := range p.flow {
+		node := &p.flow[i]
+		alias := node.filterAlias()
+
+		if next != "" && next != alias {
+			continue
+		}
+
+		if node.FilterName == BuiltInFilterEnd {
+			break
+		}
+
+		kind := node.filter.Kind()
+		step := &PreviewStep{
+			Name:    alias,
+			Kind:    kind.Name,
+			Effects: kind.Effects,
+			Stubbed: len(kind.Effects) > 0,
+		}
+		pr.Steps = append(pr.Steps, step)
+
+		if !step.Stubbed {
+			ctx.UseNamespace(node.Namespace)
+			if err := previewFilter(node, ctx, step); err != nil {
+				step.Error = err.Error()
+				pr.Result = step.Result
+				break
+			}
+		}
+		pr.Result = step.Result
+
+		var ok bool
+		if next, ok = node.JumpIf[step.Result]; step.Result != "" && !ok {
+			next = BuiltInFilterEnd
+		}
+
+		if next == BuiltInFilterEnd {
+			break
+		}
+	}
+
+	return pr
+}
+
+func previewFilter(node *FlowNode, ctx *context.Context, step *PreviewStep) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	step.Result = node.filter.Handle(ctx)
+	return nil
+}
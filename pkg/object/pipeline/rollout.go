@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/megaease/easegress/pkg/context"
+	"github.com/megaease/easegress/pkg/protocols/httpprot"
+)
+
+type (
+	// RolloutSpec describes the gradual rollout of a filter in the flow,
+	// the filter is only executed for a percentage of requests.
+	RolloutSpec struct {
+		Percentage float64 `json:"percentage" jsonschema:"required,minimum=0,maximum=100"`
+		HashKey    string  `json:"hashKey" jsonschema:"omitempty"`
+	}
+
+	// RolloutStatus is the status of the rollout of a filter.
+	RolloutStatus struct {
+		Percentage   float64 `json:"percentage"`
+		NumOfEnabled int64   `json:"numOfEnabled"`
+		NumOfSkipped int64   `json:"numOfSkipped"`
+	}
+
+	// rollout decides whether a filter is executed for a request.
+	rollout struct {
+		spec      *RolloutSpec
+		threshold uint32
+
+		numOfEnabled int64
+		numOfSkipped int64
+	}
+)
+
+// rolloutBuckets is the number of buckets requests are distributed into,
+// which makes the precision of the percentage 0.01.
+const rolloutBuckets = 10000
+
+// Validate validates RolloutSpec.
+func (spec *RolloutSpec) Validate() error {
+	if spec.Percentage < 0 || spec.Percentage > 100 {
+		return fmt.Errorf("percentage must be in [0, 100]")
+	}
+	return nil
+}
+
+// newRollout creates a rollout, the statistics are inherited from the
+// previous generation if it is not nil, so that they are kept when the
+// percentage is updated.
+func newRollout(spec *RolloutSpec, prev *rollout) *rollout {
+	r := &rollout{
+		spec:      spec,
+		threshold: uint32(spec.Percentage * rolloutBuckets / 100),
+	}
+	if prev != nil {
+		r.numOfEnabled = atomic.LoadInt64(&prev.numOfEnabled)
+		r.numOfSkipped = atomic.LoadInt64(&prev.numOfSkipped)
+	}
+	return r
+}
+
+// bucket returns the bucket of the request, it is stable for requests
+// with the same value of the hash key header, and random if the hash key
+// is not configured or the header is absent.
+func (r *rollout) bucket(ctx *context.Context) uint32 {
+	if r.spec.HashKey != "" {
+		req, _ := ctx.GetInputRequest().(*httpprot.Request)
+		if req != nil {
+			if v := req.HTTPHeader().Get(r.spec.HashKey); v != "" {
+				h := fnv.New32a()
+				h.Write([]byte(v))
+				return h.Sum32() % rolloutBuckets
+			}
+		}
+	}
+	return uint32(rand.Intn(rolloutBuckets))
+}
+
+// enabled reports whether the filter should be executed for the request.
+func (r *rollout) enabled(ctx *context.Context) bool {
+	if r.bucket(ctx) < r.threshold {
+		atomic.AddInt64(&r.numOfEnabled, 1)
+		return true
+	}
+	atomic.AddInt64(&r.numOfSkipped, 1)
+	return false
+}
+
+func (r *rollout) status() *RolloutStatus {
+	return &RolloutStatus{
+		Percentage:   r.spec.Percentage,
+		NumOfEnabled: atomic.LoadInt64(&r.numOfEnabled),
+		NumOfSkipped: atomic.LoadInt64(&r.numOfSkipped),
+	}
+}
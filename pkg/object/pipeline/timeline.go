@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package pipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megaease/easegress/pkg/context"
+)
+
+const defaultMaxTimelines = 10
+
+type (
+	// TimelineSpec describes the timeline recorder of a pipeline, which
+	// records the execution timeline of the filters for sampled requests.
+	TimelineSpec struct {
+		SampleRate   float64 `json:"sampleRate" jsonschema:"required,minimum=0,maximum=1"`
+		MaxTimelines int     `json:"maxTimelines" jsonschema:"omitempty,minimum=0"`
+	}
+
+	// Timeline is the execution timeline of the filters for a request.
+	Timeline struct {
+		Time  time.Time      `json:"time"`
+		Spans []TimelineSpan `json:"spans"`
+	}
+
+	// TimelineSpan is the execution span of a filter, Start is the offset
+	// from the start of the first filter.
+	TimelineSpan struct {
+		Name     string `json:"name"`
+		Kind     string `json:"kind"`
+		Result   string `json:"result,omitempty"`
+		Start    string `json:"start"`
+		Duration string `json:"duration"`
+	}
+
+	// timelineRecorder keeps the timelines of the most recent sampled
+	// requests.
+	timelineRecorder struct {
+		spec *TimelineSpec
+
+		lock      sync.Mutex
+		timelines []*Timeline
+		next      int
+	}
+)
+
+// Validate validates TimelineSpec.
+func (spec *TimelineSpec) Validate() error {
+	if spec.SampleRate < 0 || spec.SampleRate > 1 {
+		return fmt.Errorf("sampleRate must be in [0, 1]")
+	}
+	if spec.MaxTimelines < 0 {
+		return fmt.Errorf("maxTimelines must not be negative")
+	}
+	return nil
+}
+
+func newTimelineRecorder(spec *TimelineSpec) *timelineRecorder {
+	max := spec.MaxTimelines
+	if max == 0 {
+		max = defaultMaxTimelines
+	}
+	return &timelineRecorder{
+		spec:      spec,
+		timelines: make([]*Timeline, 0, max),
+	}
+}
+
+func newTimeline(stats []FilterStat) *Timeline {
+	tl := &Timeline{
+		Time:  stats[0].Start,
+		Spans: make([]TimelineSpan, len(stats)),
+	}
+	for i := range stats {
+		stat := &stats[i]
+		tl.Spans[i] = TimelineSpan{
+			Name:     stat.Name,
+			Kind:     stat.Kind,
+			Result:   stat.Result,
+			Start:    stat.Start.Sub(tl.Time).String(),
+			Duration: stat.Duration.String(),
+		}
+	}
+	return tl
+}
+
+// String returns the timeline in a compact form for access logs, e.g.
+// "filter1@0s(1ms)->filter2@1ms(fail,2ms)".
+func (tl *Timeline) String() string {
+	var sb strings.Builder
+	for i := range tl.Spans {
+		if i > 0 {
+			sb.WriteString("->")
+		}
+
+		span := &tl.Spans[i]
+		sb.WriteString(span.Name)
+		sb.WriteByte('@')
+		sb.WriteString(span.Start)
+		sb.WriteByte('(')
+		if span.Result != "" {
+			sb.WriteString(span.Result)
+			sb.WriteByte(',')
+		}
+		sb.WriteString(span.Duration)
+		sb.WriteByte(')')
+	}
+	return sb.String()
+}
+
+// record records the timeline of the request if it is sampled, the
+// timeline is also added to the tags of the context, so that it is
+// available in the access log.
+func (tr *timelineRecorder) record(ctx *context.Context, stats []FilterStat) {
+	if len(stats) == 0 || tr.spec.SampleRate <= 0 || rand.Float64() >= tr.spec.SampleRate {
+		return
+	}
+
+	tl := newTimeline(stats)
+	ctx.LazyAddTag(func() string {
+		return "timeline: " + tl.String()
+	})
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if len(tr.timelines) < cap(tr.timelines) {
+		tr.timelines = append(tr.timelines, tl)
+		return
+	}
+	tr.timelines[tr.next] = tl
+	tr.next = (tr.next + 1) % len(tr.timelines)
+}
+
+// recent returns the recorded timelines, the most recent one first.
+func (tr *timelineRecorder) recent() []*Timeline {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	n := len(tr.timelines)
+	result := make([]*Timeline, 0, n)
+	for i := 1; i <= n; i++ {
+		result = append(result, tr.timelines[(tr.next-i+n)%n])
+	}
+	return result
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpprot
+
+import (
+	"context"
+	"crypto/tls"
+	"sync/atomic"
+)
+
+type clientHelloKey struct{}
+
+// clientHelloHolder holds the TLS ClientHello of a connection, it is put
+// into the connection context before the handshake, and filled during the
+// handshake.
+type clientHelloHolder struct {
+	hello atomic.Value
+}
+
+// WithClientHelloHolder returns a copy of the connection context which could
+// hold the TLS ClientHello of the connection, it should be used as the
+// ConnContext of an HTTP server.
+func WithClientHelloHolder(ctx context.Context) context.Context {
+	return context.WithValue(ctx, clientHelloKey{}, &clientHelloHolder{})
+}
+
+// StoreClientHello stores the ClientHello into the holder in the context
+// of the ClientHello, it should be called in the GetConfigForClient or
+// GetCertificate callback of the TLS config.
+func StoreClientHello(chi *tls.ClientHelloInfo) {
+	ctx := chi.Context()
+	if ctx == nil {
+		return
+	}
+	if h, ok := ctx.Value(clientHelloKey{}).(*clientHelloHolder); ok {
+		h.hello.Store(chi)
+	}
+}
+
+// ClientHello returns the TLS ClientHello of the connection of the request,
+// it returns nil if the request is not from a TLS connection, or the server
+// doesn't hold the ClientHello.
+func (r *Request) ClientHello() *tls.ClientHelloInfo {
+	h, ok := r.Context().Value(clientHelloKey{}).(*clientHelloHolder)
+	if !ok {
+		return nil
+	}
+	chi, _ := h.hello.Load().(*tls.ClientHelloInfo)
+	return chi
+}
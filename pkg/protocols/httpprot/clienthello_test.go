@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpprot
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientHello(t *testing.T) {
+	assert := assert.New(t)
+
+	hello := make(chan *tls.ClientHelloInfo, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ := NewRequest(r)
+		hello <- req.ClientHello()
+	}))
+	server.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return WithClientHelloHolder(ctx)
+	}
+	server.TLS = &tls.Config{
+		GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+			StoreClientHello(chi)
+			return nil, nil
+		},
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	assert.NoError(err)
+	resp.Body.Close()
+
+	chi := <-hello
+	assert.NotNil(chi)
+	assert.NotEmpty(chi.CipherSuites)
+
+	// no holder in the context
+	stdr, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	req, _ := NewRequest(stdr)
+	assert.Nil(req.ClientHello())
+}
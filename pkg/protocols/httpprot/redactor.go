@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package httpprot
+
+import "net/http"
+
+// LogRedactorDataKey is the key of the context data holding the
+// LogRedactor of a request, which is set by filters like the Redactor.
+const LogRedactorDataKey = "HTTP_LOG_REDACTOR"
+
+// LogRedactor redacts sensitive data from the representation of requests
+// and responses used for logging, e.g. the access log and the archived
+// traffic. The requests and responses themselves are not modified.
+type LogRedactor interface {
+	// RedactString returns s with sensitive data masked.
+	RedactString(s string) string
+	// RedactHeader returns a copy of h with sensitive data masked.
+	RedactHeader(h http.Header) http.Header
+	// RedactBody returns body with sensitive data masked.
+	RedactBody(body []byte) []byte
+}
@@ -335,6 +335,12 @@ func (r *Request) Context() context.Context {
 	return r.Std().Context()
 }
 
+// SetContext replaces the context of the request, the context is used to
+// cancel the requests sent to backends.
+func (r *Request) SetContext(ctx context.Context) {
+	r.Request = r.Request.WithContext(ctx)
+}
+
 // SetMethod sets the request method.
 func (r *Request) SetMethod(method string) {
 	r.Std().Method = method
@@ -360,6 +366,26 @@ func (r *Request) SetPath(path string) {
 	r.Std().URL.Path = path
 }
 
+// IfNoneMatch returns whether the If-None-Match header of the request
+// matches the etag, i.e. the client already has the representation. The
+// weak comparison is used as required by RFC 7232 section 3.2.
+func (r *Request) IfNoneMatch(etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+
+	for _, v := range r.HTTPHeader().Values("If-None-Match") {
+		for _, tag := range strings.Split(v, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // builderRequest is a wrapper of http.Request which can be used in the
 // template of the Builder filters.
 type builderRequest struct {
@@ -101,6 +101,22 @@ func TestRequest(t *testing.T) {
 	assert.Equal("/foo/bar", request.Path())
 }
 
+func TestRequestIfNoneMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	req := getRequest(t, http.MethodGet, "http://127.0.0.1:80/foo", nil)
+	assert.False(req.IfNoneMatch(`"v1"`))
+
+	req.HTTPHeader().Set("If-None-Match", `"v0", W/"v1"`)
+	assert.True(req.IfNoneMatch(`"v1"`))
+	assert.True(req.IfNoneMatch(`W/"v0"`))
+	assert.False(req.IfNoneMatch(`"v2"`))
+	assert.False(req.IfNoneMatch(""))
+
+	req.HTTPHeader().Set("If-None-Match", "*")
+	assert.True(req.IfNoneMatch(`"v2"`))
+}
+
 func getRequest(t *testing.T, method string, url string, body io.Reader) *Request {
 	stdReq, err := http.NewRequest(method, url, body)
 	require.Nil(t, err)
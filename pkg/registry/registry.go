@@ -19,30 +19,62 @@ package registry
 
 import (
 	// Filters
+	_ "github.com/megaease/easegress/pkg/filters/accesslogshipper"
+	_ "github.com/megaease/easegress/pkg/filters/adaptivelimiter"
+	_ "github.com/megaease/easegress/pkg/filters/admissionqueue"
+	_ "github.com/megaease/easegress/pkg/filters/apiaggregator"
+	_ "github.com/megaease/easegress/pkg/filters/bodychecksum"
 	_ "github.com/megaease/easegress/pkg/filters/builder"
+	_ "github.com/megaease/easegress/pkg/filters/cachecontrol"
 	_ "github.com/megaease/easegress/pkg/filters/certextractor"
+	_ "github.com/megaease/easegress/pkg/filters/clientlimiter"
 	_ "github.com/megaease/easegress/pkg/filters/connectcontrol"
+	_ "github.com/megaease/easegress/pkg/filters/contentnegotiator"
+	_ "github.com/megaease/easegress/pkg/filters/contenttype"
+	_ "github.com/megaease/easegress/pkg/filters/correlationid"
 	_ "github.com/megaease/easegress/pkg/filters/corsadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/costquota"
+	_ "github.com/megaease/easegress/pkg/filters/deadlinebudget"
+	_ "github.com/megaease/easegress/pkg/filters/debuggate"
+	_ "github.com/megaease/easegress/pkg/filters/deprecation"
+	_ "github.com/megaease/easegress/pkg/filters/errorenvelope"
 	_ "github.com/megaease/easegress/pkg/filters/fallback"
+	_ "github.com/megaease/easegress/pkg/filters/featureflag"
+	_ "github.com/megaease/easegress/pkg/filters/fieldprojector"
+	_ "github.com/megaease/easegress/pkg/filters/fingerprint"
 	_ "github.com/megaease/easegress/pkg/filters/grpcproxy"
+	_ "github.com/megaease/easegress/pkg/filters/headerlimiter"
 	_ "github.com/megaease/easegress/pkg/filters/headerlookup"
 	_ "github.com/megaease/easegress/pkg/filters/headertojson"
 	_ "github.com/megaease/easegress/pkg/filters/kafka"
 	_ "github.com/megaease/easegress/pkg/filters/kafkabackend"
+	_ "github.com/megaease/easegress/pkg/filters/locationrewriter"
+	_ "github.com/megaease/easegress/pkg/filters/maintenance"
 	_ "github.com/megaease/easegress/pkg/filters/meshadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/mock"
 	_ "github.com/megaease/easegress/pkg/filters/mqttclientauth"
+	_ "github.com/megaease/easegress/pkg/filters/mtlsvalidator"
 	_ "github.com/megaease/easegress/pkg/filters/oidcadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/opafilter"
 	_ "github.com/megaease/easegress/pkg/filters/proxy"
+	_ "github.com/megaease/easegress/pkg/filters/quarantine"
+	_ "github.com/megaease/easegress/pkg/filters/querynormalizer"
 	_ "github.com/megaease/easegress/pkg/filters/ratelimiter"
+	_ "github.com/megaease/easegress/pkg/filters/redactor"
 	_ "github.com/megaease/easegress/pkg/filters/redirector"
 	_ "github.com/megaease/easegress/pkg/filters/remotefilter"
 	_ "github.com/megaease/easegress/pkg/filters/requestadaptor"
 	_ "github.com/megaease/easegress/pkg/filters/responseadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/scriptrouter"
+	_ "github.com/megaease/easegress/pkg/filters/sequenceguard"
+	_ "github.com/megaease/easegress/pkg/filters/smugglingguard"
+	_ "github.com/megaease/easegress/pkg/filters/soapadaptor"
+	_ "github.com/megaease/easegress/pkg/filters/tenantguard"
 	_ "github.com/megaease/easegress/pkg/filters/topicmapper"
+	_ "github.com/megaease/easegress/pkg/filters/trafficarchiver"
 	_ "github.com/megaease/easegress/pkg/filters/validator"
 	_ "github.com/megaease/easegress/pkg/filters/wasmhost"
+	_ "github.com/megaease/easegress/pkg/filters/webhookverifier"
 
 	// Objects
 	_ "github.com/megaease/easegress/pkg/object/autocertmanager"
@@ -21,10 +21,16 @@ import (
 	"context"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	sem2 "github.com/megaease/easegress/pkg/util/sem"
 )
 
+// overloadCheckInterval is the interval to check whether the server is
+// still overloaded when waiting to accept new connections.
+const overloadCheckInterval = 10 * time.Millisecond
+
 // NewLimitListener returns a Listener that accepts at most n simultaneous
 // connections from the provided Listener.
 func NewLimitListener(l net.Listener, n uint32) *LimitListener {
@@ -45,6 +51,24 @@ type LimitListener struct {
 	ctx       context.Context
 	cancel    context.CancelFunc
 	closeOnce sync.Once // ensures the done chan is only closed once
+
+	// resetOnOverflow is 1 if new connections are reset instead of being
+	// left in the backlog when the listener is overflowed.
+	resetOnOverflow int32
+	overloaded      func() bool
+
+	numOfAccepted uint64
+	numOfRejected uint64
+	numOfWaited   uint64
+}
+
+// Status is the status of LimitListener. NumOfRejected is the number of
+// connections reset on overflow, and NumOfWaited is the number of times
+// accepting is paused on overflow when connections are not reset.
+type Status struct {
+	NumOfAccepted uint64 `json:"numOfAccepted"`
+	NumOfRejected uint64 `json:"numOfRejected"`
+	NumOfWaited   uint64 `json:"numOfWaited"`
 }
 
 // acquire acquires the limiting semaphore. Returns true if successfully
@@ -58,9 +82,39 @@ func (l *LimitListener) release() {
 	l.sem.Release()
 }
 
+func (l *LimitListener) isOverloaded() bool {
+	return l.overloaded != nil && l.overloaded()
+}
+
+// waitOverload waits until the server is not overloaded or the listener
+// is closed.
+func (l *LimitListener) waitOverload() error {
+	for l.isOverloaded() {
+		select {
+		case <-l.ctx.Done():
+			return l.ctx.Err()
+		case <-time.After(overloadCheckInterval):
+		}
+	}
+	return nil
+}
+
 // Accept accepts one connection.
 func (l *LimitListener) Accept() (net.Conn, error) {
-	acquired := l.acquire()
+	if atomic.LoadInt32(&l.resetOnOverflow) == 1 {
+		return l.acceptOrReset()
+	}
+
+	// the wait is counted once no matter it is caused by the max
+	// connection or the overload.
+	acquired := l.sem.TryAcquire()
+	waited := !acquired || l.isOverloaded()
+	if waited {
+		atomic.AddUint64(&l.numOfWaited, 1)
+	}
+	if !acquired {
+		acquired = l.acquire()
+	}
 	if err := l.ctx.Err(); err != nil {
 		if acquired {
 			l.release()
@@ -68,19 +122,75 @@ func (l *LimitListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 
+	if err := l.waitOverload(); err != nil {
+		l.release()
+		return nil, err
+	}
+
 	c, err := l.Listener.Accept()
 	if err != nil {
 		l.release()
 		return nil, err
 	}
+	atomic.AddUint64(&l.numOfAccepted, 1)
 	return &limitListenerConn{Conn: c, release: l.release}, nil
 }
 
+// acceptOrReset accepts new connections, and resets them at once if the
+// max connection is reached or the server is overloaded.
+func (l *LimitListener) acceptOrReset() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		if !l.isOverloaded() && l.sem.TryAcquire() {
+			atomic.AddUint64(&l.numOfAccepted, 1)
+			return &limitListenerConn{Conn: c, release: l.release}, nil
+		}
+
+		atomic.AddUint64(&l.numOfRejected, 1)
+		// linger 0 makes the connection closed with a RST.
+		if tc, ok := c.(interface{ SetLinger(int) error }); ok {
+			tc.SetLinger(0)
+		}
+		c.Close()
+	}
+}
+
 // SetMaxConnection sets max connection.
 func (l *LimitListener) SetMaxConnection(n uint32) {
 	l.sem.SetMaxCount(int64(n))
 }
 
+// SetResetOnOverflow sets whether to reset new connections when the max
+// connection is reached or the server is overloaded, by default, the new
+// connections are left in the backlog of the operating system.
+func (l *LimitListener) SetResetOnOverflow(reset bool) {
+	if reset {
+		atomic.StoreInt32(&l.resetOnOverflow, 1)
+	} else {
+		atomic.StoreInt32(&l.resetOnOverflow, 0)
+	}
+}
+
+// SetOverloadChecker sets the function to check whether the server is
+// overloaded, no new connections are accepted when it returns true. It
+// must be called before the listener starts to accept connections.
+func (l *LimitListener) SetOverloadChecker(fn func() bool) {
+	l.overloaded = fn
+}
+
+// Status returns the status of the listener.
+func (l *LimitListener) Status() *Status {
+	return &Status{
+		NumOfAccepted: atomic.LoadUint64(&l.numOfAccepted),
+		NumOfRejected: atomic.LoadUint64(&l.numOfRejected),
+		NumOfWaited:   atomic.LoadUint64(&l.numOfWaited),
+	}
+}
+
 // Close closes LimitListener.
 func (l *LimitListener) Close() error {
 	err := l.Listener.Close()
@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2017, MegaEase
+ * All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package limitlistener
+
+import (
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newListener(t *testing.T, n uint32) *LimitListener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	return NewLimitListener(l, n)
+}
+
+func TestResetOnOverflow(t *testing.T) {
+	assert := assert.New(t)
+
+	ll := newListener(t, 1)
+	defer ll.Close()
+	ll.SetResetOnOverflow(true)
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ll.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c1.Close()
+	conn := <-accepted
+
+	// the second connection is reset as the max connection is reached.
+	c2, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c2.Close()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = c2.Read(make([]byte, 1))
+	assert.Error(err)
+
+	// the third connection is accepted after the first one is closed.
+	conn.Close()
+	c3, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c3.Close()
+	(<-accepted).Close()
+
+	status := ll.Status()
+	assert.Equal(uint64(2), status.NumOfAccepted)
+	assert.Equal(uint64(1), status.NumOfRejected)
+}
+
+func TestWaitOverload(t *testing.T) {
+	assert := assert.New(t)
+
+	ll := newListener(t, 10)
+	defer ll.Close()
+
+	var overloaded int32 = 1
+	ll.SetOverloadChecker(func() bool {
+		return atomic.LoadInt32(&overloaded) == 1
+	})
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		c, err := ll.Accept()
+		if err == nil {
+			accepted <- c
+		}
+	}()
+
+	c, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c.Close()
+
+	// the connection is left in the backlog when overloaded.
+	select {
+	case <-accepted:
+		t.Fatal("connection should not be accepted when overloaded")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	atomic.StoreInt32(&overloaded, 0)
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection should be accepted")
+	}
+
+	status := ll.Status()
+	assert.Equal(uint64(1), status.NumOfAccepted)
+	assert.Equal(uint64(0), status.NumOfRejected)
+	assert.Equal(uint64(1), status.NumOfWaited)
+}
+
+func TestWaitMaxConnection(t *testing.T) {
+	assert := assert.New(t)
+
+	ll := newListener(t, 1)
+	defer ll.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for i := 0; i < 2; i++ {
+			c, err := ll.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	c1, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c1.Close()
+	conn := <-accepted
+
+	// accepting is paused until the first connection is closed, and the
+	// second connection waits in the backlog.
+	assert.Eventually(func() bool {
+		return ll.Status().NumOfWaited == 1
+	}, time.Second, time.Millisecond)
+	c2, err := net.Dial("tcp", ll.Addr().String())
+	assert.NoError(err)
+	defer c2.Close()
+	select {
+	case <-accepted:
+		t.Fatal("connection should not be accepted when max connection is reached")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	conn.Close()
+	(<-accepted).Close()
+
+	status := ll.Status()
+	assert.Equal(uint64(2), status.NumOfAccepted)
+	assert.Equal(uint64(0), status.NumOfRejected)
+	assert.Equal(uint64(1), status.NumOfWaited)
+}
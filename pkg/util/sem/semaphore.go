@@ -58,6 +58,12 @@ func (s *Semaphore) AcquireWithContext(ctx context.Context) error {
 	return s.sem.Acquire(ctx, 1)
 }
 
+// TryAcquire acquires the semaphore without blocking, it returns false
+// if the semaphore is not acquired.
+func (s *Semaphore) TryAcquire() bool {
+	return s.sem.TryAcquire(1)
+}
+
 // Release releases one semaphore.
 func (s *Semaphore) Release() {
 	s.sem.Release(1)